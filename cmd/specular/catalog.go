@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/elisiariocouto/specular/internal/config"
+	"github.com/elisiariocouto/specular/internal/mirror"
+	"github.com/elisiariocouto/specular/internal/storage"
+)
+
+// runCatalog prints the catalog of the filesystem cache as JSON and returns the exit code
+// Usage: specular catalog [-limit N] [-cursor hostname/namespace/type]
+func runCatalog(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("catalog", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	limit := flags.Int("limit", 0, fmt.Sprintf("providers per page, at most %d; 0 lists every provider", mirror.MaxCatalogLimit))
+	cursor := flags.String("cursor", "", "continue after this provider, as printed in next_cursor")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *limit < 0 || *limit > mirror.MaxCatalogLimit {
+		fmt.Fprintf(stderr, "limit must be between 0 and %d\n", mirror.MaxCatalogLimit)
+		return 2
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(stderr, "Failed to load configuration: %v\n", err)
+		return 1
+	}
+	if cfg.StorageType != "filesystem" {
+		fmt.Fprintf(stderr, "The catalog command reads the filesystem cache, but storage type is %s\n", cfg.StorageType)
+		return 1
+	}
+	store, err := storage.NewFilesystemStorage(cfg.CacheDir)
+	if err != nil {
+		fmt.Fprintf(stderr, "Failed to open cache directory: %v\n", err)
+		return 1
+	}
+	store.CheckHostnames(mirror.CheckHostname)
+
+	ctx := context.Background()
+	var catalog *mirror.Catalog
+	if *limit > 0 {
+		catalog, err = mirror.BuildCatalog(ctx, store, cfg.IndexTTL, *cursor, *limit)
+	} else {
+		catalog, err = allCatalogPages(ctx, store, cfg.IndexTTL, *cursor)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "Failed to build catalog: %v\n", err)
+		return 1
+	}
+
+	encoder := json.NewEncoder(stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(catalog); err != nil {
+		fmt.Fprintf(stderr, "Failed to write catalog: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// allCatalogPages follows the catalog's pages from cursor to the end, returning them as one page
+func allCatalogPages(ctx context.Context, store storage.Storage, indexTTL time.Duration, cursor string) (*mirror.Catalog, error) {
+	all := &mirror.Catalog{Providers: []mirror.CatalogProvider{}}
+	for {
+		page, err := mirror.BuildCatalog(ctx, store, indexTTL, cursor, mirror.MaxCatalogLimit)
+		if err != nil {
+			return nil, err
+		}
+		all.Providers = append(all.Providers, page.Providers...)
+		if page.NextCursor == "" {
+			return all, nil
+		}
+		cursor = page.NextCursor
+	}
+}
@@ -4,20 +4,30 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"net/url"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
+	"github.com/elisiariocouto/specular/internal/audit"
 	"github.com/elisiariocouto/specular/internal/config"
+	"github.com/elisiariocouto/specular/internal/loadshed"
 	"github.com/elisiariocouto/specular/internal/logger"
 	"github.com/elisiariocouto/specular/internal/metrics"
 	"github.com/elisiariocouto/specular/internal/mirror"
 	"github.com/elisiariocouto/specular/internal/server"
 	"github.com/elisiariocouto/specular/internal/storage"
+	"github.com/elisiariocouto/specular/internal/tracing"
 	"github.com/elisiariocouto/specular/internal/version"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "catalog" {
+		os.Exit(runCatalog(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
 	// Load configuration
 	cfg, err := config.Load()
 	if err != nil {
@@ -52,6 +62,7 @@ func main() {
 				slog.String("error", err.Error()))
 			os.Exit(1)
 		}
+		st.CheckHostnames(mirror.CheckHostname)
 		storageBackend = st
 		log.InfoContext(context.Background(),
 			fmt.Sprintf("Filesystem storage initialized [cache_dir=%s]", cfg.CacheDir),
@@ -66,33 +77,244 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Initialize metrics conditionally
+	var m *metrics.Metrics
+	if cfg.MetricsEnabled {
+		m = metrics.New()
+		log.InfoContext(context.Background(), "metrics enabled")
+	} else {
+		m = metrics.Noop()
+		log.InfoContext(context.Background(), "metrics disabled")
+	}
+
+	// Initialize tracing; with no exporter, trace context is still propagated upstream
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		Exporter:     cfg.TracingExporter,
+		OTLPEndpoint: cfg.TracingOTLPEndpoint,
+		SampleRatio:  cfg.TracingSampleRatio,
+	})
+	if err != nil {
+		log.ErrorContext(context.Background(),
+			fmt.Sprintf("Failed to initialize tracing [error=%s]", err.Error()),
+			slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	if cfg.TracingExporter != tracing.ExporterNone {
+		log.InfoContext(context.Background(),
+			fmt.Sprintf("tracing enabled [exporter=%s sample_ratio=%g]", cfg.TracingExporter, cfg.TracingSampleRatio),
+			slog.String("exporter", cfg.TracingExporter),
+			slog.Float64("sample_ratio", cfg.TracingSampleRatio))
+	}
+
+	// Configure concurrency limits; a zero limit leaves the limiter disabled
+	var downloadLimiter, upstreamLimiter *loadshed.Limiter
+	if cfg.MaxConcurrentDownloads > 0 {
+		downloadLimiter = loadshed.NewLimiter("downloads", cfg.MaxConcurrentDownloads, cfg.LoadQueueSize, cfg.LoadQueueTimeout)
+		downloadLimiter.OnChange(func(inFlight, queued int) { m.SetLoad("downloads", inFlight, queued) })
+	}
+	if cfg.MaxConcurrentUpstreamFetches > 0 {
+		upstreamLimiter = loadshed.NewLimiter("upstream", cfg.MaxConcurrentUpstreamFetches, cfg.LoadQueueSize, cfg.LoadQueueTimeout)
+		upstreamLimiter.OnChange(func(inFlight, queued int) { m.SetLoad("upstream", inFlight, queued) })
+	}
+	if downloadLimiter != nil || upstreamLimiter != nil {
+		log.InfoContext(context.Background(),
+			fmt.Sprintf("Load shedding enabled [max_concurrent_downloads=%d max_concurrent_upstream_fetches=%d queue_size=%d queue_timeout=%s]",
+				cfg.MaxConcurrentDownloads, cfg.MaxConcurrentUpstreamFetches, cfg.LoadQueueSize, cfg.LoadQueueTimeout),
+			slog.Int("max_concurrent_downloads", cfg.MaxConcurrentDownloads),
+			slog.Int("max_concurrent_upstream_fetches", cfg.MaxConcurrentUpstreamFetches),
+			slog.Int("queue_size", cfg.LoadQueueSize),
+			slog.String("queue_timeout", cfg.LoadQueueTimeout.String()))
+	}
+
+	// Load upstream registry credentials
+	upstreamCredentials, err := mirror.LoadCredentials(cfg.UpstreamCredentialsFile, os.Environ())
+	if err != nil {
+		log.ErrorContext(context.Background(),
+			fmt.Sprintf("Failed to load upstream credentials [error=%s]", err.Error()),
+			slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	if upstreamCredentials.Len() > 0 {
+		log.InfoContext(context.Background(),
+			fmt.Sprintf("Upstream credentials loaded [hosts=%d credentials_file=%s]", upstreamCredentials.Len(), cfg.UpstreamCredentialsFile),
+			slog.Int("hosts", upstreamCredentials.Len()),
+			slog.String("credentials_file", cfg.UpstreamCredentialsFile))
+	}
+
+	// Parse upstream aliases
+	upstreamAliases, err := mirror.ParseUpstreamAliases(cfg.UpstreamAliases)
+	if err != nil {
+		log.ErrorContext(context.Background(),
+			fmt.Sprintf("Invalid upstream aliases [error=%s]", err.Error()),
+			slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	if upstreamAliases.Len() > 0 {
+		log.InfoContext(context.Background(),
+			fmt.Sprintf("Upstream aliases configured [aliases=%d]", upstreamAliases.Len()),
+			slog.Int("aliases", upstreamAliases.Len()))
+	}
+
+	// Parse upstream source lists
+	upstreamSources, err := mirror.ParseUpstreamSources(cfg.UpstreamSources)
+	if err != nil {
+		log.ErrorContext(context.Background(),
+			fmt.Sprintf("Invalid upstream sources [error=%s]", err.Error()),
+			slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	if upstreamSources.Len() > 0 {
+		log.InfoContext(context.Background(),
+			fmt.Sprintf("Upstream source failover configured [hosts=%d]", upstreamSources.Len()),
+			slog.Int("hosts", upstreamSources.Len()))
+	}
+
+	// Service discovery results are persisted when the storage backend supports it
+	discoveryStore, _ := storageBackend.(storage.MetadataStore)
+
 	// Initialize upstream client
-	upstreamClient := mirror.NewUpstreamClient(
+	upstreamClient, err := mirror.NewUpstreamClient(
 		cfg.UpstreamTimeout,
 		cfg.MaxRetries,
 		cfg.DiscoveryCacheTTL,
 		log,
+		mirror.UpstreamOptions{
+			FetchLimiter:    upstreamLimiter,
+			Credentials:     upstreamCredentials,
+			Aliases:         upstreamAliases,
+			ParentMirrorURL: cfg.UpstreamParentMirror,
+			Transport: mirror.TransportOptions{
+				ProxyURL:             cfg.UpstreamProxy,
+				NoProxy:              cfg.UpstreamNoProxy,
+				CAFiles:              cfg.UpstreamCAFiles,
+				ClientCertFile:       cfg.UpstreamClientCertFile,
+				ClientKeyFile:        cfg.UpstreamClientKeyFile,
+				BlockPrivateNetworks: cfg.UpstreamBlockPrivateNetworks,
+				AllowedNetworks:      cfg.UpstreamAllowedNetworks,
+			},
+			AllowedHosts:     cfg.UpstreamAllowedHosts,
+			OnBlocked:        m.RecordUpstreamBlocked,
+			DiscoveryStore:   discoveryStore,
+			RetryBudgetRatio: cfg.UpstreamRetryBudget,
+			Sources:          upstreamSources,
+			OnSourceResult:   m.RecordUpstreamSource,
+			OnRequest: func(host string, status int, duration time.Duration) {
+				m.RecordUpstreamRequest(status, duration.Seconds(), host)
+			},
+			Breaker: mirror.BreakerOptions{
+				FailureThreshold: cfg.UpstreamBreakerThreshold,
+				OpenTimeout:      cfg.UpstreamBreakerOpenTimeout,
+				OnStateChange:    m.RecordCircuitTransition,
+				OnForget:         m.ForgetCircuit,
+			},
+		},
 	)
+	if err != nil {
+		log.ErrorContext(context.Background(),
+			fmt.Sprintf("Failed to initialize upstream client [error=%s]", err.Error()),
+			slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	if cfg.UpstreamParentMirror != "" {
+		log.InfoContext(context.Background(),
+			fmt.Sprintf("Parent mirror enabled [parent_mirror=%s]", cfg.UpstreamParentMirror),
+			slog.String("parent_mirror", cfg.UpstreamParentMirror))
+	}
+	if cfg.UpstreamProxy != "" {
+		proxyURL, _ := url.Parse(cfg.UpstreamProxy)
+		log.InfoContext(context.Background(),
+			fmt.Sprintf("Upstream proxy enabled [proxy=%s no_proxy=%d]", proxyURL.Redacted(), len(cfg.UpstreamNoProxy)),
+			slog.String("proxy", proxyURL.Redacted()),
+			slog.Int("no_proxy", len(cfg.UpstreamNoProxy)))
+	}
+	if len(cfg.UpstreamAllowedHosts) > 0 || cfg.UpstreamBlockPrivateNetworks {
+		log.InfoContext(context.Background(),
+			fmt.Sprintf("Upstream request protection enabled [allowed_hosts=%d block_private_networks=%t allowed_networks=%d]",
+				len(cfg.UpstreamAllowedHosts), cfg.UpstreamBlockPrivateNetworks, len(cfg.UpstreamAllowedNetworks)),
+			slog.Int("allowed_hosts", len(cfg.UpstreamAllowedHosts)),
+			slog.Bool("block_private_networks", cfg.UpstreamBlockPrivateNetworks),
+			slog.Int("allowed_networks", len(cfg.UpstreamAllowedNetworks)))
+	}
+
+	// Load provider policy
+	var providerPolicy *mirror.ProviderPolicy
+	if cfg.ProviderPolicyFile != "" {
+		providerPolicy, err = mirror.LoadProviderPolicy(cfg.ProviderPolicyFile)
+		if err != nil {
+			log.ErrorContext(context.Background(),
+				fmt.Sprintf("Failed to load provider policy [error=%s]", err.Error()),
+				slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		log.InfoContext(context.Background(),
+			fmt.Sprintf("Provider policy loaded [policy_file=%s allow=%d deny=%d versions=%d]",
+				cfg.ProviderPolicyFile, len(providerPolicy.Allow), len(providerPolicy.Deny), len(providerPolicy.Versions)),
+			slog.String("policy_file", cfg.ProviderPolicyFile),
+			slog.Int("allow", len(providerPolicy.Allow)),
+			slog.Int("deny", len(providerPolicy.Deny)),
+			slog.Int("versions", len(providerPolicy.Versions)))
+	}
+
+	// Configure release cooldown
+	var releaseCooldown *mirror.ReleaseCooldown
+	if cfg.ReleaseCooldownEnabled() {
+		releaseCooldown, err = mirror.NewReleaseCooldown(cfg.ReleaseCooldown, cfg.ReleaseCooldownOverrides, cfg.ReleaseCooldownBypass)
+		if err != nil {
+			log.ErrorContext(context.Background(),
+				fmt.Sprintf("Invalid release cooldown configuration [error=%s]", err.Error()),
+				slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		log.InfoContext(context.Background(),
+			fmt.Sprintf("Release cooldown enabled [cooldown=%s overrides=%d bypass=%d]",
+				cfg.ReleaseCooldown, len(cfg.ReleaseCooldownOverrides), len(cfg.ReleaseCooldownBypass)),
+			slog.String("cooldown", cfg.ReleaseCooldown.String()),
+			slog.Int("overrides", len(cfg.ReleaseCooldownOverrides)),
+			slog.Int("bypass", len(cfg.ReleaseCooldownBypass)))
+	}
 
 	// Initialize mirror service
-	mirrorService := mirror.NewMirror(storageBackend, upstreamClient, cfg.BaseURL, cfg.IndexTTL)
+	mirrorService := mirror.NewMirror(storageBackend, upstreamClient, cfg.BaseURL, cfg.IndexTTL, mirror.Options{
+		Policy:          providerPolicy,
+		Cooldown:        releaseCooldown,
+		RequireApproval: cfg.ApprovalRequired,
+		OnBandwidth: func(hostname, namespace, providerType, source string, bytes int64) {
+			provider := ""
+			if namespace != "" {
+				provider = namespace + "/" + providerType
+			}
+			m.RecordBandwidth(hostname, provider, source, bytes)
+		},
+	})
 
 	log.InfoContext(context.Background(),
-		fmt.Sprintf("Mirror service initialized [index_ttl=%s]", cfg.IndexTTL),
-		slog.String("index_ttl", cfg.IndexTTL.String()))
+		fmt.Sprintf("Mirror service initialized [index_ttl=%s approval_required=%t]", cfg.IndexTTL, cfg.ApprovalRequired),
+		slog.String("index_ttl", cfg.IndexTTL.String()),
+		slog.Bool("approval_required", cfg.ApprovalRequired))
 
-	// Initialize metrics conditionally
-	var m *metrics.Metrics
-	if cfg.MetricsEnabled {
-		m = metrics.New()
-		log.InfoContext(context.Background(), "metrics enabled")
-	} else {
-		m = metrics.Noop()
-		log.InfoContext(context.Background(), "metrics disabled")
+	// Open the download audit log
+	var auditLog *audit.Log
+	if cfg.AuditLogDir != "" {
+		auditLog, err = audit.Open(cfg.AuditLogDir, audit.Options{
+			MaxSize:  int64(cfg.AuditLogMaxSizeMB) * 1024 * 1024,
+			MaxFiles: cfg.AuditLogMaxFiles,
+		})
+		if err != nil {
+			log.ErrorContext(context.Background(),
+				fmt.Sprintf("Failed to open audit log [error=%s]", err.Error()),
+				slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		log.InfoContext(context.Background(),
+			fmt.Sprintf("Audit log enabled [dir=%s max_size_mb=%d max_files=%d]",
+				cfg.AuditLogDir, cfg.AuditLogMaxSizeMB, cfg.AuditLogMaxFiles),
+			slog.String("dir", cfg.AuditLogDir),
+			slog.Int("max_size_mb", cfg.AuditLogMaxSizeMB),
+			slog.Int("max_files", cfg.AuditLogMaxFiles))
 	}
 
 	// Create HTTP server
-	httpServer := server.New(
+	httpServer, err := server.New(
 		cfg.Host,
 		cfg.Port,
 		cfg.ReadTimeout,
@@ -100,7 +322,78 @@ func main() {
 		mirrorService,
 		m,
 		log,
+		server.Options{
+			TLS: server.TLSOptions{
+				CertFile:       cfg.TLSCertFile,
+				KeyFile:        cfg.TLSKeyFile,
+				MinVersion:     cfg.TLSMinVersion,
+				CipherSuites:   cfg.TLSCipherSuites,
+				ReloadInterval: cfg.TLSReloadInterval,
+				ClientCAFile:   cfg.TLSClientCAFile,
+				ClientAuth:     cfg.TLSClientAuth,
+			},
+			Auth: server.AuthOptions{
+				TokensFile:      cfg.AuthTokensFile,
+				TokenHashes:     cfg.AuthTokenHashes,
+				ReloadInterval:  cfg.AuthReloadInterval,
+				ProtectedRoutes: cfg.AuthProtectedRoutes,
+			},
+			AuthzPolicyFile: cfg.AuthzPolicyFile,
+			AdminIdentities: cfg.AdminIdentities,
+			RateLimit: server.RateLimitOptions{
+				MetadataRate:   cfg.RateLimitMetadataRPS,
+				MetadataBurst:  cfg.RateLimitMetadataBurst,
+				ArchiveRate:    cfg.RateLimitArchiveRPS,
+				ArchiveBurst:   cfg.RateLimitArchiveBurst,
+				TrustedProxies: cfg.TrustedProxies,
+			},
+			DownloadLimiter: downloadLimiter,
+			AuditLog:        auditLog,
+		},
 	)
+	if err != nil {
+		log.ErrorContext(context.Background(),
+			fmt.Sprintf("Failed to create HTTP server [error=%s]", err.Error()),
+			slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+
+	if cfg.TLSEnabled() {
+		log.InfoContext(context.Background(),
+			fmt.Sprintf("TLS enabled [cert_file=%s min_version=%s reload_interval=%s client_auth=%s]",
+				cfg.TLSCertFile, cfg.TLSMinVersion, cfg.TLSReloadInterval, cfg.TLSClientAuth),
+			slog.String("cert_file", cfg.TLSCertFile),
+			slog.String("min_version", cfg.TLSMinVersion),
+			slog.String("reload_interval", cfg.TLSReloadInterval.String()),
+			slog.String("client_auth", cfg.TLSClientAuth))
+	}
+
+	if cfg.AuthzPolicyFile != "" {
+		log.InfoContext(context.Background(),
+			fmt.Sprintf("Authorization policy enabled [policy_file=%s]", cfg.AuthzPolicyFile),
+			slog.String("policy_file", cfg.AuthzPolicyFile))
+	}
+
+	if len(cfg.AuthProtectedRoutes) > 0 {
+		routes := strings.Join(cfg.AuthProtectedRoutes, ",")
+		log.InfoContext(context.Background(),
+			fmt.Sprintf("Authentication enabled [protected_routes=%s tokens_file=%s token_hashes=%d]",
+				routes, cfg.AuthTokensFile, len(cfg.AuthTokenHashes)),
+			slog.String("protected_routes", routes),
+			slog.String("tokens_file", cfg.AuthTokensFile),
+			slog.Int("token_hashes", len(cfg.AuthTokenHashes)))
+	}
+
+	if cfg.RateLimitMetadataRPS > 0 || cfg.RateLimitArchiveRPS > 0 {
+		log.InfoContext(context.Background(),
+			fmt.Sprintf("Rate limiting enabled [metadata_rps=%g metadata_burst=%d archive_rps=%g archive_burst=%d trusted_proxies=%d]",
+				cfg.RateLimitMetadataRPS, cfg.RateLimitMetadataBurst, cfg.RateLimitArchiveRPS, cfg.RateLimitArchiveBurst, len(cfg.TrustedProxies)),
+			slog.Float64("metadata_rps", cfg.RateLimitMetadataRPS),
+			slog.Int("metadata_burst", cfg.RateLimitMetadataBurst),
+			slog.Float64("archive_rps", cfg.RateLimitArchiveRPS),
+			slog.Int("archive_burst", cfg.RateLimitArchiveBurst),
+			slog.Int("trusted_proxies", len(cfg.TrustedProxies)))
+	}
 
 	// Start server in a goroutine
 	go func() {
@@ -114,14 +407,31 @@ func main() {
 		}
 	}()
 
-	// Wait for shutdown signal
+	// Wait for shutdown signal, reloading TLS certificates, auth tokens and authorization policy on SIGHUP
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT)
+	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
 
-	sig := <-sigChan
-	log.InfoContext(context.Background(),
-		fmt.Sprintf("Received signal [signal=%s]", sig.String()),
-		slog.String("signal", sig.String()))
+	for sig := range sigChan {
+		log.InfoContext(context.Background(),
+			fmt.Sprintf("Received signal [signal=%s]", sig.String()),
+			slog.String("signal", sig.String()))
+
+		if sig != syscall.SIGHUP {
+			break
+		}
+
+		if err := httpServer.ReloadTLS(); err != nil {
+			log.ErrorContext(context.Background(),
+				fmt.Sprintf("Failed to reload TLS certificate [error=%s]", err.Error()),
+				slog.String("error", err.Error()))
+		}
+
+		if err := httpServer.ReloadAuth(); err != nil {
+			log.ErrorContext(context.Background(),
+				fmt.Sprintf("Failed to reload auth configuration [error=%s]", err.Error()),
+				slog.String("error", err.Error()))
+		}
+	}
 
 	// Cancel background refreshes before draining HTTP connections
 	mirrorService.Shutdown()
@@ -137,5 +447,19 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Close the audit log once in-flight requests have been recorded
+	if err := auditLog.Close(); err != nil {
+		log.ErrorContext(context.Background(),
+			fmt.Sprintf("Audit log close error [error=%s]", err.Error()),
+			slog.String("error", err.Error()))
+	}
+
+	// Flush spans still waiting to be exported
+	if err := shutdownTracing(ctx); err != nil {
+		log.ErrorContext(context.Background(),
+			fmt.Sprintf("Tracing shutdown error [error=%s]", err.Error()),
+			slog.String("error", err.Error()))
+	}
+
 	log.InfoContext(context.Background(), "Specular shutdown complete")
 }
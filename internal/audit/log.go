@@ -0,0 +1,292 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Resources recorded in the audit log
+const (
+	// ResourceIndex is a provider's index.json
+	ResourceIndex = "index"
+	// ResourceVersion is a provider version's version.json
+	ResourceVersion = "version"
+	// ResourceArchive is a provider archive download
+	ResourceArchive = "archive"
+)
+
+const (
+	currentFile   = "audit.log"
+	rotatedPrefix = "audit-"
+	rotatedSuffix = ".log"
+	// rotatedLayout keeps rotated file names in chronological order when sorted
+	rotatedLayout = "20060102T150405.000000000Z"
+)
+
+// DefaultQueryLimit is the number of entries returned when a query sets no limit
+const DefaultQueryLimit = 1000
+
+// Entry records a single provider request
+type Entry struct {
+	Time        time.Time `json:"time"`
+	Identity    string    `json:"identity,omitempty"`
+	ClientIP    string    `json:"client_ip,omitempty"`
+	Resource    string    `json:"resource"`
+	Hostname    string    `json:"hostname"`
+	Namespace   string    `json:"namespace"`
+	Type        string    `json:"type"`
+	Version     string    `json:"version,omitempty"`
+	OS          string    `json:"os,omitempty"`
+	Arch        string    `json:"arch,omitempty"`
+	CacheStatus string    `json:"cache_status,omitempty"`
+	Status      int       `json:"status"`
+}
+
+// Query selects audit entries; empty fields match everything
+type Query struct {
+	Hostname  string
+	Namespace string
+	Type      string
+	Version   string
+	Identity  string
+	Resource  string
+	// Since and Until bound the entry time; zero values leave the range open
+	Since time.Time
+	Until time.Time
+	// Limit caps the number of entries returned; zero uses DefaultQueryLimit
+	Limit int
+}
+
+// matches reports whether an entry satisfies the query
+func (q Query) matches(e *Entry) bool {
+	return (q.Hostname == "" || strings.EqualFold(q.Hostname, e.Hostname)) &&
+		(q.Namespace == "" || strings.EqualFold(q.Namespace, e.Namespace)) &&
+		(q.Type == "" || strings.EqualFold(q.Type, e.Type)) &&
+		(q.Version == "" || q.Version == e.Version) &&
+		(q.Identity == "" || q.Identity == e.Identity) &&
+		(q.Resource == "" || q.Resource == e.Resource) &&
+		(q.Since.IsZero() || !e.Time.Before(q.Since)) &&
+		(q.Until.IsZero() || e.Time.Before(q.Until))
+}
+
+// Options configures audit log rotation
+type Options struct {
+	// MaxSize is the size in bytes at which the current file is rotated
+	MaxSize int64
+	// MaxFiles is the number of rotated files kept; older files are deleted
+	MaxFiles int
+}
+
+// Log is an append-only audit log of JSON lines stored in a directory.
+// The current file is rotated once it reaches the maximum size.
+type Log struct {
+	mu       sync.Mutex
+	dir      string
+	file     *os.File
+	size     int64
+	maxSize  int64
+	maxFiles int
+}
+
+// Open opens the audit log in dir, creating the directory if needed
+func Open(dir string, opts Options) (*Log, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	l := &Log{dir: dir, maxSize: opts.MaxSize, maxFiles: opts.MaxFiles}
+	if err := l.openCurrent(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// openCurrent opens the current file for appending
+func (l *Log) openCurrent() error {
+	file, err := os.OpenFile(filepath.Join(l.dir, currentFile), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat audit log: %w", err)
+	}
+	l.file = file
+	l.size = info.Size()
+	return nil
+}
+
+// Record appends an entry to the log; it is a no-op on a nil log
+func (l *Log) Record(e Entry) error {
+	if l == nil {
+		return nil
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit entry: %w", err)
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return fmt.Errorf("audit log is closed")
+	}
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(line)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write audit entry: %w", err)
+	}
+	return nil
+}
+
+// rotate renames the current file after the current time, starts a new one and deletes
+// rotated files beyond the configured count
+func (l *Log) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return fmt.Errorf("failed to close audit log: %w", err)
+	}
+	l.file = nil
+
+	rotated := filepath.Join(l.dir, rotatedPrefix+time.Now().UTC().Format(rotatedLayout)+rotatedSuffix)
+	if err := os.Rename(filepath.Join(l.dir, currentFile), rotated); err != nil {
+		// Keep appending to the oversized file rather than losing entries
+		if openErr := l.openCurrent(); openErr != nil {
+			return openErr
+		}
+		return fmt.Errorf("failed to rotate audit log: %w", err)
+	}
+	if err := l.openCurrent(); err != nil {
+		return err
+	}
+
+	files, err := l.rotatedFiles()
+	if err != nil {
+		return err
+	}
+	for len(files) > l.maxFiles {
+		if err := os.Remove(files[0]); err != nil {
+			return fmt.Errorf("failed to delete old audit log: %w", err)
+		}
+		files = files[1:]
+	}
+	return nil
+}
+
+// rotatedFiles returns the paths of rotated files, oldest first
+func (l *Log) rotatedFiles() ([]string, error) {
+	entries, err := os.ReadDir(l.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit logs: %w", err)
+	}
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasPrefix(name, rotatedPrefix) && strings.HasSuffix(name, rotatedSuffix) {
+			files = append(files, filepath.Join(l.dir, name))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Query returns matching entries in chronological order, and whether more entries matched
+// than the limit allowed
+func (l *Log) Query(ctx context.Context, q Query) ([]Entry, bool, error) {
+	if q.Limit <= 0 {
+		q.Limit = DefaultQueryLimit
+	}
+
+	// Files are listed under the lock but read without it, so queries never hold up requests;
+	// entries rotated while a query runs may be missed by it
+	l.mu.Lock()
+	files, err := l.rotatedFiles()
+	l.mu.Unlock()
+	if err != nil {
+		return nil, false, err
+	}
+	files = append(files, filepath.Join(l.dir, currentFile))
+
+	entries := []Entry{}
+	for _, path := range files {
+		if err := ctx.Err(); err != nil {
+			return nil, false, err
+		}
+		// A rotated file was last written before it was rotated, so none of its entries
+		// can be newer than its modification time
+		if !q.Since.IsZero() {
+			if info, err := os.Stat(path); err == nil && info.ModTime().Before(q.Since) {
+				continue
+			}
+		}
+		truncated, err := scanFile(path, q, &entries)
+		if err != nil {
+			return nil, false, err
+		}
+		if truncated {
+			return entries, true, nil
+		}
+	}
+	return entries, false, nil
+}
+
+// scanFile appends the matching entries of a file, reporting whether the limit was exceeded
+func scanFile(path string, q Query, entries *[]Entry) (bool, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e Entry
+		// A partially written last line is skipped rather than failing the query
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		if !q.matches(&e) {
+			continue
+		}
+		if len(*entries) == q.Limit {
+			return true, nil
+		}
+		*entries = append(*entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return false, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	return false, nil
+}
+
+// Close closes the current file; later records fail
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
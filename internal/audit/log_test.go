@@ -0,0 +1,184 @@
+package audit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestLog(t *testing.T, opts Options) (*Log, string) {
+	t.Helper()
+	dir := t.TempDir()
+	l, err := Open(dir, opts)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l, dir
+}
+
+func archiveEntry(at time.Time, identity, version string) Entry {
+	return Entry{
+		Time:        at,
+		Identity:    identity,
+		ClientIP:    "192.0.2.1",
+		Resource:    ResourceArchive,
+		Hostname:    "registry.terraform.io",
+		Namespace:   "hashicorp",
+		Type:        "aws",
+		Version:     version,
+		OS:          "linux",
+		Arch:        "amd64",
+		CacheStatus: "hit",
+		Status:      200,
+	}
+}
+
+func TestLog_QueryWhoDownloadedVersionSince(t *testing.T) {
+	l, _ := openTestLog(t, Options{})
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	entries := []Entry{
+		archiveEntry(base, "ci", "5.0.0"),
+		archiveEntry(base.Add(time.Hour), "alice", "5.0.0"),
+		archiveEntry(base.Add(2*time.Hour), "bob", "4.0.0"),
+		archiveEntry(base.Add(3*time.Hour), "ci", "5.0.0"),
+	}
+	for _, e := range entries {
+		if err := l.Record(e); err != nil {
+			t.Fatalf("Record failed: %v", err)
+		}
+	}
+
+	got, truncated, err := l.Query(context.Background(), Query{
+		Hostname:  "registry.terraform.io",
+		Namespace: "HashiCorp",
+		Type:      "aws",
+		Version:   "5.0.0",
+		Since:     base.Add(30 * time.Minute),
+	})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if truncated {
+		t.Error("expected an untruncated result")
+	}
+	if len(got) != 2 || got[0].Identity != "alice" || got[1].Identity != "ci" {
+		t.Fatalf("unexpected entries: %+v", got)
+	}
+	if got[0] != entries[1] {
+		t.Errorf("entry did not round trip: got %+v, want %+v", got[0], entries[1])
+	}
+
+	got, _, err = l.Query(context.Background(), Query{Identity: "ci", Until: base.Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(got) != 1 || !got[0].Time.Equal(base) {
+		t.Errorf("unexpected entries before until: %+v", got)
+	}
+}
+
+func TestLog_QueryLimit(t *testing.T) {
+	l, _ := openTestLog(t, Options{})
+	base := time.Now().UTC()
+	for i := range 5 {
+		if err := l.Record(archiveEntry(base.Add(time.Duration(i)*time.Second), "ci", "5.0.0")); err != nil {
+			t.Fatalf("Record failed: %v", err)
+		}
+	}
+
+	got, truncated, err := l.Query(context.Background(), Query{Limit: 3})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(got) != 3 || !truncated {
+		t.Errorf("got %d entries, truncated %t; want 3, truncated", len(got), truncated)
+	}
+	if !got[0].Time.Equal(base) {
+		t.Errorf("expected the oldest entries first, got %s", got[0].Time)
+	}
+}
+
+func TestLog_RotationAndPruning(t *testing.T) {
+	l, dir := openTestLog(t, Options{MaxSize: 400, MaxFiles: 2})
+	base := time.Now().UTC()
+	const total = 20
+	for i := range total {
+		if err := l.Record(archiveEntry(base.Add(time.Duration(i)*time.Second), "ci", "5.0.0")); err != nil {
+			t.Fatalf("Record failed: %v", err)
+		}
+	}
+
+	rotated, err := filepath.Glob(filepath.Join(dir, rotatedPrefix+"*"+rotatedSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rotated) != 2 {
+		t.Errorf("rotated files = %d, want 2", len(rotated))
+	}
+	info, err := os.Stat(filepath.Join(dir, currentFile))
+	if err != nil {
+		t.Fatalf("current file missing: %v", err)
+	}
+	if info.Size() > 400 {
+		t.Errorf("current file size = %d, want at most 400", info.Size())
+	}
+
+	// The newest entries survive pruning, in order, across the rotated and current files
+	got, _, err := l.Query(context.Background(), Query{})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(got) == 0 || len(got) >= total {
+		t.Fatalf("got %d entries, want some but not all of %d", len(got), total)
+	}
+	if last := got[len(got)-1]; !last.Time.Equal(base.Add((total - 1) * time.Second)) {
+		t.Errorf("last entry time = %s, want the newest entry", last.Time)
+	}
+	for i := 1; i < len(got); i++ {
+		if got[i].Time.Before(got[i-1].Time) {
+			t.Fatalf("entries out of order at %d", i)
+		}
+	}
+}
+
+func TestLog_ReopenAppends(t *testing.T) {
+	dir := t.TempDir()
+	first, err := Open(dir, Options{})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	first.Record(archiveEntry(time.Now().UTC(), "ci", "5.0.0"))
+	first.Close()
+	if err := first.Record(archiveEntry(time.Now().UTC(), "ci", "5.0.0")); err == nil {
+		t.Error("expected recording to a closed log to fail")
+	}
+
+	second, err := Open(dir, Options{})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer second.Close()
+	second.Record(archiveEntry(time.Now().UTC(), "alice", "5.0.0"))
+
+	got, _, err := second.Query(context.Background(), Query{})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(got) != 2 {
+		t.Errorf("got %d entries, want 2", len(got))
+	}
+}
+
+func TestLog_NilRecordIsNoop(t *testing.T) {
+	var l *Log
+	if err := l.Record(Entry{}); err != nil {
+		t.Errorf("Record on nil log = %v, want nil", err)
+	}
+	if err := l.Close(); err != nil {
+		t.Errorf("Close on nil log = %v, want nil", err)
+	}
+}
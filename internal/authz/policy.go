@@ -0,0 +1,239 @@
+package authz
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+)
+
+// Actions that can be granted to an identity
+const (
+	// ActionProviders allows fetching provider metadata and archives
+	ActionProviders = "providers"
+	// ActionMetrics allows scraping the metrics endpoint
+	ActionMetrics = "metrics"
+	// ActionAdmin allows administrative API calls
+	ActionAdmin = "admin"
+)
+
+// Special identity names usable in rules
+const (
+	// AnyIdentity matches every authenticated identity
+	AnyIdentity = "*"
+	// Anonymous matches requests without an authenticated identity
+	Anonymous = "anonymous"
+)
+
+var validActions = map[string]bool{
+	ActionProviders: true,
+	ActionMetrics:   true,
+	ActionAdmin:     true,
+	"*":             true,
+}
+
+// Rule grants actions on a set of providers to a set of identities
+type Rule struct {
+	// Identities lists identity names, AnyIdentity, or Anonymous
+	Identities []string `json:"identities"`
+	// Actions lists granted actions, or "*" for all
+	Actions []string `json:"actions"`
+	// Providers lists "namespace/type" or "hostname/namespace/type" glob patterns.
+	// Empty matches every provider. Only used for provider-scoped actions.
+	Providers []string `json:"providers,omitempty"`
+}
+
+// PolicyDocument is the on-disk representation of an authorization policy
+type PolicyDocument struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Decision is the outcome of an authorization check
+type Decision struct {
+	Allowed bool
+	Reason  string
+}
+
+// Resource identifies the provider an action applies to.
+// A zero Resource is used for actions that are not provider-scoped.
+type Resource struct {
+	Hostname  string
+	Namespace string
+	Type      string
+}
+
+// String returns the provider address, or "*" for a zero resource
+func (r Resource) String() string {
+	if r == (Resource{}) {
+		return "*"
+	}
+	return r.Hostname + "/" + r.Namespace + "/" + r.Type
+}
+
+// Validate checks that rules reference known actions and well-formed patterns
+func (d *PolicyDocument) Validate() error {
+	var errs []error
+	for i, rule := range d.Rules {
+		if len(rule.Identities) == 0 {
+			errs = append(errs, fmt.Errorf("rule %d: identities must not be empty", i))
+		}
+		if len(rule.Actions) == 0 {
+			errs = append(errs, fmt.Errorf("rule %d: actions must not be empty", i))
+		}
+		for _, action := range rule.Actions {
+			if !validActions[action] {
+				errs = append(errs, fmt.Errorf("rule %d: unknown action %q", i, action))
+			}
+		}
+		for _, pattern := range rule.Providers {
+			if err := ValidateProviderPattern(pattern); err != nil {
+				errs = append(errs, fmt.Errorf("rule %d: %w", i, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ValidateProviderPattern checks that a provider pattern has two or three segments with valid glob syntax
+func ValidateProviderPattern(pattern string) error {
+	segments := strings.Split(pattern, "/")
+	if len(segments) != 2 && len(segments) != 3 {
+		return fmt.Errorf("provider pattern %q must be namespace/type or hostname/namespace/type", pattern)
+	}
+	for _, segment := range segments {
+		if _, err := path.Match(segment, ""); err != nil {
+			return fmt.Errorf("invalid provider pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// MatchProvider reports whether a provider pattern matches a resource.
+// Two-segment patterns match any hostname. Matching is case-insensitive.
+func MatchProvider(pattern string, r Resource) bool {
+	segments := strings.Split(strings.ToLower(pattern), "/")
+	values := []string{strings.ToLower(r.Hostname), strings.ToLower(r.Namespace), strings.ToLower(r.Type)}
+	if len(segments) == 2 {
+		values = values[1:]
+	}
+	if len(segments) != len(values) {
+		return false
+	}
+	for i, segment := range segments {
+		if ok, _ := path.Match(segment, values[i]); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Evaluate checks whether identity may perform action on resource.
+// An empty identity is treated as Anonymous. Requests are denied unless a rule allows them.
+func (d *PolicyDocument) Evaluate(identity, action string, resource Resource) Decision {
+	authenticated := identity != ""
+	if !authenticated {
+		identity = Anonymous
+	}
+
+	identityMatched := false
+	actionMatched := false
+	for _, rule := range d.Rules {
+		if !matchesIdentity(rule.Identities, identity, authenticated) {
+			continue
+		}
+		identityMatched = true
+
+		if !matchesAction(rule.Actions, action) {
+			continue
+		}
+		actionMatched = true
+
+		if action != ActionProviders || len(rule.Providers) == 0 {
+			return Decision{Allowed: true, Reason: fmt.Sprintf("identity %q is allowed to %s %s", identity, action, resource)}
+		}
+		for _, pattern := range rule.Providers {
+			if MatchProvider(pattern, resource) {
+				return Decision{Allowed: true, Reason: fmt.Sprintf("identity %q is allowed to %s %s by pattern %q", identity, action, resource, pattern)}
+			}
+		}
+	}
+
+	switch {
+	case !identityMatched:
+		return Decision{Reason: fmt.Sprintf("identity %q has no authorization rules", identity)}
+	case !actionMatched:
+		return Decision{Reason: fmt.Sprintf("identity %q is not allowed the %s action", identity, action)}
+	default:
+		return Decision{Reason: fmt.Sprintf("identity %q is not allowed to access provider %s", identity, resource)}
+	}
+}
+
+func matchesIdentity(identities []string, identity string, authenticated bool) bool {
+	for _, id := range identities {
+		if id == identity || (id == AnyIdentity && authenticated) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAction(actions []string, action string) bool {
+	for _, a := range actions {
+		if a == action || a == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadPolicyFile reads and validates a JSON policy document
+func LoadPolicyFile(file string) (*PolicyDocument, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read authorization policy: %w", err)
+	}
+
+	var doc PolicyDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse authorization policy: %w", err)
+	}
+
+	if err := doc.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid authorization policy: %w", err)
+	}
+
+	return &doc, nil
+}
+
+// Authorizer evaluates requests against a policy file that can be reloaded at runtime
+type Authorizer struct {
+	file   string
+	policy atomic.Pointer[PolicyDocument]
+}
+
+// NewAuthorizer loads the policy from file
+func NewAuthorizer(file string) (*Authorizer, error) {
+	a := &Authorizer{file: file}
+	if err := a.Reload(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Reload re-reads the policy file. On failure the previous policy stays in use.
+func (a *Authorizer) Reload() error {
+	doc, err := LoadPolicyFile(a.file)
+	if err != nil {
+		return err
+	}
+	a.policy.Store(doc)
+	return nil
+}
+
+// Authorize checks whether identity may perform action on resource
+func (a *Authorizer) Authorize(identity, action string, resource Resource) Decision {
+	return a.policy.Load().Evaluate(identity, action, resource)
+}
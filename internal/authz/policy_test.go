@@ -0,0 +1,176 @@
+package authz
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testPolicy() *PolicyDocument {
+	return &PolicyDocument{
+		Rules: []Rule{
+			{
+				Identities: []string{"team-a"},
+				Actions:    []string{ActionProviders},
+				Providers:  []string{"hashicorp/*", "registry.terraform.io/ourcorp/*"},
+			},
+			{
+				Identities: []string{"platform"},
+				Actions:    []string{"*"},
+			},
+			{
+				Identities: []string{Anonymous},
+				Actions:    []string{ActionProviders},
+				Providers:  []string{"*/hashicorp/null"},
+			},
+		},
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name     string
+		identity string
+		action   string
+		resource Resource
+		allowed  bool
+		reason   string
+	}{
+		{
+			name:     "namespace pattern on any hostname",
+			identity: "team-a",
+			action:   ActionProviders,
+			resource: Resource{"registry.opentofu.org", "hashicorp", "aws"},
+			allowed:  true,
+		},
+		{
+			name:     "hostname-qualified pattern",
+			identity: "team-a",
+			action:   ActionProviders,
+			resource: Resource{"registry.terraform.io", "ourcorp", "internal"},
+			allowed:  true,
+		},
+		{
+			name:     "case-insensitive match",
+			identity: "team-a",
+			action:   ActionProviders,
+			resource: Resource{"Registry.Terraform.io", "OurCorp", "internal"},
+			allowed:  true,
+		},
+		{
+			name:     "hostname-qualified pattern on other hostname",
+			identity: "team-a",
+			action:   ActionProviders,
+			resource: Resource{"example.com", "ourcorp", "internal"},
+			reason:   `identity "team-a" is not allowed to access provider example.com/ourcorp/internal`,
+		},
+		{
+			name:     "action not granted",
+			identity: "team-a",
+			action:   ActionMetrics,
+			reason:   `identity "team-a" is not allowed the metrics action`,
+		},
+		{
+			name:     "wildcard actions",
+			identity: "platform",
+			action:   ActionMetrics,
+			allowed:  true,
+		},
+		{
+			name:     "unknown identity",
+			identity: "team-b",
+			action:   ActionProviders,
+			resource: Resource{"registry.terraform.io", "hashicorp", "aws"},
+			reason:   `identity "team-b" has no authorization rules`,
+		},
+		{
+			name:     "anonymous allowed provider",
+			action:   ActionProviders,
+			resource: Resource{"registry.terraform.io", "hashicorp", "null"},
+			allowed:  true,
+		},
+		{
+			name:     "anonymous denied provider",
+			action:   ActionProviders,
+			resource: Resource{"registry.terraform.io", "hashicorp", "aws"},
+			reason:   `identity "anonymous" is not allowed to access provider registry.terraform.io/hashicorp/aws`,
+		},
+	}
+
+	policy := testPolicy()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision := policy.Evaluate(tt.identity, tt.action, tt.resource)
+			if decision.Allowed != tt.allowed {
+				t.Fatalf("Evaluate() allowed = %v, want %v (reason: %s)", decision.Allowed, tt.allowed, decision.Reason)
+			}
+			if tt.reason != "" && decision.Reason != tt.reason {
+				t.Errorf("Evaluate() reason = %q, want %q", decision.Reason, tt.reason)
+			}
+		})
+	}
+}
+
+func TestEvaluate_AnyIdentityExcludesAnonymous(t *testing.T) {
+	policy := &PolicyDocument{Rules: []Rule{{Identities: []string{AnyIdentity}, Actions: []string{ActionProviders}}}}
+
+	if !policy.Evaluate("someone", ActionProviders, Resource{"h", "n", "t"}).Allowed {
+		t.Error("expected authenticated identity to match *")
+	}
+	if policy.Evaluate("", ActionProviders, Resource{"h", "n", "t"}).Allowed {
+		t.Error("expected anonymous request not to match *")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	doc := &PolicyDocument{
+		Rules: []Rule{
+			{Identities: nil, Actions: []string{"delete"}, Providers: []string{"just-one-segment", "a/[b"}},
+		},
+	}
+
+	err := doc.Validate()
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	for _, msg := range []string{
+		"identities must not be empty",
+		`unknown action "delete"`,
+		`provider pattern "just-one-segment" must be namespace/type or hostname/namespace/type`,
+		`invalid provider pattern "a/[b"`,
+	} {
+		if !strings.Contains(err.Error(), msg) {
+			t.Errorf("expected error to include %q, got %q", msg, err.Error())
+		}
+	}
+}
+
+func TestAuthorizer_Reload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "policy.json")
+	os.WriteFile(file, []byte(`{"rules":[{"identities":["ci"],"actions":["providers"]}]}`), 0600)
+
+	authorizer, err := NewAuthorizer(file)
+	if err != nil {
+		t.Fatalf("NewAuthorizer failed: %v", err)
+	}
+	if !authorizer.Authorize("ci", ActionProviders, Resource{"h", "n", "t"}).Allowed {
+		t.Fatal("expected ci to be allowed")
+	}
+
+	os.WriteFile(file, []byte(`{"rules":[{"identities":["ci"],"actions":["metrics"]}]}`), 0600)
+	if err := authorizer.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if authorizer.Authorize("ci", ActionProviders, Resource{"h", "n", "t"}).Allowed {
+		t.Error("expected ci to be denied after reload")
+	}
+
+	os.WriteFile(file, []byte(`{not json`), 0600)
+	if err := authorizer.Reload(); err == nil {
+		t.Fatal("expected error for invalid policy")
+	}
+	if !authorizer.Authorize("ci", ActionMetrics, Resource{}).Allowed {
+		t.Error("expected previous policy to remain after failed reload")
+	}
+}
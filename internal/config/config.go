@@ -1,8 +1,13 @@
 package config
 
 import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"math"
+	"net"
 	"net/url"
 	"os"
 	"strconv"
@@ -19,6 +24,36 @@ type Config struct {
 	WriteTimeout    time.Duration
 	ShutdownTimeout time.Duration
 
+	// TLS configuration
+	TLSCertFile       string
+	TLSKeyFile        string
+	TLSMinVersion     string
+	TLSCipherSuites   []string
+	TLSReloadInterval time.Duration
+	TLSClientCAFile   string
+	TLSClientAuth     string
+
+	// Auth configuration
+	AuthTokensFile      string
+	AuthTokenHashes     []string
+	AuthReloadInterval  time.Duration
+	AuthProtectedRoutes []string
+	AuthzPolicyFile     string
+	AdminIdentities     []string
+
+	// Rate limiting configuration
+	RateLimitMetadataRPS   float64
+	RateLimitMetadataBurst int
+	RateLimitArchiveRPS    float64
+	RateLimitArchiveBurst  int
+	TrustedProxies         []string
+
+	// Load shedding configuration
+	MaxConcurrentDownloads       int
+	MaxConcurrentUpstreamFetches int
+	LoadQueueSize                int
+	LoadQueueTimeout             time.Duration
+
 	// Storage configuration
 	StorageType string
 	CacheDir    string
@@ -28,35 +63,108 @@ type Config struct {
 	MaxRetries        int
 	DiscoveryCacheTTL time.Duration
 
+	// UpstreamRetryBudget limits retries per upstream host to this ratio of its requests; 0 disables it
+	UpstreamRetryBudget float64
+
+	// Upstream circuit breaker; a threshold of 0 disables it
+	UpstreamBreakerThreshold   int
+	UpstreamBreakerOpenTimeout time.Duration
+
+	// UpstreamCredentialsFile is a credentials.tfrc.json-style file of per-host registry tokens
+	UpstreamCredentialsFile string
+
+	// UpstreamAliases are "hostname[/namespace]=target" rules redirecting upstream fetches
+	UpstreamAliases []string
+
+	// UpstreamParentMirror is a provider network mirror used as the upstream for every hostname
+	UpstreamParentMirror string
+
+	// UpstreamSources are "hostname=source|source" lists of upstreams tried in turn for a hostname
+	UpstreamSources []string
+
+	// Upstream transport configuration
+	UpstreamProxy          string
+	UpstreamNoProxy        []string
+	UpstreamCAFiles        []string
+	UpstreamClientCertFile string
+	UpstreamClientKeyFile  string
+
+	// Upstream request protection
+	// UpstreamAllowedHosts restricts mirrored registry hostnames (exact or "*.domain"); empty allows all
+	UpstreamAllowedHosts []string
+	// UpstreamBlockPrivateNetworks refuses upstream connections to loopback, link-local and private addresses
+	UpstreamBlockPrivateNetworks bool
+	// UpstreamAllowedNetworks are IPs and CIDRs exempt from private network blocking
+	UpstreamAllowedNetworks []string
+
 	// Mirror configuration
-	BaseURL  string
-	IndexTTL time.Duration
+	BaseURL            string
+	IndexTTL           time.Duration
+	ProviderPolicyFile string
+
+	// Release cooldown configuration
+	ReleaseCooldown          time.Duration
+	ReleaseCooldownOverrides []string
+	ReleaseCooldownBypass    []string
+
+	// Approval workflow configuration
+	ApprovalRequired bool
 
 	// Observability
 	LogLevel       string
 	LogFormat      string
 	MetricsEnabled bool
+
+	// Tracing
+	// TracingExporter is where spans are sent: none, otlp or stdout
+	TracingExporter string
+	// TracingOTLPEndpoint is the OTLP/HTTP collector URL; empty uses the OTEL_EXPORTER_OTLP_* variables
+	TracingOTLPEndpoint string
+	// TracingSampleRatio is the fraction of new traces recorded
+	TracingSampleRatio float64
+
+	// Audit log
+	// AuditLogDir is where the download audit log is written; empty disables it
+	AuditLogDir string
+	// AuditLogMaxSizeMB is the size at which the audit log is rotated
+	AuditLogMaxSizeMB int
+	// AuditLogMaxFiles is the number of rotated audit log files kept
+	AuditLogMaxFiles int
 }
 
 // Load reads configuration from environment variables
 func Load() (*Config, error) {
 	cfg := &Config{
 		// Defaults
-		Port:              8080,
-		Host:              "0.0.0.0",
-		ReadTimeout:       30 * time.Second,
-		WriteTimeout:      30 * time.Second,
-		ShutdownTimeout:   30 * time.Second,
-		StorageType:       "filesystem",
-		CacheDir:          "/var/cache/specular",
-		UpstreamTimeout:   60 * time.Second,
-		MaxRetries:        3,
-		DiscoveryCacheTTL: 1 * time.Hour,
-		BaseURL:           "https://specular.example.com",
-		IndexTTL:          1 * time.Hour,
-		LogLevel:          "info",
-		LogFormat:         "json",
-		MetricsEnabled:    true,
+		Port:                       8080,
+		Host:                       "0.0.0.0",
+		ReadTimeout:                30 * time.Second,
+		WriteTimeout:               30 * time.Second,
+		ShutdownTimeout:            30 * time.Second,
+		TLSMinVersion:              "1.2",
+		TLSReloadInterval:          30 * time.Second,
+		TLSClientAuth:              "none",
+		AuthReloadInterval:         30 * time.Second,
+		RateLimitMetadataBurst:     20,
+		RateLimitArchiveBurst:      5,
+		LoadQueueTimeout:           10 * time.Second,
+		StorageType:                "filesystem",
+		CacheDir:                   "/var/cache/specular",
+		UpstreamTimeout:            60 * time.Second,
+		MaxRetries:                 3,
+		DiscoveryCacheTTL:          1 * time.Hour,
+		UpstreamRetryBudget:        0.2,
+		UpstreamBreakerThreshold:   5,
+		UpstreamBreakerOpenTimeout: 30 * time.Second,
+		BaseURL:                    "https://specular.example.com",
+		IndexTTL:                   1 * time.Hour,
+		LogLevel:                   "info",
+		LogFormat:                  "json",
+		MetricsEnabled:             true,
+		TracingExporter:            "none",
+		TracingSampleRatio:         1.0,
+		AuditLogMaxSizeMB:          100,
+		AuditLogMaxFiles:           10,
 	}
 
 	// Override with environment variables
@@ -80,6 +188,87 @@ func Load() (*Config, error) {
 		return nil, err
 	}
 
+	if v := os.Getenv("SPECULAR_TLS_CERT_FILE"); v != "" {
+		cfg.TLSCertFile = v
+	}
+
+	if v := os.Getenv("SPECULAR_TLS_KEY_FILE"); v != "" {
+		cfg.TLSKeyFile = v
+	}
+
+	if v := os.Getenv("SPECULAR_TLS_MIN_VERSION"); v != "" {
+		cfg.TLSMinVersion = v
+	}
+
+	setEnvList("SPECULAR_TLS_CIPHER_SUITES", &cfg.TLSCipherSuites)
+
+	if err := setEnvDuration("SPECULAR_TLS_RELOAD_INTERVAL", &cfg.TLSReloadInterval, "must be a valid duration (e.g., 30s)"); err != nil {
+		return nil, err
+	}
+
+	if v := os.Getenv("SPECULAR_TLS_CLIENT_CA_FILE"); v != "" {
+		cfg.TLSClientCAFile = v
+	}
+
+	if v := os.Getenv("SPECULAR_TLS_CLIENT_AUTH"); v != "" {
+		cfg.TLSClientAuth = v
+	}
+
+	if v := os.Getenv("SPECULAR_AUTH_TOKENS_FILE"); v != "" {
+		cfg.AuthTokensFile = v
+	}
+
+	setEnvList("SPECULAR_AUTH_TOKEN_HASHES", &cfg.AuthTokenHashes)
+
+	if err := setEnvDuration("SPECULAR_AUTH_RELOAD_INTERVAL", &cfg.AuthReloadInterval, "must be a valid duration (e.g., 30s)"); err != nil {
+		return nil, err
+	}
+
+	setEnvList("SPECULAR_AUTH_PROTECTED_ROUTES", &cfg.AuthProtectedRoutes)
+	if cfg.AuthProtectedRoutes == nil && cfg.AuthTokensEnabled() {
+		// Keep health checks open by default once tokens are configured
+		cfg.AuthProtectedRoutes = []string{"providers", "metrics"}
+	}
+
+	if v := os.Getenv("SPECULAR_AUTHZ_POLICY_FILE"); v != "" {
+		cfg.AuthzPolicyFile = v
+	}
+	setEnvList("SPECULAR_ADMIN_IDENTITIES", &cfg.AdminIdentities)
+
+	if err := setEnvFloat("SPECULAR_RATE_LIMIT_METADATA_RPS", &cfg.RateLimitMetadataRPS, "must be a valid number"); err != nil {
+		return nil, err
+	}
+
+	if err := setEnvInt("SPECULAR_RATE_LIMIT_METADATA_BURST", &cfg.RateLimitMetadataBurst, "must be a valid integer"); err != nil {
+		return nil, err
+	}
+
+	if err := setEnvFloat("SPECULAR_RATE_LIMIT_ARCHIVE_RPS", &cfg.RateLimitArchiveRPS, "must be a valid number"); err != nil {
+		return nil, err
+	}
+
+	if err := setEnvInt("SPECULAR_RATE_LIMIT_ARCHIVE_BURST", &cfg.RateLimitArchiveBurst, "must be a valid integer"); err != nil {
+		return nil, err
+	}
+
+	setEnvList("SPECULAR_TRUSTED_PROXIES", &cfg.TrustedProxies)
+
+	if err := setEnvInt("SPECULAR_MAX_CONCURRENT_DOWNLOADS", &cfg.MaxConcurrentDownloads, "must be a valid integer"); err != nil {
+		return nil, err
+	}
+
+	if err := setEnvInt("SPECULAR_MAX_CONCURRENT_UPSTREAM_FETCHES", &cfg.MaxConcurrentUpstreamFetches, "must be a valid integer"); err != nil {
+		return nil, err
+	}
+
+	if err := setEnvInt("SPECULAR_LOAD_QUEUE_SIZE", &cfg.LoadQueueSize, "must be a valid integer"); err != nil {
+		return nil, err
+	}
+
+	if err := setEnvDuration("SPECULAR_LOAD_QUEUE_TIMEOUT", &cfg.LoadQueueTimeout, "must be a valid duration (e.g., 10s)"); err != nil {
+		return nil, err
+	}
+
 	if v := os.Getenv("SPECULAR_STORAGE_TYPE"); v != "" {
 		cfg.StorageType = v
 	}
@@ -96,14 +285,76 @@ func Load() (*Config, error) {
 		return nil, err
 	}
 
+	if err := setEnvFloat("SPECULAR_UPSTREAM_RETRY_BUDGET", &cfg.UpstreamRetryBudget, "must be a valid number"); err != nil {
+		return nil, err
+	}
+
+	if err := setEnvInt("SPECULAR_UPSTREAM_BREAKER_THRESHOLD", &cfg.UpstreamBreakerThreshold, "must be a valid integer"); err != nil {
+		return nil, err
+	}
+
+	if err := setEnvDuration("SPECULAR_UPSTREAM_BREAKER_OPEN_TIMEOUT", &cfg.UpstreamBreakerOpenTimeout, "must be a valid duration (e.g., 30s)"); err != nil {
+		return nil, err
+	}
+
 	if err := setEnvDuration("SPECULAR_DISCOVERY_CACHE_TTL", &cfg.DiscoveryCacheTTL, "must be a valid duration (e.g., 1h)"); err != nil {
 		return nil, err
 	}
 
+	if v := os.Getenv("SPECULAR_UPSTREAM_CREDENTIALS_FILE"); v != "" {
+		cfg.UpstreamCredentialsFile = v
+	}
+
+	setEnvList("SPECULAR_UPSTREAM_ALIASES", &cfg.UpstreamAliases)
+
+	if v := os.Getenv("SPECULAR_UPSTREAM_PARENT_MIRROR"); v != "" {
+		cfg.UpstreamParentMirror = v
+	}
+
+	setEnvList("SPECULAR_UPSTREAM_SOURCES", &cfg.UpstreamSources)
+
+	if v := os.Getenv("SPECULAR_UPSTREAM_PROXY"); v != "" {
+		cfg.UpstreamProxy = v
+	}
+
+	setEnvList("SPECULAR_UPSTREAM_NO_PROXY", &cfg.UpstreamNoProxy)
+	setEnvList("SPECULAR_UPSTREAM_CA_FILES", &cfg.UpstreamCAFiles)
+
+	if v := os.Getenv("SPECULAR_UPSTREAM_CLIENT_CERT_FILE"); v != "" {
+		cfg.UpstreamClientCertFile = v
+	}
+
+	if v := os.Getenv("SPECULAR_UPSTREAM_CLIENT_KEY_FILE"); v != "" {
+		cfg.UpstreamClientKeyFile = v
+	}
+
+	setEnvList("SPECULAR_UPSTREAM_ALLOWED_HOSTS", &cfg.UpstreamAllowedHosts)
+
+	if err := setEnvBool("SPECULAR_UPSTREAM_BLOCK_PRIVATE_NETWORKS", &cfg.UpstreamBlockPrivateNetworks, "must be true or false"); err != nil {
+		return nil, err
+	}
+
+	setEnvList("SPECULAR_UPSTREAM_ALLOWED_NETWORKS", &cfg.UpstreamAllowedNetworks)
+
 	if err := setEnvDuration("SPECULAR_INDEX_TTL", &cfg.IndexTTL, "must be a valid duration (e.g., 1h)"); err != nil {
 		return nil, err
 	}
 
+	if v := os.Getenv("SPECULAR_PROVIDER_POLICY_FILE"); v != "" {
+		cfg.ProviderPolicyFile = v
+	}
+
+	if err := setEnvDuration("SPECULAR_RELEASE_COOLDOWN", &cfg.ReleaseCooldown, "must be a valid duration (e.g., 168h)"); err != nil {
+		return nil, err
+	}
+
+	setEnvList("SPECULAR_RELEASE_COOLDOWN_OVERRIDES", &cfg.ReleaseCooldownOverrides)
+	setEnvList("SPECULAR_RELEASE_COOLDOWN_BYPASS", &cfg.ReleaseCooldownBypass)
+
+	if err := setEnvBool("SPECULAR_APPROVAL_REQUIRED", &cfg.ApprovalRequired, "must be true or false"); err != nil {
+		return nil, err
+	}
+
 	if v := os.Getenv("SPECULAR_BASE_URL"); v != "" {
 		cfg.BaseURL = v
 	}
@@ -120,6 +371,30 @@ func Load() (*Config, error) {
 		return nil, err
 	}
 
+	if v := os.Getenv("SPECULAR_TRACING_EXPORTER"); v != "" {
+		cfg.TracingExporter = v
+	}
+
+	if v := os.Getenv("SPECULAR_TRACING_OTLP_ENDPOINT"); v != "" {
+		cfg.TracingOTLPEndpoint = v
+	}
+
+	if err := setEnvFloat("SPECULAR_TRACING_SAMPLE_RATIO", &cfg.TracingSampleRatio, "must be a valid number"); err != nil {
+		return nil, err
+	}
+
+	if v := os.Getenv("SPECULAR_AUDIT_LOG_DIR"); v != "" {
+		cfg.AuditLogDir = v
+	}
+
+	if err := setEnvInt("SPECULAR_AUDIT_LOG_MAX_SIZE_MB", &cfg.AuditLogMaxSizeMB, "must be a valid integer"); err != nil {
+		return nil, err
+	}
+
+	if err := setEnvInt("SPECULAR_AUDIT_LOG_MAX_FILES", &cfg.AuditLogMaxFiles, "must be a valid integer"); err != nil {
+		return nil, err
+	}
+
 	// Validate configuration
 	if err := cfg.Validate(); err != nil {
 		return nil, err
@@ -152,18 +427,165 @@ func (c *Config) Validate() error {
 		errs = append(errs, errors.New("shutdown timeout must be positive"))
 	}
 
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		errs = append(errs, errors.New("TLS certificate and key files must be set together"))
+	}
+
+	if c.TLSEnabled() {
+		validTLSVersions := map[string]bool{
+			"1.2": true,
+			"1.3": true,
+		}
+		if !validTLSVersions[c.TLSMinVersion] {
+			errs = append(errs, errors.New("TLS minimum version must be 1.2 or 1.3"))
+		}
+
+		for _, name := range c.TLSCipherSuites {
+			if !isSecureCipherSuite(name) {
+				errs = append(errs, fmt.Errorf("unsupported TLS cipher suite: %s", name))
+			}
+		}
+
+		if c.TLSReloadInterval < 0 {
+			errs = append(errs, errors.New("TLS reload interval must not be negative"))
+		}
+	}
+
+	validClientAuthModes := map[string]bool{
+		"none":     true,
+		"optional": true,
+		"required": true,
+	}
+	if !validClientAuthModes[c.TLSClientAuth] {
+		errs = append(errs, errors.New("TLS client auth must be none, optional, or required"))
+	} else if c.TLSClientAuth != "none" {
+		if !c.TLSEnabled() {
+			errs = append(errs, errors.New("TLS client auth requires TLS certificate and key files"))
+		}
+		if c.TLSClientCAFile == "" {
+			errs = append(errs, errors.New("TLS client auth requires a client CA file"))
+		}
+	}
+
+	if c.AuthReloadInterval < 0 {
+		errs = append(errs, errors.New("auth reload interval must not be negative"))
+	}
+
+	for _, entry := range c.AuthTokenHashes {
+		name, hash, ok := strings.Cut(entry, ":")
+		if !ok || name == "" || !isSHA256Hash(hash) {
+			errs = append(errs, fmt.Errorf("auth token hash for %q must be name:sha256:<hex>", name))
+		}
+	}
+
+	validRouteGroups := map[string]bool{
+		"health":    true,
+		"providers": true,
+		"metrics":   true,
+	}
+	for _, group := range c.AuthProtectedRoutes {
+		if !validRouteGroups[group] {
+			errs = append(errs, fmt.Errorf("unknown auth protected route group: %s (must be health, providers, or metrics)", group))
+		}
+	}
+	if len(c.AuthProtectedRoutes) > 0 && !c.AuthTokensEnabled() && c.TLSClientAuth != "optional" && c.TLSClientAuth != "required" {
+		errs = append(errs, errors.New("auth protected routes require auth tokens or TLS client auth"))
+	}
+
+	if c.RateLimitMetadataRPS < 0 || c.RateLimitArchiveRPS < 0 {
+		errs = append(errs, errors.New("rate limits must not be negative"))
+	}
+
+	if c.RateLimitMetadataBurst < 1 || c.RateLimitArchiveBurst < 1 {
+		errs = append(errs, errors.New("rate limit bursts must be at least 1"))
+	}
+
+	for _, proxy := range c.TrustedProxies {
+		if !isIPOrCIDR(proxy) {
+			errs = append(errs, fmt.Errorf("trusted proxy must be an IP address or CIDR: %s", proxy))
+		}
+	}
+
+	if c.MaxConcurrentDownloads < 0 || c.MaxConcurrentUpstreamFetches < 0 {
+		errs = append(errs, errors.New("concurrency limits must not be negative"))
+	}
+
+	if c.LoadQueueSize < 0 {
+		errs = append(errs, errors.New("load queue size must not be negative"))
+	}
+
+	if c.LoadQueueTimeout <= 0 {
+		errs = append(errs, errors.New("load queue timeout must be positive"))
+	}
+
 	if c.UpstreamTimeout <= 0 {
 		errs = append(errs, errors.New("upstream timeout must be positive"))
 	}
 
+	if c.UpstreamParentMirror != "" {
+		if u, err := url.Parse(c.UpstreamParentMirror); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, errors.New("upstream parent mirror must be an http or https URL"))
+		}
+	}
+
+	if c.UpstreamProxy != "" {
+		if u, err := url.Parse(c.UpstreamProxy); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, errors.New("upstream proxy must be an http or https URL"))
+		}
+	}
+
+	if (c.UpstreamClientCertFile == "") != (c.UpstreamClientKeyFile == "") {
+		errs = append(errs, errors.New("upstream client certificate and key files must be set together"))
+	}
+
+	for _, host := range c.UpstreamAllowedHosts {
+		name := strings.TrimPrefix(host, "*.")
+		if name == "" || strings.ContainsAny(name, "*/?#@ ") {
+			errs = append(errs, fmt.Errorf("upstream allowed host must be a hostname or *.domain wildcard: %s", host))
+		}
+	}
+
+	for _, network := range c.UpstreamAllowedNetworks {
+		if !isIPOrCIDR(network) {
+			errs = append(errs, fmt.Errorf("upstream allowed network must be an IP address or CIDR: %s", network))
+		}
+	}
+
 	if c.MaxRetries < 0 {
 		errs = append(errs, errors.New("max retries must not be negative"))
 	}
 
+	if c.UpstreamRetryBudget < 0 {
+		errs = append(errs, errors.New("upstream retry budget must not be negative"))
+	}
+
+	if c.UpstreamBreakerThreshold < 0 {
+		errs = append(errs, errors.New("upstream breaker threshold must not be negative"))
+	}
+
+	if c.UpstreamBreakerThreshold > 0 && c.UpstreamBreakerOpenTimeout <= 0 {
+		errs = append(errs, errors.New("upstream breaker open timeout must be positive"))
+	}
+
 	if c.IndexTTL < 0 {
 		errs = append(errs, errors.New("index TTL must not be negative"))
 	}
 
+	if c.ReleaseCooldown < 0 {
+		errs = append(errs, errors.New("release cooldown must not be negative"))
+	}
+
+	for _, entry := range c.ReleaseCooldownOverrides {
+		_, value, ok := strings.Cut(entry, "=")
+		if d, err := time.ParseDuration(value); !ok || err != nil || d < 0 {
+			errs = append(errs, fmt.Errorf("release cooldown override %q must be provider=duration (e.g., hashicorp/aws=24h)", entry))
+		}
+	}
+
+	if c.ApprovalRequired && !c.AuthTokensEnabled() && c.TLSClientAuth != "optional" && c.TLSClientAuth != "required" {
+		errs = append(errs, errors.New("approval workflow requires auth tokens or TLS client auth to identify approvers"))
+	}
+
 	if c.CacheDir == "" {
 		errs = append(errs, errors.New("cache directory must not be empty"))
 	}
@@ -195,6 +617,33 @@ func (c *Config) Validate() error {
 		errs = append(errs, errors.New("log format must be json or text"))
 	}
 
+	validTracingExporters := map[string]bool{
+		"none":   true,
+		"otlp":   true,
+		"stdout": true,
+	}
+	if !validTracingExporters[c.TracingExporter] {
+		errs = append(errs, errors.New("tracing exporter must be none, otlp, or stdout"))
+	}
+
+	if c.TracingOTLPEndpoint != "" {
+		if u, err := url.Parse(c.TracingOTLPEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, errors.New("tracing OTLP endpoint must be an http or https URL"))
+		}
+	}
+
+	if c.TracingSampleRatio < 0 || c.TracingSampleRatio > 1 {
+		errs = append(errs, errors.New("tracing sample ratio must be between 0 and 1"))
+	}
+
+	if c.AuditLogMaxSizeMB < 1 {
+		errs = append(errs, errors.New("audit log max size must be at least 1 MB"))
+	}
+
+	if c.AuditLogMaxFiles < 0 {
+		errs = append(errs, errors.New("audit log max files must not be negative"))
+	}
+
 	validStorageTypes := map[string]bool{
 		"filesystem": true,
 		"memory":     true,
@@ -206,6 +655,50 @@ func (c *Config) Validate() error {
 	return errors.Join(errs...)
 }
 
+// TLSEnabled reports whether the server should serve HTTPS directly
+func (c *Config) TLSEnabled() bool {
+	return c.TLSCertFile != "" && c.TLSKeyFile != ""
+}
+
+// AuthTokensEnabled reports whether bearer-token authentication is configured
+func (c *Config) AuthTokensEnabled() bool {
+	return c.AuthTokensFile != "" || len(c.AuthTokenHashes) > 0
+}
+
+// ReleaseCooldownEnabled returns true if any provider has a release cooldown
+func (c *Config) ReleaseCooldownEnabled() bool {
+	return c.ReleaseCooldown > 0 || len(c.ReleaseCooldownOverrides) > 0
+}
+
+// isIPOrCIDR reports whether s is an IP address or a CIDR network
+func isIPOrCIDR(s string) bool {
+	if net.ParseIP(s) != nil {
+		return true
+	}
+	_, _, err := net.ParseCIDR(s)
+	return err == nil
+}
+
+// isSHA256Hash reports whether s is "sha256:" followed by a hex-encoded SHA-256 digest
+func isSHA256Hash(s string) bool {
+	digest, ok := strings.CutPrefix(s, "sha256:")
+	if !ok {
+		return false
+	}
+	decoded, err := hex.DecodeString(digest)
+	return err == nil && len(decoded) == sha256.Size
+}
+
+// isSecureCipherSuite reports whether name is a cipher suite Go considers secure
+func isSecureCipherSuite(name string) bool {
+	for _, suite := range tls.CipherSuites() {
+		if suite.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
 func setEnvInt(key string, target *int, errMsg string) error {
 	if v := os.Getenv(key); v != "" {
 		parsed, err := strconv.Atoi(v)
@@ -217,6 +710,18 @@ func setEnvInt(key string, target *int, errMsg string) error {
 	return nil
 }
 
+// setEnvFloat parses a finite number; NaN and infinities would slip past range checks
+func setEnvFloat(key string, target *float64, errMsg string) error {
+	if v := os.Getenv(key); v != "" {
+		parsed, err := strconv.ParseFloat(v, 64)
+		if err != nil || math.IsNaN(parsed) || math.IsInf(parsed, 0) {
+			return fmt.Errorf("%s %s", key, errMsg)
+		}
+		*target = parsed
+	}
+	return nil
+}
+
 func setEnvDuration(key string, target *time.Duration, errMsg string) error {
 	if v := os.Getenv(key); v != "" {
 		duration, err := time.ParseDuration(v)
@@ -239,3 +744,18 @@ func setEnvBool(key string, target *bool, errMsg string) error {
 
 	return nil
 }
+
+// setEnvList parses a comma-separated environment variable, ignoring empty entries
+func setEnvList(key string, target *[]string) {
+	v := os.Getenv(key)
+	if v == "" {
+		return
+	}
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	*target = items
+}
@@ -0,0 +1,146 @@
+package loadshed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrOverloaded is returned when a limiter has no free slot and its queue is full or the wait timed out
+var ErrOverloaded = errors.New("overloaded")
+
+// OverloadedError reports which limiter shed a request and when to retry
+type OverloadedError struct {
+	Limiter    string
+	RetryAfter time.Duration
+}
+
+func (e *OverloadedError) Error() string {
+	return fmt.Sprintf("%s: %s limit reached", ErrOverloaded, e.Limiter)
+}
+
+// Is makes OverloadedError match ErrOverloaded
+func (e *OverloadedError) Is(target error) bool {
+	return target == ErrOverloaded
+}
+
+// Limiter caps concurrent work. Callers beyond the cap wait in a bounded queue for up to
+// the queue timeout; when the queue is full they are rejected immediately.
+type Limiter struct {
+	name         string
+	slots        chan struct{}
+	queueSize    int
+	queueTimeout time.Duration
+
+	mu       sync.Mutex
+	queued   int
+	onChange func(inFlight, queued int)
+}
+
+// NewLimiter creates a limiter allowing maxConcurrent holders and queueSize waiters.
+// A queueSize of zero rejects callers as soon as every slot is taken.
+func NewLimiter(name string, maxConcurrent, queueSize int, queueTimeout time.Duration) *Limiter {
+	return &Limiter{
+		name:         name,
+		slots:        make(chan struct{}, maxConcurrent),
+		queueSize:    queueSize,
+		queueTimeout: queueTimeout,
+	}
+}
+
+// Name returns the limiter name used in errors and metrics
+func (l *Limiter) Name() string {
+	return l.name
+}
+
+// OnChange registers a function called with the in-flight and queued counts whenever they change
+func (l *Limiter) OnChange(fn func(inFlight, queued int)) {
+	l.mu.Lock()
+	l.onChange = fn
+	l.mu.Unlock()
+	l.notify()
+}
+
+// InFlight returns the number of callers holding a slot
+func (l *Limiter) InFlight() int {
+	return len(l.slots)
+}
+
+// Queued returns the number of callers waiting for a slot
+func (l *Limiter) Queued() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.queued
+}
+
+// RetryAfter suggests how long a rejected caller should wait before retrying
+func (l *Limiter) RetryAfter() time.Duration {
+	if l.queueTimeout > time.Second {
+		return l.queueTimeout
+	}
+	return time.Second
+}
+
+func (l *Limiter) notify() {
+	l.mu.Lock()
+	fn, queued := l.onChange, l.queued
+	l.mu.Unlock()
+	if fn != nil {
+		fn(len(l.slots), queued)
+	}
+}
+
+// Acquire takes a slot, waiting in the queue if necessary. The returned release function
+// must be called exactly once when the work is done. A nil limiter never blocks.
+func (l *Limiter) Acquire(ctx context.Context) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		l.notify()
+		return l.releaseFunc(), nil
+	default:
+	}
+
+	l.mu.Lock()
+	if l.queued >= l.queueSize {
+		l.mu.Unlock()
+		return nil, &OverloadedError{Limiter: l.name, RetryAfter: l.RetryAfter()}
+	}
+	l.queued++
+	l.mu.Unlock()
+	l.notify()
+
+	defer func() {
+		l.mu.Lock()
+		l.queued--
+		l.mu.Unlock()
+		l.notify()
+	}()
+
+	timer := time.NewTimer(l.queueTimeout)
+	defer timer.Stop()
+
+	select {
+	case l.slots <- struct{}{}:
+		return l.releaseFunc(), nil
+	case <-timer.C:
+		return nil, &OverloadedError{Limiter: l.name, RetryAfter: l.RetryAfter()}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (l *Limiter) releaseFunc() func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			<-l.slots
+			l.notify()
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package loadshed
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLimiter_RejectsWithoutQueue(t *testing.T) {
+	l := NewLimiter("downloads", 1, 0, time.Second)
+
+	release, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+
+	_, err = l.Acquire(context.Background())
+	if !errors.Is(err, ErrOverloaded) {
+		t.Fatalf("expected ErrOverloaded, got %v", err)
+	}
+	var overloaded *OverloadedError
+	if !errors.As(err, &overloaded) || overloaded.Limiter != "downloads" || overloaded.RetryAfter != time.Second {
+		t.Errorf("unexpected overloaded error: %+v", overloaded)
+	}
+
+	release()
+	release() // releasing twice must not free a second slot
+	if l.InFlight() != 0 {
+		t.Errorf("expected no slots in use, got %d", l.InFlight())
+	}
+}
+
+func TestLimiter_QueueWaitsForSlot(t *testing.T) {
+	l := NewLimiter("upstream", 1, 1, time.Second)
+
+	var mu sync.Mutex
+	var maxQueued int
+	l.OnChange(func(inFlight, queued int) {
+		mu.Lock()
+		maxQueued = max(maxQueued, queued)
+		mu.Unlock()
+	})
+
+	release, _ := l.Acquire(context.Background())
+
+	acquired := make(chan error, 1)
+	go func() {
+		r, err := l.Acquire(context.Background())
+		if err == nil {
+			r()
+		}
+		acquired <- err
+	}()
+
+	// Wait until the second caller is queued, then fill the queue
+	deadline := time.Now().Add(time.Second)
+	for l.Queued() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := l.Acquire(context.Background()); !errors.Is(err, ErrOverloaded) {
+		t.Errorf("expected full queue to reject, got %v", err)
+	}
+
+	release()
+	if err := <-acquired; err != nil {
+		t.Fatalf("queued caller failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if maxQueued != 1 {
+		t.Errorf("expected queue depth of 1 to be reported, got %d", maxQueued)
+	}
+}
+
+func TestLimiter_QueueTimeout(t *testing.T) {
+	l := NewLimiter("upstream", 1, 1, 20*time.Millisecond)
+	release, _ := l.Acquire(context.Background())
+	defer release()
+
+	if _, err := l.Acquire(context.Background()); !errors.Is(err, ErrOverloaded) {
+		t.Errorf("expected timeout to shed the request, got %v", err)
+	}
+	if l.Queued() != 0 {
+		t.Errorf("expected queue to be empty after timeout, got %d", l.Queued())
+	}
+}
+
+func TestLimiter_ContextCancelled(t *testing.T) {
+	l := NewLimiter("upstream", 1, 1, time.Minute)
+	release, _ := l.Acquire(context.Background())
+	defer release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := l.Acquire(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestLimiter_Nil(t *testing.T) {
+	var l *Limiter
+	release, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("nil limiter should never fail: %v", err)
+	}
+	release()
+}
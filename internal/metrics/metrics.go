@@ -18,13 +18,15 @@ type Metrics struct {
 	HTTPResponseSize    prometheus.HistogramVec
 
 	// Cache metrics
-	CacheHitsTotal   prometheus.CounterVec
-	CacheMissesTotal prometheus.CounterVec
+	CacheHitsTotal    prometheus.CounterVec
+	CacheMissesTotal  prometheus.CounterVec
+	CacheLookupsTotal prometheus.CounterVec
 
 	// Upstream metrics
-	UpstreamRequestsTotal   prometheus.CounterVec
-	UpstreamRequestDuration prometheus.HistogramVec
-	UpstreamErrors          prometheus.CounterVec
+	UpstreamRequestsTotal       prometheus.CounterVec
+	UpstreamRequestDuration     prometheus.HistogramVec
+	UpstreamHTTPRequestDuration prometheus.HistogramVec
+	UpstreamErrors              prometheus.CounterVec
 
 	// Storage metrics
 	StorageOperationsTotal   prometheus.CounterVec
@@ -32,6 +34,36 @@ type Metrics struct {
 
 	// Error metrics
 	ErrorsTotal prometheus.CounterVec
+
+	// Auth metrics
+	AuthFailuresTotal prometheus.CounterVec
+	AuthzDenialsTotal prometheus.CounterVec
+
+	// Provider policy metrics
+	PolicyDenialsTotal prometheus.CounterVec
+
+	// Rate limiting metrics
+	RateLimitedTotal prometheus.CounterVec
+
+	// Load shedding metrics
+	LoadInFlight   prometheus.GaugeVec
+	LoadQueueDepth prometheus.GaugeVec
+	LoadShedTotal  prometheus.CounterVec
+
+	// Upstream protection metrics
+	UpstreamBlockedTotal prometheus.CounterVec
+
+	// Upstream circuit breaker metrics
+	UpstreamCircuitState       prometheus.GaugeVec
+	UpstreamCircuitTransitions prometheus.CounterVec
+
+	// Upstream source failover metrics
+	UpstreamSourceHealthy  prometheus.GaugeVec
+	UpstreamSourceRequests prometheus.CounterVec
+
+	// Bandwidth metrics
+	UpstreamBytesTotal    prometheus.CounterVec
+	CacheServedBytesTotal prometheus.CounterVec
 }
 
 // New creates and registers all metrics
@@ -89,10 +121,18 @@ func New() *Metrics {
 			[]string{"cache_type"},
 		),
 
+		CacheLookupsTotal: *promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "specular_cache_lookups_total",
+				Help: "Total number of cache lookups by how the request was satisfied (hit, stale, built, miss, coalesced)",
+			},
+			[]string{"cache_type", "status"},
+		),
+
 		UpstreamRequestsTotal: *promauto.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "specular_upstream_requests_total",
-				Help: "Total number of upstream registry requests",
+				Help: "Total number of HTTP requests sent to upstream registries, including retries",
 			},
 			[]string{"status"},
 		),
@@ -100,12 +140,21 @@ func New() *Metrics {
 		UpstreamRequestDuration: *promauto.NewHistogramVec(
 			prometheus.HistogramOpts{
 				Name:    "specular_upstream_request_duration_seconds",
-				Help:    "Upstream request duration in seconds",
+				Help:    "Duration in seconds of requests answered with an upstream fetch, by resource type",
 				Buckets: prometheus.DefBuckets,
 			},
 			[]string{"endpoint"},
 		),
 
+		UpstreamHTTPRequestDuration: *promauto.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "specular_upstream_http_request_duration_seconds",
+				Help:    "Duration in seconds of HTTP requests sent to upstream registries, by configured host or \"other\"",
+				Buckets: prometheus.DefBuckets,
+			},
+			[]string{"host"},
+		),
+
 		UpstreamErrors: *promauto.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "specular_upstream_errors_total",
@@ -138,6 +187,118 @@ func New() *Metrics {
 			},
 			[]string{"component", "error_type"},
 		),
+
+		AuthFailuresTotal: *promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "specular_auth_failures_total",
+				Help: "Total number of rejected unauthenticated requests",
+			},
+			[]string{"route_group", "reason"},
+		),
+
+		AuthzDenialsTotal: *promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "specular_authz_denials_total",
+				Help: "Total number of requests denied by the authorization policy",
+			},
+			[]string{"action"},
+		),
+
+		PolicyDenialsTotal: *promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "specular_policy_denials_total",
+				Help: "Total number of requests for providers forbidden by the provider policy",
+			},
+			[]string{"resource_type"},
+		),
+
+		RateLimitedTotal: *promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "specular_rate_limited_total",
+				Help: "Total number of requests rejected by per-client rate limiting",
+			},
+			[]string{"route_class"},
+		),
+
+		LoadInFlight: *promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "specular_load_in_flight",
+				Help: "Number of requests holding a concurrency slot",
+			},
+			[]string{"limiter"},
+		),
+
+		LoadQueueDepth: *promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "specular_load_queue_depth",
+				Help: "Number of requests waiting for a concurrency slot",
+			},
+			[]string{"limiter"},
+		),
+
+		LoadShedTotal: *promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "specular_load_shed_total",
+				Help: "Total number of requests rejected because a concurrency limit and its queue were full",
+			},
+			[]string{"limiter"},
+		),
+
+		UpstreamBlockedTotal: *promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "specular_upstream_blocked_total",
+				Help: "Total number of upstream requests refused by the hostname allowlist or private network blocking",
+			},
+			[]string{"reason"},
+		),
+
+		UpstreamCircuitState: *promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "specular_upstream_circuit_state",
+				Help: "Circuit breaker state per upstream host (0 closed, 1 half-open, 2 open)",
+			},
+			[]string{"host"},
+		),
+
+		UpstreamCircuitTransitions: *promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "specular_upstream_circuit_transitions_total",
+				Help: "Total number of circuit breaker state changes per upstream host",
+			},
+			[]string{"host", "state"},
+		),
+
+		UpstreamSourceHealthy: *promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "specular_upstream_source_healthy",
+				Help: "Whether the last fetch from a configured upstream source succeeded (1) or failed (0)",
+			},
+			[]string{"hostname", "source"},
+		),
+
+		UpstreamSourceRequests: *promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "specular_upstream_source_requests_total",
+				Help: "Total number of fetches from configured upstream sources by result",
+			},
+			[]string{"hostname", "source", "result"},
+		),
+
+		UpstreamBytesTotal: *promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "specular_upstream_bytes_total",
+				Help: "Total number of bytes downloaded from upstream per provider",
+			},
+			[]string{"hostname", "provider"},
+		),
+
+		CacheServedBytesTotal: *promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "specular_cache_served_bytes_total",
+				Help: "Total number of bytes served to clients without an upstream download per provider",
+			},
+			[]string{"hostname", "provider"},
+		),
 	}
 
 	return m
@@ -162,10 +323,39 @@ func (m *Metrics) RecordCacheMiss(cacheType string) {
 	m.CacheMissesTotal.WithLabelValues(cacheType).Inc()
 }
 
-// RecordUpstreamRequest records an upstream request
-func (m *Metrics) RecordUpstreamRequest(status int, duration float64, endpoint string) {
-	statusStr := fmt.Sprintf("%d", status)
+// RecordCacheStatus records how a request was satisfied, counting it as a hit or a miss
+func (m *Metrics) RecordCacheStatus(cacheType, status string, hit bool) {
+	if !m.enabled {
+		return
+	}
+	m.CacheLookupsTotal.WithLabelValues(cacheType, status).Inc()
+	if hit {
+		m.RecordCacheHit(cacheType)
+	} else {
+		m.RecordCacheMiss(cacheType)
+	}
+}
+
+// RecordUpstreamRequest records an HTTP request sent to an upstream host
+// A status of 0 means no response was received and is recorded as "error"
+func (m *Metrics) RecordUpstreamRequest(status int, duration float64, host string) {
+	if !m.enabled {
+		return
+	}
+	statusStr := "error"
+	if status != 0 {
+		statusStr = fmt.Sprintf("%d", status)
+	}
 	m.UpstreamRequestsTotal.WithLabelValues(statusStr).Inc()
+	m.UpstreamHTTPRequestDuration.WithLabelValues(host).Observe(duration)
+}
+
+// RecordUpstreamFetch records how long a request of the given resource type (the endpoint)
+// took to answer from upstream
+func (m *Metrics) RecordUpstreamFetch(endpoint string, duration float64) {
+	if !m.enabled {
+		return
+	}
 	m.UpstreamRequestDuration.WithLabelValues(endpoint).Observe(duration)
 }
 
@@ -185,6 +375,115 @@ func (m *Metrics) RecordError(component, errorType string) {
 	m.ErrorsTotal.WithLabelValues(component, errorType).Inc()
 }
 
+// RecordAuthFailure records a request rejected for missing or invalid credentials
+func (m *Metrics) RecordAuthFailure(routeGroup, reason string) {
+	if !m.enabled {
+		return
+	}
+	m.AuthFailuresTotal.WithLabelValues(routeGroup, reason).Inc()
+}
+
+// RecordAuthzDenial records a request denied by the authorization policy
+func (m *Metrics) RecordAuthzDenial(action string) {
+	if !m.enabled {
+		return
+	}
+	m.AuthzDenialsTotal.WithLabelValues(action).Inc()
+}
+
+// RecordPolicyDenial records a request for a provider forbidden by the provider policy
+func (m *Metrics) RecordPolicyDenial(resourceType string) {
+	if !m.enabled {
+		return
+	}
+	m.PolicyDenialsTotal.WithLabelValues(resourceType).Inc()
+}
+
+// RecordRateLimited records a request rejected because its client exceeded the rate limit
+func (m *Metrics) RecordRateLimited(routeClass string) {
+	if !m.enabled {
+		return
+	}
+	m.RateLimitedTotal.WithLabelValues(routeClass).Inc()
+}
+
+// SetLoad records the in-flight and queued counts of a concurrency limiter
+func (m *Metrics) SetLoad(limiter string, inFlight, queued int) {
+	if !m.enabled {
+		return
+	}
+	m.LoadInFlight.WithLabelValues(limiter).Set(float64(inFlight))
+	m.LoadQueueDepth.WithLabelValues(limiter).Set(float64(queued))
+}
+
+// RecordLoadShed records a request rejected by a concurrency limiter
+func (m *Metrics) RecordLoadShed(limiter string) {
+	if !m.enabled {
+		return
+	}
+	m.LoadShedTotal.WithLabelValues(limiter).Inc()
+}
+
+// RecordUpstreamBlocked records an upstream request refused to protect internal networks
+func (m *Metrics) RecordUpstreamBlocked(reason string) {
+	if !m.enabled {
+		return
+	}
+	m.UpstreamBlockedTotal.WithLabelValues(reason).Inc()
+}
+
+// RecordCircuitTransition records an upstream host's circuit breaker entering a new state
+func (m *Metrics) RecordCircuitTransition(host, state string) {
+	if !m.enabled {
+		return
+	}
+	value := 0.0
+	switch state {
+	case "half_open":
+		value = 1
+	case "open":
+		value = 2
+	}
+	m.UpstreamCircuitState.WithLabelValues(host).Set(value)
+	m.UpstreamCircuitTransitions.WithLabelValues(host, state).Inc()
+}
+
+// ForgetCircuit removes the circuit breaker series of an upstream host no longer tracked
+func (m *Metrics) ForgetCircuit(host string) {
+	if !m.enabled {
+		return
+	}
+	m.UpstreamCircuitState.DeleteLabelValues(host)
+	m.UpstreamCircuitTransitions.DeletePartialMatch(prometheus.Labels{"host": host})
+}
+
+// RecordUpstreamSource records a fetch from one of a hostname's configured upstream sources
+func (m *Metrics) RecordUpstreamSource(hostname, source string, ok bool) {
+	if !m.enabled {
+		return
+	}
+	healthy, result := 0.0, "failure"
+	if ok {
+		healthy, result = 1, "success"
+	}
+	m.UpstreamSourceHealthy.WithLabelValues(hostname, source).Set(healthy)
+	m.UpstreamSourceRequests.WithLabelValues(hostname, source, result).Inc()
+}
+
+// RecordBandwidth records bytes of a provider downloaded from upstream or served from cache
+// The source is "upstream" or "cache"; the provider is "namespace/type", or empty with an empty
+// hostname for bytes of failed upstream fetches
+func (m *Metrics) RecordBandwidth(hostname, provider, source string, bytes int64) {
+	if !m.enabled {
+		return
+	}
+	if source == "upstream" {
+		m.UpstreamBytesTotal.WithLabelValues(hostname, provider).Add(float64(bytes))
+	} else {
+		m.CacheServedBytesTotal.WithLabelValues(hostname, provider).Add(float64(bytes))
+	}
+}
+
 // Noop returns a no-op metrics instance that does nothing
 // Use this when metrics are disabled to avoid nil pointer checks everywhere
 func Noop() *Metrics {
@@ -0,0 +1,103 @@
+package mirror
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// UpstreamAlias redirects upstream fetches for a hostname, optionally limited to one namespace.
+// Exactly one of DiscoveryHost and BaseURL is set.
+type UpstreamAlias struct {
+	Hostname  string
+	Namespace string // empty matches every namespace
+	// DiscoveryHost is a registry host whose service discovery is used instead
+	DiscoveryHost string
+	// BaseURL is a providers.v1 endpoint used directly, without service discovery
+	BaseURL string
+}
+
+// UpstreamAliases maps requested provider addresses to the upstream actually fetched from.
+// Requested addresses are still used for cache keys and generated URLs.
+// A nil *UpstreamAliases maps every address to itself.
+type UpstreamAliases struct {
+	rules []UpstreamAlias
+}
+
+// ParseUpstreamAliases parses "hostname[/namespace]=target" entries, where target is either
+// a discovery hostname (e.g., "artifactory.corp.example.com") or an http(s) providers.v1 base URL
+func ParseUpstreamAliases(entries []string) (*UpstreamAliases, error) {
+	aliases := &UpstreamAliases{}
+	seen := make(map[string]bool)
+
+	for _, entry := range entries {
+		source, target, ok := strings.Cut(entry, "=")
+		source, target = strings.TrimSpace(source), strings.TrimSpace(target)
+		if !ok || source == "" || target == "" {
+			return nil, fmt.Errorf("invalid upstream alias %q: expected hostname[/namespace]=target", entry)
+		}
+
+		hostname, namespace, _ := strings.Cut(source, "/")
+		if hostname == "" || strings.Contains(namespace, "/") {
+			return nil, fmt.Errorf("invalid upstream alias source %q: expected hostname or hostname/namespace", source)
+		}
+
+		key := strings.ToLower(source)
+		if seen[key] {
+			return nil, fmt.Errorf("duplicate upstream alias for %s", source)
+		}
+		seen[key] = true
+
+		alias := UpstreamAlias{Hostname: strings.ToLower(hostname), Namespace: namespace}
+		if strings.Contains(target, "://") {
+			u, err := url.Parse(target)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return nil, fmt.Errorf("invalid upstream alias target %q: base URLs must be absolute http or https URLs", target)
+			}
+			alias.BaseURL = strings.TrimSuffix(target, "/")
+		} else {
+			if strings.ContainsAny(target, "/?#") {
+				return nil, fmt.Errorf("invalid upstream alias target %q: expected a hostname or URL", target)
+			}
+			alias.DiscoveryHost = strings.ToLower(target)
+		}
+
+		aliases.rules = append(aliases.rules, alias)
+	}
+
+	return aliases, nil
+}
+
+// Len returns the number of configured aliases
+func (a *UpstreamAliases) Len() int {
+	if a == nil {
+		return 0
+	}
+	return len(a.rules)
+}
+
+// resolve returns the alias for a provider address; namespace-specific rules win over hostname-wide ones
+func (a *UpstreamAliases) resolve(hostname, namespace string) (UpstreamAlias, bool) {
+	if a == nil {
+		return UpstreamAlias{}, false
+	}
+
+	hostname = strings.ToLower(hostname)
+	var hostWide *UpstreamAlias
+	for i := range a.rules {
+		rule := &a.rules[i]
+		if rule.Hostname != hostname {
+			continue
+		}
+		if rule.Namespace == "" {
+			hostWide = rule
+		} else if strings.EqualFold(rule.Namespace, namespace) {
+			return *rule, true
+		}
+	}
+
+	if hostWide != nil {
+		return *hostWide, true
+	}
+	return UpstreamAlias{}, false
+}
@@ -0,0 +1,103 @@
+package mirror
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/elisiariocouto/specular/internal/storage"
+)
+
+func TestParseUpstreamAliases(t *testing.T) {
+	aliases, err := ParseUpstreamAliases([]string{
+		"registry.terraform.io=artifactory.corp.example.com",
+		"registry.terraform.io/ourcorp=https://tfe.corp.example.com/api/registry/v1/providers/",
+	})
+	if err != nil {
+		t.Fatalf("ParseUpstreamAliases failed: %v", err)
+	}
+
+	alias, ok := aliases.resolve("Registry.Terraform.io", "hashicorp")
+	if !ok || alias.DiscoveryHost != "artifactory.corp.example.com" {
+		t.Errorf("expected hostname-wide alias, got %+v (%t)", alias, ok)
+	}
+
+	alias, ok = aliases.resolve("registry.terraform.io", "ourcorp")
+	if !ok || alias.BaseURL != "https://tfe.corp.example.com/api/registry/v1/providers" {
+		t.Errorf("expected namespace alias to take precedence, got %+v (%t)", alias, ok)
+	}
+
+	if _, ok := aliases.resolve("example.com", "hashicorp"); ok {
+		t.Error("expected no alias for an unmapped hostname")
+	}
+
+	var none *UpstreamAliases
+	if _, ok := none.resolve("registry.terraform.io", "hashicorp"); ok {
+		t.Error("expected nil aliases to resolve nothing")
+	}
+}
+
+func TestParseUpstreamAliases_Invalid(t *testing.T) {
+	tests := []string{
+		"registry.terraform.io",
+		"=artifactory.corp.example.com",
+		"registry.terraform.io/a/b=artifactory.corp.example.com",
+		"registry.terraform.io=ftp://artifactory.corp.example.com",
+		"registry.terraform.io=artifactory.corp.example.com/path",
+	}
+
+	for _, entry := range tests {
+		if _, err := ParseUpstreamAliases([]string{entry}); err == nil {
+			t.Errorf("expected error for %q", entry)
+		}
+	}
+
+	if _, err := ParseUpstreamAliases([]string{"example.com=a.example.com", "EXAMPLE.com=b.example.com"}); err == nil {
+		t.Error("expected error for duplicate aliases")
+	}
+}
+
+// TestAlias_KeepsRequestedAddress tests that aliased providers are fetched from the alias target
+// while being cached and served under the requested hostname
+func TestAlias_KeepsRequestedAddress(t *testing.T) {
+	tests := []struct {
+		name   string
+		target func(host, url string) string
+	}{
+		{name: "discovery host", target: func(host, _ string) string { return host }},
+		{name: "base URL", target: func(_, url string) string { return url + "/v1/providers/" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, upstreamHost, setVersions := newVersionsUpstream(t)
+			setVersions("1.0.0")
+
+			aliases, err := ParseUpstreamAliases([]string{"registry.terraform.io/hashicorp=" + tt.target(upstreamHost, server.URL)})
+			if err != nil {
+				t.Fatalf("ParseUpstreamAliases failed: %v", err)
+			}
+			upstream := newTestUpstreamClientForMirror(server)
+			upstream.aliases = aliases
+
+			store := storage.NewMemoryStorage()
+			m := NewMirror(store, upstream, "http://localhost:8080", 0, Options{})
+			ctx := context.Background()
+
+			if _, err := m.GetIndex(ctx, "registry.terraform.io", "hashicorp", "aws"); err != nil {
+				t.Fatalf("GetIndex failed: %v", err)
+			}
+			if _, err := store.GetIndex(ctx, "registry.terraform.io", "hashicorp", "aws"); err != nil {
+				t.Errorf("expected index cached under the requested hostname: %v", err)
+			}
+
+			data, err := m.GetVersion(ctx, "registry.terraform.io", "hashicorp", "aws", "1.0.0")
+			if err != nil {
+				t.Fatalf("GetVersion failed: %v", err)
+			}
+			if !strings.Contains(string(data), "http://localhost:8080/terraform/providers/download/registry.terraform.io/hashicorp/aws/1.0.0/linux/amd64/") {
+				t.Errorf("expected generated URLs to use the requested hostname, got %s", data)
+			}
+		})
+	}
+}
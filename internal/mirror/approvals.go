@@ -0,0 +1,189 @@
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"time"
+)
+
+// Approval states of a provider version
+const (
+	// ApprovalPending marks a newly discovered version awaiting an admin decision
+	ApprovalPending = "pending"
+	// ApprovalApproved marks a version an admin allowed to be served
+	ApprovalApproved = "approved"
+	// ApprovalRejected marks a version an admin refused to serve
+	ApprovalRejected = "rejected"
+)
+
+// ErrApprovalsUnavailable is returned when approvals are required but storage cannot persist them
+var ErrApprovalsUnavailable = errors.New("storage does not support approval records")
+
+// VersionApproval is the approval record of a single provider version
+type VersionApproval struct {
+	Version      string     `json:"version"`
+	State        string     `json:"state"`
+	DiscoveredAt time.Time  `json:"discovered_at"`
+	DecidedBy    string     `json:"decided_by,omitempty"`
+	DecidedAt    *time.Time `json:"decided_at,omitempty"`
+}
+
+// providerApprovals is the persisted approval document of a provider.
+// Versions without a record predate the approval workflow and are served.
+type providerApprovals struct {
+	Versions map[string]*VersionApproval `json:"versions"`
+}
+
+// approvalsKey returns the metadata key of a provider's approval document
+func approvalsKey(hostname, namespace, providerType string) string {
+	return fmt.Sprintf("approvals/%s/%s/%s", hostname, namespace, providerType)
+}
+
+// loadApprovals reads a provider's approval document; a missing document is empty
+func (m *Mirror) loadApprovals(ctx context.Context, hostname, namespace, providerType string) (*providerApprovals, error) {
+	if m.metadata == nil {
+		return nil, ErrApprovalsUnavailable
+	}
+
+	approvals := &providerApprovals{Versions: make(map[string]*VersionApproval)}
+	data, err := m.metadata.GetMetadata(ctx, approvalsKey(hostname, namespace, providerType))
+	if errors.Is(err, io.EOF) {
+		return approvals, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read approvals: %w", err)
+	}
+	if err := json.Unmarshal(data, approvals); err != nil {
+		return nil, fmt.Errorf("failed to parse approvals: %w", err)
+	}
+	if approvals.Versions == nil {
+		approvals.Versions = make(map[string]*VersionApproval)
+	}
+	return approvals, nil
+}
+
+// saveApprovals persists a provider's approval document
+func (m *Mirror) saveApprovals(ctx context.Context, hostname, namespace, providerType string, approvals *providerApprovals) error {
+	data, err := json.Marshal(approvals)
+	if err != nil {
+		return fmt.Errorf("failed to marshal approvals: %w", err)
+	}
+	if err := m.metadata.PutMetadata(ctx, approvalsKey(hostname, namespace, providerType), data); err != nil {
+		return fmt.Errorf("failed to store approvals: %w", err)
+	}
+	return nil
+}
+
+// recordPending puts newly discovered versions into the pending state
+func (m *Mirror) recordPending(ctx context.Context, hostname, namespace, providerType string, versions []string, now time.Time) error {
+	m.approvalsMu.Lock()
+	defer m.approvalsMu.Unlock()
+
+	approvals, err := m.loadApprovals(ctx, hostname, namespace, providerType)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range versions {
+		if _, ok := approvals.Versions[v]; ok {
+			continue
+		}
+		approvals.Versions[v] = &VersionApproval{Version: v, State: ApprovalPending, DiscoveredAt: now}
+		slog.Info(fmt.Sprintf("new version awaiting approval [hostname=%s namespace=%s type=%s version=%s]",
+			hostname, namespace, providerType, v),
+			"hostname", hostname, "namespace", namespace, "type", providerType, "version", v)
+	}
+
+	return m.saveApprovals(ctx, hostname, namespace, providerType, approvals)
+}
+
+// unapprovedVersions returns the versions of a provider that are pending or rejected
+func (m *Mirror) unapprovedVersions(ctx context.Context, hostname, namespace, providerType string) (map[string]bool, error) {
+	if !m.requireApproval {
+		return nil, nil
+	}
+
+	approvals, err := m.loadApprovals(ctx, hostname, namespace, providerType)
+	if err != nil {
+		return nil, err
+	}
+
+	unapproved := make(map[string]bool)
+	for v, record := range approvals.Versions {
+		if record.State != ApprovalApproved {
+			unapproved[v] = true
+		}
+	}
+	return unapproved, nil
+}
+
+// PendingVersions lists the versions of a provider awaiting approval, oldest first
+func (m *Mirror) PendingVersions(ctx context.Context, hostname, namespace, providerType string) ([]VersionApproval, error) {
+	approvals, err := m.loadApprovals(ctx, hostname, namespace, providerType)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := make([]VersionApproval, 0)
+	for _, record := range approvals.Versions {
+		if record.State == ApprovalPending {
+			pending = append(pending, *record)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		if !pending[i].DiscoveredAt.Equal(pending[j].DiscoveredAt) {
+			return pending[i].DiscoveredAt.Before(pending[j].DiscoveredAt)
+		}
+		return pending[i].Version < pending[j].Version
+	})
+	return pending, nil
+}
+
+// ApproveVersion allows a version to be served and records who approved it
+func (m *Mirror) ApproveVersion(ctx context.Context, hostname, namespace, providerType, version, approver string) (*VersionApproval, error) {
+	return m.decideVersion(ctx, hostname, namespace, providerType, version, approver, ApprovalApproved)
+}
+
+// RejectVersion keeps a version hidden and records who rejected it
+func (m *Mirror) RejectVersion(ctx context.Context, hostname, namespace, providerType, version, approver string) (*VersionApproval, error) {
+	return m.decideVersion(ctx, hostname, namespace, providerType, version, approver, ApprovalRejected)
+}
+
+// decideVersion records an approval decision for a version with an approval record.
+// Returns ErrNotFound if the version was never put up for approval.
+func (m *Mirror) decideVersion(ctx context.Context, hostname, namespace, providerType, version, approver, state string) (*VersionApproval, error) {
+	m.approvalsMu.Lock()
+	defer m.approvalsMu.Unlock()
+
+	approvals, err := m.loadApprovals(ctx, hostname, namespace, providerType)
+	if err != nil {
+		return nil, err
+	}
+
+	record, ok := approvals.Versions[version]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	now := time.Now().UTC()
+	record.State = state
+	record.DecidedBy = approver
+	record.DecidedAt = &now
+
+	if err := m.saveApprovals(ctx, hostname, namespace, providerType, approvals); err != nil {
+		return nil, err
+	}
+
+	slog.Info(fmt.Sprintf("version %s [hostname=%s namespace=%s type=%s version=%s approver=%s]",
+		state, hostname, namespace, providerType, version, approver),
+		"hostname", hostname, "namespace", namespace, "type", providerType, "version", version,
+		"state", state, "approver", approver)
+
+	result := *record
+	return &result, nil
+}
@@ -0,0 +1,165 @@
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/elisiariocouto/specular/internal/storage"
+)
+
+// newVersionsUpstream starts a registry serving service discovery and a versions listing
+// that can be changed between refreshes. It returns the server and its hostname.
+func newVersionsUpstream(t *testing.T) (*httptest.Server, string, func(versions ...string)) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var current []string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/.well-known/terraform.json":
+			w.Write([]byte(`{"providers.v1":"/v1/providers/"}`))
+		case "/v1/providers/hashicorp/aws/versions":
+			mu.Lock()
+			resp := RegistryVersionsResponse{}
+			for _, v := range current {
+				resp.Versions = append(resp.Versions, RegistryVersion{
+					Version:   v,
+					Platforms: []RegistryPlatform{{OS: "linux", Arch: "amd64"}},
+				})
+			}
+			mu.Unlock()
+			json.NewEncoder(w).Encode(resp)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	u, _ := url.Parse(server.URL)
+	setVersions := func(versions ...string) {
+		mu.Lock()
+		current = versions
+		mu.Unlock()
+	}
+	return server, u.Host, setVersions
+}
+
+func indexVersions(t *testing.T, data []byte) map[string]VersionInfo {
+	t.Helper()
+	var index IndexResponse
+	if err := json.Unmarshal(data, &index); err != nil {
+		t.Fatalf("failed to parse index: %v", err)
+	}
+	return index.Versions
+}
+
+// TestApproval_Workflow tests that versions discovered on refresh stay hidden until approved
+func TestApproval_Workflow(t *testing.T) {
+	server, hostname, setVersions := newVersionsUpstream(t)
+	store := storage.NewMemoryStorage()
+	m := NewMirror(store, newTestUpstreamClientForMirror(server), "http://localhost:8080", 0,
+		Options{RequireApproval: true})
+	ctx := context.Background()
+
+	// Versions in the first listing are served without approval
+	setVersions("1.0.0")
+	data, err := m.GetIndex(ctx, hostname, "hashicorp", "aws")
+	if err != nil {
+		t.Fatalf("GetIndex failed: %v", err)
+	}
+	if _, ok := indexVersions(t, data)["1.0.0"]; !ok {
+		t.Fatalf("expected 1.0.0 in first listing, got %s", data)
+	}
+
+	// A refresh discovers 1.1.0, which goes into the pending state
+	setVersions("1.0.0", "1.1.0")
+	if _, err := m.fetchAndCacheIndex(ctx, hostname, "hashicorp", "aws"); err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+
+	data, err = m.GetIndex(ctx, hostname, "hashicorp", "aws")
+	if err != nil {
+		t.Fatalf("GetIndex failed: %v", err)
+	}
+	if _, ok := indexVersions(t, data)["1.1.0"]; ok {
+		t.Errorf("expected pending 1.1.0 to be hidden, got %s", data)
+	}
+	if _, err := m.GetVersion(ctx, hostname, "hashicorp", "aws", "1.1.0"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound for pending version, got %v", err)
+	}
+
+	pending, err := m.PendingVersions(ctx, hostname, "hashicorp", "aws")
+	if err != nil {
+		t.Fatalf("PendingVersions failed: %v", err)
+	}
+	if len(pending) != 1 || pending[0].Version != "1.1.0" || pending[0].State != ApprovalPending {
+		t.Fatalf("unexpected pending versions: %+v", pending)
+	}
+
+	// Approving records the approver and makes the version visible
+	record, err := m.ApproveVersion(ctx, hostname, "hashicorp", "aws", "1.1.0", "alice")
+	if err != nil {
+		t.Fatalf("ApproveVersion failed: %v", err)
+	}
+	if record.State != ApprovalApproved || record.DecidedBy != "alice" || record.DecidedAt == nil {
+		t.Errorf("unexpected approval record: %+v", record)
+	}
+
+	data, err = m.GetIndex(ctx, hostname, "hashicorp", "aws")
+	if err != nil {
+		t.Fatalf("GetIndex failed: %v", err)
+	}
+	if _, ok := indexVersions(t, data)["1.1.0"]; !ok {
+		t.Errorf("expected approved 1.1.0 in index, got %s", data)
+	}
+
+	// Rejected versions stay hidden and leave the pending list
+	setVersions("1.0.0", "1.1.0", "1.2.0")
+	if _, err := m.fetchAndCacheIndex(ctx, hostname, "hashicorp", "aws"); err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	if _, err := m.RejectVersion(ctx, hostname, "hashicorp", "aws", "1.2.0", "bob"); err != nil {
+		t.Fatalf("RejectVersion failed: %v", err)
+	}
+
+	data, _ = m.GetIndex(ctx, hostname, "hashicorp", "aws")
+	if _, ok := indexVersions(t, data)["1.2.0"]; ok {
+		t.Errorf("expected rejected 1.2.0 to be hidden, got %s", data)
+	}
+	if pending, _ := m.PendingVersions(ctx, hostname, "hashicorp", "aws"); len(pending) != 0 {
+		t.Errorf("expected no pending versions, got %+v", pending)
+	}
+
+	// Decisions are persisted in storage and survive a new mirror instance
+	restarted := NewMirror(store, newTestUpstreamClientForMirror(server), "http://localhost:8080", 0,
+		Options{RequireApproval: true})
+	if _, err := restarted.GetVersion(ctx, hostname, "hashicorp", "aws", "1.2.0"); err != ErrNotFound {
+		t.Errorf("expected rejected version to stay hidden after restart, got %v", err)
+	}
+}
+
+// TestApproval_UnknownVersion tests that only versions put up for approval can be decided
+func TestApproval_UnknownVersion(t *testing.T) {
+	m := NewMirror(storage.NewMemoryStorage(), nil, "http://localhost:8080", 0, Options{RequireApproval: true})
+
+	if _, err := m.ApproveVersion(context.Background(), "registry.terraform.io", "hashicorp", "aws", "9.9.9", "alice"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+// TestApproval_RequiresMetadataStore tests that approvals fail closed without persistent records
+func TestApproval_RequiresMetadataStore(t *testing.T) {
+	mockStorage := NewMockStorage()
+	mockStorage.PutIndex(context.Background(), "registry.terraform.io", "hashicorp", "aws", []byte(`{"versions":{"1.0.0":{}}}`))
+	m := NewMirror(mockStorage, nil, "http://localhost:8080", 0, Options{RequireApproval: true})
+
+	if _, err := m.GetIndex(context.Background(), "registry.terraform.io", "hashicorp", "aws"); err != ErrApprovalsUnavailable {
+		t.Errorf("expected ErrApprovalsUnavailable, got %v", err)
+	}
+}
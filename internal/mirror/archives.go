@@ -0,0 +1,76 @@
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+)
+
+// upstreamArchives records where each platform archive of a version lives upstream.
+// Version documents served to clients point at this mirror, so the original
+// absolute URLs are kept separately for mirror protocol upstreams.
+type upstreamArchives struct {
+	URLs map[string]string `json:"urls"` // platform key -> absolute archive URL
+}
+
+// archiveURLsKey returns the metadata key of a version's upstream archive URLs
+func archiveURLsKey(hostname, namespace, providerType, version string) string {
+	return fmt.Sprintf("archive-urls/%s/%s/%s/%s", hostname, namespace, providerType, version)
+}
+
+// saveArchiveURLs persists the upstream archive URLs of a version document
+// Storage without metadata support skips this; archive URLs are then looked up upstream on download
+func (m *Mirror) saveArchiveURLs(ctx context.Context, hostname, namespace, providerType, version string, response *VersionResponse) {
+	if m.metadata == nil || len(response.Archives) == 0 {
+		return
+	}
+
+	archives := upstreamArchives{URLs: make(map[string]string, len(response.Archives))}
+	for platform, archive := range response.Archives {
+		// Registry sources only give filenames; their archives are located through FetchDownloadURL
+		if u, err := url.Parse(archive.URL); err == nil && u.IsAbs() {
+			archives.URLs[platform] = archive.URL
+		}
+	}
+	if len(archives.URLs) == 0 {
+		return
+	}
+
+	data, err := json.Marshal(archives)
+	if err == nil {
+		err = m.metadata.PutMetadata(ctx, archiveURLsKey(hostname, namespace, providerType, version), data)
+	}
+	if err != nil {
+		slog.Warn(fmt.Sprintf("failed to store upstream archive URLs [hostname=%s namespace=%s type=%s version=%s err=%s]",
+			hostname, namespace, providerType, version, err),
+			"hostname", hostname, "namespace", namespace, "type", providerType, "version", version, "err", err)
+	}
+}
+
+// upstreamArchiveURL returns the persisted upstream URL of a platform archive, if known
+func (m *Mirror) upstreamArchiveURL(ctx context.Context, hostname, namespace, providerType, version, os, arch string) (string, bool) {
+	if m.metadata == nil {
+		return "", false
+	}
+
+	data, err := m.metadata.GetMetadata(ctx, archiveURLsKey(hostname, namespace, providerType, version))
+	if err != nil {
+		if !errors.Is(err, io.EOF) {
+			slog.Warn(fmt.Sprintf("failed to read upstream archive URLs [hostname=%s namespace=%s type=%s version=%s err=%s]",
+				hostname, namespace, providerType, version, err),
+				"hostname", hostname, "namespace", namespace, "type", providerType, "version", version, "err", err)
+		}
+		return "", false
+	}
+
+	var archives upstreamArchives
+	if err := json.Unmarshal(data, &archives); err != nil {
+		return "", false
+	}
+	archiveURL, ok := archives.URLs[buildPlatformKey(os, arch)]
+	return archiveURL, ok && archiveURL != ""
+}
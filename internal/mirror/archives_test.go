@@ -0,0 +1,134 @@
+package mirror
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/elisiariocouto/specular/internal/storage"
+)
+
+// newMirrorProtocolUpstream serves a provider network mirror without service discovery.
+// The linux archive URL is relative to the version document and the darwin one lives on another host.
+func newMirrorProtocolUpstream(t *testing.T) (*httptest.Server, string, func() map[string]int) {
+	t.Helper()
+
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	record := func(r *http.Request) {
+		mu.Lock()
+		requests[r.Host+r.URL.Path]++
+		mu.Unlock()
+	}
+
+	archiveHost := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		record(r)
+		w.Write([]byte("darwin archive"))
+	}))
+	t.Cleanup(archiveHost.Close)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		record(r)
+		switch r.URL.Path {
+		case "/hashicorp/aws/index.json":
+			w.Write([]byte(`{"versions":{"1.0.0":{}}}`))
+		case "/hashicorp/aws/1.0.0.json":
+			w.Write([]byte(`{"archives":{` +
+				`"linux_amd64":{"url":"../../files/terraform-provider-aws_1.0.0_linux_amd64.zip"},` +
+				`"darwin_arm64":{"url":"` + archiveHost.URL + `/dl/terraform-provider-aws_1.0.0_darwin_arm64.zip"}}}`))
+		case "/files/terraform-provider-aws_1.0.0_linux_amd64.zip":
+			w.Write([]byte("linux archive"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	u, _ := url.Parse(server.URL)
+	snapshot := func() map[string]int {
+		mu.Lock()
+		defer mu.Unlock()
+		out := make(map[string]int, len(requests))
+		for k, v := range requests {
+			out[k] = v
+		}
+		return out
+	}
+	return server, u.Host, snapshot
+}
+
+func readArchive(t *testing.T, m *Mirror, hostname, os, arch string) string {
+	t.Helper()
+	reader, err := m.GetArchive(context.Background(), hostname, "hashicorp", "aws", "1.0.0", os, arch)
+	if err != nil {
+		t.Fatalf("GetArchive(%s_%s) failed: %v", os, arch, err)
+	}
+	defer reader.Close()
+	data, _ := io.ReadAll(reader)
+	return string(data)
+}
+
+// TestMirrorProtocol_ArchiveDownloads tests archive downloads from a mirror protocol upstream,
+// both with persisted archive URLs and with storage that cannot persist them
+func TestMirrorProtocol_ArchiveDownloads(t *testing.T) {
+	tests := []struct {
+		name  string
+		store storage.Storage
+		// versionFetches is how often the version document is fetched for two downloads
+		versionFetches int
+	}{
+		{name: "persisted archive URLs", store: storage.NewMemoryStorage(), versionFetches: 1},
+		{name: "looked up on download", store: NewMockStorage(), versionFetches: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, hostname, requests := newMirrorProtocolUpstream(t)
+			m := NewMirror(tt.store, newTestUpstreamClientForMirror(server), "http://localhost:8080", 0, Options{})
+			ctx := context.Background()
+
+			if _, err := m.GetIndex(ctx, hostname, "hashicorp", "aws"); err != nil {
+				t.Fatalf("GetIndex failed: %v", err)
+			}
+			if _, err := m.GetVersion(ctx, hostname, "hashicorp", "aws", "1.0.0"); err != nil {
+				t.Fatalf("GetVersion failed: %v", err)
+			}
+
+			if got := readArchive(t, m, hostname, "linux", "amd64"); got != "linux archive" {
+				t.Errorf("unexpected linux archive: %q", got)
+			}
+			if got := readArchive(t, m, hostname, "darwin", "arm64"); got != "darwin archive" {
+				t.Errorf("unexpected darwin archive: %q", got)
+			}
+
+			if got := requests()[hostname+"/hashicorp/aws/1.0.0.json"]; got != tt.versionFetches {
+				t.Errorf("expected %d version document fetches, got %d", tt.versionFetches, got)
+			}
+		})
+	}
+}
+
+func TestSaveArchiveURLs(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	m := NewMirror(store, nil, "http://localhost:8080", 0, Options{})
+	ctx := context.Background()
+
+	m.saveArchiveURLs(ctx, "example.com", "hashicorp", "aws", "1.0.0", &VersionResponse{Archives: map[string]Archive{
+		"linux_amd64": {URL: "https://example.com/files/a.zip"},
+	}})
+
+	got, ok := m.upstreamArchiveURL(ctx, "example.com", "hashicorp", "aws", "1.0.0", "linux", "amd64")
+	if !ok || got != "https://example.com/files/a.zip" {
+		t.Errorf("upstreamArchiveURL = %q, %t", got, ok)
+	}
+	if _, ok := m.upstreamArchiveURL(ctx, "example.com", "hashicorp", "aws", "1.0.0", "windows", "amd64"); ok {
+		t.Error("expected unknown platform to have no archive URL")
+	}
+	if _, ok := m.upstreamArchiveURL(ctx, "example.com", "hashicorp", "aws", "2.0.0", "linux", "amd64"); ok {
+		t.Error("expected unknown version to have no archive URL")
+	}
+}
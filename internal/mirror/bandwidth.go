@@ -0,0 +1,274 @@
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/elisiariocouto/specular/internal/storage"
+)
+
+// Bandwidth sources passed to Options.OnBandwidth
+const (
+	// BandwidthUpstream counts bytes downloaded from upstream registries and mirrors
+	BandwidthUpstream = "upstream"
+	// BandwidthCache counts bytes served to clients without an upstream download
+	BandwidthCache = "cache"
+)
+
+// bandwidthKey is the metadata key of the persisted bandwidth totals
+const bandwidthKey = "bandwidth/totals"
+
+// bandwidthFlushInterval is how often changed totals are written to storage
+const bandwidthFlushInterval = time.Minute
+
+// BandwidthTotals counts bytes downloaded from upstream and bytes served from cache since a point in time
+type BandwidthTotals struct {
+	Since         time.Time `json:"since"`
+	UpstreamBytes int64     `json:"upstream_bytes"`
+	// FailedUpstreamBytes are the upstream bytes of failed fetches, such as error responses for
+	// providers that do not exist. They are part of UpstreamBytes but of no provider's totals.
+	FailedUpstreamBytes int64 `json:"failed_upstream_bytes"`
+	CacheBytes          int64 `json:"cache_bytes"`
+}
+
+// ProviderBandwidth counts the bytes of a single provider since startup
+type ProviderBandwidth struct {
+	Hostname      string `json:"hostname"`
+	Namespace     string `json:"namespace"`
+	Type          string `json:"type"`
+	UpstreamBytes int64  `json:"upstream_bytes"`
+	CacheBytes    int64  `json:"cache_bytes"`
+}
+
+// BandwidthSummary reports bytes downloaded from upstream against bytes served from cache.
+// Totals since the cache was created are only kept across restarts when storage supports
+// metadata; otherwise they match the totals since startup.
+type BandwidthSummary struct {
+	SinceStartup      BandwidthTotals     `json:"since_startup"`
+	SinceCacheCreated BandwidthTotals     `json:"since_cache_created"`
+	Providers         []ProviderBandwidth `json:"providers"`
+}
+
+// bandwidthTracker accumulates bandwidth totals and periodically persists the lifetime totals
+type bandwidthTracker struct {
+	mu        sync.Mutex
+	startup   BandwidthTotals
+	lifetime  BandwidthTotals
+	providers map[providerKey]*ProviderBandwidth
+	dirty     bool
+
+	store    storage.MetadataStore // nil keeps totals in memory only
+	onRecord func(hostname, namespace, providerType, source string, bytes int64)
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// newBandwidthTracker loads the persisted lifetime totals and starts flushing changes to store
+func newBandwidthTracker(store storage.MetadataStore, onRecord func(hostname, namespace, providerType, source string, bytes int64)) *bandwidthTracker {
+	now := time.Now().UTC()
+	t := &bandwidthTracker{
+		startup:   BandwidthTotals{Since: now},
+		lifetime:  BandwidthTotals{Since: now},
+		providers: make(map[providerKey]*ProviderBandwidth),
+		store:     store,
+		onRecord:  onRecord,
+	}
+	if store == nil {
+		return t
+	}
+
+	data, err := store.GetMetadata(context.Background(), bandwidthKey)
+	switch {
+	case errors.Is(err, io.EOF):
+		// A new cache starts counting now; persist the start time right away
+		t.dirty = true
+	case err != nil:
+		slog.Warn(fmt.Sprintf("failed to read bandwidth totals, counting from now [err=%s]", err), "err", err)
+	default:
+		var persisted BandwidthTotals
+		if err := json.Unmarshal(data, &persisted); err != nil {
+			slog.Warn(fmt.Sprintf("failed to parse bandwidth totals, counting from now [err=%s]", err), "err", err)
+		} else {
+			t.lifetime = persisted
+		}
+	}
+
+	t.stop = make(chan struct{})
+	t.done = make(chan struct{})
+	go t.flushLoop()
+	return t
+}
+
+// recordUpstream counts bytes downloaded from upstream for a provider
+func (t *bandwidthTracker) recordUpstream(hostname, namespace, providerType string, bytes int64) {
+	t.record(hostname, namespace, providerType, BandwidthUpstream, bytes)
+}
+
+// recordFetch counts the bytes downloaded by an upstream fetch. Only successful fetches are
+// attributed to the provider, since anyone can ask for providers that do not exist and every
+// attributed provider is kept in memory, persisted and exported as metric labels.
+func (t *bandwidthTracker) recordFetch(hostname, namespace, providerType string, bytes int64, fetchErr error) {
+	if fetchErr == nil {
+		t.recordUpstream(hostname, namespace, providerType, bytes)
+		return
+	}
+	if t == nil || bytes <= 0 {
+		return
+	}
+
+	t.mu.Lock()
+	t.startup.UpstreamBytes += bytes
+	t.startup.FailedUpstreamBytes += bytes
+	t.lifetime.UpstreamBytes += bytes
+	t.lifetime.FailedUpstreamBytes += bytes
+	t.dirty = true
+	t.mu.Unlock()
+
+	if t.onRecord != nil {
+		t.onRecord("", "", "", BandwidthUpstream, bytes)
+	}
+}
+
+// recordCache counts bytes served for a provider without an upstream download
+func (t *bandwidthTracker) recordCache(hostname, namespace, providerType string, bytes int64) {
+	t.record(hostname, namespace, providerType, BandwidthCache, bytes)
+}
+
+func (t *bandwidthTracker) record(hostname, namespace, providerType, source string, bytes int64) {
+	if t == nil || bytes <= 0 {
+		return
+	}
+
+	key := providerKey{hostname, namespace, providerType}
+	t.mu.Lock()
+	provider, ok := t.providers[key]
+	if !ok {
+		provider = &ProviderBandwidth{Hostname: hostname, Namespace: namespace, Type: providerType}
+		t.providers[key] = provider
+	}
+	if source == BandwidthUpstream {
+		t.startup.UpstreamBytes += bytes
+		t.lifetime.UpstreamBytes += bytes
+		provider.UpstreamBytes += bytes
+	} else {
+		t.startup.CacheBytes += bytes
+		t.lifetime.CacheBytes += bytes
+		provider.CacheBytes += bytes
+	}
+	t.dirty = true
+	t.mu.Unlock()
+
+	if t.onRecord != nil {
+		t.onRecord(hostname, namespace, providerType, source, bytes)
+	}
+}
+
+// summary returns the current totals, with providers sorted by address
+func (t *bandwidthTracker) summary() BandwidthSummary {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	providers := make([]ProviderBandwidth, 0, len(t.providers))
+	for _, p := range t.providers {
+		providers = append(providers, *p)
+	}
+	sort.Slice(providers, func(i, j int) bool {
+		a, b := providers[i], providers[j]
+		if a.Hostname != b.Hostname {
+			return a.Hostname < b.Hostname
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Type < b.Type
+	})
+
+	return BandwidthSummary{
+		SinceStartup:      t.startup,
+		SinceCacheCreated: t.lifetime,
+		Providers:         providers,
+	}
+}
+
+// flushLoop persists changed totals until the tracker is shut down
+func (t *bandwidthTracker) flushLoop() {
+	defer close(t.done)
+	ticker := time.NewTicker(bandwidthFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			t.flush(context.Background())
+		case <-t.stop:
+			return
+		}
+	}
+}
+
+// flush writes the lifetime totals to storage if they changed since the last write
+func (t *bandwidthTracker) flush(ctx context.Context) {
+	t.mu.Lock()
+	if !t.dirty {
+		t.mu.Unlock()
+		return
+	}
+	lifetime := t.lifetime
+	t.dirty = false
+	t.mu.Unlock()
+
+	data, err := json.Marshal(lifetime)
+	if err == nil {
+		err = t.store.PutMetadata(ctx, bandwidthKey, data)
+	}
+	if err != nil {
+		slog.Warn(fmt.Sprintf("failed to persist bandwidth totals [err=%s]", err), "err", err)
+		t.mu.Lock()
+		t.dirty = true
+		t.mu.Unlock()
+	}
+}
+
+// shutdown stops the flush loop and persists the final totals
+func (t *bandwidthTracker) shutdown() {
+	if t == nil || t.store == nil {
+		return
+	}
+	close(t.stop)
+	<-t.done
+	t.flush(context.Background())
+}
+
+// upstreamBytes counts the bytes read from upstream responses on behalf of one fetch
+type upstreamBytes struct {
+	n atomic.Int64
+}
+
+type upstreamBytesContextKey struct{}
+
+// withUpstreamBytes returns a copy of ctx in which upstream response bytes are counted.
+// Nested counters shadow outer ones, so every byte is counted once.
+func withUpstreamBytes(ctx context.Context) (context.Context, *upstreamBytes) {
+	counter := &upstreamBytes{}
+	return context.WithValue(ctx, upstreamBytesContextKey{}, counter), counter
+}
+
+// upstreamBytesCounter returns the counter of ctx, or nil if upstream bytes are not counted
+func upstreamBytesCounter(ctx context.Context) *upstreamBytes {
+	counter, _ := ctx.Value(upstreamBytesContextKey{}).(*upstreamBytes)
+	return counter
+}
+
+// add counts n bytes; it is a no-op on a nil counter
+func (c *upstreamBytes) add(n int) {
+	if c != nil && n > 0 {
+		c.n.Add(int64(n))
+	}
+}
@@ -0,0 +1,136 @@
+package mirror
+
+import (
+	"context"
+	"testing"
+
+	"github.com/elisiariocouto/specular/internal/storage"
+)
+
+// TestBandwidth_ArchiveDownloadAndCachedServes tests that archive downloads count upstream bytes
+// and that only responses without their own upstream download count as served from cache
+func TestBandwidth_ArchiveDownloadAndCachedServes(t *testing.T) {
+	server, hostname, _ := newMirrorProtocolUpstream(t)
+
+	type record struct {
+		source string
+		bytes  int64
+	}
+	var records []record
+	m := NewMirror(storage.NewMemoryStorage(), newTestUpstreamClientForMirror(server), "http://localhost:8080", 0, Options{
+		OnBandwidth: func(_, _, _, source string, bytes int64) {
+			records = append(records, record{source, bytes})
+		},
+	})
+	defer m.Shutdown()
+
+	if _, err := m.GetVersion(context.Background(), hostname, "hashicorp", "aws", "1.0.0"); err != nil {
+		t.Fatalf("GetVersion failed: %v", err)
+	}
+	before := m.BandwidthSummary().SinceStartup.UpstreamBytes
+	if before == 0 {
+		t.Error("expected the version document download to be counted")
+	}
+
+	archive := readArchive(t, m, hostname, "linux", "amd64")
+	m.RecordServed(hostname, "hashicorp", "aws", CacheMiss, int64(len(archive)))
+	m.RecordServed(hostname, "hashicorp", "aws", CacheHit, int64(len(archive)))
+	m.RecordServed(hostname, "hashicorp", "aws", CacheCoalesced, int64(len(archive)))
+
+	summary := m.BandwidthSummary()
+	if got := summary.SinceStartup.UpstreamBytes - before; got != int64(len(archive)) {
+		t.Errorf("archive upstream bytes = %d, want %d", got, len(archive))
+	}
+	if got := summary.SinceStartup.CacheBytes; got != 2*int64(len(archive)) {
+		t.Errorf("cache bytes = %d, want %d", got, 2*len(archive))
+	}
+	if len(summary.Providers) != 1 || summary.Providers[0].Type != "aws" ||
+		summary.Providers[0].UpstreamBytes != summary.SinceStartup.UpstreamBytes {
+		t.Errorf("unexpected provider totals: %+v", summary.Providers)
+	}
+
+	var upstream, cache int64
+	for _, r := range records {
+		switch r.source {
+		case BandwidthUpstream:
+			upstream += r.bytes
+		case BandwidthCache:
+			cache += r.bytes
+		}
+	}
+	if upstream != summary.SinceStartup.UpstreamBytes || cache != summary.SinceStartup.CacheBytes {
+		t.Errorf("OnBandwidth totals = %d/%d, want %d/%d", upstream, cache,
+			summary.SinceStartup.UpstreamBytes, summary.SinceStartup.CacheBytes)
+	}
+}
+
+// TestBandwidth_PersistsLifetimeTotals tests that totals since the cache was created survive a restart
+func TestBandwidth_PersistsLifetimeTotals(t *testing.T) {
+	store := storage.NewMemoryStorage()
+
+	first := newBandwidthTracker(store, nil)
+	first.recordUpstream("registry.terraform.io", "hashicorp", "aws", 100)
+	first.recordCache("registry.terraform.io", "hashicorp", "aws", 400)
+	created := first.summary().SinceCacheCreated.Since
+	first.shutdown()
+
+	second := newBandwidthTracker(store, nil)
+	defer second.shutdown()
+	second.recordCache("registry.terraform.io", "hashicorp", "aws", 50)
+
+	summary := second.summary()
+	if summary.SinceStartup.UpstreamBytes != 0 || summary.SinceStartup.CacheBytes != 50 {
+		t.Errorf("unexpected totals since startup: %+v", summary.SinceStartup)
+	}
+	lifetime := summary.SinceCacheCreated
+	if lifetime.UpstreamBytes != 100 || lifetime.CacheBytes != 450 {
+		t.Errorf("unexpected totals since cache creation: %+v", lifetime)
+	}
+	if !lifetime.Since.Equal(created) {
+		t.Errorf("cache creation time = %s, want %s", lifetime.Since, created)
+	}
+}
+
+// TestBandwidth_WithoutMetadataStore tests that totals are kept in memory when storage cannot persist them
+func TestBandwidth_WithoutMetadataStore(t *testing.T) {
+	tracker := newBandwidthTracker(nil, nil)
+	tracker.recordUpstream("registry.terraform.io", "hashicorp", "aws", 10)
+	tracker.shutdown()
+
+	summary := tracker.summary()
+	if summary.SinceStartup != summary.SinceCacheCreated || summary.SinceCacheCreated.UpstreamBytes != 10 {
+		t.Errorf("unexpected summary: %+v", summary)
+	}
+}
+
+// TestBandwidth_FailedFetchesAreNotAttributed tests that a fetch for a provider the upstream
+// does not have counts its bytes without creating a provider entry
+func TestBandwidth_FailedFetchesAreNotAttributed(t *testing.T) {
+	server, hostname, _ := newMirrorProtocolUpstream(t)
+
+	var providers []string
+	m := NewMirror(storage.NewMemoryStorage(), newTestUpstreamClientForMirror(server), "http://localhost:8080", 0, Options{
+		OnBandwidth: func(_, namespace, providerType, _ string, _ int64) {
+			providers = append(providers, namespace+"/"+providerType)
+		},
+	})
+	defer m.Shutdown()
+
+	if _, err := m.GetIndex(context.Background(), hostname, "hashicorp", "missing"); err == nil {
+		t.Fatal("expected GetIndex to fail for a provider the upstream does not have")
+	}
+
+	summary := m.BandwidthSummary()
+	if len(summary.Providers) != 0 {
+		t.Errorf("expected no provider entries, got %+v", summary.Providers)
+	}
+	if summary.SinceStartup.UpstreamBytes != summary.SinceStartup.FailedUpstreamBytes {
+		t.Errorf("upstream bytes = %d, want the %d failed bytes",
+			summary.SinceStartup.UpstreamBytes, summary.SinceStartup.FailedUpstreamBytes)
+	}
+	for _, provider := range providers {
+		if provider != "/" {
+			t.Errorf("OnBandwidth attributed failed bytes to %s", provider)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Circuit breaker states
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half_open"
+)
+
+// BreakerOptions configures the per-host upstream circuit breaker
+type BreakerOptions struct {
+	// FailureThreshold is the number of consecutive failed attempts that opens a host's
+	// circuit; 0 disables the breaker
+	FailureThreshold int
+	// OpenTimeout is how long an open circuit fails requests fast before letting a probe through
+	OpenTimeout time.Duration
+	// OnStateChange is called whenever a host's circuit changes state
+	OnStateChange func(host, state string)
+	// OnForget is called when a closed circuit left idle is dropped, so per-host state
+	// elsewhere can be dropped with it
+	OnForget func(host string)
+}
+
+// circuitIdleTTL is how long a closed circuit may go unused before it is forgotten
+const circuitIdleTTL = 30 * time.Minute
+
+// CircuitOpenError reports an upstream host whose circuit is open and when it will be probed
+type CircuitOpenError struct {
+	Host       string
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%s: %s is failing, retrying in %s", ErrCircuitOpen, e.Host, e.RetryAfter.Round(time.Second))
+}
+
+// Is makes CircuitOpenError match ErrCircuitOpen
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// CircuitStatus describes the circuit of one upstream host
+type CircuitStatus struct {
+	Host                string         `json:"host"`
+	State               string         `json:"state"`
+	ConsecutiveFailures int            `json:"consecutive_failures"`
+	OpenedAt            *time.Time     `json:"opened_at,omitempty"`
+	NextProbeAt         *time.Time     `json:"next_probe_at,omitempty"`
+	Transitions         map[string]int `json:"transitions"`
+}
+
+// hostCircuit is the breaker state of one upstream host
+type hostCircuit struct {
+	state       string
+	failures    int
+	openedAt    time.Time
+	probing     bool // a half-open probe request is in flight
+	transitions map[string]int
+	lastUsed    time.Time
+}
+
+// circuitBreaker tracks upstream health per host. After FailureThreshold consecutive
+// failures a host's circuit opens and requests fail fast; once OpenTimeout has passed
+// the next request is let through as a probe, closing the circuit on success and
+// reopening it on failure. A nil *circuitBreaker allows every request.
+type circuitBreaker struct {
+	threshold     int
+	openTimeout   time.Duration
+	onStateChange func(host, state string)
+	onForget      func(host string)
+
+	mu        sync.Mutex
+	hosts     map[string]*hostCircuit
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// newCircuitBreaker returns a breaker, or nil when opts disable it
+func newCircuitBreaker(opts BreakerOptions) *circuitBreaker {
+	if opts.FailureThreshold <= 0 {
+		return nil
+	}
+	return &circuitBreaker{
+		threshold:     opts.FailureThreshold,
+		openTimeout:   opts.OpenTimeout,
+		onStateChange: opts.OnStateChange,
+		onForget:      opts.OnForget,
+		hosts:         make(map[string]*hostCircuit),
+		now:           time.Now,
+	}
+}
+
+// circuit returns the state of a host, creating a closed circuit on first use; b.mu must be held
+func (b *circuitBreaker) circuit(host string) *hostCircuit {
+	now := b.now()
+
+	// Drop idle closed circuits so the map does not grow without bound; open and
+	// half-open circuits are kept until they close
+	if now.Sub(b.lastSweep) > time.Minute {
+		for h, c := range b.hosts {
+			if c.state == CircuitClosed && now.Sub(c.lastUsed) > circuitIdleTTL {
+				delete(b.hosts, h)
+				if b.onForget != nil {
+					b.onForget(h)
+				}
+			}
+		}
+		b.lastSweep = now
+	}
+
+	c, ok := b.hosts[host]
+	if !ok {
+		c = &hostCircuit{state: CircuitClosed, transitions: make(map[string]int)}
+		b.hosts[host] = c
+	}
+	c.lastUsed = now
+	return c
+}
+
+// transition moves a circuit to a new state; b.mu must be held
+func (b *circuitBreaker) transition(host string, c *hostCircuit, state string) {
+	if c.state == state {
+		return
+	}
+	c.state = state
+	c.transitions[state]++
+	if b.onStateChange != nil {
+		b.onStateChange(host, state)
+	}
+}
+
+// allow returns a *CircuitOpenError if requests to host must fail fast
+func (b *circuitBreaker) allow(host string) error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.circuit(host)
+	switch c.state {
+	case CircuitOpen:
+		wait := c.openedAt.Add(b.openTimeout).Sub(b.now())
+		if wait > 0 {
+			return &CircuitOpenError{Host: host, RetryAfter: wait}
+		}
+		b.transition(host, c, CircuitHalfOpen)
+		c.probing = true
+		return nil
+	case CircuitHalfOpen:
+		if c.probing {
+			return &CircuitOpenError{Host: host, RetryAfter: b.openTimeout}
+		}
+		c.probing = true
+		return nil
+	}
+	return nil
+}
+
+// success records a healthy response from host, closing its circuit
+func (b *circuitBreaker) success(host string) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.circuit(host)
+	c.failures = 0
+	c.probing = false
+	b.transition(host, c, CircuitClosed)
+}
+
+// failure records a failed attempt against host, opening its circuit at the threshold
+// or straight away when a probe fails
+func (b *circuitBreaker) failure(host string) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.circuit(host)
+	c.failures++
+	c.probing = false
+	if c.state == CircuitHalfOpen || c.failures >= b.threshold {
+		c.openedAt = b.now()
+		b.transition(host, c, CircuitOpen)
+	}
+}
+
+// abandon releases a probe whose outcome is unknown, such as a canceled request,
+// so the next request can probe instead
+func (b *circuitBreaker) abandon(host string) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if c, ok := b.hosts[host]; ok {
+		c.probing = false
+	}
+}
+
+// record updates a host's circuit with the outcome of one request attempt. Network errors
+// and 5xx responses are failures; canceled and blocked requests say nothing about the host.
+func (b *circuitBreaker) record(ctx context.Context, host string, status int, err error) {
+	switch {
+	case err != nil && (ctx.Err() != nil || errors.Is(err, ErrUpstreamBlocked)):
+		b.abandon(host)
+	case err != nil || status >= 500:
+		b.failure(host)
+	default:
+		b.success(host)
+	}
+}
+
+// status returns the circuit of every host seen so far, sorted by host
+func (b *circuitBreaker) status() []CircuitStatus {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	statuses := make([]CircuitStatus, 0, len(b.hosts))
+	for host, c := range b.hosts {
+		status := CircuitStatus{
+			Host:                host,
+			State:               c.state,
+			ConsecutiveFailures: c.failures,
+			Transitions:         make(map[string]int, len(c.transitions)),
+		}
+		for state, n := range c.transitions {
+			status.Transitions[state] = n
+		}
+		if c.state != CircuitClosed {
+			openedAt := c.openedAt.UTC()
+			nextProbe := openedAt.Add(b.openTimeout)
+			status.OpenedAt, status.NextProbeAt = &openedAt, &nextProbe
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Host < statuses[j].Host })
+	return statuses
+}
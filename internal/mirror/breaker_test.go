@@ -0,0 +1,162 @@
+package mirror
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker_StateMachine(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	var changes []string
+	b := newCircuitBreaker(BreakerOptions{
+		FailureThreshold: 2,
+		OpenTimeout:      30 * time.Second,
+		OnStateChange:    func(host, state string) { changes = append(changes, host+"="+state) },
+	})
+	b.now = func() time.Time { return now }
+	host := "registry.example.com"
+
+	// Failures below the threshold keep the circuit closed; a success resets the count
+	b.failure(host)
+	b.success(host)
+	b.failure(host)
+	if err := b.allow(host); err != nil {
+		t.Fatalf("expected closed circuit to allow requests, got %v", err)
+	}
+
+	b.failure(host)
+	err := b.allow(host)
+	var circuitErr *CircuitOpenError
+	if !errors.As(err, &circuitErr) || !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected CircuitOpenError, got %v", err)
+	}
+	if circuitErr.RetryAfter != 30*time.Second {
+		t.Errorf("RetryAfter = %s, want 30s", circuitErr.RetryAfter)
+	}
+
+	// After the open timeout a single probe is let through
+	now = now.Add(31 * time.Second)
+	if err := b.allow(host); err != nil {
+		t.Fatalf("expected a probe to be allowed, got %v", err)
+	}
+	if err := b.allow(host); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected concurrent requests to fail fast while probing, got %v", err)
+	}
+
+	// A failed probe reopens the circuit immediately
+	b.failure(host)
+	if err := b.allow(host); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected circuit to reopen after a failed probe, got %v", err)
+	}
+
+	// An abandoned probe lets the next request probe instead
+	now = now.Add(31 * time.Second)
+	if err := b.allow(host); err != nil {
+		t.Fatalf("expected a probe to be allowed, got %v", err)
+	}
+	b.abandon(host)
+	if err := b.allow(host); err != nil {
+		t.Fatalf("expected a new probe after an abandoned one, got %v", err)
+	}
+
+	b.success(host)
+	if err := b.allow(host); err != nil {
+		t.Fatalf("expected circuit to close after a successful probe, got %v", err)
+	}
+
+	want := []string{
+		host + "=open", host + "=half_open", host + "=open", host + "=half_open", host + "=closed",
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("state changes = %v, want %v", changes, want)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Fatalf("state changes = %v, want %v", changes, want)
+		}
+	}
+
+	status := b.status()
+	if len(status) != 1 || status[0].State != CircuitClosed || status[0].Transitions[CircuitOpen] != 2 {
+		t.Errorf("unexpected status: %+v", status)
+	}
+}
+
+func TestCircuitBreaker_Disabled(t *testing.T) {
+	b := newCircuitBreaker(BreakerOptions{})
+	if b != nil {
+		t.Fatal("expected a zero threshold to disable the breaker")
+	}
+	b.failure("registry.example.com")
+	if err := b.allow("registry.example.com"); err != nil {
+		t.Errorf("expected disabled breaker to allow requests, got %v", err)
+	}
+	if b.status() != nil {
+		t.Error("expected no status from a disabled breaker")
+	}
+}
+
+// TestCircuitBreaker_ForgetsIdleClosedCircuits tests that idle closed circuits are dropped
+// while open ones are kept
+func TestCircuitBreaker_ForgetsIdleClosedCircuits(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	var forgotten []string
+	b := newCircuitBreaker(BreakerOptions{
+		FailureThreshold: 1,
+		OpenTimeout:      time.Hour,
+		OnForget:         func(host string) { forgotten = append(forgotten, host) },
+	})
+	b.now = func() time.Time { return now }
+
+	b.success("closed.example.com")
+	b.failure("open.example.com")
+
+	now = now.Add(circuitIdleTTL + time.Minute)
+	b.success("active.example.com")
+
+	hosts := make(map[string]bool)
+	for _, status := range b.status() {
+		hosts[status.Host] = true
+	}
+	if hosts["closed.example.com"] || !hosts["open.example.com"] || !hosts["active.example.com"] {
+		t.Errorf("expected only the idle closed circuit to be dropped, got %v", hosts)
+	}
+	if len(forgotten) != 1 || forgotten[0] != "closed.example.com" {
+		t.Errorf("expected OnForget for closed.example.com, got %v", forgotten)
+	}
+}
+
+func TestUpstreamClient_CircuitBreakerFailsFast(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	uc := newTestUpstreamClient(server)
+	uc.maxRetries = 0
+	uc.breaker = newCircuitBreaker(BreakerOptions{FailureThreshold: 2, OpenTimeout: time.Hour})
+
+	for i := 0; i < 2; i++ {
+		if _, err := uc.FetchArchive(t.Context(), "registry.terraform.io", server.URL+"/a.zip"); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("request %d: expected an upstream error, got %v", i, err)
+		}
+	}
+
+	if _, err := uc.FetchArchive(t.Context(), "registry.terraform.io", server.URL+"/a.zip"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen once the circuit opened, got %v", err)
+	}
+	if requests.Load() != 2 {
+		t.Errorf("expected 2 upstream requests, got %d", requests.Load())
+	}
+
+	status := uc.CircuitStatus()
+	if len(status) != 1 || status[0].State != CircuitOpen || status[0].NextProbeAt == nil {
+		t.Errorf("unexpected circuit status: %+v", status)
+	}
+}
@@ -0,0 +1,129 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// CacheStatus describes how the mirror satisfied a request
+type CacheStatus string
+
+const (
+	// CacheHit means the response was served from a fresh cache entry
+	CacheHit CacheStatus = "hit"
+	// CacheStale means a stale cache entry was served while a background refresh was started
+	CacheStale CacheStatus = "stale"
+	// CacheMiss means the response was fetched from upstream and cached
+	CacheMiss CacheStatus = "miss"
+	// CacheBuilt means a version document was built from the cached versions response
+	CacheBuilt CacheStatus = "built"
+	// CacheCoalesced means the response came from an upstream fetch started by a concurrent request
+	CacheCoalesced CacheStatus = "coalesced"
+)
+
+// Hit reports whether the request was answered without waiting on upstream
+func (s CacheStatus) Hit() bool {
+	return s == CacheHit || s == CacheStale || s == CacheBuilt
+}
+
+// CacheReport collects the cache status of a mirror request
+type CacheReport struct {
+	mu     sync.Mutex
+	status CacheStatus
+}
+
+// Status returns the reported cache status, or "" if the mirror never consulted its cache
+func (r *CacheReport) Status() CacheStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status
+}
+
+type cacheReportContextKey struct{}
+
+// WithCacheReport returns a copy of ctx that collects the cache status of mirror calls made with it
+func WithCacheReport(ctx context.Context) (context.Context, *CacheReport) {
+	report := &CacheReport{}
+	return context.WithValue(ctx, cacheReportContextKey{}, report), report
+}
+
+// reportCache records the cache status of a request; later reports replace earlier ones, so the
+// requested resource's own lookup, made last, determines the outcome
+func reportCache(ctx context.Context, status CacheStatus) {
+	if report, ok := ctx.Value(cacheReportContextKey{}).(*CacheReport); ok {
+		report.mu.Lock()
+		report.status = status
+		report.mu.Unlock()
+	}
+}
+
+// reportedCache returns the cache status recorded so far in ctx
+func reportedCache(ctx context.Context) CacheStatus {
+	if report, ok := ctx.Value(cacheReportContextKey{}).(*CacheReport); ok {
+		return report.Status()
+	}
+	return ""
+}
+
+// flightGroup coalesces concurrent upstream fetches of the same resource into one
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+	// timeout bounds each shared fetch, which no longer ends with its callers; 0 leaves it unbounded
+	timeout time.Duration
+}
+
+type flightCall struct {
+	done chan struct{}
+	val  any
+	err  error
+}
+
+// do runs fn unless a call with the same key is already running, in which case it waits for
+// that call's result; shared reports whether the result came from another caller.
+// fn runs on a context that keeps the values of the first caller's but not its cancellation,
+// so a caller that goes away does not fail the others. Every caller, the first one included,
+// gives up waiting when its own context is cancelled.
+func (g *flightGroup) do(ctx context.Context, key string, fn func(ctx context.Context) (any, error)) (val any, shared bool, err error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	call, shared := g.calls[key]
+	if !shared {
+		call = &flightCall{done: make(chan struct{})}
+		g.calls[key] = call
+		go g.run(context.WithoutCancel(ctx), key, call, fn)
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.val, shared, call.err
+	case <-ctx.Done():
+		return nil, shared, ctx.Err()
+	}
+}
+
+// run executes a shared call and publishes its result to every waiting caller
+func (g *flightGroup) run(ctx context.Context, key string, call *flightCall, fn func(ctx context.Context) (any, error)) {
+	if g.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.timeout)
+		defer cancel()
+	}
+	defer func() {
+		// The call runs outside the request's goroutine, beyond the reach of the server's
+		// panic recovery, so a panic fails the call instead of the process
+		if r := recover(); r != nil {
+			call.val, call.err = nil, fmt.Errorf("shared fetch panicked: %v", r)
+		}
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(call.done)
+	}()
+	call.val, call.err = fn(ctx)
+}
@@ -0,0 +1,226 @@
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/elisiariocouto/specular/internal/storage"
+)
+
+// newCacheStatusTestMirror returns a mirror backed by a registry serving one provider version,
+// and a counter of the versions API requests it received
+func newCacheStatusTestMirror(t *testing.T, store storage.Storage, indexTTL time.Duration, versionsGate chan struct{}) (*Mirror, string, *atomic.Int32) {
+	t.Helper()
+	var versionsRequests atomic.Int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.Contains(r.URL.Path, ".well-known/terraform.json") {
+			fmt.Fprint(w, `{"providers.v1": "/v1/providers/"}`)
+			return
+		}
+		versionsRequests.Add(1)
+		if versionsGate != nil {
+			<-versionsGate
+		}
+		json.NewEncoder(w).Encode(RegistryVersionsResponse{
+			Versions: []RegistryVersion{
+				{Version: "1.0.0", Platforms: []RegistryPlatform{{OS: "linux", Arch: "amd64"}}},
+			},
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	client := server.Client()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	upstream := &UpstreamClient{
+		httpClient:     client,
+		logger:         logger,
+		discoveryCache: NewDiscoveryCache(time.Hour, client, logger),
+	}
+	m := NewMirror(store, upstream, "http://localhost:8080", indexTTL, Options{})
+	t.Cleanup(m.Shutdown)
+	return m, strings.TrimPrefix(server.URL, "https://"), &versionsRequests
+}
+
+func TestCacheStatus_MissHitAndBuilt(t *testing.T) {
+	m, host, _ := newCacheStatusTestMirror(t, NewMockStorage(), 0, nil)
+
+	steps := []struct {
+		name string
+		get  func(ctx context.Context) error
+		want CacheStatus
+	}{
+		{"index miss", func(ctx context.Context) error {
+			_, err := m.GetIndex(ctx, host, "hashicorp", "aws")
+			return err
+		}, CacheMiss},
+		{"index hit", func(ctx context.Context) error {
+			_, err := m.GetIndex(ctx, host, "hashicorp", "aws")
+			return err
+		}, CacheHit},
+		{"version built", func(ctx context.Context) error {
+			_, err := m.GetVersion(ctx, host, "hashicorp", "aws", "1.0.0")
+			return err
+		}, CacheBuilt},
+		{"version hit", func(ctx context.Context) error {
+			_, err := m.GetVersion(ctx, host, "hashicorp", "aws", "1.0.0")
+			return err
+		}, CacheHit},
+	}
+
+	for _, step := range steps {
+		ctx, report := WithCacheReport(context.Background())
+		if err := step.get(ctx); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if got := report.Status(); got != step.want {
+			t.Errorf("%s: status = %q, want %q", step.name, got, step.want)
+		}
+	}
+}
+
+func TestCacheStatus_VersionNeedingIndexIsMiss(t *testing.T) {
+	m, host, _ := newCacheStatusTestMirror(t, NewMockStorage(), 0, nil)
+
+	ctx, report := WithCacheReport(context.Background())
+	if _, err := m.GetVersion(ctx, host, "hashicorp", "aws", "1.0.0"); err != nil {
+		t.Fatalf("GetVersion failed: %v", err)
+	}
+	if got := report.Status(); got != CacheMiss {
+		t.Errorf("status = %q, want %q", got, CacheMiss)
+	}
+}
+
+func TestCacheStatus_StaleIndex(t *testing.T) {
+	store := NewMockStorage()
+	m, host, _ := newCacheStatusTestMirror(t, store, time.Hour, nil)
+	store.PutIndex(context.Background(), host, "hashicorp", "aws", []byte(`{"versions":{"1.0.0":{}}}`))
+	store.indexAge = 2 * time.Hour
+	store.indexExists = true
+
+	ctx, report := WithCacheReport(context.Background())
+	if _, err := m.GetIndex(ctx, host, "hashicorp", "aws"); err != nil {
+		t.Fatalf("GetIndex failed: %v", err)
+	}
+	if got := report.Status(); got != CacheStale {
+		t.Errorf("status = %q, want %q", got, CacheStale)
+	}
+}
+
+func TestCacheStatus_ConcurrentMissesCoalesced(t *testing.T) {
+	gate := make(chan struct{})
+	m, host, versionsRequests := newCacheStatusTestMirror(t, storage.NewMemoryStorage(), 0, gate)
+
+	const clients = 3
+	statuses := make([]CacheStatus, clients)
+	var wg sync.WaitGroup
+	for i := range clients {
+		wg.Go(func() {
+			ctx, report := WithCacheReport(context.Background())
+			if _, err := m.GetIndex(ctx, host, "hashicorp", "aws"); err != nil {
+				t.Errorf("GetIndex failed: %v", err)
+			}
+			statuses[i] = report.Status()
+		})
+	}
+
+	// Let every client join the in-flight fetch before the upstream answers
+	time.Sleep(100 * time.Millisecond)
+	close(gate)
+	wg.Wait()
+
+	if got := versionsRequests.Load(); got != 1 {
+		t.Errorf("versions requests = %d, want 1", got)
+	}
+	counts := map[CacheStatus]int{}
+	for _, s := range statuses {
+		counts[s]++
+	}
+	if counts[CacheMiss] != 1 || counts[CacheCoalesced] != clients-1 {
+		t.Errorf("statuses = %v, want one miss and %d coalesced", statuses, clients-1)
+	}
+}
+
+func TestFlightGroup_WaiterCancelled(t *testing.T) {
+	var g flightGroup
+	release := make(chan struct{})
+	defer close(release)
+
+	started := make(chan struct{})
+	go g.do(context.Background(), "key", func(context.Context) (any, error) {
+		close(started)
+		<-release
+		return nil, nil
+	})
+	<-started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, shared, err := g.do(ctx, "key", func(context.Context) (any, error) {
+		t.Fatal("waiter should not run the call")
+		return nil, nil
+	})
+	if !shared || err != context.Canceled {
+		t.Errorf("do() = shared %t, err %v; want shared, context.Canceled", shared, err)
+	}
+}
+
+func TestFlightGroup_LeaderCancelled(t *testing.T) {
+	var g flightGroup
+	release := make(chan struct{})
+	started := make(chan struct{})
+	var fetchErr error
+
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	leaderDone := make(chan error, 1)
+	go func() {
+		_, _, err := g.do(leaderCtx, "key", func(ctx context.Context) (any, error) {
+			close(started)
+			<-release
+			fetchErr = ctx.Err()
+			return "result", nil
+		})
+		leaderDone <- err
+	}()
+	<-started
+
+	waiterDone := make(chan struct{})
+	var (
+		val    any
+		shared bool
+		err    error
+	)
+	go func() {
+		defer close(waiterDone)
+		val, shared, err = g.do(context.Background(), "key", func(context.Context) (any, error) {
+			t.Error("waiter should not run the call")
+			return nil, nil
+		})
+	}()
+
+	// Let the waiter join the call, then disconnect the leader while the fetch is running
+	time.Sleep(50 * time.Millisecond)
+	cancelLeader()
+	if err := <-leaderDone; err != context.Canceled {
+		t.Errorf("leader err = %v, want context.Canceled", err)
+	}
+	close(release)
+	<-waiterDone
+
+	if fetchErr != nil {
+		t.Errorf("shared fetch context was cancelled with the leader: %v", fetchErr)
+	}
+	if val != "result" || !shared || err != nil {
+		t.Errorf("waiter do() = %v, shared %t, err %v; want the shared result", val, shared, err)
+	}
+}
@@ -0,0 +1,245 @@
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/elisiariocouto/specular/internal/storage"
+	"github.com/elisiariocouto/specular/internal/tracing"
+	goversion "github.com/hashicorp/go-version"
+)
+
+// Catalog page sizes, counted in providers
+const (
+	DefaultCatalogLimit = 100
+	MaxCatalogLimit     = 1000
+)
+
+var (
+	// ErrInvalidCursor is returned for a catalog cursor that is not a provider address
+	ErrInvalidCursor = errors.New("invalid catalog cursor")
+	// ErrCatalogUnavailable is returned when storage cannot list its contents
+	ErrCatalogUnavailable = errors.New("storage does not support listing")
+)
+
+// Catalog is one page of the providers held in the cache
+type Catalog struct {
+	Providers []CatalogProvider `json:"providers"`
+	// NextCursor is passed back to fetch the next page; it is empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// CatalogProvider describes what the cache holds for a provider
+type CatalogProvider struct {
+	Hostname  string           `json:"hostname"`
+	Namespace string           `json:"namespace"`
+	Type      string           `json:"type"`
+	Index     CatalogIndex     `json:"index"`
+	Versions  []CatalogVersion `json:"versions"`
+	// ArchiveBytes is the total size of the provider's cached archives
+	ArchiveBytes int64 `json:"archive_bytes"`
+	// OtherArchives are cached archives that cannot be attributed to a version and platform
+	OtherArchives []CatalogArchive `json:"other_archives,omitempty"`
+}
+
+// CatalogIndex describes the freshness of a provider's cached index.json
+type CatalogIndex struct {
+	Cached   bool       `json:"cached"`
+	CachedAt *time.Time `json:"cached_at,omitempty"`
+	// Stale is true once the index is older than the index TTL and will be refreshed on next use
+	Stale bool `json:"stale"`
+}
+
+// CatalogVersion describes a cached provider version
+type CatalogVersion struct {
+	Version string `json:"version"`
+	// MetadataCached reports whether the version.json document is cached
+	MetadataCached bool             `json:"metadata_cached"`
+	Archives       []CatalogArchive `json:"archives"`
+}
+
+// CatalogArchive describes a cached platform archive
+type CatalogArchive struct {
+	OS       string    `json:"os,omitempty"`
+	Arch     string    `json:"arch,omitempty"`
+	Filename string    `json:"filename"`
+	Size     int64     `json:"size"`
+	CachedAt time.Time `json:"cached_at"`
+}
+
+// Catalog returns a page of the providers held in the mirror's cache
+func (m *Mirror) Catalog(ctx context.Context, cursor string, limit int) (*Catalog, error) {
+	return BuildCatalog(ctx, m.storage, m.indexTTL, cursor, limit)
+}
+
+// BuildCatalog lists up to limit providers held in store after the provider address in cursor,
+// which is empty for the first page. A limit of zero or less uses DefaultCatalogLimit and limits
+// above MaxCatalogLimit are capped. indexTTL decides which indexes are reported stale.
+// Returns ErrCatalogUnavailable if store does not implement storage.Lister.
+func BuildCatalog(ctx context.Context, store storage.Storage, indexTTL time.Duration, cursor string, limit int) (_ *Catalog, err error) {
+	ctx, span := tracing.Start(ctx, "Mirror.Catalog")
+	defer func() { tracing.End(span, err) }()
+
+	lister, ok := store.(storage.Lister)
+	if !ok {
+		return nil, ErrCatalogUnavailable
+	}
+
+	var after storage.Provider
+	if cursor != "" {
+		parts := strings.Split(cursor, "/")
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidCursor, cursor)
+		}
+		after = storage.Provider{Hostname: parts[0], Namespace: parts[1], Type: parts[2]}
+	}
+	if limit <= 0 {
+		limit = DefaultCatalogLimit
+	}
+	limit = min(limit, MaxCatalogLimit)
+
+	// One extra provider tells whether another page follows
+	providers, err := lister.ListProviders(ctx, after, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list providers: %w", err)
+	}
+	catalog := &Catalog{Providers: make([]CatalogProvider, 0, min(len(providers), limit))}
+	if len(providers) > limit {
+		providers = providers[:limit]
+		catalog.NextCursor = providers[limit-1].String()
+	}
+
+	ageChecker, _ := store.(storage.CacheAgeChecker)
+	for _, provider := range providers {
+		entry, err := catalogProvider(ctx, store, lister, ageChecker, indexTTL, provider)
+		if err != nil {
+			return nil, err
+		}
+		catalog.Providers = append(catalog.Providers, *entry)
+	}
+	return catalog, nil
+}
+
+// catalogProvider describes the cached index, versions and archives of a provider
+func catalogProvider(ctx context.Context, store storage.Storage, lister storage.Lister, ageChecker storage.CacheAgeChecker, indexTTL time.Duration, provider storage.Provider) (*CatalogProvider, error) {
+	hostname, namespace, providerType := provider.Hostname, provider.Namespace, provider.Type
+	entry := &CatalogProvider{
+		Hostname:  hostname,
+		Namespace: namespace,
+		Type:      providerType,
+		Versions:  []CatalogVersion{},
+	}
+
+	if ageChecker != nil {
+		age, exists, err := ageChecker.IndexAge(ctx, hostname, namespace, providerType)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check index age of %s: %w", provider, err)
+		}
+		if exists {
+			cachedAt := time.Now().Add(-age).UTC()
+			entry.Index = CatalogIndex{
+				Cached:   true,
+				CachedAt: &cachedAt,
+				Stale:    indexTTL > 0 && age > indexTTL,
+			}
+		}
+	}
+
+	versionNames, err := lister.ListVersions(ctx, hostname, namespace, providerType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list versions of %s: %w", provider, err)
+	}
+	archives, err := lister.ListArchives(ctx, hostname, namespace, providerType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list archives of %s: %w", provider, err)
+	}
+
+	// Attribute archives to platforms through the cached version documents, falling back
+	// to the standard archive file name for versions whose document is not cached
+	versions := make(map[string]*CatalogVersion)
+	platforms := make(map[string]archivePlatform)
+	for _, version := range versionNames {
+		versions[version] = &CatalogVersion{Version: version, MetadataCached: true, Archives: []CatalogArchive{}}
+		data, err := store.GetVersion(ctx, hostname, namespace, providerType, version)
+		if err != nil {
+			continue
+		}
+		var response VersionResponse
+		if json.Unmarshal(data, &response) != nil {
+			continue
+		}
+		for platform, archive := range response.Archives {
+			os, arch, err := parsePlatformKey(platform)
+			if err != nil || archive.URL == "" {
+				continue
+			}
+			platforms[path.Base(archive.URL)] = archivePlatform{version, os, arch}
+		}
+	}
+
+	for _, archive := range archives {
+		filename := path.Base(archive.Path)
+		item := CatalogArchive{Filename: filename, Size: archive.Size, CachedAt: archive.CachedAt.UTC()}
+		entry.ArchiveBytes += archive.Size
+
+		platform, ok := platforms[filename]
+		if !ok {
+			platform, ok = parseProviderFilename(providerType, filename)
+		}
+		if !ok {
+			entry.OtherArchives = append(entry.OtherArchives, item)
+			continue
+		}
+		item.OS, item.Arch = platform.os, platform.arch
+		version, ok := versions[platform.version]
+		if !ok {
+			version = &CatalogVersion{Version: platform.version, Archives: []CatalogArchive{}}
+			versions[platform.version] = version
+		}
+		version.Archives = append(version.Archives, item)
+	}
+
+	for _, version := range versions {
+		entry.Versions = append(entry.Versions, *version)
+	}
+	sort.Slice(entry.Versions, func(i, j int) bool {
+		return versionLess(entry.Versions[i].Version, entry.Versions[j].Version)
+	})
+	return entry, nil
+}
+
+// archivePlatform is the version and platform an archive was built for
+type archivePlatform struct {
+	version, os, arch string
+}
+
+// parseProviderFilename reads the version and platform from a standard provider archive file name,
+// terraform-provider-TYPE_VERSION_OS_ARCH.zip
+func parseProviderFilename(providerType, filename string) (archivePlatform, bool) {
+	prefix := "terraform-provider-" + providerType + "_"
+	if !strings.HasPrefix(filename, prefix) || !strings.HasSuffix(filename, ".zip") {
+		return archivePlatform{}, false
+	}
+	parts := strings.Split(strings.TrimSuffix(strings.TrimPrefix(filename, prefix), ".zip"), "_")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return archivePlatform{}, false
+	}
+	return archivePlatform{parts[0], parts[1], parts[2]}, true
+}
+
+// versionLess orders versions by semantic version precedence, falling back to string order
+// when either version cannot be parsed
+func versionLess(a, b string) bool {
+	aVersion, aErr := goversion.NewVersion(a)
+	bVersion, bErr := goversion.NewVersion(b)
+	if aErr != nil || bErr != nil {
+		return a < b
+	}
+	return aVersion.LessThan(bVersion)
+}
@@ -0,0 +1,139 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/elisiariocouto/specular/internal/storage"
+)
+
+func TestCatalog_VersionsPlatformsAndSizes(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStorage()
+	host := "registry.terraform.io"
+	store.PutIndex(ctx, host, "hashicorp", "aws", []byte(`{"versions":{"5.0.0":{},"5.10.0":{}}}`))
+	// The version document names the archive, which does not follow the standard file name
+	store.PutVersion(ctx, host, "hashicorp", "aws", "5.10.0", []byte(
+		`{"archives":{"linux_amd64":{"url":"http://localhost:8080/terraform/providers/download/registry.terraform.io/hashicorp/aws/5.10.0/linux/amd64/aws-linux.zip"}}}`))
+	store.PutArchive(ctx, host+"/hashicorp/aws/aws-linux.zip", bytes.NewReader(make([]byte, 30)))
+	// Without a version document the standard file name identifies the platform
+	store.PutArchive(ctx, host+"/hashicorp/aws/terraform-provider-aws_5.0.0_darwin_arm64.zip", bytes.NewReader(make([]byte, 20)))
+	store.PutArchive(ctx, host+"/hashicorp/aws/unknown.bin", bytes.NewReader(make([]byte, 5)))
+
+	m := NewMirror(store, nil, "http://localhost:8080", time.Hour, Options{})
+	defer m.Shutdown()
+
+	catalog, err := m.Catalog(ctx, "", 0)
+	if err != nil {
+		t.Fatalf("Catalog failed: %v", err)
+	}
+	if len(catalog.Providers) != 1 || catalog.NextCursor != "" {
+		t.Fatalf("unexpected catalog: %+v", catalog)
+	}
+	provider := catalog.Providers[0]
+	if !provider.Index.Cached || provider.Index.Stale || provider.Index.CachedAt == nil {
+		t.Errorf("unexpected index freshness: %+v", provider.Index)
+	}
+	if provider.ArchiveBytes != 55 {
+		t.Errorf("archive bytes = %d, want 55", provider.ArchiveBytes)
+	}
+	if len(provider.OtherArchives) != 1 || provider.OtherArchives[0].Filename != "unknown.bin" {
+		t.Errorf("unexpected other archives: %+v", provider.OtherArchives)
+	}
+
+	if len(provider.Versions) != 2 {
+		t.Fatalf("versions = %+v, want 5.0.0 and 5.10.0", provider.Versions)
+	}
+	older, newer := provider.Versions[0], provider.Versions[1]
+	if older.Version != "5.0.0" || older.MetadataCached || len(older.Archives) != 1 ||
+		older.Archives[0].OS != "darwin" || older.Archives[0].Arch != "arm64" || older.Archives[0].Size != 20 {
+		t.Errorf("unexpected version 5.0.0: %+v", older)
+	}
+	if newer.Version != "5.10.0" || !newer.MetadataCached || len(newer.Archives) != 1 ||
+		newer.Archives[0].OS != "linux" || newer.Archives[0].Filename != "aws-linux.zip" || newer.Archives[0].CachedAt.IsZero() {
+		t.Errorf("unexpected version 5.10.0: %+v", newer)
+	}
+}
+
+func TestCatalog_Pagination(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStorage()
+	for _, providerType := range []string{"aws", "google", "random"} {
+		store.PutIndex(ctx, "registry.terraform.io", "hashicorp", providerType, []byte(`{"versions":{}}`))
+	}
+
+	var types []string
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages == 3 {
+			t.Fatal("pagination did not end")
+		}
+		catalog, err := BuildCatalog(ctx, store, 0, cursor, 2)
+		if err != nil {
+			t.Fatalf("BuildCatalog failed: %v", err)
+		}
+		for _, provider := range catalog.Providers {
+			types = append(types, provider.Type)
+		}
+		if catalog.NextCursor == "" {
+			break
+		}
+		cursor = catalog.NextCursor
+	}
+	if len(types) != 3 || types[0] != "aws" || types[1] != "google" || types[2] != "random" {
+		t.Errorf("paged providers = %v", types)
+	}
+
+	if _, err := BuildCatalog(ctx, store, 0, "registry.terraform.io/hashicorp", 2); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+func TestCatalog_SkipsInvalidHostnameDirectories(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := storage.NewFilesystemStorage(dir)
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+	store.CheckHostnames(CheckHostname)
+	store.PutIndex(ctx, "registry.terraform.io", "hashicorp", "aws", []byte(`{"versions":{}}`))
+	for _, stray := range []string{"lost+found/a/b", "Registry.Terraform.io/hashicorp/aws", "registry.terraform.io:443/hashicorp/aws"} {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.FromSlash(stray)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	catalog, err := BuildCatalog(ctx, store, 0, "", 0)
+	if err != nil {
+		t.Fatalf("BuildCatalog failed: %v", err)
+	}
+	if len(catalog.Providers) != 1 || catalog.Providers[0].Hostname != "registry.terraform.io" {
+		t.Errorf("expected only registry.terraform.io/hashicorp/aws, got %+v", catalog.Providers)
+	}
+}
+
+func TestCatalog_StorageWithoutLister(t *testing.T) {
+	if _, err := BuildCatalog(context.Background(), NewMockStorage(), 0, "", 0); !errors.Is(err, ErrCatalogUnavailable) {
+		t.Errorf("expected ErrCatalogUnavailable, got %v", err)
+	}
+}
+
+func TestVersionLess(t *testing.T) {
+	ordered := []string{"1.2.0", "1.10.0", "2.0.0-beta1", "2.0.0-rc1", "2.0.0", "v2.0.1", "2.0.1.1"}
+	for i := 1; i < len(ordered); i++ {
+		if !versionLess(ordered[i-1], ordered[i]) || versionLess(ordered[i], ordered[i-1]) {
+			t.Errorf("expected %s < %s", ordered[i-1], ordered[i])
+		}
+	}
+
+	// Versions that do not parse fall back to string order
+	if !versionLess("1.0.0", "latest") || versionLess("latest", "1.0.0") {
+		t.Error("expected unparseable versions to compare as strings")
+	}
+}
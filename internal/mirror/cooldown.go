@@ -0,0 +1,141 @@
+package mirror
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/elisiariocouto/specular/internal/authz"
+)
+
+// cooldownOverride sets the cooldown for providers matching a pattern
+type cooldownOverride struct {
+	pattern  string
+	duration time.Duration
+}
+
+// cooldownBypass exempts a provider, or a single version of it, from the cooldown
+type cooldownBypass struct {
+	pattern string
+	version string
+}
+
+// ReleaseCooldown hides provider versions until they have been public for a minimum duration
+type ReleaseCooldown struct {
+	defaultDuration time.Duration
+	overrides       []cooldownOverride
+	bypass          []cooldownBypass
+}
+
+// NewReleaseCooldown builds a release cooldown from a default duration, "pattern=duration" overrides,
+// and "pattern" or "pattern@version" bypass entries. The first matching override wins.
+func NewReleaseCooldown(defaultDuration time.Duration, overrides, bypass []string) (*ReleaseCooldown, error) {
+	c := &ReleaseCooldown{defaultDuration: defaultDuration}
+
+	for _, entry := range overrides {
+		pattern, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("cooldown override %q must be pattern=duration", entry)
+		}
+		if err := authz.ValidateProviderPattern(pattern); err != nil {
+			return nil, err
+		}
+		duration, err := time.ParseDuration(value)
+		if err != nil || duration < 0 {
+			return nil, fmt.Errorf("cooldown override %q has an invalid duration", entry)
+		}
+		c.overrides = append(c.overrides, cooldownOverride{pattern: pattern, duration: duration})
+	}
+
+	for _, entry := range bypass {
+		pattern, version, _ := strings.Cut(entry, "@")
+		if err := authz.ValidateProviderPattern(pattern); err != nil {
+			return nil, err
+		}
+		c.bypass = append(c.bypass, cooldownBypass{pattern: pattern, version: version})
+	}
+
+	return c, nil
+}
+
+// durationFor returns the cooldown that applies to a provider
+func (c *ReleaseCooldown) durationFor(resource authz.Resource) time.Duration {
+	for _, o := range c.overrides {
+		if authz.MatchProvider(o.pattern, resource) {
+			return o.duration
+		}
+	}
+	return c.defaultDuration
+}
+
+// activeFor returns the cooldown for a provider, or zero if no cooldown applies to any of its versions
+func (c *ReleaseCooldown) activeFor(hostname, namespace, providerType string) time.Duration {
+	resource := authz.Resource{Hostname: hostname, Namespace: namespace, Type: providerType}
+	for _, b := range c.bypass {
+		if b.version == "" && authz.MatchProvider(b.pattern, resource) {
+			return 0
+		}
+	}
+	return c.durationFor(resource)
+}
+
+// bypassed reports whether a specific version is exempt from the cooldown
+func (c *ReleaseCooldown) bypassed(hostname, namespace, providerType, version string) bool {
+	resource := authz.Resource{Hostname: hostname, Namespace: namespace, Type: providerType}
+	for _, b := range c.bypass {
+		if (b.version == "" || b.version == version) && authz.MatchProvider(b.pattern, resource) {
+			return true
+		}
+	}
+	return false
+}
+
+// Hides reports whether a version released at releasedAt is still within its cooldown at now.
+// A zero release time means the version predates Specular's first listing and is never hidden.
+func (c *ReleaseCooldown) Hides(hostname, namespace, providerType, version string, releasedAt, now time.Time) bool {
+	if releasedAt.IsZero() || c.bypassed(hostname, namespace, providerType, version) {
+		return false
+	}
+	duration := c.activeFor(hostname, namespace, providerType)
+	return duration > 0 && now.Sub(releasedAt) < duration
+}
+
+// releasedAt returns when a version became available: the upstream publish time if known,
+// otherwise the first time Specular saw it
+func (v RegistryVersion) releasedAt() time.Time {
+	if v.PublishedAt != nil {
+		return *v.PublishedAt
+	}
+	if v.FirstSeen != nil {
+		return *v.FirstSeen
+	}
+	return time.Time{}
+}
+
+// recordFirstSeen stamps versions missing from the previous versions response with now and
+// carries first-seen times over for versions seen before. On the first listing of a provider
+// (previous is nil) nothing is stamped, so existing versions are not held back.
+// It returns the versions that are new since the previous listing.
+func recordFirstSeen(previous, current *RegistryVersionsResponse, now time.Time) []string {
+	if previous == nil {
+		return nil
+	}
+
+	seen := make(map[string]*time.Time, len(previous.Versions))
+	for _, v := range previous.Versions {
+		seen[v.Version] = v.FirstSeen
+	}
+
+	var added []string
+	for i := range current.Versions {
+		v := &current.Versions[i]
+		firstSeen, ok := seen[v.Version]
+		if !ok {
+			stamp := now
+			firstSeen = &stamp
+			added = append(added, v.Version)
+		}
+		v.FirstSeen = firstSeen
+	}
+	return added
+}
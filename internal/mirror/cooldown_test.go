@@ -0,0 +1,167 @@
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewReleaseCooldown_Invalid(t *testing.T) {
+	tests := []struct {
+		name      string
+		overrides []string
+		bypass    []string
+	}{
+		{"override without duration", []string{"hashicorp/aws"}, nil},
+		{"override with invalid duration", []string{"hashicorp/aws=soon"}, nil},
+		{"override with negative duration", []string{"hashicorp/aws=-1h"}, nil},
+		{"override with invalid pattern", []string{"aws=24h"}, nil},
+		{"bypass with invalid pattern", nil, []string{"aws@1.0.0"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewReleaseCooldown(72*time.Hour, tt.overrides, tt.bypass); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestReleaseCooldown_Hides(t *testing.T) {
+	cooldown, err := NewReleaseCooldown(72*time.Hour,
+		[]string{"hashicorp/google=1h", "ourcorp/*=0s"},
+		[]string{"hashicorp/aws@5.70.1", "hashicorp/null"})
+	if err != nil {
+		t.Fatalf("NewReleaseCooldown failed: %v", err)
+	}
+
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name         string
+		providerType string
+		namespace    string
+		version      string
+		age          time.Duration
+		hidden       bool
+	}{
+		{"within default cooldown", "aws", "hashicorp", "5.70.0", 24 * time.Hour, true},
+		{"past default cooldown", "aws", "hashicorp", "5.69.0", 96 * time.Hour, false},
+		{"bypassed version", "aws", "hashicorp", "5.70.1", time.Minute, false},
+		{"bypassed provider", "null", "hashicorp", "3.2.0", time.Minute, false},
+		{"shorter override", "google", "hashicorp", "6.0.0", 2 * time.Hour, false},
+		{"within shorter override", "google", "hashicorp", "6.0.1", 30 * time.Minute, true},
+		{"disabled override", "internal", "ourcorp", "1.0.0", time.Minute, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := cooldown.Hides("registry.terraform.io", tt.namespace, tt.providerType, tt.version, now.Add(-tt.age), now)
+			if got != tt.hidden {
+				t.Errorf("Hides() = %v, want %v", got, tt.hidden)
+			}
+		})
+	}
+
+	if cooldown.Hides("registry.terraform.io", "hashicorp", "aws", "5.70.0", time.Time{}, now) {
+		t.Error("versions without a release time should never be hidden")
+	}
+}
+
+func TestRecordFirstSeen(t *testing.T) {
+	earlier := time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC)
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	// First listing: nothing is stamped
+	first := &RegistryVersionsResponse{Versions: []RegistryVersion{{Version: "1.0.0"}}}
+	if added := recordFirstSeen(nil, first, now); len(added) != 0 {
+		t.Errorf("expected no new versions on first listing, got %v", added)
+	}
+	if first.Versions[0].FirstSeen != nil {
+		t.Error("expected versions in the first listing to have no first-seen time")
+	}
+
+	previous := &RegistryVersionsResponse{Versions: []RegistryVersion{
+		{Version: "1.0.0"},
+		{Version: "1.1.0", FirstSeen: &earlier},
+	}}
+	current := &RegistryVersionsResponse{Versions: []RegistryVersion{
+		{Version: "1.0.0"},
+		{Version: "1.1.0"},
+		{Version: "1.2.0"},
+	}}
+
+	added := recordFirstSeen(previous, current, now)
+	if len(added) != 1 || added[0] != "1.2.0" {
+		t.Errorf("expected 1.2.0 to be new, got %v", added)
+	}
+	if current.Versions[0].FirstSeen != nil {
+		t.Error("expected 1.0.0 to keep having no first-seen time")
+	}
+	if current.Versions[1].FirstSeen == nil || !current.Versions[1].FirstSeen.Equal(earlier) {
+		t.Errorf("expected 1.1.0 to keep its first-seen time, got %v", current.Versions[1].FirstSeen)
+	}
+	if current.Versions[2].FirstSeen == nil || !current.Versions[2].FirstSeen.Equal(now) {
+		t.Errorf("expected 1.2.0 to be stamped with now, got %v", current.Versions[2].FirstSeen)
+	}
+}
+
+// TestCooldown_HidesRecentVersions tests that recently released versions are removed from
+// index.json and cannot be fetched, using upstream publish times or first-seen times
+func TestCooldown_HidesRecentVersions(t *testing.T) {
+	mockStorage := NewMockStorage()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("upstream should not be called when cache hit")
+	}))
+	defer server.Close()
+
+	cooldown, err := NewReleaseCooldown(72*time.Hour, nil, nil)
+	if err != nil {
+		t.Fatalf("NewReleaseCooldown failed: %v", err)
+	}
+	m := NewMirror(mockStorage, newTestUpstreamClientForMirror(server), "http://localhost:8080", 0,
+		Options{Cooldown: cooldown})
+
+	ctx := context.Background()
+	hostname, namespace, providerType := "registry.terraform.io", "hashicorp", "aws"
+	recent := time.Now().Add(-time.Hour)
+	old := time.Now().Add(-30 * 24 * time.Hour)
+
+	versionsResp := RegistryVersionsResponse{Versions: []RegistryVersion{
+		{Version: "5.0.0", Platforms: []RegistryPlatform{{OS: "linux", Arch: "amd64"}}},
+		{Version: "5.1.0", Platforms: []RegistryPlatform{{OS: "linux", Arch: "amd64"}}, PublishedAt: &old, FirstSeen: &recent},
+		{Version: "5.2.0", Platforms: []RegistryPlatform{{OS: "linux", Arch: "amd64"}}, PublishedAt: &recent},
+		{Version: "5.3.0", Platforms: []RegistryPlatform{{OS: "linux", Arch: "amd64"}}, FirstSeen: &recent},
+	}}
+	versionsData, _ := json.Marshal(versionsResp)
+	mockStorage.PutVersionsResponse(ctx, hostname, namespace, providerType, versionsData)
+	mockStorage.PutIndex(ctx, hostname, namespace, providerType,
+		[]byte(`{"versions":{"5.0.0":{},"5.1.0":{},"5.2.0":{},"5.3.0":{}}}`))
+
+	data, err := m.GetIndex(ctx, hostname, namespace, providerType)
+	if err != nil {
+		t.Fatalf("GetIndex failed: %v", err)
+	}
+	var index IndexResponse
+	if err := json.Unmarshal(data, &index); err != nil {
+		t.Fatalf("failed to parse index: %v", err)
+	}
+	if len(index.Versions) != 2 {
+		t.Errorf("expected 5.0.0 and 5.1.0 to be advertised, got %v", index.Versions)
+	}
+	for _, v := range []string{"5.0.0", "5.1.0"} {
+		if _, ok := index.Versions[v]; !ok {
+			t.Errorf("expected %s in index", v)
+		}
+	}
+
+	if _, err := m.GetVersion(ctx, hostname, namespace, providerType, "5.3.0"); err != ErrNotFound {
+		t.Errorf("GetVersion: expected ErrNotFound for version in cooldown, got %v", err)
+	}
+	if _, err := m.GetArchive(ctx, hostname, namespace, providerType, "5.2.0", "linux", "amd64"); err != ErrNotFound {
+		t.Errorf("GetArchive: expected ErrNotFound for version in cooldown, got %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package mirror
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// tokenEnvPrefix is the prefix of Terraform-style per-host token environment variables
+const tokenEnvPrefix = "TF_TOKEN_"
+
+// Credentials holds bearer tokens for upstream registries, keyed by host
+// A nil *Credentials holds no tokens
+type Credentials struct {
+	tokens map[string]string
+}
+
+// credentialsFile matches the credentials block of Terraform's credentials.tfrc.json
+type credentialsFile struct {
+	Credentials map[string]struct {
+		Token string `json:"token"`
+	} `json:"credentials"`
+}
+
+// LoadCredentials builds upstream credentials from an optional credentials file and
+// TF_TOKEN_<host> environment variables, with environment variables taking precedence
+func LoadCredentials(path string, environ []string) (*Credentials, error) {
+	c := &Credentials{tokens: make(map[string]string)}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read credentials file: %w", err)
+		}
+
+		var file credentialsFile
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("failed to parse credentials file: %w", err)
+		}
+
+		for host, entry := range file.Credentials {
+			if entry.Token == "" {
+				return nil, fmt.Errorf("credentials for %s have no token", host)
+			}
+			c.tokens[normalizeCredentialsHost(host)] = entry.Token
+		}
+	}
+
+	for _, kv := range environ {
+		name, token, ok := strings.Cut(kv, "=")
+		if !ok || !strings.HasPrefix(name, tokenEnvPrefix) || token == "" {
+			continue
+		}
+		host := decodeTokenEnvHost(strings.TrimPrefix(name, tokenEnvPrefix))
+		if host == "" {
+			continue
+		}
+		c.tokens[host] = token
+	}
+
+	return c, nil
+}
+
+// decodeTokenEnvHost converts the host part of a TF_TOKEN_ variable name back into a hostname
+// Following Terraform, double underscores encode hyphens and single underscores encode periods
+func decodeTokenEnvHost(encoded string) string {
+	parts := strings.Split(encoded, "__")
+	for i, part := range parts {
+		parts[i] = strings.ReplaceAll(part, "_", ".")
+	}
+	return normalizeCredentialsHost(strings.Join(parts, "-"))
+}
+
+// normalizeCredentialsHost lowercases a host and drops the default HTTPS port
+func normalizeCredentialsHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if h, port, err := net.SplitHostPort(host); err == nil && port == "443" {
+		return h
+	}
+	return host
+}
+
+// Len returns the number of hosts with configured credentials
+func (c *Credentials) Len() int {
+	if c == nil {
+		return 0
+	}
+	return len(c.tokens)
+}
+
+// tokenFor returns the token configured for the exact host
+func (c *Credentials) tokenFor(host string) (string, bool) {
+	if c == nil || host == "" {
+		return "", false
+	}
+	token, ok := c.tokens[normalizeCredentialsHost(host)]
+	return token, ok
+}
+
+// authorize adds the bearer token of the registry or mirror host a request is made for,
+// which is not necessarily the request's own host: a registry's discovered API may live
+// elsewhere. An empty host, as for archive downloads, leaves the request untouched.
+func (c *Credentials) authorize(req *http.Request, host string) {
+	if token, ok := c.tokenFor(host); ok {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+}
@@ -0,0 +1,218 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLoadCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials.tfrc.json")
+	content := `{"credentials": {
+		"App.Terraform.io": {"token": "from-file"},
+		"tfe.example.com:443": {"token": "file-only"},
+		"registry.example.com:8443": {"token": "with-port"}
+	}}`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("failed to write credentials file: %v", err)
+	}
+
+	creds, err := LoadCredentials(path, []string{
+		"TF_TOKEN_app_terraform_io=from-env",
+		"TF_TOKEN_my__registry_example_com=hyphenated",
+		"TF_TOKEN_empty_example_com=",
+		"HOME=/root",
+	})
+	if err != nil {
+		t.Fatalf("LoadCredentials failed: %v", err)
+	}
+
+	tests := []struct {
+		url       string
+		wantToken string
+		wantOK    bool
+	}{
+		{url: "https://app.terraform.io/v1/providers/", wantToken: "from-env", wantOK: true},
+		{url: "https://tfe.example.com/.well-known/terraform.json", wantToken: "file-only", wantOK: true},
+		{url: "https://TFE.example.com:443/v1/", wantToken: "file-only", wantOK: true},
+		{url: "https://my-registry.example.com/", wantToken: "hyphenated", wantOK: true},
+		{url: "https://registry.example.com:8443/v1/", wantToken: "with-port", wantOK: true},
+		{url: "https://registry.example.com/v1/"},
+		{url: "https://empty.example.com/"},
+		{url: "https://objects.githubusercontent.com/archive.zip"},
+	}
+
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.url)
+		token, ok := creds.tokenFor(u.Host)
+		if ok != tt.wantOK || token != tt.wantToken {
+			t.Errorf("tokenFor(%s) = %q, %t; want %q, %t", tt.url, token, ok, tt.wantToken, tt.wantOK)
+		}
+	}
+}
+
+func TestLoadCredentials_Invalid(t *testing.T) {
+	dir := t.TempDir()
+
+	if _, err := LoadCredentials(filepath.Join(dir, "missing.json"), nil); err == nil {
+		t.Error("expected error for missing credentials file")
+	}
+
+	path := filepath.Join(dir, "notoken.json")
+	os.WriteFile(path, []byte(`{"credentials": {"tfe.example.com": {}}}`), 0600)
+	if _, err := LoadCredentials(path, nil); err == nil {
+		t.Error("expected error for credentials without a token")
+	}
+}
+
+func TestCredentials_NotForwardedToArchiveHost(t *testing.T) {
+	var mu sync.Mutex
+	seen := make(map[string]string)
+	record := func(r *http.Request) {
+		mu.Lock()
+		seen[r.URL.Path] = r.Header.Get("Authorization")
+		mu.Unlock()
+	}
+
+	archiveServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		record(r)
+		w.Write([]byte("archive"))
+	}))
+	defer archiveServer.Close()
+
+	registry := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		record(r)
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/.well-known/terraform.json":
+			w.Write([]byte(`{"providers.v1":"/v1/providers/"}`))
+		case "/v1/providers/ourcorp/internal/versions":
+			w.Write([]byte(`{"versions":[{"version":"1.0.0","platforms":[{"os":"linux","arch":"amd64"}]}]}`))
+		case "/v1/providers/ourcorp/internal/1.0.0/download/linux/amd64":
+			fmt.Fprintf(w, `{"filename":"a.zip","download_url":"%s/a.zip"}`, archiveServer.URL)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer registry.Close()
+
+	u, _ := url.Parse(registry.URL)
+	creds, err := LoadCredentials("", nil)
+	if err != nil {
+		t.Fatalf("LoadCredentials failed: %v", err)
+	}
+	creds.tokens[u.Host] = "secret"
+
+	client := registry.Client()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	discoveryCache := NewDiscoveryCache(time.Minute, client, logger)
+	discoveryCache.credentials = creds
+	uc := &UpstreamClient{
+		httpClient:     client,
+		logger:         logger,
+		discoveryCache: discoveryCache,
+		credentials:    creds,
+	}
+
+	ctx := context.Background()
+	if _, _, err := uc.FetchIndex(ctx, u.Host, "ourcorp", "internal"); err != nil {
+		t.Fatalf("FetchIndex failed: %v", err)
+	}
+	info, err := uc.FetchDownloadURL(ctx, u.Host, "ourcorp", "internal", "1.0.0", "linux", "amd64")
+	if err != nil {
+		t.Fatalf("FetchDownloadURL failed: %v", err)
+	}
+	body, err := uc.FetchArchive(ctx, "registry.terraform.io", info.DownloadURL)
+	if err != nil {
+		t.Fatalf("FetchArchive failed: %v", err)
+	}
+	body.Close()
+
+	for _, path := range []string{
+		"/.well-known/terraform.json",
+		"/v1/providers/ourcorp/internal/versions",
+		"/v1/providers/ourcorp/internal/1.0.0/download/linux/amd64",
+	} {
+		if seen[path] != "Bearer secret" {
+			t.Errorf("expected token on %s, got %q", path, seen[path])
+		}
+	}
+	if auth, ok := seen["/a.zip"]; !ok || auth != "" {
+		t.Errorf("expected archive request without credentials, got %q (requested=%t)", auth, ok)
+	}
+}
+
+func TestCredentials_SentToDiscoveredAPIHost(t *testing.T) {
+	var mu sync.Mutex
+	seen := make(map[string]string)
+	api := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen[r.URL.Path] = r.Header.Get("Authorization")
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/api/v1/providers/ourcorp/internal/versions":
+			w.Write([]byte(`{"versions":[{"version":"1.0.0","platforms":[{"os":"linux","arch":"amd64"}]}]}`))
+		case "/api/v1/providers/ourcorp/internal/1.0.0/download/linux/amd64":
+			w.Write([]byte(`{"filename":"a.zip","download_url":"https://archives.example.com/a.zip"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer api.Close()
+
+	registry := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"providers.v1":"%s/api/v1/providers/"}`, api.URL)
+	}))
+	defer registry.Close()
+
+	u, _ := url.Parse(registry.URL)
+	apiURL, _ := url.Parse(api.URL)
+	creds, err := LoadCredentials("", nil)
+	if err != nil {
+		t.Fatalf("LoadCredentials failed: %v", err)
+	}
+	creds.tokens[u.Host] = "registry-token"
+	creds.tokens[apiURL.Host] = "api-token"
+
+	client := registry.Client()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	discoveryCache := NewDiscoveryCache(time.Minute, client, logger)
+	discoveryCache.credentials = creds
+	uc := &UpstreamClient{
+		httpClient:     client,
+		logger:         logger,
+		discoveryCache: discoveryCache,
+		credentials:    creds,
+	}
+
+	ctx := context.Background()
+	if _, _, err := uc.FetchIndex(ctx, u.Host, "ourcorp", "internal"); err != nil {
+		t.Fatalf("FetchIndex failed: %v", err)
+	}
+	if _, err := uc.FetchDownloadURL(ctx, u.Host, "ourcorp", "internal", "1.0.0", "linux", "amd64"); err != nil {
+		t.Fatalf("FetchDownloadURL failed: %v", err)
+	}
+
+	// The token belongs to the registry being resolved, not to the host serving its API
+	for _, path := range []string{
+		"/api/v1/providers/ourcorp/internal/versions",
+		"/api/v1/providers/ourcorp/internal/1.0.0/download/linux/amd64",
+	} {
+		if seen[path] != "Bearer registry-token" {
+			t.Errorf("expected the registry token on %s, got %q", path, seen[path])
+		}
+	}
+}
@@ -3,19 +3,82 @@ package mirror
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"net"
 	"net/http"
 	"net/url"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/elisiariocouto/specular/internal/storage"
+	"github.com/elisiariocouto/specular/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/net/idna"
 )
 
+// maxDiscoveryRedirects limits how many redirects are followed for .well-known/terraform.json
+const maxDiscoveryRedirects = 3
+
 // ServiceDiscovery represents the response from .well-known/terraform.json
 type ServiceDiscovery struct {
-	Hostname    string    `json:"-"`
-	ProvidersV1 string    `json:"providers.v1"`
-	CachedAt    time.Time `json:"-"`
+	Hostname    string `json:"-"`
+	ProvidersV1 string `json:"providers.v1"`
+	// ProvidersURL is ProvidersV1 resolved against the URL the discovery document was served from
+	ProvidersURL string    `json:"-"`
+	CachedAt     time.Time `json:"-"`
+}
+
+// storedDiscovery is the persisted form of a service discovery result
+type storedDiscovery struct {
+	ProvidersV1  string    `json:"providers.v1"`
+	ProvidersURL string    `json:"providers_url"`
+	CachedAt     time.Time `json:"cached_at"`
+}
+
+// discoveryKey returns the metadata key of a hostname's persisted service discovery
+func discoveryKey(hostname string) string {
+	return "discovery/" + hostname
+}
+
+// normalizeHostname converts a registry hostname to the ASCII form used on the network.
+// Internationalized names are converted to punycode, explicit ports are kept and the
+// default HTTPS port is dropped.
+func normalizeHostname(hostname string) (string, error) {
+	host, port := strings.TrimSuffix(strings.TrimPrefix(hostname, "["), "]"), ""
+	if h, p, err := net.SplitHostPort(hostname); err == nil {
+		host, port = h, p
+	}
+
+	if net.ParseIP(host) == nil {
+		ascii, err := idna.Lookup.ToASCII(host)
+		if err != nil {
+			return "", fmt.Errorf("invalid registry hostname %q: %w", hostname, err)
+		}
+		host = ascii
+	}
+
+	if port == "" || port == "443" {
+		if strings.Contains(host, ":") {
+			return "[" + host + "]", nil
+		}
+		return host, nil
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// checkDiscoveryRedirect follows discovery redirects only to HTTPS URLs, and only a few times
+func checkDiscoveryRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) > maxDiscoveryRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxDiscoveryRedirects)
+	}
+	if req.URL.Scheme != "https" {
+		return fmt.Errorf("refusing to follow service discovery redirect to %s URL", req.URL.Scheme)
+	}
+	return nil
 }
 
 // DiscoveryCache caches service discovery responses with TTL
@@ -27,16 +90,25 @@ type DiscoveryCache struct {
 	ttl      time.Duration
 	client   *http.Client
 	logger   *slog.Logger
+
+	credentials *Credentials // nil sends discovery requests unauthenticated
+
+	// store persists discovery results across restarts; nil keeps them in memory only
+	store     storage.MetadataStore
+	refresher *IndexRefresher
+	breaker   *circuitBreaker // nil never fails discovery fast
+	onRequest func(host string, status int, duration time.Duration)
 }
 
 // NewDiscoveryCache creates a new discovery cache
 func NewDiscoveryCache(ttl time.Duration, client *http.Client, logger *slog.Logger) *DiscoveryCache {
 	dc := &DiscoveryCache{
-		cache:    make(map[string]*ServiceDiscovery),
-		inFlight: make(map[string]bool),
-		ttl:      ttl,
-		client:   client,
-		logger:   logger,
+		cache:     make(map[string]*ServiceDiscovery),
+		inFlight:  make(map[string]bool),
+		ttl:       ttl,
+		client:    client,
+		logger:    logger,
+		refresher: NewIndexRefresher(),
 	}
 	dc.cond = sync.NewCond(&dc.mu)
 	return dc
@@ -77,27 +149,48 @@ func isValidProvidersURL(urlStr string) bool {
 // DiscoverServices discovers the service endpoints for a Terraform registry
 // It fetches https://{hostname}/.well-known/terraform.json and caches the result.
 // Multiple concurrent requests for the same hostname will coalesce to a single upstream fetch.
-func (dc *DiscoveryCache) DiscoverServices(ctx context.Context, hostname string) (*ServiceDiscovery, error) {
-	dc.mu.Lock()
-	defer dc.mu.Unlock()
+// Expired results are served while being refreshed in the background, so a registry
+// outage does not break hosts that were discovered before, even across restarts.
+func (dc *DiscoveryCache) DiscoverServices(ctx context.Context, hostname string) (_ *ServiceDiscovery, err error) {
+	ctx, span := tracing.Start(ctx, "DiscoveryCache.DiscoverServices", attribute.String("specular.provider.hostname", hostname))
+	defer func() { tracing.End(span, err) }()
 
-	// Check cache first
-	if cached, ok := dc.cache[hostname]; ok {
-		// Check if cache is still valid
+	// Check cache first, falling back to the persisted result after a restart. Storage is read
+	// outside the lock so a slow store does not hold up lookups of other hostnames.
+	dc.mu.Lock()
+	cached := dc.cache[hostname]
+	dc.mu.Unlock()
+	if cached == nil {
+		if persisted := dc.loadPersisted(ctx, hostname); persisted != nil {
+			dc.mu.Lock()
+			// A result published while the store was read is newer
+			if cached = dc.cache[hostname]; cached == nil {
+				cached = persisted
+				dc.cache[hostname] = cached
+			}
+			dc.mu.Unlock()
+		}
+	}
+	span.SetAttributes(tracing.CacheHit(cached != nil))
+	if cached != nil {
 		if time.Since(cached.CachedAt) < dc.ttl {
 			dc.logger.DebugContext(ctx, "using cached service discovery",
 				slog.String("hostname", hostname),
 				slog.String("providers_v1", cached.ProvidersV1))
 			return cached, nil
 		}
+		dc.maybeRefresh(hostname, cached)
+		return cached, nil
 	}
 
 	// Wait for any in-flight request for this hostname to complete
+	dc.mu.Lock()
 	for dc.inFlight[hostname] {
 		dc.cond.Wait()
 		// After waiting, check cache again in case the in-flight request succeeded
 		if cached, ok := dc.cache[hostname]; ok {
 			if time.Since(cached.CachedAt) < dc.ttl {
+				dc.mu.Unlock()
 				dc.logger.DebugContext(ctx, "using service discovery from coalesced request",
 					slog.String("hostname", hostname),
 					slog.String("providers_v1", cached.ProvidersV1))
@@ -113,24 +206,107 @@ func (dc *DiscoveryCache) DiscoverServices(ctx context.Context, hostname string)
 	// Fetch from upstream (outside the lock)
 	discovery, err := dc.fetchFromUpstream(ctx, hostname)
 
-	// Update cache and signal waiters
+	// Update cache and signal waiters, then persist outside the lock
 	dc.mu.Lock()
 	delete(dc.inFlight, hostname)
+	if err == nil {
+		dc.cache[hostname] = discovery
+	}
+	dc.cond.Broadcast()
+	dc.mu.Unlock()
 
 	if err != nil {
-		dc.cond.Broadcast()
 		return nil, err
 	}
+	dc.persist(ctx, discovery)
+	return discovery, nil
+}
 
-	// Validate ProvidersV1 URL before caching
-	if !isValidProvidersURL(discovery.ProvidersV1) {
-		dc.cond.Broadcast()
-		return nil, fmt.Errorf("invalid providers.v1 URL in service discovery: %q", discovery.ProvidersV1)
+// maybeRefresh refreshes an expired discovery result in the background
+// The expired result keeps being served until a refresh succeeds
+func (dc *DiscoveryCache) maybeRefresh(hostname string, stale *ServiceDiscovery) {
+	age := time.Since(stale.CachedAt)
+	dc.refresher.TryRefresh(hostname, "", "", func(ctx context.Context) {
+		dc.logger.InfoContext(ctx, fmt.Sprintf("background discovery refresh started [hostname=%s age=%s ttl=%s]",
+			hostname, age.Round(time.Second), dc.ttl),
+			slog.String("hostname", hostname),
+			slog.String("age", age.String()),
+			slog.String("ttl", dc.ttl.String()))
+
+		discovery, err := dc.fetchFromUpstream(ctx, hostname)
+		if err != nil {
+			dc.logger.WarnContext(ctx, fmt.Sprintf("background discovery refresh failed, stale providers.v1 will continue to be served [hostname=%s providers_v1=%s err=%s]",
+				hostname, stale.ProvidersV1, err),
+				slog.String("hostname", hostname),
+				slog.String("providers_v1", stale.ProvidersV1),
+				slog.String("error", err.Error()))
+			return
+		}
+
+		dc.mu.Lock()
+		dc.cache[hostname] = discovery
+		dc.mu.Unlock()
+		dc.persist(ctx, discovery)
+
+		dc.logger.InfoContext(ctx, fmt.Sprintf("background discovery refresh completed [hostname=%s providers_v1=%s]",
+			hostname, discovery.ProvidersV1),
+			slog.String("hostname", hostname),
+			slog.String("providers_v1", discovery.ProvidersV1))
+	})
+}
+
+// loadPersisted returns the persisted discovery result for a hostname, or nil if there is none
+func (dc *DiscoveryCache) loadPersisted(ctx context.Context, hostname string) *ServiceDiscovery {
+	if dc.store == nil {
+		return nil
 	}
 
-	dc.cache[hostname] = discovery
-	dc.cond.Broadcast()
-	return discovery, nil
+	data, err := dc.store.GetMetadata(ctx, discoveryKey(hostname))
+	if err != nil {
+		if !errors.Is(err, io.EOF) {
+			dc.logger.WarnContext(ctx, fmt.Sprintf("failed to read persisted service discovery [hostname=%s err=%s]", hostname, err),
+				slog.String("hostname", hostname),
+				slog.String("error", err.Error()))
+		}
+		return nil
+	}
+
+	var stored storedDiscovery
+	if err := json.Unmarshal(data, &stored); err != nil || !isValidProvidersURL(stored.ProvidersURL) {
+		return nil
+	}
+	return &ServiceDiscovery{
+		Hostname:     hostname,
+		ProvidersV1:  stored.ProvidersV1,
+		ProvidersURL: stored.ProvidersURL,
+		CachedAt:     stored.CachedAt,
+	}
+}
+
+// persist stores a discovery result so it survives restarts
+func (dc *DiscoveryCache) persist(ctx context.Context, discovery *ServiceDiscovery) {
+	if dc.store == nil {
+		return
+	}
+
+	data, err := json.Marshal(storedDiscovery{
+		ProvidersV1:  discovery.ProvidersV1,
+		ProvidersURL: discovery.ProvidersURL,
+		CachedAt:     discovery.CachedAt,
+	})
+	if err == nil {
+		err = dc.store.PutMetadata(ctx, discoveryKey(discovery.Hostname), data)
+	}
+	if err != nil {
+		dc.logger.WarnContext(ctx, fmt.Sprintf("failed to persist service discovery [hostname=%s err=%s]", discovery.Hostname, err),
+			slog.String("hostname", discovery.Hostname),
+			slog.String("error", err.Error()))
+	}
+}
+
+// Shutdown cancels background discovery refreshes and waits for them to finish
+func (dc *DiscoveryCache) Shutdown() {
+	dc.refresher.Shutdown()
 }
 
 // fetchFromUpstream fetches service discovery from the .well-known endpoint
@@ -138,14 +314,36 @@ func (dc *DiscoveryCache) fetchFromUpstream(ctx context.Context, hostname string
 	dc.logger.DebugContext(ctx, "discovering services from .well-known",
 		slog.String("hostname", hostname))
 
-	wellKnownURL := fmt.Sprintf("https://%s/.well-known/terraform.json", hostname)
+	host, err := normalizeHostname(hostname)
+	if err != nil {
+		return nil, err
+	}
+	wellKnownURL := fmt.Sprintf("https://%s/.well-known/terraform.json", host)
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wellKnownURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create discovery request: %w", err)
 	}
+	dc.credentials.authorize(req, host)
 
-	resp, err := dc.client.Do(req)
+	// Redirects are part of the protocol; the shared client is copied so the
+	// stricter redirect policy only applies to discovery
+	client := *dc.client
+	client.CheckRedirect = checkDiscoveryRedirect
+
+	if err := dc.breaker.allow(host); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	if dc.onRequest != nil {
+		dc.onRequest(host, status, time.Since(start))
+	}
+	dc.breaker.record(ctx, host, status, err)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch service discovery: %w", err)
 	}
@@ -160,18 +358,28 @@ func (dc *DiscoveryCache) fetchFromUpstream(ctx context.Context, hostname string
 		return nil, fmt.Errorf("failed to parse service discovery response: %w", err)
 	}
 
+	// Validate ProvidersV1 URL before caching
+	if !isValidProvidersURL(discovery.ProvidersV1) {
+		return nil, fmt.Errorf("invalid providers.v1 URL in service discovery: %q", discovery.ProvidersV1)
+	}
+
+	// Relative URLs are resolved against the final document URL, after any redirects
+	ref, _ := url.Parse(discovery.ProvidersV1)
+	discovery.ProvidersURL = resp.Request.URL.ResolveReference(ref).String()
+
 	// Set metadata
 	discovery.Hostname = hostname
 	discovery.CachedAt = time.Now()
 
 	dc.logger.DebugContext(ctx, "discovered service endpoints",
 		slog.String("hostname", hostname),
-		slog.String("providers_v1", discovery.ProvidersV1))
+		slog.String("providers_v1", discovery.ProvidersV1),
+		slog.String("providers_url", discovery.ProvidersURL))
 
 	return &discovery, nil
 }
 
-// Clear removes all cached discovery information
+// Clear removes all in-memory discovery information; persisted results are kept
 func (dc *DiscoveryCache) Clear() {
 	dc.mu.Lock()
 	defer dc.mu.Unlock()
@@ -11,8 +11,11 @@ import (
 	"net/url"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/elisiariocouto/specular/internal/storage"
 )
 
 func newTestLogger() *slog.Logger {
@@ -60,12 +63,12 @@ func TestDiscoveryCache_CacheHit(t *testing.T) {
 }
 
 func TestDiscoveryCache_CacheExpiration(t *testing.T) {
-	callCount := 0
+	var callCount atomic.Int32
 	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		callCount++
+		call := callCount.Add(1)
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]string{
-			"providers.v1": fmt.Sprintf("https://registry.terraform.io/v1/providers/?call=%d", callCount),
+			"providers.v1": fmt.Sprintf("https://registry.terraform.io/v1/providers/?call=%d", call),
 		})
 	}))
 	defer server.Close()
@@ -85,18 +88,33 @@ func TestDiscoveryCache_CacheExpiration(t *testing.T) {
 	// Wait for cache to expire
 	time.Sleep(100 * time.Millisecond)
 
-	// Second request should fetch again
+	// Second request serves the expired entry and refreshes it in the background
 	discovery2, err := cache.DiscoverServices(context.Background(), hostname)
 	if err != nil {
 		t.Fatalf("second request failed: %v", err)
 	}
+	if discovery1.ProvidersV1 != discovery2.ProvidersV1 {
+		t.Errorf("expected the expired entry to be served while refreshing")
+	}
 
-	if discovery1.ProvidersV1 == discovery2.ProvidersV1 {
-		t.Errorf("cache should have expired and fetched new data")
+	// Later requests see the refreshed data
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		discovery3, err := cache.DiscoverServices(context.Background(), hostname)
+		if err != nil {
+			t.Fatalf("third request failed: %v", err)
+		}
+		if discovery3.ProvidersV1 != discovery1.ProvidersV1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("cache should have expired and fetched new data")
+		}
+		time.Sleep(10 * time.Millisecond)
 	}
 
-	if callCount != 2 {
-		t.Errorf("expected 2 upstream calls, got %d", callCount)
+	if callCount.Load() != 2 {
+		t.Errorf("expected 2 upstream calls, got %d", callCount.Load())
 	}
 }
 
@@ -429,3 +447,283 @@ func TestDiscoveryCache_ContextCancellation(t *testing.T) {
 		t.Errorf("expected context cancellation error")
 	}
 }
+
+func TestNormalizeHostname(t *testing.T) {
+	tests := []struct {
+		hostname string
+		want     string
+		wantErr  bool
+	}{
+		{hostname: "registry.terraform.io", want: "registry.terraform.io"},
+		{hostname: "Registry.Terraform.IO", want: "registry.terraform.io"},
+		{hostname: "registry.example.com:8443", want: "registry.example.com:8443"},
+		{hostname: "registry.example.com:443", want: "registry.example.com"},
+		{hostname: "Bücher.example", want: "xn--bcher-kva.example"},
+		{hostname: "münchen.example:8443", want: "xn--mnchen-3ya.example:8443"},
+		{hostname: "127.0.0.1:8443", want: "127.0.0.1:8443"},
+		{hostname: "[::1]:8443", want: "[::1]:8443"},
+		{hostname: "[::1]", want: "[::1]"},
+		{hostname: "bad host.example.com", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := normalizeHostname(tt.hostname)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("normalizeHostname(%q) error = %v, wantErr %t", tt.hostname, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("normalizeHostname(%q) = %q, want %q", tt.hostname, got, tt.want)
+		}
+	}
+}
+
+// TestDiscoveryCache_ResolvesProvidersURL tests that providers.v1 is resolved relative to the discovery document
+func TestDiscoveryCache_ResolvesProvidersURL(t *testing.T) {
+	tests := []struct {
+		name        string
+		providersV1 func(serverURL string) string
+		want        func(serverURL string) string
+	}{
+		{
+			name:        "absolute path",
+			providersV1: func(string) string { return "/v1/providers/" },
+			want:        func(u string) string { return u + "/v1/providers/" },
+		},
+		{
+			name:        "relative path",
+			providersV1: func(string) string { return "../api/providers/" },
+			want:        func(u string) string { return u + "/api/providers/" },
+		},
+		{
+			name:        "cross-host absolute URL",
+			providersV1: func(string) string { return "https://api.example.com:8443/v1/providers/" },
+			want:        func(string) string { return "https://api.example.com:8443/v1/providers/" },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var server *httptest.Server
+			server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(map[string]string{"providers.v1": tt.providersV1(server.URL)})
+			}))
+			defer server.Close()
+
+			u, _ := url.Parse(server.URL)
+			cache := NewDiscoveryCache(time.Minute, server.Client(), newTestLogger())
+			discovery, err := cache.DiscoverServices(context.Background(), u.Host)
+			if err != nil {
+				t.Fatalf("DiscoverServices failed: %v", err)
+			}
+			if discovery.ProvidersURL != tt.want(server.URL) {
+				t.Errorf("ProvidersURL = %s, want %s", discovery.ProvidersURL, tt.want(server.URL))
+			}
+		})
+	}
+}
+
+func TestDiscoveryCache_Redirects(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/terraform.json":
+			http.Redirect(w, r, "/registry/.well-known/terraform.json", http.StatusFound)
+		case "/registry/.well-known/terraform.json":
+			json.NewEncoder(w).Encode(map[string]string{"providers.v1": "providers/"})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	cache := NewDiscoveryCache(time.Minute, server.Client(), newTestLogger())
+	discovery, err := cache.DiscoverServices(context.Background(), u.Host)
+	if err != nil {
+		t.Fatalf("DiscoverServices failed: %v", err)
+	}
+	if want := server.URL + "/registry/.well-known/providers/"; discovery.ProvidersURL != want {
+		t.Errorf("expected providers URL relative to the redirected document, got %s want %s", discovery.ProvidersURL, want)
+	}
+}
+
+func TestDiscoveryCache_UnsafeRedirects(t *testing.T) {
+	tests := []struct {
+		name     string
+		location func(r *http.Request) string
+	}{
+		{name: "downgrade to http", location: func(r *http.Request) string { return "http://" + r.Host + "/.well-known/terraform.json" }},
+		{name: "redirect loop", location: func(r *http.Request) string { return r.URL.Path }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Redirect(w, r, tt.location(r), http.StatusFound)
+			}))
+			defer server.Close()
+
+			u, _ := url.Parse(server.URL)
+			cache := NewDiscoveryCache(time.Minute, server.Client(), newTestLogger())
+			if _, err := cache.DiscoverServices(context.Background(), u.Host); err == nil {
+				t.Error("expected unsafe redirect to be refused")
+			}
+		})
+	}
+}
+
+func TestDiscoveryCache_PersistsAcrossRestarts(t *testing.T) {
+	var failing atomic.Bool
+	var callCount atomic.Int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		callCount.Add(1)
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"providers.v1": "/v1/providers/"})
+	}))
+	defer server.Close()
+
+	store, err := storage.NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+	u, _ := url.Parse(server.URL)
+	hostname := u.Host
+
+	first := NewDiscoveryCache(time.Hour, server.Client(), newTestLogger())
+	first.store = store
+	if _, err := first.DiscoverServices(context.Background(), hostname); err != nil {
+		t.Fatalf("initial discovery failed: %v", err)
+	}
+	first.Shutdown()
+
+	// A restarted cache serves the persisted result while the registry is down
+	failing.Store(true)
+	restarted := NewDiscoveryCache(time.Hour, server.Client(), newTestLogger())
+	restarted.store = store
+	defer restarted.Shutdown()
+
+	discovery, err := restarted.DiscoverServices(context.Background(), hostname)
+	if err != nil {
+		t.Fatalf("expected persisted discovery to be served, got %v", err)
+	}
+	if want := server.URL + "/v1/providers/"; discovery.ProvidersURL != want {
+		t.Errorf("ProvidersURL = %q, want %q", discovery.ProvidersURL, want)
+	}
+	if callCount.Load() != 1 {
+		t.Errorf("expected a fresh persisted result not to be refetched, got %d calls", callCount.Load())
+	}
+}
+
+func TestDiscoveryCache_StaleOnError(t *testing.T) {
+	var callCount atomic.Int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		callCount.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	hostname := u.Host
+
+	store := storage.NewMemoryStorage()
+	stored, _ := json.Marshal(storedDiscovery{
+		ProvidersV1:  "https://registry.example.com/v1/providers/",
+		ProvidersURL: "https://registry.example.com/v1/providers/",
+		CachedAt:     time.Now().Add(-48 * time.Hour),
+	})
+	store.PutMetadata(context.Background(), discoveryKey(hostname), stored)
+
+	cache := NewDiscoveryCache(time.Hour, server.Client(), newTestLogger())
+	cache.store = store
+	defer cache.Shutdown()
+
+	for i := 0; i < 3; i++ {
+		discovery, err := cache.DiscoverServices(context.Background(), hostname)
+		if err != nil {
+			t.Fatalf("expected stale discovery to be served, got %v", err)
+		}
+		if discovery.ProvidersURL != "https://registry.example.com/v1/providers/" {
+			t.Fatalf("unexpected ProvidersURL: %s", discovery.ProvidersURL)
+		}
+	}
+
+	// The expired entry is refreshed in the background; the failure keeps it in place
+	deadline := time.Now().Add(2 * time.Second)
+	for callCount.Load() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected a background refresh of the expired entry")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if discovery, err := cache.DiscoverServices(context.Background(), hostname); err != nil || discovery.ProvidersV1 != "https://registry.example.com/v1/providers/" {
+		t.Fatalf("expected stale discovery after failed refresh, got %v %v", discovery, err)
+	}
+}
+
+// blockingMetadataStore holds GetMetadata calls until released
+type blockingMetadataStore struct {
+	*storage.MemoryStorage
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingMetadataStore) GetMetadata(ctx context.Context, key string) ([]byte, error) {
+	s.started <- struct{}{}
+	<-s.release
+	return s.MemoryStorage.GetMetadata(ctx, key)
+}
+
+func TestDiscoveryCache_StorageReadsDoNotBlockOtherHosts(t *testing.T) {
+	store := &blockingMetadataStore{
+		MemoryStorage: storage.NewMemoryStorage(),
+		started:       make(chan struct{}, 1),
+		release:       make(chan struct{}),
+	}
+	stored, _ := json.Marshal(storedDiscovery{
+		ProvidersV1:  "https://slow.example.com/v1/providers/",
+		ProvidersURL: "https://slow.example.com/v1/providers/",
+		CachedAt:     time.Now(),
+	})
+	store.MemoryStorage.PutMetadata(context.Background(), discoveryKey("slow.example.com"), stored)
+
+	cache := NewDiscoveryCache(time.Hour, http.DefaultClient, newTestLogger())
+	cache.store = store
+	defer cache.Shutdown()
+	cache.cache["fast.example.com"] = &ServiceDiscovery{
+		Hostname:     "fast.example.com",
+		ProvidersV1:  "https://fast.example.com/v1/providers/",
+		ProvidersURL: "https://fast.example.com/v1/providers/",
+		CachedAt:     time.Now(),
+	}
+
+	slow := make(chan error, 1)
+	go func() {
+		_, err := cache.DiscoverServices(context.Background(), "slow.example.com")
+		slow <- err
+	}()
+	<-store.started
+
+	// The cached host is served while the other host's persisted result is being read
+	fast := make(chan error, 1)
+	go func() {
+		_, err := cache.DiscoverServices(context.Background(), "fast.example.com")
+		fast <- err
+	}()
+	select {
+	case err := <-fast:
+		if err != nil {
+			t.Fatalf("cached discovery failed: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("cached discovery waited on another host's storage read")
+	}
+
+	close(store.release)
+	if err := <-slow; err != nil {
+		t.Fatalf("persisted discovery failed: %v", err)
+	}
+}
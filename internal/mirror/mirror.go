@@ -9,10 +9,14 @@ import (
 	"log/slog"
 	"net/url"
 	"path"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/elisiariocouto/specular/internal/storage"
+	"github.com/elisiariocouto/specular/internal/tracing"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Mirror handles caching and proxying of Terraform providers
@@ -23,14 +27,42 @@ type Mirror struct {
 	baseURL    string
 	indexTTL   time.Duration
 	refresher  *IndexRefresher
+	policy     *ProviderPolicy
+	cooldown   *ReleaseCooldown
+
+	metadata        storage.MetadataStore
+	requireApproval bool
+	approvalsMu     sync.Mutex
+
+	flights   flightGroup // coalesces concurrent upstream fetches of the same resource
+	bandwidth *bandwidthTracker
+}
+
+// Options holds optional mirror features
+type Options struct {
+	// Policy restricts which providers and versions are served; nil serves everything
+	Policy *ProviderPolicy
+	// Cooldown hides versions released too recently; nil disables the cooldown
+	Cooldown *ReleaseCooldown
+	// RequireApproval holds newly discovered versions back until an admin approves them.
+	// Approval records are kept in storage, which must implement storage.MetadataStore.
+	RequireApproval bool
+	// OnBandwidth is called whenever bytes are downloaded from upstream (BandwidthUpstream) or
+	// served without an upstream download (BandwidthCache). Bytes of failed upstream fetches are
+	// reported with an empty hostname, namespace and type.
+	OnBandwidth func(hostname, namespace, providerType, source string, bytes int64)
 }
 
 // NewMirror creates a new mirror service
-func NewMirror(store storage.Storage, upstream *UpstreamClient, baseURL string, indexTTL time.Duration) *Mirror {
+func NewMirror(store storage.Storage, upstream *UpstreamClient, baseURL string, indexTTL time.Duration, opts Options) *Mirror {
 	var ageChecker storage.CacheAgeChecker
 	if ac, ok := store.(storage.CacheAgeChecker); ok {
 		ageChecker = ac
 	}
+	var metadata storage.MetadataStore
+	if ms, ok := store.(storage.MetadataStore); ok {
+		metadata = ms
+	}
 	return &Mirror{
 		storage:    store,
 		ageChecker: ageChecker,
@@ -38,35 +70,250 @@ func NewMirror(store storage.Storage, upstream *UpstreamClient, baseURL string,
 		baseURL:    baseURL,
 		indexTTL:   indexTTL,
 		refresher:  NewIndexRefresher(),
+		policy:     opts.Policy,
+		cooldown:   opts.Cooldown,
+
+		metadata:        metadata,
+		requireApproval: opts.RequireApproval,
+
+		flights:   flightGroup{timeout: upstream.fetchTimeout()},
+		bandwidth: newBandwidthTracker(metadata, opts.OnBandwidth),
 	}
 }
 
-// Shutdown cancels all background refresh goroutines and waits for them to complete.
+// Shutdown cancels all background refresh goroutines and waits for them to complete,
+// then persists the bandwidth totals.
 func (m *Mirror) Shutdown() {
 	m.refresher.Shutdown()
+	if m.upstream != nil && m.upstream.discoveryCache != nil {
+		m.upstream.discoveryCache.Shutdown()
+	}
+	m.bandwidth.shutdown()
+}
+
+// BandwidthSummary returns the bytes downloaded from upstream against the bytes served from cache
+func (m *Mirror) BandwidthSummary() BandwidthSummary {
+	return m.bandwidth.summary()
+}
+
+// RecordServed counts the bytes of a response sent to a client; responses that did not need
+// their own upstream download count as served from cache
+func (m *Mirror) RecordServed(hostname, namespace, providerType string, status CacheStatus, bytes int64) {
+	if status == "" || status == CacheMiss {
+		return
+	}
+	m.bandwidth.recordCache(hostname, namespace, providerType, bytes)
+}
+
+// CircuitStatus returns the circuit breaker state of every upstream host contacted so far
+func (m *Mirror) CircuitStatus() []CircuitStatus {
+	if m.upstream == nil {
+		return nil
+	}
+	return m.upstream.CircuitStatus()
+}
+
+// SourceStatus returns the health of the configured upstream sources
+func (m *Mirror) SourceStatus() []SourceStatus {
+	if m.upstream == nil {
+		return nil
+	}
+	return m.upstream.SourceStatus()
+}
+
+// checkProvider returns an ErrInvalidAddress error for non-canonical hostnames and an
+// ErrForbidden error if the provider policy forbids the provider
+func (m *Mirror) checkProvider(hostname, namespace, providerType string) error {
+	if err := CheckHostname(hostname); err != nil {
+		return err
+	}
+	if m.policy == nil {
+		return nil
+	}
+	return m.policy.CheckProvider(hostname, namespace, providerType)
+}
+
+// checkVersion returns ErrForbidden for forbidden providers and ErrNotFound for versions
+// outside the policy's constraints, still within the release cooldown, or not approved,
+// so hidden versions look like they do not exist
+func (m *Mirror) checkVersion(ctx context.Context, hostname, namespace, providerType, version string) error {
+	if err := m.checkProvider(hostname, namespace, providerType); err != nil {
+		return err
+	}
+	if m.policy != nil && !m.policy.AllowsVersion(hostname, namespace, providerType, version) {
+		return ErrNotFound
+	}
+
+	hidden, err := m.hiddenVersions(ctx, hostname, namespace, providerType, true)
+	if err != nil {
+		return err
+	}
+	if hidden[version] {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// hiddenVersions returns the versions of a provider withheld by the release cooldown or
+// awaiting approval
+func (m *Mirror) hiddenVersions(ctx context.Context, hostname, namespace, providerType string, fetchMissing bool) (map[string]bool, error) {
+	hidden, err := m.cooldownHidden(ctx, hostname, namespace, providerType, fetchMissing)
+	if err != nil {
+		return nil, err
+	}
+
+	unapproved, err := m.unapprovedVersions(ctx, hostname, namespace, providerType)
+	if err != nil {
+		return nil, err
+	}
+	if len(unapproved) > 0 && hidden == nil {
+		hidden = make(map[string]bool, len(unapproved))
+	}
+	for v := range unapproved {
+		hidden[v] = true
+	}
+	return hidden, nil
+}
+
+// cooldownHidden returns the versions of a provider that are still within the release cooldown.
+// Release times come from the cached versions response; when fetchMissing is set and nothing is
+// cached yet, the index is fetched first to populate it.
+func (m *Mirror) cooldownHidden(ctx context.Context, hostname, namespace, providerType string, fetchMissing bool) (map[string]bool, error) {
+	if m.cooldown == nil || m.cooldown.activeFor(hostname, namespace, providerType) <= 0 {
+		return nil, nil
+	}
+
+	versionsResp, err := m.cachedVersionsResponse(ctx, hostname, namespace, providerType)
+	if err != nil && fetchMissing {
+		if _, indexErr := m.getIndex(ctx, hostname, namespace, providerType); indexErr != nil {
+			return nil, indexErr
+		}
+		versionsResp, err = m.cachedVersionsResponse(ctx, hostname, namespace, providerType)
+	}
+	if err != nil {
+		slog.Warn(fmt.Sprintf("release times unavailable, cooldown not applied [hostname=%s namespace=%s type=%s err=%s]",
+			hostname, namespace, providerType, err),
+			"hostname", hostname, "namespace", namespace, "type", providerType, "err", err)
+		return nil, nil
+	}
+
+	now := time.Now()
+	hidden := make(map[string]bool)
+	for _, v := range versionsResp.Versions {
+		if m.cooldown.Hides(hostname, namespace, providerType, v.Version, v.releasedAt(), now) {
+			hidden[v.Version] = true
+		}
+	}
+	return hidden, nil
+}
+
+// cachedVersionsResponse reads and parses the cached versions response for a provider
+func (m *Mirror) cachedVersionsResponse(ctx context.Context, hostname, namespace, providerType string) (*RegistryVersionsResponse, error) {
+	data, err := m.storage.GetVersionsResponse(ctx, hostname, namespace, providerType)
+	if err != nil {
+		return nil, err
+	}
+	var versionsResp RegistryVersionsResponse
+	if err := json.Unmarshal(data, &versionsResp); err != nil {
+		return nil, fmt.Errorf("failed to parse versions response: %w", err)
+	}
+	return &versionsResp, nil
 }
 
 // GetIndex returns the index for a provider, using cache or fetching from upstream.
 // If cached data is stale (older than indexTTL), it is returned immediately while
 // a background refresh is triggered asynchronously.
-func (m *Mirror) GetIndex(ctx context.Context, hostname, namespace, providerType string) ([]byte, error) {
+// Versions not allowed by the provider policy, within the release cooldown, or not approved
+// are removed from the response.
+func (m *Mirror) GetIndex(ctx context.Context, hostname, namespace, providerType string) (_ []byte, err error) {
+	ctx, span := tracing.Start(ctx, "Mirror.GetIndex", tracing.Provider(hostname, namespace, providerType)...)
+	defer func() { tracing.End(span, err) }()
+
+	if err := m.checkProvider(hostname, namespace, providerType); err != nil {
+		return nil, err
+	}
+
+	data, err := m.getIndex(ctx, hostname, namespace, providerType)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.policy != nil {
+		if data, err = m.policy.filterIndex(hostname, namespace, providerType, data); err != nil {
+			return nil, err
+		}
+	}
+
+	hidden, err := m.hiddenVersions(ctx, hostname, namespace, providerType, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(hidden) == 0 {
+		return data, nil
+	}
+	slog.DebugContext(ctx, fmt.Sprintf("hiding versions within release cooldown or awaiting approval [hostname=%s namespace=%s type=%s count=%d]",
+		hostname, namespace, providerType, len(hidden)),
+		"hostname", hostname, "namespace", namespace, "type", providerType, "count", len(hidden))
+	return filterIndexVersions(data, func(version string) bool { return hidden[version] })
+}
+
+// filterIndexVersions removes versions for which hide returns true from an index.json document
+func filterIndexVersions(data []byte, hide func(version string) bool) ([]byte, error) {
+	var index IndexResponse
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("failed to parse index response: %w", err)
+	}
+
+	for v := range index.Versions {
+		if hide(v) {
+			delete(index.Versions, v)
+		}
+	}
+
+	return json.Marshal(index)
+}
+
+// getIndex returns the unfiltered index for a provider from cache or upstream
+func (m *Mirror) getIndex(ctx context.Context, hostname, namespace, providerType string) ([]byte, error) {
 	// Try to get from cache
 	cachedData, err := m.storage.GetIndex(ctx, hostname, namespace, providerType)
+	trace.SpanFromContext(ctx).SetAttributes(tracing.CacheHit(err == nil))
 	if err == nil {
 		// Cache hit — check if stale and maybe trigger background refresh
-		m.maybeRefreshIndex(hostname, namespace, providerType)
+		if m.maybeRefreshIndex(hostname, namespace, providerType) {
+			reportCache(ctx, CacheStale)
+		} else {
+			reportCache(ctx, CacheHit)
+		}
 		return cachedData, nil
 	}
 
-	// Cache miss, fetch from upstream synchronously
-	return m.fetchAndCacheIndex(ctx, hostname, namespace, providerType)
+	// Cache miss, fetch from upstream synchronously, sharing the fetch with concurrent misses
+	key := fmt.Sprintf("index:%s/%s/%s", hostname, namespace, providerType)
+	data, shared, err := m.flights.do(ctx, key, func(ctx context.Context) (any, error) {
+		return m.fetchAndCacheIndex(ctx, hostname, namespace, providerType)
+	})
+	reportCache(ctx, missStatus(shared))
+	if err != nil {
+		return nil, err
+	}
+	return data.([]byte), nil
+}
+
+// missStatus returns the cache status of a request that missed the cache
+func missStatus(shared bool) CacheStatus {
+	if shared {
+		return CacheCoalesced
+	}
+	return CacheMiss
 }
 
 // maybeRefreshIndex checks if the cached index is stale and triggers a background refresh if needed.
 // This never blocks the caller — stale data is always returned immediately.
-func (m *Mirror) maybeRefreshIndex(hostname, namespace, providerType string) {
+// It reports whether the cached index is stale.
+func (m *Mirror) maybeRefreshIndex(hostname, namespace, providerType string) bool {
 	if m.ageChecker == nil || m.indexTTL <= 0 {
-		return
+		return false
 	}
 
 	age, exists, err := m.ageChecker.IndexAge(context.Background(), hostname, namespace, providerType)
@@ -74,11 +321,11 @@ func (m *Mirror) maybeRefreshIndex(hostname, namespace, providerType string) {
 		slog.Warn(fmt.Sprintf("failed to check index age [hostname=%s namespace=%s type=%s err=%s]",
 			hostname, namespace, providerType, err),
 			"hostname", hostname, "namespace", namespace, "type", providerType, "err", err)
-		return
+		return false
 	}
 
 	if !exists || age <= m.indexTTL {
-		return
+		return false
 	}
 
 	m.refresher.TryRefresh(hostname, namespace, providerType, func(ctx context.Context) {
@@ -98,10 +345,16 @@ func (m *Mirror) maybeRefreshIndex(hostname, namespace, providerType string) {
 			hostname, namespace, providerType),
 			"hostname", hostname, "namespace", namespace, "type", providerType)
 	})
+	return true
 }
 
 // fetchAndCacheIndex fetches the index from upstream and stores both index.json and versions.json in cache.
-func (m *Mirror) fetchAndCacheIndex(ctx context.Context, hostname, namespace, providerType string) ([]byte, error) {
+func (m *Mirror) fetchAndCacheIndex(ctx context.Context, hostname, namespace, providerType string) (_ []byte, err error) {
+	ctx, span := tracing.Start(ctx, "Mirror.fetchAndCacheIndex", tracing.Provider(hostname, namespace, providerType)...)
+	defer func() { tracing.End(span, err) }()
+	ctx, downloaded := withUpstreamBytes(ctx)
+	defer func() { m.bandwidth.recordFetch(hostname, namespace, providerType, downloaded.n.Load(), err) }()
+
 	indexResponse, versionsResponse, err := m.upstream.FetchIndex(ctx, hostname, namespace, providerType)
 	if err != nil {
 		return nil, err
@@ -112,40 +365,99 @@ func (m *Mirror) fetchAndCacheIndex(ctx context.Context, hostname, namespace, pr
 		return nil, fmt.Errorf("failed to marshal index response: %w", err)
 	}
 
-	if err := m.storage.PutIndex(ctx, hostname, namespace, providerType, data); err != nil {
-		slog.Warn(fmt.Sprintf("failed to cache index [hostname=%s namespace=%s type=%s err=%s]", hostname, namespace, providerType, err),
-			"hostname", hostname, "namespace", namespace, "type", providerType, "err", err)
+	// Mirror protocol upstreams have no versions API; track their versions all the same
+	// so release times are known
+	if versionsResponse == nil {
+		versionsResponse = versionsFromIndex(indexResponse)
 	}
 
-	if versionsResponse != nil {
-		versionsData, err := json.Marshal(versionsResponse)
-		if err == nil {
-			if err := m.storage.PutVersionsResponse(ctx, hostname, namespace, providerType, versionsData); err != nil {
-				slog.Warn(fmt.Sprintf("failed to cache versions response [hostname=%s namespace=%s type=%s err=%s]", hostname, namespace, providerType, err),
-					"hostname", hostname, "namespace", namespace, "type", providerType, "err", err)
-			}
+	// Carry first-seen times over from the previous listing; a missing or unreadable
+	// previous listing is treated as the provider's first
+	now := time.Now()
+	previous, _ := m.cachedVersionsResponse(ctx, hostname, namespace, providerType)
+	added := recordFirstSeen(previous, versionsResponse, now)
+
+	// New versions must be pending before they can appear in a cached index
+	if m.requireApproval && len(added) > 0 {
+		if err := m.recordPending(ctx, hostname, namespace, providerType, added, now.UTC()); err != nil {
+			return nil, fmt.Errorf("failed to record versions awaiting approval: %w", err)
 		}
 	}
 
+	versionsData, err := json.Marshal(versionsResponse)
+	if err == nil {
+		if err := m.storage.PutVersionsResponse(ctx, hostname, namespace, providerType, versionsData); err != nil {
+			slog.Warn(fmt.Sprintf("failed to cache versions response [hostname=%s namespace=%s type=%s err=%s]", hostname, namespace, providerType, err),
+				"hostname", hostname, "namespace", namespace, "type", providerType, "err", err)
+		}
+	}
+
+	if err := m.storage.PutIndex(ctx, hostname, namespace, providerType, data); err != nil {
+		slog.Warn(fmt.Sprintf("failed to cache index [hostname=%s namespace=%s type=%s err=%s]", hostname, namespace, providerType, err),
+			"hostname", hostname, "namespace", namespace, "type", providerType, "err", err)
+	}
+
 	return data, nil
 }
 
+// versionsFromIndex builds a versions response without platforms from an index response
+func versionsFromIndex(index *IndexResponse) *RegistryVersionsResponse {
+	resp := &RegistryVersionsResponse{Versions: make([]RegistryVersion, 0, len(index.Versions))}
+	for v := range index.Versions {
+		resp.Versions = append(resp.Versions, RegistryVersion{Version: v})
+	}
+	sort.Slice(resp.Versions, func(i, j int) bool { return resp.Versions[i].Version < resp.Versions[j].Version })
+	return resp
+}
+
 // GetVersion returns the version for a provider, using cache or fetching from upstream
 // It also rewrites archive URLs to point to this mirror
-func (m *Mirror) GetVersion(ctx context.Context, hostname, namespace, providerType, version string) ([]byte, error) {
+func (m *Mirror) GetVersion(ctx context.Context, hostname, namespace, providerType, version string) (_ []byte, err error) {
+	ctx, span := tracing.Start(ctx, "Mirror.GetVersion", tracing.ProviderVersion(hostname, namespace, providerType, version)...)
+	defer func() { tracing.End(span, err) }()
+
+	if err := m.checkVersion(ctx, hostname, namespace, providerType, version); err != nil {
+		return nil, err
+	}
+
 	// Try to get from cache
 	cachedData, err := m.storage.GetVersion(ctx, hostname, namespace, providerType, version)
+	span.SetAttributes(tracing.CacheHit(err == nil))
 	if err == nil {
 		// Return cached data (URLs are already correct from when we built it)
+		reportCache(ctx, CacheHit)
 		return cachedData, nil
 	}
 
-	// Cache miss, try to fetch from upstream
+	// Cache miss, sharing the fetch with concurrent misses
+	key := fmt.Sprintf("version:%s/%s/%s/%s", hostname, namespace, providerType, version)
+	data, shared, err := m.flights.do(ctx, key, func(ctx context.Context) (any, error) {
+		return m.fetchVersion(ctx, hostname, namespace, providerType, version)
+	})
+	if shared {
+		reportCache(ctx, CacheCoalesced)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return data.([]byte), nil
+}
+
+// fetchVersion fetches a version document from upstream, or builds it from the cached versions
+// response when the upstream has no version documents, and caches the result
+func (m *Mirror) fetchVersion(ctx context.Context, hostname, namespace, providerType, version string) (_ []byte, err error) {
+	reportCache(ctx, CacheMiss)
+	ctx, downloaded := withUpstreamBytes(ctx)
+	defer func() { m.bandwidth.recordFetch(hostname, namespace, providerType, downloaded.n.Load(), err) }()
+
 	response, err := m.upstream.FetchVersion(ctx, hostname, namespace, providerType, version)
 	if err != nil {
 		// If upstream returns ErrNotFound, build from cached versions response
 		if errors.Is(err, ErrNotFound) {
 			data, buildErr := m.buildVersionFromCache(ctx, hostname, namespace, providerType, version)
+			if buildErr == nil {
+				reportCache(ctx, CacheBuilt)
+			}
 			// If versions cache is empty, fetch the index first to populate it
 			if buildErr != nil {
 				slog.DebugContext(ctx,
@@ -154,10 +466,16 @@ func (m *Mirror) GetVersion(ctx context.Context, hostname, namespace, providerTy
 					"namespace", namespace,
 					"type", providerType,
 					"version", version)
-				if _, indexErr := m.GetIndex(ctx, hostname, namespace, providerType); indexErr == nil {
+				if _, indexErr := m.getIndex(ctx, hostname, namespace, providerType); indexErr == nil {
 					// Retry building from cache after fetching index
 					data, buildErr = m.buildVersionFromCache(ctx, hostname, namespace, providerType, version)
 				}
+				// Only an index that was already cached leaves the version built purely from cache
+				if buildErr == nil && reportedCache(ctx).Hit() {
+					reportCache(ctx, CacheBuilt)
+				} else {
+					reportCache(ctx, missStatus(reportedCache(ctx) == CacheCoalesced))
+				}
 			}
 			if buildErr != nil {
 				return nil, buildErr
@@ -167,6 +485,9 @@ func (m *Mirror) GetVersion(ctx context.Context, hostname, namespace, providerTy
 		return nil, err
 	}
 
+	// Remember where the archives live before their URLs are rewritten
+	m.saveArchiveURLs(ctx, hostname, namespace, providerType, version, response)
+
 	// Marshal response to JSON
 	data, err := json.Marshal(response)
 	if err != nil {
@@ -190,7 +511,10 @@ func (m *Mirror) GetVersion(ctx context.Context, hostname, namespace, providerTy
 
 // buildVersionFromCache builds a version.json response from the cached versions response
 // This avoids making multiple API calls to the upstream registry
-func (m *Mirror) buildVersionFromCache(ctx context.Context, hostname, namespace, providerType, version string) ([]byte, error) {
+func (m *Mirror) buildVersionFromCache(ctx context.Context, hostname, namespace, providerType, version string) (_ []byte, err error) {
+	ctx, span := tracing.Start(ctx, "Mirror.buildVersionFromCache", tracing.ProviderVersion(hostname, namespace, providerType, version)...)
+	defer func() { tracing.End(span, err) }()
+
 	// Get cached versions response
 	versionsData, err := m.storage.GetVersionsResponse(ctx, hostname, namespace, providerType)
 	if err != nil {
@@ -250,34 +574,79 @@ func (m *Mirror) buildVersionFromCache(ctx context.Context, hostname, namespace,
 }
 
 // GetArchive returns a provider archive, using cache or fetching from upstream on-demand
-// Takes explicit parameters for on-demand fetching instead of relying on stored URLs
-func (m *Mirror) GetArchive(ctx context.Context, hostname, namespace, providerType, version, os, arch, archivePath string) (io.ReadCloser, error) {
+// Takes explicit parameters so the archive can be located upstream even without stored URLs.
+// The cache path is built from the checked version and platform, never from the requested
+// file name, so a name from another version cannot reach that version's archive
+func (m *Mirror) GetArchive(ctx context.Context, hostname, namespace, providerType, version, os, arch string) (_ io.ReadCloser, err error) {
+	ctx, span := tracing.Start(ctx, "Mirror.GetArchive",
+		append(tracing.ProviderVersion(hostname, namespace, providerType, version), tracing.Platform(os, arch))...)
+	defer func() { tracing.End(span, err) }()
+
+	if err := m.checkVersion(ctx, hostname, namespace, providerType, version); err != nil {
+		return nil, err
+	}
+	archivePath := buildArchivePath(hostname, namespace, providerType, version, os, arch)
+
 	// Try to get from cache
 	reader, err := m.storage.GetArchive(ctx, archivePath)
+	span.SetAttributes(tracing.CacheHit(err == nil))
 	if err == nil {
+		reportCache(ctx, CacheHit)
 		return reader, nil
 	}
 
-	// Cache miss - fetch download URL from registry API
-	downloadInfo, err := m.upstream.FetchDownloadURL(ctx, hostname, namespace, providerType, version, os, arch)
+	// Cache miss, sharing the download with concurrent misses
+	_, shared, err := m.flights.do(ctx, "archive:"+archivePath, func(ctx context.Context) (any, error) {
+		return nil, m.fetchArchive(ctx, hostname, namespace, providerType, version, os, arch, archivePath)
+	})
+	reportCache(ctx, missStatus(shared))
 	if err != nil {
-		return nil, fmt.Errorf("failed to get download URL: %w", err)
+		return nil, err
+	}
+
+	// Return cached file
+	return m.storage.GetArchive(ctx, archivePath)
+}
+
+// fetchArchive downloads a provider archive from upstream into the cache
+func (m *Mirror) fetchArchive(ctx context.Context, hostname, namespace, providerType, version, os, arch, archivePath string) (err error) {
+	ctx, downloaded := withUpstreamBytes(ctx)
+	defer func() { m.bandwidth.recordFetch(hostname, namespace, providerType, downloaded.n.Load(), err) }()
+
+	// Use the archive URL recorded from a mirror protocol version document,
+	// otherwise ask the upstream for it
+	archiveURL, ok := m.upstreamArchiveURL(ctx, hostname, namespace, providerType, version, os, arch)
+	if !ok {
+		downloadInfo, err := m.upstream.FetchDownloadURL(ctx, hostname, namespace, providerType, version, os, arch)
+		if err != nil {
+			return fmt.Errorf("failed to get download URL: %w", err)
+		}
+		archiveURL = downloadInfo.DownloadURL
 	}
 
 	// Fetch archive from upstream
-	archiveReader, err := m.upstream.FetchArchive(ctx, downloadInfo.DownloadURL)
+	archiveReader, err := m.upstream.FetchArchive(ctx, hostname, archiveURL)
+	if err != nil && ok && ctx.Err() == nil {
+		// The source that served the version document may be gone; look the archive up again,
+		// which fails over across the hostname's sources
+		downloadInfo, lookupErr := m.upstream.FetchDownloadURL(ctx, hostname, namespace, providerType, version, os, arch)
+		if lookupErr == nil && downloadInfo.DownloadURL != archiveURL {
+			slog.WarnContext(ctx,
+				fmt.Sprintf("recorded archive URL failed, retrying from upstream [hostname=%s namespace=%s type=%s version=%s err=%s]", hostname, namespace, providerType, version, err),
+				"hostname", hostname, "namespace", namespace, "type", providerType, "version", version, "err", err)
+			archiveReader, err = m.upstream.FetchArchive(ctx, hostname, downloadInfo.DownloadURL)
+		}
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch archive: %w", err)
+		return fmt.Errorf("failed to fetch archive: %w", err)
 	}
 	defer archiveReader.Close()
 
 	// Stream archive directly into cache to avoid holding entire file in memory
 	if err := m.storage.PutArchive(ctx, archivePath, archiveReader); err != nil {
-		return nil, fmt.Errorf("failed to cache archive: %w", err)
+		return fmt.Errorf("failed to cache archive: %w", err)
 	}
-
-	// Return cached file
-	return m.storage.GetArchive(ctx, archivePath)
+	return nil
 }
 
 // rewriteArchiveURLs rewrites archive URLs to point to this mirror
@@ -359,6 +728,11 @@ func buildProviderFilename(providerType, version, os, arch string) string {
 	return fmt.Sprintf("terraform-provider-%s_%s_%s_%s.zip", providerType, version, os, arch)
 }
 
+// buildArchivePath constructs the cache path of a provider archive
+func buildArchivePath(hostname, namespace, providerType, version, os, arch string) string {
+	return fmt.Sprintf("%s/%s/%s/%s", hostname, namespace, providerType, buildProviderFilename(providerType, version, os, arch))
+}
+
 // parsePlatformKey parses a platform key (e.g., "linux_amd64") into OS and architecture
 func parsePlatformKey(platform string) (os, arch string, err error) {
 	parts := strings.Split(platform, "_")
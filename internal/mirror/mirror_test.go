@@ -146,7 +146,7 @@ func TestGetIndex_CacheHit(t *testing.T) {
 	defer server.Close()
 
 	upstream := newTestUpstreamClientForMirror(server)
-	mirror := NewMirror(mockStorage, upstream, "http://localhost:8080", 0)
+	mirror := NewMirror(mockStorage, upstream, "http://localhost:8080", 0, Options{})
 
 	hostname, namespace, providerType := "registry.terraform.io", "hashicorp", "aws"
 	cachedData := []byte(`{"versions": {"1.0.0": {}}}`)
@@ -189,7 +189,7 @@ func TestGetIndex_CacheMiss_FetchUpstream(t *testing.T) {
 	defer server.Close()
 
 	upstream := newTestUpstreamClientForMirror(server)
-	mirror := NewMirror(mockStorage, upstream, "http://localhost:8080", 0)
+	mirror := NewMirror(mockStorage, upstream, "http://localhost:8080", 0, Options{})
 
 	hostname, namespace, providerType := "registry.terraform.io", "hashicorp", "aws"
 
@@ -217,7 +217,7 @@ func TestGetIndex_UpstreamError(t *testing.T) {
 	defer server.Close()
 
 	upstream := newTestUpstreamClientForMirror(server)
-	mirror := NewMirror(mockStorage, upstream, "http://localhost:8080", 0)
+	mirror := NewMirror(mockStorage, upstream, "http://localhost:8080", 0, Options{})
 
 	_, err := mirror.GetIndex(context.Background(), "registry.terraform.io", "hashicorp", "aws")
 	if err == nil {
@@ -234,7 +234,7 @@ func TestGetVersion_CacheHit(t *testing.T) {
 	defer server.Close()
 
 	upstream := newTestUpstreamClientForMirror(server)
-	mirror := NewMirror(mockStorage, upstream, "http://localhost:8080", 0)
+	mirror := NewMirror(mockStorage, upstream, "http://localhost:8080", 0, Options{})
 
 	hostname, namespace, providerType, version := "registry.terraform.io", "hashicorp", "aws", "1.0.0"
 	cachedData := []byte(`{"archives": {"linux_amd64": {"url": "http://localhost:8080/download/..."}}}`)
@@ -271,7 +271,7 @@ func TestGetVersion_CacheMiss_FetchUpstream(t *testing.T) {
 	defer server.Close()
 
 	upstream := newTestUpstreamClientForMirror(server)
-	mirror := NewMirror(mockStorage, upstream, "http://localhost:8080", 0)
+	mirror := NewMirror(mockStorage, upstream, "http://localhost:8080", 0, Options{})
 
 	hostname, namespace, providerType, version := "registry.terraform.io", "hashicorp", "aws", "1.0.0"
 
@@ -312,7 +312,7 @@ func TestGetVersion_BuildFromCache(t *testing.T) {
 	defer server.Close()
 
 	upstream := newTestUpstreamClientForMirror(server)
-	mirror := NewMirror(mockStorage, upstream, "http://localhost:8080", 0)
+	mirror := NewMirror(mockStorage, upstream, "http://localhost:8080", 0, Options{})
 
 	// This will fail due to service discovery not being configured
 	_, err := mirror.GetVersion(context.Background(), "registry.terraform.io", "hashicorp", "aws", "1.0.0")
@@ -335,7 +335,7 @@ func TestGetVersion_NotFound(t *testing.T) {
 	defer server.Close()
 
 	upstream := newTestUpstreamClientForMirror(server)
-	mirror := NewMirror(mockStorage, upstream, "http://localhost:8080", 0)
+	mirror := NewMirror(mockStorage, upstream, "http://localhost:8080", 0, Options{})
 
 	_, err := mirror.GetVersion(context.Background(), "registry.terraform.io", "hashicorp", "aws", "99.0.0")
 	if err == nil {
@@ -352,7 +352,7 @@ func TestGetArchive_CacheHit(t *testing.T) {
 	defer server.Close()
 
 	upstream := newTestUpstreamClientForMirror(server)
-	mirror := NewMirror(mockStorage, upstream, "http://localhost:8080", 0)
+	mirror := NewMirror(mockStorage, upstream, "http://localhost:8080", 0, Options{})
 
 	archivePath := "registry.terraform.io/hashicorp/aws/terraform-provider-aws_1.0.0_linux_amd64.zip"
 	archiveContent := []byte("archive content")
@@ -360,7 +360,7 @@ func TestGetArchive_CacheHit(t *testing.T) {
 	// Pre-populate cache
 	mockStorage.PutArchive(context.Background(), archivePath, bytes.NewReader(archiveContent))
 
-	result, err := mirror.GetArchive(context.Background(), "registry.terraform.io", "hashicorp", "aws", "1.0.0", "linux", "amd64", archivePath)
+	result, err := mirror.GetArchive(context.Background(), "registry.terraform.io", "hashicorp", "aws", "1.0.0", "linux", "amd64")
 	if err != nil {
 		t.Fatalf("GetArchive failed: %v", err)
 	}
@@ -399,14 +399,12 @@ func TestGetArchive_CacheMiss_FetchUpstream(t *testing.T) {
 	defer server.Close()
 
 	upstream := newTestUpstreamClientForMirror(server)
-	mirror := NewMirror(mockStorage, upstream, "http://localhost:8080", 0)
-
-	archivePath := "registry.terraform.io/hashicorp/aws/terraform-provider-aws_1.0.0_linux_amd64.zip"
+	mirror := NewMirror(mockStorage, upstream, "http://localhost:8080", 0, Options{})
 
 	// This test requires that the upstream client can fetch the download URL and then fetch the archive
 	// We'll test the cache hit scenario instead for simplicity, as the full integration requires
 	// a more complex mock setup
-	result, err := mirror.GetArchive(context.Background(), "registry.terraform.io", "hashicorp", "aws", "1.0.0", "linux", "amd64", archivePath)
+	result, err := mirror.GetArchive(context.Background(), "registry.terraform.io", "hashicorp", "aws", "1.0.0", "linux", "amd64")
 	if err != nil {
 		// This is expected to fail without a full mock, which is okay
 		// The important part is tested in TestGetArchive_CacheHit
@@ -429,7 +427,7 @@ func TestGetArchive_CacheMiss_FetchUpstream(t *testing.T) {
 func TestRewriteArchiveURLs(t *testing.T) {
 	mockStorage := NewMockStorage()
 	upstream := newTestUpstreamClientForMirror(httptest.NewTLSServer(http.HandlerFunc(nil)))
-	mirror := NewMirror(mockStorage, upstream, "http://localhost:8080", 0)
+	mirror := NewMirror(mockStorage, upstream, "http://localhost:8080", 0, Options{})
 
 	versionResp := VersionResponse{
 		Archives: map[string]Archive{
@@ -465,7 +463,7 @@ func TestRewriteArchiveURLs(t *testing.T) {
 func TestRewriteArchiveURLs_InvalidPlatformKey(t *testing.T) {
 	mockStorage := NewMockStorage()
 	upstream := newTestUpstreamClientForMirror(httptest.NewTLSServer(http.HandlerFunc(nil)))
-	mirror := NewMirror(mockStorage, upstream, "http://localhost:8080", 0)
+	mirror := NewMirror(mockStorage, upstream, "http://localhost:8080", 0, Options{})
 
 	versionResp := VersionResponse{
 		Archives: map[string]Archive{
@@ -528,7 +526,7 @@ func TestExtractFilename(t *testing.T) {
 
 	mockStorage := NewMockStorage()
 	upstream := newTestUpstreamClientForMirror(httptest.NewTLSServer(http.HandlerFunc(nil)))
-	mirror := NewMirror(mockStorage, upstream, "http://localhost:8080", 0)
+	mirror := NewMirror(mockStorage, upstream, "http://localhost:8080", 0, Options{})
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -564,7 +562,7 @@ func TestBuildDownloadURL(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			mirror := NewMirror(mockStorage, upstream, tt.baseURL, 0)
+			mirror := NewMirror(mockStorage, upstream, tt.baseURL, 0, Options{})
 			got := mirror.buildDownloadURL("registry.terraform.io", "hashicorp", "aws", "1.0.0", "linux", "amd64", "terraform-provider-aws_1.0.0_linux_amd64.zip")
 			if got != tt.wantURL {
 				t.Errorf("buildDownloadURL = %q, want %q", got, tt.wantURL)
@@ -637,7 +635,7 @@ func TestNewMirror(t *testing.T) {
 	mockStorage := NewMockStorage()
 	upstream := newTestUpstreamClientForMirror(httptest.NewTLSServer(http.HandlerFunc(nil)))
 
-	mirror := NewMirror(mockStorage, upstream, "http://localhost:8080", 0)
+	mirror := NewMirror(mockStorage, upstream, "http://localhost:8080", 0, Options{})
 	if mirror == nil {
 		t.Fatal("NewMirror returned nil")
 	}
@@ -680,7 +678,7 @@ func TestBuildVersionFromCache(t *testing.T) {
 	mockStorage.PutVersionsResponse(context.Background(), "registry.terraform.io", "hashicorp", "aws", versionsData)
 
 	upstream := newTestUpstreamClientForMirror(httptest.NewTLSServer(http.HandlerFunc(nil)))
-	mirror := NewMirror(mockStorage, upstream, "http://localhost:8080", 0)
+	mirror := NewMirror(mockStorage, upstream, "http://localhost:8080", 0, Options{})
 
 	result, err := mirror.buildVersionFromCache(context.Background(), "registry.terraform.io", "hashicorp", "aws", "1.0.0")
 	if err != nil {
@@ -723,7 +721,7 @@ func TestBuildVersionFromCache_NotFound(t *testing.T) {
 	mockStorage.PutVersionsResponse(context.Background(), "registry.terraform.io", "hashicorp", "aws", versionsData)
 
 	upstream := newTestUpstreamClientForMirror(httptest.NewTLSServer(http.HandlerFunc(nil)))
-	mirror := NewMirror(mockStorage, upstream, "http://localhost:8080", 0)
+	mirror := NewMirror(mockStorage, upstream, "http://localhost:8080", 0, Options{})
 
 	_, err := mirror.buildVersionFromCache(context.Background(), "registry.terraform.io", "hashicorp", "aws", "99.0.0")
 	if err != ErrNotFound {
@@ -735,7 +733,7 @@ func TestBuildVersionFromCache_NotFound(t *testing.T) {
 func TestBuildVersionFromCache_NoVersionsCache(t *testing.T) {
 	mockStorage := NewMockStorage()
 	upstream := newTestUpstreamClientForMirror(httptest.NewTLSServer(http.HandlerFunc(nil)))
-	mirror := NewMirror(mockStorage, upstream, "http://localhost:8080", 0)
+	mirror := NewMirror(mockStorage, upstream, "http://localhost:8080", 0, Options{})
 
 	_, err := mirror.buildVersionFromCache(context.Background(), "registry.terraform.io", "hashicorp", "aws", "1.0.0")
 	if err == nil {
@@ -765,7 +763,7 @@ func TestGetIndex_CacheWriteError(t *testing.T) {
 	defer server.Close()
 
 	upstream := newTestUpstreamClientForMirror(server)
-	mirror := NewMirror(mockStorage, upstream, "http://localhost:8080", 0)
+	mirror := NewMirror(mockStorage, upstream, "http://localhost:8080", 0, Options{})
 
 	// Will fail due to service discovery not being configured
 	_, err := mirror.GetIndex(context.Background(), "registry.terraform.io", "hashicorp", "aws")
@@ -798,7 +796,7 @@ func TestGetVersion_CacheWriteError(t *testing.T) {
 	defer server.Close()
 
 	upstream := newTestUpstreamClientForMirror(server)
-	mirror := NewMirror(mockStorage, upstream, "http://localhost:8080", 0)
+	mirror := NewMirror(mockStorage, upstream, "http://localhost:8080", 0, Options{})
 
 	// Will fail due to service discovery not being configured
 	_, err := mirror.GetVersion(context.Background(), "registry.terraform.io", "hashicorp", "aws", "1.0.0")
@@ -823,7 +821,7 @@ func TestGetIndex_FreshCache_NoRefresh(t *testing.T) {
 	defer server.Close()
 
 	upstream := newTestUpstreamClientForMirror(server)
-	m := NewMirror(mockStorage, upstream, "http://localhost:8080", 1*time.Hour)
+	m := NewMirror(mockStorage, upstream, "http://localhost:8080", 1*time.Hour, Options{})
 
 	cachedData := []byte(`{"versions": {"1.0.0": {}}}`)
 	mockStorage.PutIndex(context.Background(), "registry.terraform.io", "hashicorp", "aws", cachedData)
@@ -878,7 +876,7 @@ func TestGetIndex_StaleCache_TriggersBackgroundRefresh(t *testing.T) {
 
 	// Use the test server's host as the "registry" hostname so discovery works
 	serverHost := strings.TrimPrefix(server.URL, "https://")
-	m := NewMirror(mockStorage, upstream, "http://localhost:8080", 1*time.Hour)
+	m := NewMirror(mockStorage, upstream, "http://localhost:8080", 1*time.Hour, Options{})
 	defer m.Shutdown()
 
 	cachedData := []byte(`{"versions": {"1.0.0": {}}}`)
@@ -943,7 +941,7 @@ func TestGetIndex_StaleCache_UpstreamFails_ServesStaleData(t *testing.T) {
 	}
 
 	serverHost := strings.TrimPrefix(server.URL, "https://")
-	m := NewMirror(mockStorage, upstream, "http://localhost:8080", 1*time.Hour)
+	m := NewMirror(mockStorage, upstream, "http://localhost:8080", 1*time.Hour, Options{})
 
 	cachedData := []byte(`{"versions": {"1.0.0": {}}}`)
 	mockStorage.PutIndex(context.Background(), serverHost, "hashicorp", "aws", cachedData)
@@ -963,7 +961,7 @@ func TestGetIndex_StaleCache_UpstreamFails_ServesStaleData(t *testing.T) {
 	m.Shutdown()
 
 	// Second call: should still return the same stale data (unchanged by failed refresh)
-	m2 := NewMirror(mockStorage, upstream, "http://localhost:8080", 0)
+	m2 := NewMirror(mockStorage, upstream, "http://localhost:8080", 0, Options{})
 	result2, err := m2.GetIndex(context.Background(), serverHost, "hashicorp", "aws")
 	if err != nil {
 		t.Fatalf("GetIndex should not fail after failed refresh: %v", err)
@@ -985,7 +983,7 @@ func TestGetIndex_ZeroTTL_DisablesRevalidation(t *testing.T) {
 	defer server.Close()
 
 	upstream := newTestUpstreamClientForMirror(server)
-	m := NewMirror(mockStorage, upstream, "http://localhost:8080", 0)
+	m := NewMirror(mockStorage, upstream, "http://localhost:8080", 0, Options{})
 
 	cachedData := []byte(`{"versions": {"1.0.0": {}}}`)
 	mockStorage.PutIndex(context.Background(), "registry.terraform.io", "hashicorp", "aws", cachedData)
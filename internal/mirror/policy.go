@@ -0,0 +1,138 @@
+package mirror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/elisiariocouto/specular/internal/authz"
+	goversion "github.com/hashicorp/go-version"
+)
+
+// VersionRule pins providers matching a pattern to a version constraint
+type VersionRule struct {
+	// Provider is a "namespace/type" or "hostname/namespace/type" glob pattern
+	Provider string `json:"provider"`
+	// Constraint uses Terraform's version constraint syntax (e.g., ">= 5.0, < 6.0" or "~> 5.70")
+	Constraint string `json:"constraint"`
+
+	constraints goversion.Constraints
+}
+
+// ProviderPolicy decides which providers and versions the mirror serves, regardless of the caller
+type ProviderPolicy struct {
+	// Allow lists provider patterns that may be served. Empty allows every provider not denied.
+	Allow []string `json:"allow,omitempty"`
+	// Deny lists provider patterns that are never served. Deny takes precedence over Allow.
+	Deny []string `json:"deny,omitempty"`
+	// Versions restricts matching providers to versions satisfying every matching constraint
+	Versions []VersionRule `json:"versions,omitempty"`
+}
+
+// LoadProviderPolicy reads and validates a JSON provider policy file
+func LoadProviderPolicy(file string) (*ProviderPolicy, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read provider policy: %w", err)
+	}
+
+	var policy ProviderPolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse provider policy: %w", err)
+	}
+
+	if err := policy.compile(); err != nil {
+		return nil, fmt.Errorf("invalid provider policy: %w", err)
+	}
+
+	return &policy, nil
+}
+
+// compile validates patterns and parses version constraints
+func (p *ProviderPolicy) compile() error {
+	var errs []error
+	for _, pattern := range append(append([]string{}, p.Allow...), p.Deny...) {
+		if err := authz.ValidateProviderPattern(pattern); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for i := range p.Versions {
+		rule := &p.Versions[i]
+		if err := authz.ValidateProviderPattern(rule.Provider); err != nil {
+			errs = append(errs, err)
+		}
+		constraints, err := goversion.NewConstraint(rule.Constraint)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid version constraint %q for %s: %w", rule.Constraint, rule.Provider, err))
+			continue
+		}
+		rule.constraints = constraints
+	}
+	return errors.Join(errs...)
+}
+
+// CheckProvider returns an error wrapping ErrForbidden if the provider may not be served
+func (p *ProviderPolicy) CheckProvider(hostname, namespace, providerType string) error {
+	resource := policyResource(hostname, namespace, providerType)
+
+	for _, pattern := range p.Deny {
+		if authz.MatchProvider(pattern, resource) {
+			return fmt.Errorf("%w: provider %s is denied by pattern %q", ErrForbidden, resource, pattern)
+		}
+	}
+
+	if len(p.Allow) == 0 {
+		return nil
+	}
+	for _, pattern := range p.Allow {
+		if authz.MatchProvider(pattern, resource) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: provider %s is not in the allow list", ErrForbidden, resource)
+}
+
+// policyResource returns the provider matched against policy rules, with the hostname in the
+// canonical form used upstream so other spellings of a registry match the same rules
+func policyResource(hostname, namespace, providerType string) authz.Resource {
+	if canonical, err := normalizeHostname(hostname); err == nil {
+		hostname = canonical
+	}
+	return authz.Resource{Hostname: hostname, Namespace: namespace, Type: providerType}
+}
+
+// AllowsVersion reports whether a provider version satisfies every matching version constraint.
+// Versions that cannot be parsed are rejected when any constraint applies.
+func (p *ProviderPolicy) AllowsVersion(hostname, namespace, providerType, version string) bool {
+	resource := policyResource(hostname, namespace, providerType)
+
+	var parsed *goversion.Version
+	for _, rule := range p.Versions {
+		if !authz.MatchProvider(rule.Provider, resource) {
+			continue
+		}
+		if parsed == nil {
+			v, err := goversion.NewVersion(version)
+			if err != nil {
+				return false
+			}
+			parsed = v
+		}
+		if !rule.constraints.Check(parsed) {
+			return false
+		}
+	}
+	return true
+}
+
+// filterIndex removes versions from an index.json document that the policy does not allow
+func (p *ProviderPolicy) filterIndex(hostname, namespace, providerType string, data []byte) ([]byte, error) {
+	if len(p.Versions) == 0 {
+		return data, nil
+	}
+
+	return filterIndexVersions(data, func(version string) bool {
+		return !p.AllowsVersion(hostname, namespace, providerType, version)
+	})
+}
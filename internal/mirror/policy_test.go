@@ -0,0 +1,196 @@
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writePolicyFile(t *testing.T, content string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "policy.json")
+	if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatalf("failed to write policy: %v", err)
+	}
+	return file
+}
+
+func testProviderPolicy(t *testing.T) *ProviderPolicy {
+	t.Helper()
+	policy, err := LoadProviderPolicy(writePolicyFile(t, `{
+		"allow": ["registry.terraform.io/hashicorp/*", "registry.terraform.io/ourcorp/*"],
+		"deny": ["*/hashicorp/template"],
+		"versions": [
+			{"provider": "hashicorp/aws", "constraint": ">= 5.0, < 6.0"},
+			{"provider": "hashicorp/aws", "constraint": "!= 5.1.0"}
+		]
+	}`))
+	if err != nil {
+		t.Fatalf("LoadProviderPolicy failed: %v", err)
+	}
+	return policy
+}
+
+func TestProviderPolicy_CheckProvider(t *testing.T) {
+	policy := testProviderPolicy(t)
+
+	tests := []struct {
+		namespace, providerType string
+		forbidden               bool
+		reason                  string
+	}{
+		{"hashicorp", "aws", false, ""},
+		{"ourcorp", "internal", false, ""},
+		{"hashicorp", "template", true, `denied by pattern "*/hashicorp/template"`},
+		{"community", "thing", true, "not in the allow list"},
+	}
+
+	for _, tt := range tests {
+		err := policy.CheckProvider("registry.terraform.io", tt.namespace, tt.providerType)
+		if (err != nil) != tt.forbidden {
+			t.Errorf("CheckProvider(%s/%s) error = %v, forbidden %v", tt.namespace, tt.providerType, err, tt.forbidden)
+			continue
+		}
+		if err != nil {
+			if !errors.Is(err, ErrForbidden) {
+				t.Errorf("expected ErrForbidden, got %v", err)
+			}
+			if !strings.Contains(err.Error(), tt.reason) {
+				t.Errorf("expected error to contain %q, got %q", tt.reason, err.Error())
+			}
+		}
+	}
+}
+
+func TestProviderPolicy_AllowsVersion(t *testing.T) {
+	policy := testProviderPolicy(t)
+
+	tests := []struct {
+		providerType, version string
+		allowed               bool
+	}{
+		{"aws", "5.70.0", true},
+		{"aws", "5.1.0", false},
+		{"aws", "4.67.0", false},
+		{"aws", "6.0.0", false},
+		{"aws", "not-a-version", false},
+		{"google", "1.0.0", true},
+	}
+
+	for _, tt := range tests {
+		if got := policy.AllowsVersion("registry.terraform.io", "hashicorp", tt.providerType, tt.version); got != tt.allowed {
+			t.Errorf("AllowsVersion(%s, %s) = %v, want %v", tt.providerType, tt.version, got, tt.allowed)
+		}
+	}
+}
+
+func TestLoadProviderPolicy_Invalid(t *testing.T) {
+	_, err := LoadProviderPolicy(writePolicyFile(t, `{
+		"deny": ["single"],
+		"versions": [{"provider": "hashicorp/aws", "constraint": "around 5"}]
+	}`))
+	if err == nil {
+		t.Fatal("expected error for invalid policy")
+	}
+	for _, msg := range []string{`provider pattern "single"`, `invalid version constraint "around 5"`} {
+		if !strings.Contains(err.Error(), msg) {
+			t.Errorf("expected error to include %q, got %q", msg, err.Error())
+		}
+	}
+}
+
+// TestGetIndex_PolicyFiltersVersions tests that disallowed versions are never advertised
+func TestGetIndex_PolicyFiltersVersions(t *testing.T) {
+	mockStorage := NewMockStorage()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("upstream should not be called when cache hit")
+	}))
+	defer server.Close()
+
+	m := NewMirror(mockStorage, newTestUpstreamClientForMirror(server), "http://localhost:8080", 0,
+		Options{Policy: testProviderPolicy(t)})
+
+	mockStorage.PutIndex(context.Background(), "registry.terraform.io", "hashicorp", "aws",
+		[]byte(`{"versions":{"4.67.0":{},"5.1.0":{},"5.70.0":{},"6.0.0":{}}}`))
+
+	data, err := m.GetIndex(context.Background(), "registry.terraform.io", "hashicorp", "aws")
+	if err != nil {
+		t.Fatalf("GetIndex failed: %v", err)
+	}
+
+	var index IndexResponse
+	if err := json.Unmarshal(data, &index); err != nil {
+		t.Fatalf("failed to parse index: %v", err)
+	}
+	if len(index.Versions) != 1 {
+		t.Fatalf("expected only 5.70.0 to be advertised, got %v", index.Versions)
+	}
+	if _, ok := index.Versions["5.70.0"]; !ok {
+		t.Errorf("expected 5.70.0 in index, got %v", index.Versions)
+	}
+}
+
+// TestPolicy_BlocksBeforeFetching tests that forbidden providers and versions never reach storage or upstream
+func TestPolicy_BlocksBeforeFetching(t *testing.T) {
+	mockStorage := NewMockStorage()
+	mockStorage.getIndexErr = errors.New("storage must not be called")
+	mockStorage.getVersionErr = errors.New("storage must not be called")
+	mockStorage.getArchiveErr = errors.New("storage must not be called")
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("upstream must not be called for forbidden providers")
+	}))
+	defer server.Close()
+
+	m := NewMirror(mockStorage, newTestUpstreamClientForMirror(server), "http://localhost:8080", 0,
+		Options{Policy: testProviderPolicy(t)})
+	ctx := context.Background()
+
+	if _, err := m.GetIndex(ctx, "registry.terraform.io", "community", "thing"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("GetIndex: expected ErrForbidden, got %v", err)
+	}
+	if _, err := m.GetVersion(ctx, "registry.terraform.io", "hashicorp", "template", "2.2.0"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("GetVersion: expected ErrForbidden, got %v", err)
+	}
+	if _, err := m.GetVersion(ctx, "registry.terraform.io", "hashicorp", "aws", "4.67.0"); err != ErrNotFound {
+		t.Errorf("GetVersion: expected ErrNotFound for disallowed version, got %v", err)
+	}
+	if _, err := m.GetArchive(ctx, "registry.terraform.io", "hashicorp", "aws", "6.0.0", "linux", "amd64"); err != ErrNotFound {
+		t.Errorf("GetArchive: expected ErrNotFound for disallowed version, got %v", err)
+	}
+}
+
+// TestProviderPolicy_NonCanonicalHostnames tests that other spellings of a registry hostname
+// cannot slip past deny rules written for the canonical one
+func TestProviderPolicy_NonCanonicalHostnames(t *testing.T) {
+	policy, err := LoadProviderPolicy(writePolicyFile(t, `{"deny": ["registry.terraform.io/hashicorp/template"]}`))
+	if err != nil {
+		t.Fatalf("LoadProviderPolicy failed: %v", err)
+	}
+
+	m := NewMirror(NewMockStorage(), nil, "http://localhost:8080", 0, Options{Policy: policy})
+	defer m.Shutdown()
+
+	for _, hostname := range []string{"registry.terraform.io:443", "ｒegistry.terraform.io", "Registry.Terraform.io"} {
+		if err := policy.CheckProvider(hostname, "hashicorp", "template"); !errors.Is(err, ErrForbidden) {
+			t.Errorf("CheckProvider(%q) = %v, want ErrForbidden", hostname, err)
+		}
+		if _, err := m.GetIndex(context.Background(), hostname, "hashicorp", "template"); !errors.Is(err, ErrInvalidAddress) {
+			t.Errorf("GetIndex(%q) = %v, want ErrInvalidAddress", hostname, err)
+		}
+		if _, err := m.GetVersion(context.Background(), hostname, "hashicorp", "aws", "1.0.0"); !errors.Is(err, ErrInvalidAddress) {
+			t.Errorf("GetVersion(%q) = %v, want ErrInvalidAddress", hostname, err)
+		}
+	}
+
+	for _, hostname := range []string{"registry.terraform.io", "localhost:8443", "xn--rgistry-fya.example.com"} {
+		if err := CheckHostname(hostname); err != nil {
+			t.Errorf("CheckHostname(%q) = %v, want nil", hostname, err)
+		}
+	}
+}
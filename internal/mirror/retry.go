@@ -0,0 +1,147 @@
+package mirror
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// maxBackoff caps the jittered exponential backoff between attempts
+	maxBackoff = 30 * time.Second
+	// maxRetryAfter is the longest Retry-After honoured; longer waits are not retried at all
+	maxRetryAfter = 30 * time.Second
+	// retryBudgetReserve is the number of retries a host may use before its budget depends on traffic
+	retryBudgetReserve = 10
+	// retryBudgetIdleTTL is how long a host's budget is kept without requests; a forgotten
+	// host starts again from the reserve
+	retryBudgetIdleTTL = 10 * time.Minute
+)
+
+// backoffDelay returns a full-jitter delay: a random duration below 1<<attempt seconds, capped at maxBackoff
+func backoffDelay(attempt int) time.Duration {
+	ceiling := min(time.Duration(1)<<uint(min(attempt, 16))*time.Second, maxBackoff)
+	return rand.N(ceiling)
+}
+
+// sleepContext waits for d, respecting context cancellation
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// retryableStatus reports whether a response status is worth retrying
+func retryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// retryAfter returns the wait requested by a 429 or 503 response's Retry-After header,
+// given either as delay seconds or as an HTTP date
+func retryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return 0, false
+	}
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// retryBudget limits retries per upstream host to a ratio of the requests it receives.
+// Every request deposits ratio tokens and every retry spends one, on top of a small
+// reserve, so a failing host sees at most about ratio retries per request instead of
+// every request multiplying into several. A nil *retryBudget allows every retry.
+type retryBudget struct {
+	ratio float64
+
+	mu        sync.Mutex
+	balance   map[string]*hostBudget
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// hostBudget is the retry budget of one upstream host
+type hostBudget struct {
+	tokens   float64
+	lastUsed time.Time
+}
+
+// newRetryBudget returns a budget allowing ratio retries per request, or nil when ratio is not positive
+func newRetryBudget(ratio float64) *retryBudget {
+	if ratio <= 0 {
+		return nil
+	}
+	return &retryBudget{ratio: ratio, balance: make(map[string]*hostBudget), now: time.Now}
+}
+
+// host returns the budget of a host, starting from the reserve on first use; b.mu must be held
+func (b *retryBudget) host(host string) *hostBudget {
+	now := b.now()
+
+	// Drop idle hosts so the map does not grow without bound
+	if now.Sub(b.lastSweep) > time.Minute {
+		for h, budget := range b.balance {
+			if now.Sub(budget.lastUsed) > retryBudgetIdleTTL {
+				delete(b.balance, h)
+			}
+		}
+		b.lastSweep = now
+	}
+
+	budget, ok := b.balance[host]
+	if !ok {
+		budget = &hostBudget{tokens: retryBudgetReserve}
+		b.balance[host] = budget
+	}
+	budget.lastUsed = now
+	return budget
+}
+
+// deposit credits a host for a new request
+func (b *retryBudget) deposit(host string) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	budget := b.host(host)
+	budget.tokens = min(budget.tokens+b.ratio, retryBudgetReserve)
+}
+
+// withdraw spends a token for a retry, reporting false when the host's budget is exhausted
+func (b *retryBudget) withdraw(host string) bool {
+	if b == nil {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	budget := b.host(host)
+	if budget.tokens < 1 {
+		return false
+	}
+	budget.tokens--
+	return true
+}
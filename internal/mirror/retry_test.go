@@ -0,0 +1,247 @@
+package mirror
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		status int
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{name: "429 seconds", status: http.StatusTooManyRequests, header: "5", want: 5 * time.Second, ok: true},
+		{name: "503 HTTP date", status: http.StatusServiceUnavailable, header: "Sun, 01 Jun 2025 12:00:20 GMT", want: 20 * time.Second, ok: true},
+		{name: "date in the past", status: http.StatusServiceUnavailable, header: "Sun, 01 Jun 2025 11:00:00 GMT", want: 0, ok: true},
+		{name: "other status", status: http.StatusBadGateway, header: "5"},
+		{name: "missing header", status: http.StatusTooManyRequests},
+		{name: "invalid header", status: http.StatusTooManyRequests, header: "soon"},
+		{name: "negative seconds", status: http.StatusTooManyRequests, header: "-1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.status, Header: http.Header{}}
+			if tt.header != "" {
+				resp.Header.Set("Retry-After", tt.header)
+			}
+			got, ok := retryAfter(resp, now)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("retryAfter() = %s, %v; want %s, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	for attempt, ceiling := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		for i := 0; i < 100; i++ {
+			if d := backoffDelay(attempt); d < 0 || d >= ceiling {
+				t.Fatalf("backoffDelay(%d) = %s, want below %s", attempt, d, ceiling)
+			}
+		}
+	}
+	if d := backoffDelay(40); d >= maxBackoff {
+		t.Errorf("backoffDelay(40) = %s, want below %s", d, maxBackoff)
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	budget := newRetryBudget(0.5)
+	host := "registry.example.com"
+
+	for i := 0; i < retryBudgetReserve; i++ {
+		if !budget.withdraw(host) {
+			t.Fatalf("expected reserve retry %d to be allowed", i)
+		}
+	}
+	if budget.withdraw(host) {
+		t.Fatal("expected the budget to be exhausted")
+	}
+
+	// Two requests at a ratio of 0.5 earn one retry
+	budget.deposit(host)
+	budget.deposit(host)
+	if !budget.withdraw(host) {
+		t.Fatal("expected deposits to allow another retry")
+	}
+	if budget.withdraw(host) {
+		t.Fatal("expected the budget to be exhausted again")
+	}
+
+	// Budgets are tracked per host
+	if !budget.withdraw("other.example.com") {
+		t.Error("expected another host to have its own budget")
+	}
+
+	if newRetryBudget(0) != nil || !(*retryBudget)(nil).withdraw(host) {
+		t.Error("expected a zero ratio to disable the budget")
+	}
+}
+
+func TestRetryBudget_ForgetsIdleHosts(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	budget := newRetryBudget(0.5)
+	budget.now = func() time.Time { return now }
+
+	budget.withdraw("idle.example.com")
+	now = now.Add(retryBudgetIdleTTL + time.Minute)
+	budget.withdraw("active.example.com")
+
+	if _, ok := budget.balance["idle.example.com"]; ok {
+		t.Error("expected the idle host to be forgotten")
+	}
+	if _, ok := budget.balance["active.example.com"]; !ok {
+		t.Error("expected the active host to be kept")
+	}
+}
+
+func TestDoRequestWithRetry_RetryAfter(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	uc := newTestUpstreamClient(server)
+	start := time.Now()
+	body, status, err := uc.fetch(context.Background(), server.URL, "")
+	if err != nil || status != http.StatusOK || string(body) != "ok" {
+		t.Fatalf("expected 429 to be retried, got %q %d %v", body, status, err)
+	}
+	if requests.Load() != 2 {
+		t.Errorf("expected 2 requests, got %d", requests.Load())
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("expected Retry-After: 0 to retry immediately, took %s", elapsed)
+	}
+}
+
+func TestDoRequestWithRetry_LongRetryAfterNotRetried(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	uc := newTestUpstreamClient(server)
+	_, status, err := uc.fetch(context.Background(), server.URL, "")
+	if err != nil || status != http.StatusServiceUnavailable {
+		t.Fatalf("expected the 503 to be returned, got %d %v", status, err)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("expected no retries beyond the maximum Retry-After, got %d requests", requests.Load())
+	}
+}
+
+func TestDoRequestWithRetry_RetryBudgetExhausted(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	uc := newTestUpstreamClient(server)
+	uc.retryBudget = newRetryBudget(0.1)
+	host := server.Listener.Addr().String()
+	for uc.retryBudget.withdraw(host) {
+	}
+
+	_, status, err := uc.fetch(context.Background(), server.URL, "")
+	if err != nil || status != http.StatusBadGateway {
+		t.Fatalf("expected the 502 to be returned, got %d %v", status, err)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("expected no retries with an exhausted budget, got %d requests", requests.Load())
+	}
+}
+
+func TestFetch_RetriesBodyReadFailure(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			// Promise more than is sent so the connection drops mid-body
+			w.Header().Set("Content-Length", "100")
+			w.Write([]byte(`{"versions":`))
+			return
+		}
+		w.Write([]byte(`{"versions":[]}`))
+	}))
+	defer server.Close()
+
+	uc := newTestUpstreamClient(server)
+	body, status, err := uc.fetch(context.Background(), server.URL, "")
+	if err != nil || status != http.StatusOK || string(body) != `{"versions":[]}` {
+		t.Fatalf("expected the truncated body to be retried, got %q %d %v", body, status, err)
+	}
+	if requests.Load() != 2 {
+		t.Errorf("expected 2 requests, got %d", requests.Load())
+	}
+}
+
+func TestFetch_BodyReadRetryDepositsOnce(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Length", "100")
+		w.Write([]byte(`{"versions":`))
+	}))
+	defer server.Close()
+
+	uc := newTestUpstreamClient(server)
+	uc.retryBudget = newRetryBudget(0.5)
+	host := server.Listener.Addr().String()
+	for uc.retryBudget.withdraw(host) {
+	}
+	uc.retryBudget.deposit(host)
+
+	// The fetch's deposit allows one retry; repeating the request must not deposit again
+	if _, _, err := uc.fetch(context.Background(), server.URL, ""); err == nil {
+		t.Fatal("expected the truncated body to fail the fetch")
+	}
+	if requests.Load() != 2 {
+		t.Errorf("expected 2 requests, got %d", requests.Load())
+	}
+	if balance := uc.retryBudget.balance[host].tokens; balance != 0 {
+		t.Errorf("retry budget balance = %v, want 0 after one deposit and one retry", balance)
+	}
+}
+
+func TestFetch_BodyReadRetriesShareAttempts(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Every other response is a server error, the rest drop mid-body
+		if requests.Add(1)%2 == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Length", "100")
+		w.Write([]byte(`{"versions":`))
+	}))
+	defer server.Close()
+
+	uc := newTestUpstreamClient(server)
+	if _, status, err := uc.fetch(context.Background(), server.URL, ""); err == nil && status == http.StatusOK {
+		t.Fatal("expected the fetch to fail")
+	}
+	if want := int32(uc.maxRetries + 1); requests.Load() != want {
+		t.Errorf("expected %d requests in total, got %d", want, requests.Load())
+	}
+}
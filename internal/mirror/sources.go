@@ -0,0 +1,474 @@
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elisiariocouto/specular/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// sourceRecoveryInterval is how long a failed source is tried only after healthy ones
+const sourceRecoveryInterval = 30 * time.Second
+
+// Upstream source kinds
+const (
+	// SourceRegistry fetches from the hostname's own registry, honouring aliases
+	SourceRegistry = "registry"
+	// SourceMirror fetches from a provider network mirror
+	SourceMirror = "mirror"
+	// SourceBundle reads a directory written by "terraform providers mirror"
+	SourceBundle = "bundle"
+)
+
+// upstreamSource is one way of reaching the providers of a hostname
+type upstreamSource struct {
+	kind string
+	name string   // used in logs, metrics and status
+	base *url.URL // network mirror base URL for SourceMirror
+	dir  string   // bundle directory for SourceBundle
+
+	mu                  sync.Mutex
+	consecutiveFailures int
+	lastError           string
+	lastFailure         time.Time
+	lastSuccess         time.Time
+	served              int
+}
+
+// SourceStatus describes the health of one upstream source of a hostname
+type SourceStatus struct {
+	Hostname            string     `json:"hostname"`
+	Source              string     `json:"source"`
+	Kind                string     `json:"kind"`
+	Healthy             bool       `json:"healthy"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastFailure         *time.Time `json:"last_failure,omitempty"`
+	LastSuccess         *time.Time `json:"last_success,omitempty"`
+	Served              int        `json:"served"`
+}
+
+// UpstreamSources maps registry hostnames to ordered lists of sources tried in turn.
+// A nil *UpstreamSources gives every hostname its usual single upstream.
+type UpstreamSources struct {
+	hosts map[string][]*upstreamSource
+}
+
+// ParseUpstreamSources parses "hostname=source|source|..." entries. A source is "registry"
+// for the hostname's own registry, an http(s) network mirror base URL, or a local bundle
+// directory given as an absolute path or file: URL.
+func ParseUpstreamSources(entries []string) (*UpstreamSources, error) {
+	sources := &UpstreamSources{hosts: make(map[string][]*upstreamSource)}
+
+	for _, entry := range entries {
+		hostname, list, ok := strings.Cut(entry, "=")
+		hostname, list = strings.ToLower(strings.TrimSpace(hostname)), strings.TrimSpace(list)
+		if !ok || hostname == "" || list == "" || strings.ContainsAny(hostname, "/?#") {
+			return nil, fmt.Errorf("invalid upstream sources %q: expected hostname=source|source", entry)
+		}
+		if _, dup := sources.hosts[hostname]; dup {
+			return nil, fmt.Errorf("duplicate upstream sources for %s", hostname)
+		}
+
+		seen := make(map[string]bool)
+		for _, spec := range strings.Split(list, "|") {
+			src, err := parseUpstreamSource(strings.TrimSpace(spec))
+			if err != nil {
+				return nil, fmt.Errorf("invalid upstream sources for %s: %w", hostname, err)
+			}
+			if seen[src.name] {
+				return nil, fmt.Errorf("invalid upstream sources for %s: %s listed twice", hostname, src.name)
+			}
+			seen[src.name] = true
+			sources.hosts[hostname] = append(sources.hosts[hostname], src)
+		}
+	}
+
+	return sources, nil
+}
+
+// parseUpstreamSource parses a single source specification
+func parseUpstreamSource(spec string) (*upstreamSource, error) {
+	switch {
+	case spec == SourceRegistry:
+		return &upstreamSource{kind: SourceRegistry, name: SourceRegistry}, nil
+	case strings.HasPrefix(spec, "http://") || strings.HasPrefix(spec, "https://"):
+		base, err := url.Parse(spec)
+		if err != nil || base.Host == "" {
+			return nil, fmt.Errorf("invalid network mirror URL %q", spec)
+		}
+		return &upstreamSource{kind: SourceMirror, name: base.Redacted(), base: base}, nil
+	case strings.HasPrefix(spec, "file:") || filepath.IsAbs(spec):
+		dir := spec
+		if strings.HasPrefix(spec, "file:") {
+			u, err := url.Parse(spec)
+			if err != nil || u.Path == "" {
+				return nil, fmt.Errorf("invalid bundle URL %q", spec)
+			}
+			dir = u.Path
+		}
+		if !filepath.IsAbs(dir) {
+			return nil, fmt.Errorf("bundle directory must be an absolute path: %s", dir)
+		}
+		dir = filepath.Clean(dir)
+		return &upstreamSource{kind: SourceBundle, name: "file:" + dir, dir: dir}, nil
+	}
+	return nil, fmt.Errorf("unknown source %q: expected registry, a network mirror URL or an absolute bundle path", spec)
+}
+
+// Len returns the number of hostnames with source lists
+func (s *UpstreamSources) Len() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.hosts)
+}
+
+// configuresHost reports whether host is a hostname with a source list or the host of one
+// of the configured network mirrors
+func (s *UpstreamSources) configuresHost(host string) bool {
+	if s == nil {
+		return false
+	}
+	if _, ok := s.hosts[host]; ok {
+		return true
+	}
+	for _, sources := range s.hosts {
+		for _, src := range sources {
+			if src.base != nil && strings.EqualFold(src.base.Host, host) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// forHost returns the sources of a hostname in the order they should be tried: healthy
+// sources in configured order, then recently failed ones. Nil means no source list.
+func (s *UpstreamSources) forHost(hostname string) []*upstreamSource {
+	if s == nil {
+		return nil
+	}
+	configured := s.hosts[strings.ToLower(hostname)]
+	if configured == nil {
+		return nil
+	}
+
+	now := time.Now()
+	ordered := make([]*upstreamSource, 0, len(configured))
+	var failed []*upstreamSource
+	for _, src := range configured {
+		if src.healthy(now) {
+			ordered = append(ordered, src)
+		} else {
+			failed = append(failed, src)
+		}
+	}
+	return append(ordered, failed...)
+}
+
+// healthy reports whether a source has not failed within sourceRecoveryInterval
+func (src *upstreamSource) healthy(now time.Time) bool {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	return src.consecutiveFailures == 0 || now.Sub(src.lastFailure) > sourceRecoveryInterval
+}
+
+// recordResult updates a source's health with the outcome of a fetch
+func (src *upstreamSource) recordResult(err error) {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+
+	if err != nil {
+		src.consecutiveFailures++
+		src.lastError = err.Error()
+		src.lastFailure = time.Now()
+		return
+	}
+	src.consecutiveFailures = 0
+	src.lastSuccess = time.Now()
+	src.served++
+}
+
+// status returns the health of every configured source, sorted by hostname then priority
+func (s *UpstreamSources) status() []SourceStatus {
+	if s == nil {
+		return nil
+	}
+
+	hostnames := make([]string, 0, len(s.hosts))
+	for hostname := range s.hosts {
+		hostnames = append(hostnames, hostname)
+	}
+	sort.Strings(hostnames)
+
+	now := time.Now()
+	var statuses []SourceStatus
+	for _, hostname := range hostnames {
+		for _, src := range s.hosts[hostname] {
+			healthy := src.healthy(now)
+			src.mu.Lock()
+			status := SourceStatus{
+				Hostname:            hostname,
+				Source:              src.name,
+				Kind:                src.kind,
+				Healthy:             healthy,
+				ConsecutiveFailures: src.consecutiveFailures,
+				LastError:           src.lastError,
+				Served:              src.served,
+			}
+			if !src.lastFailure.IsZero() {
+				t := src.lastFailure.UTC()
+				status.LastFailure = &t
+			}
+			if !src.lastSuccess.IsZero() {
+				t := src.lastSuccess.UTC()
+				status.LastSuccess = &t
+			}
+			src.mu.Unlock()
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses
+}
+
+// SourceStatus returns the health of every configured upstream source
+func (uc *UpstreamClient) SourceStatus() []SourceStatus {
+	return uc.sources.status()
+}
+
+// failover calls fetch with each source in turn until one succeeds. Sources that do not
+// have the provider fall through to the next without counting against their health.
+// ErrNotFound is returned only when no source has the provider.
+func (uc *UpstreamClient) failover(ctx context.Context, hostname, namespace, providerType, what string, sources []*upstreamSource, fetch func(ctx context.Context, src *upstreamSource) error) error {
+	var errs []error
+	notFound := true
+
+	for _, src := range sources {
+		sourceCtx, span := tracing.Start(ctx, "UpstreamClient.source",
+			attribute.String("specular.upstream.source", src.name),
+			attribute.String("specular.upstream.source_kind", src.kind))
+		err := fetch(sourceCtx, src)
+		if errors.Is(err, ErrNotFound) {
+			span.SetAttributes(attribute.Bool("specular.upstream.not_found", true))
+			tracing.End(span, nil)
+		} else {
+			tracing.End(span, err)
+		}
+		if err == nil {
+			src.recordResult(nil)
+			uc.reportSource(hostname, src, true)
+			uc.logger.InfoContext(ctx,
+				fmt.Sprintf("upstream source served %s [hostname=%s namespace=%s type=%s source=%s]", what, hostname, namespace, providerType, src.name),
+				slog.String("hostname", hostname),
+				slog.String("namespace", namespace),
+				slog.String("type", providerType),
+				slog.String("source", src.name))
+			return nil
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+
+		if errors.Is(err, ErrNotFound) {
+			uc.logger.DebugContext(ctx,
+				fmt.Sprintf("upstream source does not have %s [hostname=%s namespace=%s type=%s source=%s]", what, hostname, namespace, providerType, src.name),
+				slog.String("hostname", hostname),
+				slog.String("source", src.name))
+			errs = append(errs, fmt.Errorf("%s: %w", src.name, err))
+			continue
+		}
+
+		notFound = false
+		src.recordResult(err)
+		uc.reportSource(hostname, src, false)
+		uc.logger.WarnContext(ctx,
+			fmt.Sprintf("upstream source failed, trying next [hostname=%s namespace=%s type=%s source=%s error=%s]", hostname, namespace, providerType, src.name, err),
+			slog.String("hostname", hostname),
+			slog.String("namespace", namespace),
+			slog.String("type", providerType),
+			slog.String("source", src.name),
+			slog.String("error", err.Error()))
+		errs = append(errs, fmt.Errorf("%s: %w", src.name, err))
+	}
+
+	if notFound {
+		return ErrNotFound
+	}
+	return fmt.Errorf("all upstream sources failed: %w", errors.Join(errs...))
+}
+
+// reportSource notifies the configured callback of a source's fetch outcome
+func (uc *UpstreamClient) reportSource(hostname string, src *upstreamSource, ok bool) {
+	if uc.onSourceResult != nil {
+		uc.onSourceResult(hostname, src.name, ok)
+	}
+}
+
+// fetchSourceIndex fetches a provider's index from one source
+func (uc *UpstreamClient) fetchSourceIndex(ctx context.Context, src *upstreamSource, hostname, namespace, providerType string) (*IndexResponse, *RegistryVersionsResponse, error) {
+	switch src.kind {
+	case SourceMirror:
+		index, err := uc.fetchMirrorIndex(ctx, src.base.JoinPath(hostname, namespace, providerType, "index.json").String())
+		return index, nil, err
+	case SourceBundle:
+		var index IndexResponse
+		if err := src.readBundleJSON(path.Join(hostname, namespace, providerType, "index.json"), &index); err != nil {
+			return nil, nil, err
+		}
+		return &index, nil, nil
+	}
+	return uc.fetchRegistryIndex(ctx, hostname, namespace, providerType)
+}
+
+// fetchSourceVersion fetches a version document from one source
+// Unlike FetchVersion without sources, registries return a document too, so versions never
+// depend on which source filled the cached versions listing
+func (uc *UpstreamClient) fetchSourceVersion(ctx context.Context, src *upstreamSource, hostname, namespace, providerType, version string) (*VersionResponse, error) {
+	switch src.kind {
+	case SourceMirror:
+		return uc.fetchMirrorVersion(ctx, src.base.JoinPath(hostname, namespace, providerType, version+".json").String())
+	case SourceBundle:
+		return src.readBundleVersion(hostname, namespace, providerType, version)
+	}
+	return uc.fetchRegistryVersion(ctx, hostname, namespace, providerType, version)
+}
+
+// fetchSourceDownloadURL looks up an archive's download URL in one source
+func (uc *UpstreamClient) fetchSourceDownloadURL(ctx context.Context, src *upstreamSource, hostname, namespace, providerType, version, os, arch string) (*DownloadInfo, error) {
+	var response *VersionResponse
+	var err error
+	switch src.kind {
+	case SourceMirror:
+		return uc.fetchMirrorDownloadURL(ctx, src.base.JoinPath(hostname, namespace, providerType, version+".json").String(), os, arch)
+	case SourceBundle:
+		response, err = src.readBundleVersion(hostname, namespace, providerType, version)
+	default:
+		return uc.fetchRegistryDownloadURL(ctx, hostname, namespace, providerType, version, os, arch)
+	}
+	if err != nil {
+		return nil, err
+	}
+	archive, ok := response.Archives[buildPlatformKey(os, arch)]
+	if !ok || archive.URL == "" {
+		return nil, ErrNotFound
+	}
+	return &DownloadInfo{DownloadURL: archive.URL}, nil
+}
+
+// fetchRegistryVersion builds a version document from a registry's versions listing.
+// Archive URLs are bare filenames; downloads look up the real URL through FetchDownloadURL.
+func (uc *UpstreamClient) fetchRegistryVersion(ctx context.Context, hostname, namespace, providerType, version string) (*VersionResponse, error) {
+	_, versions, err := uc.fetchRegistryIndex(ctx, hostname, namespace, providerType)
+	if err != nil {
+		return nil, err
+	}
+	if versions == nil {
+		// The registry speaks the mirror protocol, which has version documents of its own
+		url := fmt.Sprintf("https://%s/%s/%s/%s.json", uc.upstreamHost(hostname, namespace), namespace, providerType, version)
+		return uc.fetchMirrorVersion(ctx, url)
+	}
+
+	for _, v := range versions.Versions {
+		if v.Version != version || len(v.Platforms) == 0 {
+			continue
+		}
+		response := &VersionResponse{Archives: make(map[string]Archive, len(v.Platforms))}
+		for _, platform := range v.Platforms {
+			response.Archives[buildPlatformKey(platform.OS, platform.Arch)] = Archive{
+				URL: buildProviderFilename(providerType, version, platform.OS, platform.Arch),
+			}
+		}
+		return response, nil
+	}
+	return nil, ErrNotFound
+}
+
+// readBundleJSON decodes a JSON document from a bundle; missing documents are ErrNotFound
+func (src *upstreamSource) readBundleJSON(name string, v any) error {
+	f, err := src.openBundleFile(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return fmt.Errorf("failed to read %s from bundle: %w", name, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse %s from bundle: %w", name, err)
+	}
+	return nil
+}
+
+// readBundleVersion reads a version document from a bundle, resolving archive URLs to file URLs
+func (src *upstreamSource) readBundleVersion(hostname, namespace, providerType, version string) (*VersionResponse, error) {
+	name := path.Join(hostname, namespace, providerType, version+".json")
+	var response VersionResponse
+	if err := src.readBundleJSON(name, &response); err != nil {
+		return nil, err
+	}
+
+	base := &url.URL{Scheme: "file", Path: filepath.ToSlash(filepath.Join(src.dir, filepath.FromSlash(name)))}
+	for platform, archive := range response.Archives {
+		ref, err := url.Parse(archive.URL)
+		if err != nil || ref.IsAbs() {
+			return nil, fmt.Errorf("invalid archive URL for %s in bundle: %q", platform, archive.URL)
+		}
+		archive.URL = base.ResolveReference(ref).String()
+		response.Archives[platform] = archive
+	}
+	return &response, nil
+}
+
+// openBundleFile opens a file below the bundle directory; paths cannot escape it
+func (src *upstreamSource) openBundleFile(name string) (*os.File, error) {
+	root, err := os.OpenRoot(src.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bundle %s: %w", src.dir, err)
+	}
+	defer root.Close()
+
+	f, err := root.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s from bundle: %w", name, err)
+	}
+	return f, nil
+}
+
+// openBundleArchive opens an archive referenced by a file URL, which must lie inside a bundle
+// configured for the hostname, so upstream documents cannot point at arbitrary local files or
+// at the bundles of other hostnames
+func (s *UpstreamSources) openBundleArchive(hostname, filePath string) (io.ReadCloser, error) {
+	if s != nil {
+		target := filepath.Clean(filepath.FromSlash(filePath))
+		for _, src := range s.hosts[strings.ToLower(hostname)] {
+			if src.kind != SourceBundle {
+				continue
+			}
+			rel, err := filepath.Rel(src.dir, target)
+			if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				continue
+			}
+			return src.openBundleFile(rel)
+		}
+	}
+	return nil, fmt.Errorf("archive URL must use http or https scheme, got: file")
+}
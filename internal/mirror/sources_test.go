@@ -0,0 +1,267 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/elisiariocouto/specular/internal/storage"
+)
+
+func TestParseUpstreamSources(t *testing.T) {
+	dir := t.TempDir()
+	sources, err := ParseUpstreamSources([]string{
+		"Registry.Terraform.io=registry|https://mirror.example.com/providers/|file:" + dir,
+	})
+	if err != nil {
+		t.Fatalf("ParseUpstreamSources failed: %v", err)
+	}
+
+	got := sources.forHost("registry.terraform.io")
+	if len(got) != 3 {
+		t.Fatalf("expected 3 sources, got %d", len(got))
+	}
+	for i, kind := range []string{SourceRegistry, SourceMirror, SourceBundle} {
+		if got[i].kind != kind {
+			t.Errorf("source %d kind = %s, want %s", i, got[i].kind, kind)
+		}
+	}
+	if got[2].dir != dir {
+		t.Errorf("bundle dir = %s, want %s", got[2].dir, dir)
+	}
+
+	if sources.forHost("example.com") != nil {
+		t.Error("expected no sources for an unconfigured hostname")
+	}
+	var none *UpstreamSources
+	if none.forHost("registry.terraform.io") != nil || none.Len() != 0 {
+		t.Error("expected nil sources to configure nothing")
+	}
+}
+
+func TestParseUpstreamSources_Invalid(t *testing.T) {
+	tests := []string{
+		"registry.terraform.io",
+		"=registry",
+		"registry.terraform.io=",
+		"registry.terraform.io=ftp://mirror.example.com",
+		"registry.terraform.io=relative/bundle",
+		"registry.terraform.io=registry|registry",
+	}
+
+	for _, entry := range tests {
+		if _, err := ParseUpstreamSources([]string{entry}); err == nil {
+			t.Errorf("expected error for %q", entry)
+		}
+	}
+
+	if _, err := ParseUpstreamSources([]string{"example.com=registry", "EXAMPLE.com=registry"}); err == nil {
+		t.Error("expected error for duplicate hostnames")
+	}
+}
+
+// writeBundle writes a provider in "terraform providers mirror" layout
+func writeBundle(t *testing.T, dir string) {
+	t.Helper()
+	files := map[string]string{
+		"registry.terraform.io/hashicorp/aws/index.json":                                   `{"versions":{"1.0.0":{}}}`,
+		"registry.terraform.io/hashicorp/aws/1.0.0.json":                                   `{"archives":{"linux_amd64":{"url":"terraform-provider-aws_1.0.0_linux_amd64.zip"}}}`,
+		"registry.terraform.io/hashicorp/aws/terraform-provider-aws_1.0.0_linux_amd64.zip": "bundle archive",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestSources_Failover tests that sources are tried in order, failed sources are skipped
+// after healthy ones, and sources without the provider do not count as failures
+func TestSources_Failover(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+
+	empty := httptest.NewServer(http.NotFoundHandler())
+	defer empty.Close()
+
+	dir := t.TempDir()
+	writeBundle(t, dir)
+
+	sources, err := ParseUpstreamSources([]string{"registry.terraform.io=" + failing.URL + "|" + empty.URL + "|" + dir})
+	if err != nil {
+		t.Fatalf("ParseUpstreamSources failed: %v", err)
+	}
+
+	var results []string
+	uc := newTestUpstreamClient(failing)
+	uc.maxRetries = 0
+	uc.sources = sources
+	uc.onSourceResult = func(hostname, source string, ok bool) {
+		if ok {
+			results = append(results, "ok "+source)
+		} else {
+			results = append(results, "failed "+source)
+		}
+	}
+
+	index, _, err := uc.FetchIndex(context.Background(), "registry.terraform.io", "hashicorp", "aws")
+	if err != nil {
+		t.Fatalf("FetchIndex failed: %v", err)
+	}
+	if _, ok := index.Versions["1.0.0"]; !ok {
+		t.Errorf("expected version 1.0.0 from the bundle, got %v", index.Versions)
+	}
+
+	want := []string{"failed " + failing.URL, "ok file:" + dir}
+	if strings.Join(results, ",") != strings.Join(want, ",") {
+		t.Errorf("results = %v, want %v", results, want)
+	}
+
+	// The failed mirror is now tried last
+	ordered := sources.forHost("registry.terraform.io")
+	if ordered[len(ordered)-1].name != failing.URL {
+		t.Errorf("expected failed source last, got %s", ordered[len(ordered)-1].name)
+	}
+
+	statuses := uc.SourceStatus()
+	if len(statuses) != 3 {
+		t.Fatalf("expected 3 source statuses, got %d", len(statuses))
+	}
+	for _, status := range statuses {
+		switch status.Source {
+		case failing.URL:
+			if status.Healthy || status.ConsecutiveFailures != 1 || status.LastError == "" {
+				t.Errorf("expected failing source to be unhealthy, got %+v", status)
+			}
+		case empty.URL:
+			if !status.Healthy || status.ConsecutiveFailures != 0 {
+				t.Errorf("expected not-found source to stay healthy, got %+v", status)
+			}
+		default:
+			if !status.Healthy || status.Served != 1 {
+				t.Errorf("expected bundle to have served one document, got %+v", status)
+			}
+		}
+	}
+}
+
+// TestSources_NotFound tests that ErrNotFound is returned only when no source has the provider
+func TestSources_NotFound(t *testing.T) {
+	empty := httptest.NewServer(http.NotFoundHandler())
+	defer empty.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+
+	uc := newTestUpstreamClient(empty)
+	uc.maxRetries = 0
+
+	uc.sources, _ = ParseUpstreamSources([]string{"registry.terraform.io=" + empty.URL + "|" + t.TempDir()})
+	if _, _, err := uc.FetchIndex(context.Background(), "registry.terraform.io", "hashicorp", "aws"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	uc.sources, _ = ParseUpstreamSources([]string{"registry.terraform.io=" + empty.URL + "|" + failing.URL})
+	_, _, err := uc.FetchIndex(context.Background(), "registry.terraform.io", "hashicorp", "aws")
+	if err == nil || err == ErrNotFound {
+		t.Errorf("expected an upstream error, got %v", err)
+	}
+}
+
+// TestSources_BundleArchive tests that providers are mirrored from a bundle, including archives
+func TestSources_BundleArchive(t *testing.T) {
+	dir := t.TempDir()
+	writeBundle(t, dir)
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	uc := newTestUpstreamClient(server)
+	uc.sources, _ = ParseUpstreamSources([]string{"registry.terraform.io=" + dir})
+	m := NewMirror(storage.NewMemoryStorage(), uc, "http://localhost:8080", 0, Options{})
+
+	ctx := context.Background()
+	if _, err := m.GetVersion(ctx, "registry.terraform.io", "hashicorp", "aws", "1.0.0"); err != nil {
+		t.Fatalf("GetVersion failed: %v", err)
+	}
+
+	reader, err := m.GetArchive(ctx, "registry.terraform.io", "hashicorp", "aws", "1.0.0", "linux", "amd64")
+	if err != nil {
+		t.Fatalf("GetArchive failed: %v", err)
+	}
+	defer reader.Close()
+	if data, _ := io.ReadAll(reader); string(data) != "bundle archive" {
+		t.Errorf("archive = %q, want bundle archive", data)
+	}
+}
+
+// TestSources_BundleArchiveOutsideBundle tests that file URLs outside configured bundles are refused
+func TestSources_BundleArchiveOutsideBundle(t *testing.T) {
+	dir := t.TempDir()
+	outside := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(outside, []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	sources, _ := ParseUpstreamSources([]string{"registry.terraform.io=" + dir})
+	for _, path := range []string{outside, filepath.Join(dir, "..", filepath.Base(filepath.Dir(outside)), "secret")} {
+		if _, err := sources.openBundleArchive("registry.terraform.io", path); err == nil {
+			t.Errorf("expected %s to be refused", path)
+		}
+	}
+
+	// Bundles only serve the hostnames they are configured for
+	writeBundle(t, dir)
+	archive := filepath.Join(dir, "registry.terraform.io", "hashicorp", "aws", "terraform-provider-aws_1.0.0_linux_amd64.zip")
+	if _, err := sources.openBundleArchive("other.example.com", archive); err == nil {
+		t.Error("expected another hostname to be refused the bundle")
+	}
+	reader, err := sources.openBundleArchive("registry.terraform.io", archive)
+	if err != nil {
+		t.Fatalf("expected the bundle's own hostname to read it, got %v", err)
+	}
+	reader.Close()
+
+	var none *UpstreamSources
+	if _, err := none.openBundleArchive("registry.terraform.io", outside); err == nil {
+		t.Error("expected file URLs to be refused without bundles")
+	}
+
+	// Version documents cannot point outside the bundle either
+	versionDir := filepath.Join(dir, "registry.terraform.io", "hashicorp", "aws")
+	if err := os.MkdirAll(versionDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(versionDir, "1.0.0.json"),
+		[]byte(`{"archives":{"linux_amd64":{"url":"file://`+outside+`"}}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	src := sources.forHost("registry.terraform.io")[0]
+	if _, err := src.readBundleVersion("registry.terraform.io", "hashicorp", "aws", "1.0.0"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("expected absolute archive URL to be rejected, got %v", err)
+	}
+}
+
+// TestFetchMirrorVersion_RejectsFileURLs tests that remote mirrors cannot point archives at local files
+func TestFetchMirrorVersion_RejectsFileURLs(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"archives":{"linux_amd64":{"url":"file:///srv/bundle/registry.terraform.io/hashicorp/aws/a.zip"}}}`))
+	}))
+	defer server.Close()
+
+	if _, err := newTestUpstreamClient(server).fetchMirrorVersion(context.Background(), server.URL+"/hashicorp/aws/1.0.0.json"); err == nil {
+		t.Error("expected a file archive URL from a remote mirror to be rejected")
+	}
+}
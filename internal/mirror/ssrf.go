@@ -0,0 +1,218 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Reasons reported for blocked upstream requests
+const (
+	BlockReasonHostNotAllowed = "host_not_allowed"
+	BlockReasonPrivateAddress = "private_address"
+)
+
+// hostAllowed reports whether a registry hostname matches an allowlist entry.
+// Entries are exact hostnames or "*.domain" wildcards matching any subdomain.
+// An empty allowlist allows every hostname.
+func hostAllowed(hostname string, allowlist []string) bool {
+	if len(allowlist) == 0 {
+		return true
+	}
+
+	host := strings.ToLower(hostname)
+	if normalized, err := normalizeHostname(hostname); err == nil {
+		host = normalized
+	}
+
+	for _, entry := range allowlist {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if suffix, ok := strings.CutPrefix(entry, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+			continue
+		}
+		if host == entry {
+			return true
+		}
+	}
+	return false
+}
+
+// checkHostAllowed returns an error wrapping ErrUpstreamBlocked if a registry hostname is not allowlisted
+func (uc *UpstreamClient) checkHostAllowed(ctx context.Context, hostname string) error {
+	if hostAllowed(hostname, uc.allowedHosts) {
+		return nil
+	}
+	uc.reportBlocked(ctx, hostname, BlockReasonHostNotAllowed)
+	return fmt.Errorf("%w: registry hostname %s is not in the upstream allowlist", ErrUpstreamBlocked, hostname)
+}
+
+// reportBlocked logs a blocked upstream request and notifies the configured callback
+func (uc *UpstreamClient) reportBlocked(ctx context.Context, target, reason string) {
+	uc.logger.WarnContext(ctx,
+		fmt.Sprintf("upstream request blocked [target=%s reason=%s]", target, reason),
+		"target", target, "reason", reason)
+	if uc.onBlocked != nil {
+		uc.onBlocked(reason)
+	}
+}
+
+// internalNetworks are blocked ranges not covered by the net.IP predicates: "this network"
+// and carrier-grade NAT shared address space
+var internalNetworks = mustParseCIDRs("0.0.0.0/8", "100.64.0.0/10")
+
+// NAT64 prefixes: the well-known prefix embeds an IPv4 address in its last
+// four bytes, which is checked in turn, and the local-use prefix only reaches internal networks
+var (
+	nat64WellKnown = mustParseCIDRs("64:ff9b::/96")[0]
+	nat64LocalUse  = mustParseCIDRs("64:ff9b:1::/48")[0]
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+	return networks
+}
+
+// privateAddress reports whether an IP is loopback, link-local, private, unspecified, shared
+// address space, or a NAT64 address reaching one of those. IPv4-mapped IPv6 addresses are
+// checked as the IPv4 address they map to.
+func privateAddress(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsPrivate() || ip.IsUnspecified() {
+		return true
+	}
+	for _, network := range internalNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	if ip.To4() == nil && len(ip) == net.IPv6len {
+		if nat64LocalUse.Contains(ip) {
+			return true
+		}
+		if nat64WellKnown.Contains(ip) {
+			return privateAddress(ip[12:])
+		}
+	}
+	return false
+}
+
+// addressGuard rejects connections to private addresses at dial time, after DNS
+// resolution, so hostnames resolving to internal addresses are caught as well.
+// Requests sent through a proxy are checked before they reach it, since the proxy
+// and not the guard connects to the target.
+type addressGuard struct {
+	allowed   []*net.IPNet
+	onBlocked func(address string)
+}
+
+// newAddressGuard parses the IP addresses and CIDRs exempt from blocking
+func newAddressGuard(allowedNetworks []string, onBlocked func(address string)) (*addressGuard, error) {
+	g := &addressGuard{onBlocked: onBlocked}
+	for _, entry := range allowedNetworks {
+		entry = strings.TrimSpace(entry)
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid allowed network: %s", entry)
+			}
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			g.allowed = append(g.allowed, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed network: %s", entry)
+		}
+		g.allowed = append(g.allowed, network)
+	}
+	return g, nil
+}
+
+// control is a net.Dialer Control function checking the address being connected to
+func (g *addressGuard) control(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil
+	}
+	return g.check(address, ip)
+}
+
+// check returns an error wrapping ErrUpstreamBlocked if ip is private and not exempt
+func (g *addressGuard) check(target string, ip net.IP) error {
+	if !privateAddress(ip) {
+		return nil
+	}
+	for _, network := range g.allowed {
+		if network.Contains(ip) {
+			return nil
+		}
+	}
+	if g.onBlocked != nil {
+		g.onBlocked(target)
+	}
+	return fmt.Errorf("%w: connections to private address %s are not allowed", ErrUpstreamBlocked, ip)
+}
+
+// proxy wraps a transport proxy function to check the target of every proxied request.
+// IP literals are checked directly and hostnames are resolved first; a hostname that does
+// not resolve cannot be checked and is refused rather than left to the proxy's resolver.
+func (g *addressGuard) proxy(next func(*http.Request) (*url.URL, error)) func(*http.Request) (*url.URL, error) {
+	return func(req *http.Request) (*url.URL, error) {
+		proxyURL, err := next(req)
+		if err != nil || proxyURL == nil {
+			// Direct connections are checked at dial time
+			return proxyURL, err
+		}
+
+		host := req.URL.Hostname()
+		if ip := net.ParseIP(host); ip != nil {
+			return proxyURL, g.check(host, ip)
+		}
+		addrs, err := net.DefaultResolver.LookupIPAddr(req.Context(), host)
+		if err != nil {
+			return nil, fmt.Errorf("%w: cannot resolve %s to check it against private network blocking: %v",
+				ErrUpstreamBlocked, host, err)
+		}
+		for _, addr := range addrs {
+			if err := g.check(host, addr.IP); err != nil {
+				return nil, err
+			}
+		}
+		return proxyURL, nil
+	}
+}
+
+// dialContext returns a dial function that applies the guard to every connection except
+// those to exemptAddr, the configured proxy, which must stay reachable on internal networks
+func (g *addressGuard) dialContext(exemptAddr string) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	direct := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	guarded := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: g.control}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if exemptAddr != "" && addr == exemptAddr {
+			return direct.DialContext(ctx, network, addr)
+		}
+		return guarded.DialContext(ctx, network, addr)
+	}
+}
@@ -0,0 +1,222 @@
+package mirror
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHostAllowed(t *testing.T) {
+	allowlist := []string{"registry.terraform.io", "*.corp.example.com"}
+
+	tests := []struct {
+		hostname string
+		want     bool
+	}{
+		{"registry.terraform.io", true},
+		{"Registry.Terraform.IO", true},
+		{"registry.terraform.io:443", true},
+		{"tfe.corp.example.com", true},
+		{"a.b.corp.example.com", true},
+		{"corp.example.com", false},
+		{"evilcorp.example.com", false},
+		{"registry.opentofu.org", false},
+		{"169.254.169.254", false},
+	}
+
+	for _, tt := range tests {
+		if got := hostAllowed(tt.hostname, allowlist); got != tt.want {
+			t.Errorf("hostAllowed(%q) = %v, want %v", tt.hostname, got, tt.want)
+		}
+	}
+
+	if !hostAllowed("anything.example.com", nil) {
+		t.Error("expected an empty allowlist to allow every hostname")
+	}
+}
+
+func TestUpstreamClient_HostAllowlist(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	}))
+	defer server.Close()
+
+	var reasons []string
+	uc := newTestUpstreamClient(server)
+	uc.allowedHosts = []string{"registry.terraform.io"}
+	uc.onBlocked = func(reason string) { reasons = append(reasons, reason) }
+
+	if _, _, err := uc.FetchIndex(t.Context(), "internal.corp", "hashicorp", "aws"); !errors.Is(err, ErrUpstreamBlocked) {
+		t.Fatalf("expected ErrUpstreamBlocked from FetchIndex, got %v", err)
+	}
+	if _, err := uc.FetchVersion(t.Context(), "internal.corp", "hashicorp", "aws", "1.0.0"); !errors.Is(err, ErrUpstreamBlocked) {
+		t.Fatalf("expected ErrUpstreamBlocked from FetchVersion, got %v", err)
+	}
+	if _, err := uc.FetchDownloadURL(t.Context(), "internal.corp", "hashicorp", "aws", "1.0.0", "linux", "amd64"); !errors.Is(err, ErrUpstreamBlocked) {
+		t.Fatalf("expected ErrUpstreamBlocked from FetchDownloadURL, got %v", err)
+	}
+
+	if requests.Load() != 0 {
+		t.Errorf("expected no upstream requests, got %d", requests.Load())
+	}
+	if len(reasons) != 3 || reasons[0] != BlockReasonHostNotAllowed {
+		t.Errorf("unexpected blocked reasons: %v", reasons)
+	}
+}
+
+func TestUpstreamClient_BlocksPrivateAddresses(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write([]byte("archive"))
+	}))
+	defer server.Close()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	var blocked atomic.Int32
+	uc, err := NewUpstreamClient(5*time.Second, 2, time.Minute, logger, UpstreamOptions{
+		Transport: TransportOptions{BlockPrivateNetworks: true},
+		OnBlocked: func(reason string) {
+			if reason == BlockReasonPrivateAddress {
+				blocked.Add(1)
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewUpstreamClient failed: %v", err)
+	}
+
+	if _, err := uc.FetchArchive(t.Context(), "registry.terraform.io", server.URL+"/a.zip"); !errors.Is(err, ErrUpstreamBlocked) {
+		t.Fatalf("expected ErrUpstreamBlocked, got %v", err)
+	}
+	if requests.Load() != 0 {
+		t.Errorf("expected the loopback server not to be reached, got %d requests", requests.Load())
+	}
+	// Blocked connections are not retried
+	if blocked.Load() != 1 {
+		t.Errorf("expected one blocked connection, got %d", blocked.Load())
+	}
+}
+
+func TestUpstreamClient_AllowedNetworks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("archive"))
+	}))
+	defer server.Close()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	uc, err := NewUpstreamClient(5*time.Second, 0, time.Minute, logger, UpstreamOptions{
+		Transport: TransportOptions{BlockPrivateNetworks: true, AllowedNetworks: []string{"127.0.0.0/8"}},
+	})
+	if err != nil {
+		t.Fatalf("NewUpstreamClient failed: %v", err)
+	}
+
+	body, err := uc.FetchArchive(t.Context(), "registry.terraform.io", server.URL+"/a.zip")
+	if err != nil {
+		t.Fatalf("expected allowed network to be reachable, got %v", err)
+	}
+	data, _ := io.ReadAll(body)
+	body.Close()
+	if string(data) != "archive" {
+		t.Errorf("unexpected body: %q", data)
+	}
+}
+
+func TestUpstreamClient_BlockPrivateNetworksTrustsProxy(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("via proxy"))
+	}))
+	defer proxy.Close()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	uc, err := NewUpstreamClient(5*time.Second, 0, time.Minute, logger, UpstreamOptions{
+		Transport: TransportOptions{ProxyURL: proxy.URL, BlockPrivateNetworks: true},
+	})
+	if err != nil {
+		t.Fatalf("NewUpstreamClient failed: %v", err)
+	}
+
+	// A public address, which the proxy answers for without being dialed
+	body, err := uc.FetchArchive(t.Context(), "registry.terraform.io", "http://203.0.113.10/a.zip")
+	if err != nil {
+		t.Fatalf("expected the configured proxy to be reachable, got %v", err)
+	}
+	body.Close()
+}
+
+func TestUpstreamClient_BlockPrivateNetworksThroughProxy(t *testing.T) {
+	var requests atomic.Int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write([]byte("via proxy"))
+	}))
+	defer proxy.Close()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	uc, err := NewUpstreamClient(5*time.Second, 0, time.Minute, logger, UpstreamOptions{
+		Transport: TransportOptions{ProxyURL: proxy.URL, BlockPrivateNetworks: true},
+	})
+	if err != nil {
+		t.Fatalf("NewUpstreamClient failed: %v", err)
+	}
+
+	for _, target := range []string{
+		"http://10.0.0.1/a.zip",
+		"http://100.64.0.1/a.zip",
+		"http://[::ffff:169.254.169.254]/a.zip",
+		"http://localhost/a.zip",
+		"http://does-not-resolve.invalid/a.zip",
+	} {
+		if _, err := uc.FetchArchive(t.Context(), "registry.terraform.io", target); !errors.Is(err, ErrUpstreamBlocked) {
+			t.Errorf("%s: expected ErrUpstreamBlocked, got %v", target, err)
+		}
+	}
+	if requests.Load() != 0 {
+		t.Errorf("expected the proxy not to be asked for private targets, got %d requests", requests.Load())
+	}
+}
+
+func TestPrivateAddress(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"127.0.0.1", true},
+		{"10.1.2.3", true},
+		{"169.254.169.254", true},
+		{"0.1.2.3", true},
+		{"100.64.0.1", true},
+		{"100.127.255.254", true},
+		{"::ffff:10.0.0.1", true},
+		{"64:ff9b::a00:1", true},
+		{"64:ff9b::a9fe:a9fe", true},
+		{"64:ff9b:1::1", true},
+		{"fd00::1", true},
+		{"100.128.0.1", false},
+		{"8.8.8.8", false},
+		{"::ffff:8.8.8.8", false},
+		{"64:ff9b::808:808", false},
+		{"2001:4860:4860::8888", false},
+	}
+	for _, tt := range tests {
+		if got := privateAddress(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("privateAddress(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestNewAddressGuard_Invalid(t *testing.T) {
+	for _, entry := range []string{"internal.corp", "10.0.0.0/33"} {
+		if _, err := newAddressGuard([]string{entry}, nil); err == nil {
+			t.Errorf("expected error for %q", entry)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package mirror
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// TransportOptions configures how upstream connections are established
+type TransportOptions struct {
+	// ProxyURL routes upstream requests through an HTTP(S) proxy; credentials may be
+	// given as userinfo. Empty falls back to the standard HTTPS_PROXY/NO_PROXY variables.
+	ProxyURL string
+	// NoProxy lists hosts reached directly when ProxyURL is set: hostnames (matching
+	// subdomains too), ".domain" suffixes, IP addresses, CIDRs, or "*" for every host
+	NoProxy []string
+	// CAFiles are PEM bundles trusted in addition to the system roots
+	CAFiles []string
+	// ClientCertFile and ClientKeyFile present a client certificate to upstreams requiring mTLS
+	ClientCertFile string
+	ClientKeyFile  string
+	// BlockPrivateNetworks refuses connections to loopback, link-local and private addresses
+	BlockPrivateNetworks bool
+	// AllowedNetworks lists IP addresses and CIDRs exempt from private network blocking
+	AllowedNetworks []string
+}
+
+// newTransport builds the HTTP transport used for all upstream requests
+// onBlocked is called with the address of every connection refused by private network blocking
+func newTransport(opts TransportOptions, onBlocked func(address string)) (*http.Transport, error) {
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 10,
+		IdleConnTimeout:     90 * time.Second,
+	}
+
+	if opts.ProxyURL != "" {
+		proxyURL, err := url.Parse(opts.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid upstream proxy URL: %w", err)
+		}
+		if proxyURL.Scheme != "http" && proxyURL.Scheme != "https" {
+			return nil, fmt.Errorf("upstream proxy URL must use http or https scheme, got: %s", proxyURL.Scheme)
+		}
+		if proxyURL.Host == "" {
+			return nil, fmt.Errorf("upstream proxy URL must have a host")
+		}
+		transport.Proxy = proxyFunc(proxyURL, opts.NoProxy)
+	}
+
+	if opts.BlockPrivateNetworks {
+		guard, err := newAddressGuard(opts.AllowedNetworks, onBlocked)
+		if err != nil {
+			return nil, err
+		}
+		// The explicitly configured proxy is trusted even on an internal address, but the
+		// targets it is asked to reach are checked like direct connections
+		transport.DialContext = guard.dialContext(proxyAddress(opts.ProxyURL))
+		transport.Proxy = guard.proxy(transport.Proxy)
+	}
+
+	if len(opts.CAFiles) == 0 && opts.ClientCertFile == "" && opts.ClientKeyFile == "" {
+		return transport, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if len(opts.CAFiles) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		for _, path := range opts.CAFiles {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read upstream CA bundle: %w", err)
+			}
+			if !pool.AppendCertsFromPEM(data) {
+				return nil, fmt.Errorf("no certificates found in upstream CA bundle %s", path)
+			}
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if opts.ClientCertFile != "" || opts.ClientKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.ClientCertFile, opts.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load upstream client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
+
+// proxyAddress returns the host:port dialed for a proxy URL, or "" when none is configured
+func proxyAddress(proxyURL string) string {
+	u, err := url.Parse(proxyURL)
+	if proxyURL == "" || err != nil {
+		return ""
+	}
+	if u.Port() != "" {
+		return u.Host
+	}
+	if u.Scheme == "https" {
+		return net.JoinHostPort(u.Hostname(), "443")
+	}
+	return net.JoinHostPort(u.Hostname(), "80")
+}
+
+// proxyFunc returns a transport proxy function that bypasses the proxy for no-proxy hosts
+func proxyFunc(proxyURL *url.URL, noProxy []string) func(*http.Request) (*url.URL, error) {
+	return func(req *http.Request) (*url.URL, error) {
+		if bypassProxy(req.URL.Hostname(), noProxy) {
+			return nil, nil
+		}
+		return proxyURL, nil
+	}
+}
+
+// bypassProxy reports whether a host matches any no-proxy rule
+func bypassProxy(host string, noProxy []string) bool {
+	host = strings.ToLower(host)
+	ip := net.ParseIP(host)
+
+	for _, rule := range noProxy {
+		rule = strings.ToLower(strings.TrimSpace(rule))
+		switch {
+		case rule == "":
+			continue
+		case rule == "*":
+			return true
+		case strings.Contains(rule, "/"):
+			if _, cidr, err := net.ParseCIDR(rule); err == nil && ip != nil && cidr.Contains(ip) {
+				return true
+			}
+		case net.ParseIP(rule) != nil:
+			if ip != nil && ip.Equal(net.ParseIP(rule)) {
+				return true
+			}
+		case strings.HasPrefix(rule, "."):
+			if strings.HasSuffix(host, rule) {
+				return true
+			}
+		default:
+			if host == rule || strings.HasSuffix(host, "."+rule) {
+				return true
+			}
+		}
+	}
+	return false
+}
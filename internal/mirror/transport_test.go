@@ -0,0 +1,205 @@
+package mirror
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeClientCert writes a self-signed client certificate and key and returns their paths
+func writeClientCert(t *testing.T, dir string) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "specular"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	certFile = filepath.Join(dir, "client.crt")
+	keyFile = filepath.Join(dir, "client.key")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certFile, keyFile
+}
+
+// writeServerCA writes the certificate of a TLS test server as a PEM bundle
+func writeServerCA(t *testing.T, server *httptest.Server) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("failed to write CA bundle: %v", err)
+	}
+	return path
+}
+
+func TestBypassProxy(t *testing.T) {
+	noProxy := []string{"internal.example.com", ".corp.local", "10.0.0.0/8", "192.168.1.5"}
+
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{host: "internal.example.com", want: true},
+		{host: "registry.internal.example.com", want: true},
+		{host: "notinternal.example.com", want: false},
+		{host: "build.corp.local", want: true},
+		{host: "corp.local", want: false},
+		{host: "10.1.2.3", want: true},
+		{host: "192.168.1.5", want: true},
+		{host: "192.168.1.6", want: false},
+		{host: "registry.terraform.io", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := bypassProxy(tt.host, noProxy); got != tt.want {
+			t.Errorf("bypassProxy(%s) = %t, want %t", tt.host, got, tt.want)
+		}
+	}
+
+	if !bypassProxy("anything.example.com", []string{"*"}) {
+		t.Error("expected * to bypass the proxy for every host")
+	}
+}
+
+func TestNewTransport_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	certFile, _ := writeClientCert(t, dir)
+	notPEM := filepath.Join(dir, "empty.pem")
+	os.WriteFile(notPEM, []byte("not a certificate"), 0600)
+
+	tests := []struct {
+		name string
+		opts TransportOptions
+	}{
+		{name: "unsupported proxy scheme", opts: TransportOptions{ProxyURL: "ftp://proxy:21"}},
+		{name: "proxy without host", opts: TransportOptions{ProxyURL: "http://"}},
+		{name: "missing CA file", opts: TransportOptions{CAFiles: []string{filepath.Join(dir, "missing.pem")}}},
+		{name: "CA file without certificates", opts: TransportOptions{CAFiles: []string{notPEM}}},
+		{name: "client cert without key", opts: TransportOptions{ClientCertFile: certFile}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newTransport(tt.opts, nil); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestUpstreamClient_UsesProxy(t *testing.T) {
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.Header.Get("Proxy-Authorization")+" "+r.URL.String())
+		w.Write([]byte("via proxy"))
+	}))
+	defer proxy.Close()
+
+	proxyURL, _ := url.Parse(proxy.URL)
+	proxyURL.User = url.UserPassword("user", "pass")
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	uc, err := NewUpstreamClient(5*time.Second, 0, time.Minute, logger, UpstreamOptions{
+		Transport: TransportOptions{ProxyURL: proxyURL.String(), NoProxy: []string{"direct.invalid"}},
+	})
+	if err != nil {
+		t.Fatalf("NewUpstreamClient failed: %v", err)
+	}
+
+	body, err := uc.FetchArchive(t.Context(), "registry.terraform.io", "http://archives.example.com/a.zip")
+	if err != nil {
+		t.Fatalf("FetchArchive failed: %v", err)
+	}
+	data, _ := io.ReadAll(body)
+	body.Close()
+
+	if string(data) != "via proxy" || len(proxied) != 1 {
+		t.Fatalf("expected request to go through the proxy, got %q (%v)", data, proxied)
+	}
+	if proxied[0] != "Basic dXNlcjpwYXNz http://archives.example.com/a.zip" {
+		t.Errorf("unexpected proxied request: %s", proxied[0])
+	}
+
+	// No-proxy hosts are dialed directly and never reach the proxy
+	if _, err := uc.FetchArchive(t.Context(), "registry.terraform.io", "http://direct.invalid/a.zip"); err == nil {
+		t.Error("expected direct connection to an unresolvable host to fail")
+	}
+	if len(proxied) != 1 {
+		t.Errorf("expected no-proxy host to bypass the proxy, got %v", proxied)
+	}
+}
+
+func TestUpstreamClient_CustomCAAndClientCert(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 {
+			http.Error(w, "client certificate required", http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+
+	caFile := writeServerCA(t, server)
+	certFile, keyFile := writeClientCert(t, t.TempDir())
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	// Without the CA bundle the server certificate is not trusted
+	untrusted, err := NewUpstreamClient(5*time.Second, 0, time.Minute, logger, UpstreamOptions{})
+	if err != nil {
+		t.Fatalf("NewUpstreamClient failed: %v", err)
+	}
+	if _, err := untrusted.FetchArchive(t.Context(), "registry.terraform.io", server.URL+"/a.zip"); err == nil {
+		t.Fatal("expected untrusted server certificate to be rejected")
+	}
+
+	uc, err := NewUpstreamClient(5*time.Second, 0, time.Minute, logger, UpstreamOptions{
+		Transport: TransportOptions{CAFiles: []string{caFile}, ClientCertFile: certFile, ClientKeyFile: keyFile},
+	})
+	if err != nil {
+		t.Fatalf("NewUpstreamClient failed: %v", err)
+	}
+	body, err := uc.FetchArchive(t.Context(), "registry.terraform.io", server.URL+"/a.zip")
+	if err != nil {
+		t.Fatalf("FetchArchive failed: %v", err)
+	}
+	data, _ := io.ReadAll(body)
+	body.Close()
+	if string(data) != "ok" {
+		t.Errorf("unexpected body: %q", data)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"time"
 )
 
 var (
@@ -13,6 +14,12 @@ var (
 	ErrInvalidURL = errors.New("invalid URL")
 	// ErrInvalidAddress is returned when a provider address is invalid
 	ErrInvalidAddress = errors.New("invalid provider address")
+	// ErrForbidden is returned when the provider policy forbids serving a provider
+	ErrForbidden = errors.New("forbidden by provider policy")
+	// ErrUpstreamBlocked is returned when an upstream host or address may not be contacted
+	ErrUpstreamBlocked = errors.New("upstream blocked")
+	// ErrCircuitOpen is returned when an upstream host's circuit breaker is failing requests fast
+	ErrCircuitOpen = errors.New("upstream circuit open")
 )
 
 // VersionInfo contains metadata about a provider version
@@ -57,6 +64,10 @@ type RegistryVersionsResponse struct {
 type RegistryVersion struct {
 	Version   string             `json:"version"`
 	Platforms []RegistryPlatform `json:"platforms"`
+	// PublishedAt is the publish time, for registries that report one
+	PublishedAt *time.Time `json:"published_at,omitempty"`
+	// FirstSeen is recorded by Specular when a version first appears in a refreshed listing
+	FirstSeen *time.Time `json:"first_seen,omitempty"`
 }
 
 // RegistryPlatform represents a platform in the registry versions response
@@ -78,6 +89,21 @@ type ProviderAddress struct {
 	Type      string
 }
 
+// CheckHostname returns an error wrapping ErrInvalidAddress unless hostname is in the canonical
+// form used to contact the registry: ASCII and lower case, without the default HTTPS port.
+// Policies, authorization rules and cache keys match the hostname as given, so other spellings
+// of the same registry must be refused before any of them is consulted.
+func CheckHostname(hostname string) error {
+	canonical, err := normalizeHostname(hostname)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidAddress, err)
+	}
+	if canonical != hostname {
+		return fmt.Errorf("%w: hostname %q must be written as %q", ErrInvalidAddress, hostname, canonical)
+	}
+	return nil
+}
+
 // Validate checks if the provider address is valid
 func (p *ProviderAddress) Validate() error {
 	if p.Hostname == "" {
@@ -3,13 +3,21 @@ package mirror
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"net"
 	"net/http"
 	"net/url"
 	"strings"
 	"time"
+
+	"github.com/elisiariocouto/specular/internal/loadshed"
+	"github.com/elisiariocouto/specular/internal/storage"
+	"github.com/elisiariocouto/specular/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // UpstreamClient handles fetching from the upstream registry
@@ -18,80 +26,251 @@ type UpstreamClient struct {
 	maxRetries     int
 	logger         *slog.Logger
 	discoveryCache *DiscoveryCache
+	fetchLimiter   *loadshed.Limiter
+	credentials    *Credentials
+	aliases        *UpstreamAliases
+	parentMirror   *url.URL // nil fetches from each provider's own registry
+	allowedHosts   []string // empty allows every registry hostname
+	onBlocked      func(reason string)
+	breaker        *circuitBreaker // nil never fails requests fast
+	retryBudget    *retryBudget    // nil allows every retry
+	sources        *UpstreamSources
+	onSourceResult func(hostname, source string, ok bool)
+	onRequest      func(host string, status int, duration time.Duration)
+}
+
+// UpstreamOptions holds optional upstream client features
+type UpstreamOptions struct {
+	// FetchLimiter caps concurrent upstream fetches; nil leaves them unlimited
+	FetchLimiter *loadshed.Limiter
+	// Credentials supplies bearer tokens for private upstream registries
+	Credentials *Credentials
+	// Aliases redirect fetches for some provider addresses to other upstreams
+	Aliases *UpstreamAliases
+	// ParentMirrorURL is the base URL of a provider network mirror used for every hostname
+	ParentMirrorURL string
+	// Transport configures proxies, trusted CAs, client certificates and private network blocking
+	Transport TransportOptions
+	// AllowedHosts restricts which registry hostnames may be mirrored; entries are exact
+	// hostnames or "*.domain" wildcards. Empty allows every hostname.
+	AllowedHosts []string
+	// OnBlocked is called with the block reason whenever an upstream request is refused
+	OnBlocked func(reason string)
+	// DiscoveryStore persists service discovery results across restarts; nil keeps them in memory
+	DiscoveryStore storage.MetadataStore
+	// Breaker fails requests to unhealthy upstream hosts fast; the zero value disables it
+	Breaker BreakerOptions
+	// RetryBudgetRatio limits retries per host to this ratio of its requests, on top of a
+	// small reserve; 0 leaves retries limited only by the retry count
+	RetryBudgetRatio float64
+	// Sources lists, per hostname, the upstreams tried in turn; they take precedence over
+	// the parent mirror
+	Sources *UpstreamSources
+	// OnSourceResult is called after each fetch from a configured source
+	OnSourceResult func(hostname, source string, ok bool)
+	// OnRequest is called after every HTTP request sent upstream, including retries and service
+	// discovery, with the response status or 0 when no response was received. The host is only
+	// reported for configured upstreams; every other host is reported as HostOther.
+	OnRequest func(host string, status int, duration time.Duration)
+}
+
+// HostOther is the host reported to OnRequest for upstream hosts that are not configured,
+// which keeps hostnames supplied by clients or upstream responses out of metric labels
+const HostOther = "other"
+
+// fetchTimeout returns how long a fetch may take when every attempt, including attempts
+// retried after a failed body read, uses the full request timeout, or 0 when requests are
+// not bounded
+func (uc *UpstreamClient) fetchTimeout() time.Duration {
+	if uc == nil || uc.httpClient == nil {
+		return 0
+	}
+	return uc.httpClient.Timeout * time.Duration(uc.maxRetries+1)
 }
 
 // NewUpstreamClient creates a new upstream client
-func NewUpstreamClient(timeout time.Duration, maxRetries int, discoveryCacheTTL time.Duration, logger *slog.Logger) *UpstreamClient {
+func NewUpstreamClient(timeout time.Duration, maxRetries int, discoveryCacheTTL time.Duration, logger *slog.Logger, opts UpstreamOptions) (*UpstreamClient, error) {
+	uc := &UpstreamClient{
+		maxRetries:   maxRetries,
+		logger:       logger,
+		fetchLimiter: opts.FetchLimiter,
+		credentials:  opts.Credentials,
+		aliases:      opts.Aliases,
+		allowedHosts: opts.AllowedHosts,
+		onBlocked:    opts.OnBlocked,
+
+		sources:        opts.Sources,
+		onSourceResult: opts.OnSourceResult,
+	}
+
+	onStateChange := opts.Breaker.OnStateChange
+	opts.Breaker.OnStateChange = func(host, state string) {
+		msg := fmt.Sprintf("upstream circuit %s [host=%s]", state, host)
+		if state == CircuitOpen {
+			logger.Warn(msg, slog.String("host", host), slog.String("state", state))
+		} else {
+			logger.Info(msg, slog.String("host", host), slog.String("state", state))
+		}
+		if onStateChange != nil {
+			onStateChange(host, state)
+		}
+	}
+	uc.breaker = newCircuitBreaker(opts.Breaker)
+	uc.retryBudget = newRetryBudget(opts.RetryBudgetRatio)
+
+	transport, err := newTransport(opts.Transport, func(address string) {
+		uc.reportBlocked(context.Background(), address, BlockReasonPrivateAddress)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.ParentMirrorURL != "" {
+		parentMirror, err := url.Parse(opts.ParentMirrorURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid parent mirror URL: %w", err)
+		}
+		if parentMirror.Scheme != "http" && parentMirror.Scheme != "https" || parentMirror.Host == "" {
+			return nil, fmt.Errorf("parent mirror URL must be an absolute http or https URL")
+		}
+		uc.parentMirror = parentMirror
+	}
+
+	if onRequest := opts.OnRequest; onRequest != nil {
+		uc.onRequest = func(host string, status int, duration time.Duration) {
+			onRequest(uc.requestHostLabel(host), status, duration)
+		}
+	}
+
 	// Create HTTP client with connection pooling and timeouts
-	httpClient := &http.Client{
-		Timeout: timeout,
-		Transport: &http.Transport{
-			MaxIdleConns:        100,
-			MaxIdleConnsPerHost: 10,
-			IdleConnTimeout:     90 * time.Second,
-		},
+	uc.httpClient = &http.Client{
+		Timeout:   timeout,
+		Transport: tracing.NewTransport(transport),
 	}
 
 	// Create discovery cache with configurable TTL
-	discoveryCache := NewDiscoveryCache(discoveryCacheTTL, httpClient, logger)
+	uc.discoveryCache = NewDiscoveryCache(discoveryCacheTTL, uc.httpClient, logger)
+	uc.discoveryCache.credentials = opts.Credentials
+	uc.discoveryCache.store = opts.DiscoveryStore
+	uc.discoveryCache.breaker = uc.breaker
+	uc.discoveryCache.onRequest = uc.onRequest
+
+	return uc, nil
+}
 
-	return &UpstreamClient{
-		httpClient:     httpClient,
-		maxRetries:     maxRetries,
-		logger:         logger,
-		discoveryCache: discoveryCache,
+// requestHostLabel returns the host to report for an upstream request: hosts of the parent
+// mirror and configured sources, allowlisted hostnames, the allowlist wildcard matching a
+// subdomain, and HostOther for everything else
+func (uc *UpstreamClient) requestHostLabel(host string) string {
+	host = strings.ToLower(host)
+	if uc.parentMirror != nil && host == strings.ToLower(uc.parentMirror.Host) {
+		return host
 	}
+	if uc.sources.configuresHost(host) {
+		return host
+	}
+
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+	for _, entry := range uc.allowedHosts {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if suffix, ok := strings.CutPrefix(entry, "*."); ok {
+			if strings.HasSuffix(hostname, "."+suffix) {
+				return entry
+			}
+		} else if hostname == entry {
+			return host
+		}
+	}
+	return HostOther
+}
+
+// CircuitStatus returns the circuit breaker state of every upstream host contacted so far
+func (uc *UpstreamClient) CircuitStatus() []CircuitStatus {
+	return uc.breaker.status()
+}
+
+// upstreamHost returns the host actually contacted for a provider address, honouring aliases
+// The host is in its ASCII form, with any explicit port
+func (uc *UpstreamClient) upstreamHost(hostname, namespace string) string {
+	if alias, ok := uc.aliases.resolve(hostname, namespace); ok && alias.DiscoveryHost != "" {
+		hostname = alias.DiscoveryHost
+	}
+	if host, err := normalizeHostname(hostname); err == nil {
+		return host
+	}
+	return hostname
 }
 
 // getProvidersEndpoint discovers and returns the providers.v1 API endpoint for a registry
-// Uses service discovery with caching
-func (uc *UpstreamClient) getProvidersEndpoint(ctx context.Context, hostname string) (string, error) {
+// Uses service discovery with caching, unless an alias supplies the endpoint directly
+func (uc *UpstreamClient) getProvidersEndpoint(ctx context.Context, hostname, namespace string) (string, error) {
+	if alias, ok := uc.aliases.resolve(hostname, namespace); ok && alias.BaseURL != "" {
+		return alias.BaseURL, nil
+	}
+	host := uc.upstreamHost(hostname, namespace)
+
 	// Try service discovery first
-	discovery, err := uc.discoveryCache.DiscoverServices(ctx, hostname)
+	discovery, err := uc.discoveryCache.DiscoverServices(ctx, host)
 	if err != nil {
 		uc.logger.DebugContext(ctx, "service discovery failed, using fallback",
-			slog.String("hostname", hostname),
+			slog.String("hostname", host),
 			slog.String("error", err.Error()))
 		// Fallback: assume standard HTTPS endpoint
-		return fmt.Sprintf("https://%s", hostname), fmt.Errorf("service discovery failed: %w", err)
+		return fmt.Sprintf("https://%s", host), fmt.Errorf("service discovery failed: %w", err)
 	}
 
-	// The ProvidersV1 field contains a path (e.g., "/v1/providers/")
-	// We need to construct the full URL by combining with the hostname
-	providersPath := strings.TrimSuffix(discovery.ProvidersV1, "/")
-	fullURL := fmt.Sprintf("https://%s%s", hostname, providersPath)
-
-	return fullURL, nil
+	// ProvidersURL is already resolved against the discovery document, so it may
+	// point at another host or port
+	return strings.TrimSuffix(discovery.ProvidersURL, "/"), nil
 }
 
 // FetchIndex fetches the index.json for a provider
 // Returns both the simplified IndexResponse and the full RegistryVersionsResponse
-func (uc *UpstreamClient) FetchIndex(ctx context.Context, hostname, namespace, providerType string) (*IndexResponse, *RegistryVersionsResponse, error) {
+func (uc *UpstreamClient) FetchIndex(ctx context.Context, hostname, namespace, providerType string) (_ *IndexResponse, _ *RegistryVersionsResponse, err error) {
+	ctx, span := tracing.Start(ctx, "UpstreamClient.FetchIndex", tracing.Provider(hostname, namespace, providerType)...)
+	defer func() { tracing.End(span, err) }()
+
+	if err := uc.checkHostAllowed(ctx, hostname); err != nil {
+		return nil, nil, err
+	}
+
+	if sources := uc.sources.forHost(hostname); sources != nil {
+		var index *IndexResponse
+		var versions *RegistryVersionsResponse
+		err := uc.failover(ctx, hostname, namespace, providerType, "index", sources, func(ctx context.Context, src *upstreamSource) error {
+			var err error
+			index, versions, err = uc.fetchSourceIndex(ctx, src, hostname, namespace, providerType)
+			return err
+		})
+		return index, versions, err
+	}
+
+	if uc.useParentMirror(hostname, namespace) {
+		index, err := uc.fetchMirrorIndex(ctx, uc.parentMirrorURL(hostname, namespace, providerType, "index.json"))
+		return index, nil, err
+	}
+
+	return uc.fetchRegistryIndex(ctx, hostname, namespace, providerType)
+}
+
+// fetchRegistryIndex fetches a provider's versions from its registry, using service discovery
+// and falling back to the mirror protocol on the same host
+func (uc *UpstreamClient) fetchRegistryIndex(ctx context.Context, hostname, namespace, providerType string) (*IndexResponse, *RegistryVersionsResponse, error) {
 	// Use service discovery to get the providers endpoint
-	endpoint, err := uc.getProvidersEndpoint(ctx, hostname)
+	endpoint, err := uc.getProvidersEndpoint(ctx, hostname, namespace)
 	if err != nil {
 		// Fallback to mirror protocol format
-		url := fmt.Sprintf("https://%s/%s/%s/index.json", hostname, namespace, providerType)
+		url := fmt.Sprintf("https://%s/%s/%s/index.json", uc.upstreamHost(hostname, namespace), namespace, providerType)
 
 		uc.logger.DebugContext(ctx, "service discovery failed, using mirror protocol fallback",
 			slog.String("url", url),
 			slog.String("error", err.Error()))
 
-		body, status, fetchErr := uc.fetch(ctx, url)
-		if fetchErr != nil {
-			return nil, nil, fetchErr
-		}
-
-		if statusErr := checkStatusCode(status); statusErr != nil {
-			return nil, nil, statusErr
-		}
-
-		var response IndexResponse
-		if err := parseJSON(body, &response, "index"); err != nil {
-			return nil, nil, err
-		}
-
-		return &response, nil, nil
+		index, fetchErr := uc.fetchMirrorIndex(ctx, url)
+		return index, nil, fetchErr
 	}
 
 	// Use discovered providers.v1 endpoint
@@ -100,7 +279,8 @@ func (uc *UpstreamClient) FetchIndex(ctx context.Context, hostname, namespace, p
 	uc.logger.DebugContext(ctx, "fetching provider versions from upstream",
 		slog.String("url", url))
 
-	body, status, err := uc.fetch(ctx, url)
+	// The registry's token is sent even when its API is served from another host
+	body, status, err := uc.fetch(ctx, url, uc.upstreamHost(hostname, namespace))
 	if err != nil {
 		return nil, nil, err
 	}
@@ -116,11 +296,41 @@ func (uc *UpstreamClient) FetchIndex(ctx context.Context, hostname, namespace, p
 // FetchVersion fetches the version.json for a specific provider version
 // For registries with service discovery, this returns ErrNotFound to signal
 // that version.json should be built from cached versions response
-func (uc *UpstreamClient) FetchVersion(ctx context.Context, hostname, namespace, providerType, version string) (*VersionResponse, error) {
+func (uc *UpstreamClient) FetchVersion(ctx context.Context, hostname, namespace, providerType, version string) (_ *VersionResponse, err error) {
+	ctx, span := tracing.Start(ctx, "UpstreamClient.FetchVersion", tracing.ProviderVersion(hostname, namespace, providerType, version)...)
+	buildFromCache := false
+	defer func() {
+		// ErrNotFound asking for the version to be built from cache is not a failure
+		spanErr := err
+		if buildFromCache {
+			spanErr = nil
+		}
+		tracing.End(span, spanErr)
+	}()
+
+	if err := uc.checkHostAllowed(ctx, hostname); err != nil {
+		return nil, err
+	}
+
+	if sources := uc.sources.forHost(hostname); sources != nil {
+		var response *VersionResponse
+		err := uc.failover(ctx, hostname, namespace, providerType, "version "+version, sources, func(ctx context.Context, src *upstreamSource) error {
+			var err error
+			response, err = uc.fetchSourceVersion(ctx, src, hostname, namespace, providerType, version)
+			return err
+		})
+		return response, err
+	}
+
+	if uc.useParentMirror(hostname, namespace) {
+		return uc.fetchMirrorVersion(ctx, uc.parentMirrorURL(hostname, namespace, providerType, version+".json"))
+	}
+
 	// Check if this registry supports service discovery
-	_, err := uc.getProvidersEndpoint(ctx, hostname)
-	if err == nil {
+	if _, err := uc.getProvidersEndpoint(ctx, hostname, namespace); err == nil {
 		// Registry has service discovery - version.json should be built from cache
+		buildFromCache = true
+		span.SetAttributes(attribute.Bool("specular.version.build_from_cache", true))
 		uc.logger.DebugContext(ctx, "registry uses service discovery, version will be built from cache",
 			slog.String("hostname", hostname),
 			slog.String("namespace", namespace),
@@ -130,12 +340,40 @@ func (uc *UpstreamClient) FetchVersion(ctx context.Context, hostname, namespace,
 	}
 
 	// Fallback: use provider network mirror protocol format
-	url := fmt.Sprintf("https://%s/%s/%s/%s.json", hostname, namespace, providerType, version)
+	url := fmt.Sprintf("https://%s/%s/%s/%s.json", uc.upstreamHost(hostname, namespace), namespace, providerType, version)
 
+	return uc.fetchMirrorVersion(ctx, url)
+}
+
+// fetchMirrorIndex fetches an index.json document from a provider network mirror
+func (uc *UpstreamClient) fetchMirrorIndex(ctx context.Context, indexURL string) (*IndexResponse, error) {
+	uc.logger.DebugContext(ctx, "fetching index from mirror protocol",
+		slog.String("url", indexURL))
+
+	body, status, err := uc.fetch(ctx, indexURL, mirrorHost(indexURL))
+	if err != nil {
+		return nil, err
+	}
+
+	if statusErr := checkStatusCode(status); statusErr != nil {
+		return nil, statusErr
+	}
+
+	var response IndexResponse
+	if err := parseJSON(body, &response, "index"); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// fetchMirrorVersion fetches a version.json document from a provider network mirror
+// Archive URLs are resolved against the document URL, since the protocol allows relative URLs
+func (uc *UpstreamClient) fetchMirrorVersion(ctx context.Context, versionURL string) (*VersionResponse, error) {
 	uc.logger.DebugContext(ctx, "fetching version metadata from mirror protocol",
-		slog.String("url", url))
+		slog.String("url", versionURL))
 
-	body, status, err := uc.fetch(ctx, url)
+	body, status, err := uc.fetch(ctx, versionURL, mirrorHost(versionURL))
 	if err != nil {
 		return nil, err
 	}
@@ -149,17 +387,92 @@ func (uc *UpstreamClient) FetchVersion(ctx context.Context, hostname, namespace,
 		return nil, err
 	}
 
+	base, err := url.Parse(versionURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid version URL: %w", err)
+	}
+	for platform, archive := range response.Archives {
+		ref, err := url.Parse(archive.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid archive URL for %s: %w", platform, err)
+		}
+		resolved := base.ResolveReference(ref)
+		// Only bundles may refer to local files, and they are read by readBundleVersion
+		if resolved.Scheme != "http" && resolved.Scheme != "https" {
+			return nil, fmt.Errorf("invalid archive URL for %s: must use http or https scheme, got: %s", platform, resolved.Scheme)
+		}
+		archive.URL = resolved.String()
+		response.Archives[platform] = archive
+	}
+
 	return &response, nil
 }
 
-// FetchArchive fetches a provider archive from a URL with retry logic
-// The archiveURL must be an absolute URL
-func (uc *UpstreamClient) FetchArchive(ctx context.Context, archiveURL string) (io.ReadCloser, error) {
+// mirrorHost returns the host of a network mirror document URL, whose own token is sent with it
+func mirrorHost(documentURL string) string {
+	u, err := url.Parse(documentURL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// fetchMirrorDownloadURL looks up a platform's archive URL in a network mirror version document,
+// since the mirror protocol has no download API
+func (uc *UpstreamClient) fetchMirrorDownloadURL(ctx context.Context, versionURL, os, arch string) (*DownloadInfo, error) {
+	response, err := uc.fetchMirrorVersion(ctx, versionURL)
+	if err != nil {
+		return nil, err
+	}
+	archive, ok := response.Archives[buildPlatformKey(os, arch)]
+	if !ok || archive.URL == "" {
+		return nil, ErrNotFound
+	}
+	return &DownloadInfo{DownloadURL: archive.URL}, nil
+}
+
+// useParentMirror reports whether a provider is fetched from the parent mirror
+// Aliases are more specific than the parent mirror and take precedence over it
+func (uc *UpstreamClient) useParentMirror(hostname, namespace string) bool {
+	if uc.parentMirror == nil {
+		return false
+	}
+	_, aliased := uc.aliases.resolve(hostname, namespace)
+	return !aliased
+}
+
+// parentMirrorURL builds a network mirror protocol URL on the parent mirror:
+// {base}/{hostname}/{namespace}/{type}/{file}
+func (uc *UpstreamClient) parentMirrorURL(hostname, namespace, providerType, file string) string {
+	return uc.parentMirror.JoinPath(hostname, namespace, providerType, file).String()
+}
+
+// FetchArchive fetches a provider archive of a registry hostname from a URL with retry logic
+// The archiveURL must be an absolute URL; file URLs are only read from the local bundles
+// configured for the hostname
+// The span ends when the archive body is closed, so it covers the whole download
+func (uc *UpstreamClient) FetchArchive(ctx context.Context, hostname, archiveURL string) (_ io.ReadCloser, err error) {
+	ctx, span := tracing.Start(ctx, "UpstreamClient.FetchArchive")
+	defer func() {
+		if err != nil {
+			tracing.End(span, err)
+		}
+	}()
+
 	// Validate URL
 	parsedURL, err := url.Parse(archiveURL)
 	if err != nil {
 		return nil, fmt.Errorf("invalid archive URL: %w", err)
 	}
+	span.SetAttributes(attribute.String("specular.archive.scheme", parsedURL.Scheme), attribute.String("server.address", parsedURL.Hostname()))
+
+	if parsedURL.Scheme == "file" {
+		reader, err := uc.sources.openBundleArchive(hostname, parsedURL.Path)
+		if err != nil {
+			return nil, err
+		}
+		return &tracedBody{ReadCloser: reader, span: span}, nil
+	}
 
 	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
 		return nil, fmt.Errorf("archive URL must use http or https scheme, got: %s", parsedURL.Scheme)
@@ -169,28 +482,79 @@ func (uc *UpstreamClient) FetchArchive(ctx context.Context, archiveURL string) (
 		return nil, fmt.Errorf("archive URL must have a host")
 	}
 
-	resp, status, err := uc.doRequestWithRetry(ctx, archiveURL)
+	// The fetch slot is held until the caller has consumed and closed the archive body
+	release, err := uc.fetchLimiter.Acquire(ctx)
 	if err != nil {
 		return nil, err
 	}
 
+	// Archives are downloaded without credentials, since they are often hosted elsewhere
+	resp, _, status, err := uc.doRequestWithRetry(ctx, archiveURL, "", false)
+	if err != nil {
+		release()
+		return nil, err
+	}
+
 	// Check for HTTP errors - return status code in error message
 	if status != http.StatusOK {
 		resp.Body.Close()
+		release()
 		return nil, fmt.Errorf("unexpected status code: %d", status)
 	}
 
-	return resp.Body, nil
+	return &tracedBody{
+		ReadCloser: &releasingReadCloser{ReadCloser: resp.Body, release: release},
+		span:       span,
+		counter:    upstreamBytesCounter(ctx),
+	}, nil
 }
 
-// exponentialBackoff waits for exponential backoff duration, respecting context cancellation
-func exponentialBackoff(ctx context.Context, attempt int) error {
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	case <-time.After(time.Duration(1<<uint(attempt)) * time.Second):
-		return nil
+// tracedBody ends an archive download span when the body is closed, recording the bytes read
+// and the time spent waiting for them, which separates download time from cache writes
+type tracedBody struct {
+	io.ReadCloser
+	span     trace.Span
+	counter  *upstreamBytes // nil for archives read from local bundles
+	bytes    int64
+	readTime time.Duration
+	err      error
+}
+
+func (b *tracedBody) Read(p []byte) (int, error) {
+	start := time.Now()
+	n, err := b.ReadCloser.Read(p)
+	b.readTime += time.Since(start)
+	b.bytes += int64(n)
+	b.counter.add(n)
+	if err != nil && err != io.EOF {
+		b.err = err
 	}
+	return n, err
+}
+
+func (b *tracedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.span.SetAttributes(
+		attribute.Int64("specular.archive.bytes", b.bytes),
+		attribute.Float64("specular.archive.read_seconds", b.readTime.Seconds()))
+	tracing.End(b.span, b.err)
+	return err
+}
+
+// releasingReadCloser releases a fetch slot when the wrapped body is closed
+type releasingReadCloser struct {
+	io.ReadCloser
+	release func()
+}
+
+func (r *releasingReadCloser) Close() error {
+	defer r.release()
+	return r.ReadCloser.Close()
+}
+
+// exponentialBackoff waits for a jittered exponential backoff duration, respecting context cancellation
+func exponentialBackoff(ctx context.Context, attempt int) error {
+	return sleepContext(ctx, backoffDelay(attempt))
 }
 
 // checkStatusCode validates HTTP status and returns appropriate error
@@ -215,72 +579,142 @@ func parseJSON(data []byte, v interface{}, responseType string) error {
 // doRequestWithRetry performs an HTTP GET request with exponential backoff retry logic
 // Returns the HTTP response (caller is responsible for closing the body) and status code
 // Note: Returns response on both success (2xx-3xx) and client errors (4xx), only retries on server errors (5xx) or network errors
-func (uc *UpstreamClient) doRequestWithRetry(ctx context.Context, url string) (*http.Response, int, error) {
+// With readBody the body is read as part of each attempt and returned, with the response body
+// already closed; connections dropped while reading it are retried like failed requests
+// credentialsHost is the registry or mirror whose token is sent; empty sends none
+func (uc *UpstreamClient) doRequestWithRetry(ctx context.Context, url, credentialsHost string, readBody bool) (*http.Response, []byte, int, error) {
 	var lastErr error
 	var lastStatus int
 
 	for attempt := 0; attempt <= uc.maxRetries; attempt++ {
 		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 		if err != nil {
-			return nil, 0, fmt.Errorf("failed to create request: %w", err)
+			return nil, nil, 0, fmt.Errorf("failed to create request: %w", err)
 		}
+		uc.credentials.authorize(req, credentialsHost)
 
+		host := strings.ToLower(req.URL.Host)
+		if attempt == 0 {
+			uc.retryBudget.deposit(host)
+		}
+
+		// Hosts with an open circuit fail fast instead of waiting through retries
+		if err := uc.breaker.allow(host); err != nil {
+			return nil, nil, lastStatus, err
+		}
+
+		start := time.Now()
 		resp, err := uc.httpClient.Do(req)
+		status := 0
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		if uc.onRequest != nil {
+			uc.onRequest(host, status, time.Since(start))
+		}
+		uc.breaker.record(ctx, host, status, err)
 		if err != nil {
 			lastErr = err
 			lastStatus = 0
-			// Only retry on network errors if we have attempts left
-			if attempt < uc.maxRetries {
-				if backoffErr := exponentialBackoff(ctx, attempt); backoffErr != nil {
-					return nil, 0, backoffErr
-				}
-				continue
+			// Blocked addresses stay blocked, so they are not retried
+			if errors.Is(err, ErrUpstreamBlocked) || !uc.canRetry(ctx, host, attempt) {
+				return nil, nil, 0, fmt.Errorf("failed to fetch: %w", lastErr)
+			}
+			if backoffErr := exponentialBackoff(ctx, attempt); backoffErr != nil {
+				return nil, nil, 0, backoffErr
 			}
-			// Last attempt failed
-			return nil, 0, fmt.Errorf("failed to fetch: %w", lastErr)
+			continue
 		}
 
 		lastStatus = resp.StatusCode
 
-		// Don't retry on client errors (4xx) or success (2xx-3xx) - return immediately
-		if resp.StatusCode < 500 {
-			return resp, resp.StatusCode, nil
+		// Success, redirects and client errors other than 429 are final, and so are
+		// retryable statuses once no retry is left
+		final := !retryableStatus(resp.StatusCode)
+		var delay time.Duration
+		if !final {
+			// 429 and 503 may say when to come back; waits beyond maxRetryAfter are not retried
+			var hasRetryAfter bool
+			delay, hasRetryAfter = retryAfter(resp, time.Now())
+			final = hasRetryAfter && delay > maxRetryAfter || !uc.canRetry(ctx, host, attempt)
+			if !hasRetryAfter {
+				delay = backoffDelay(attempt)
+			}
 		}
 
-		// For 5xx errors with retries left, backoff and retry
-		if attempt < uc.maxRetries {
+		if final {
+			if !readBody {
+				return resp, nil, resp.StatusCode, nil
+			}
+			body, err := io.ReadAll(resp.Body)
 			resp.Body.Close()
+			upstreamBytesCounter(ctx).add(len(body))
+			if err == nil {
+				return resp, body, resp.StatusCode, nil
+			}
+
+			uc.breaker.record(ctx, host, 0, err)
+			lastErr = fmt.Errorf("failed to read response body: %w", err)
+			if !uc.canRetry(ctx, host, attempt) {
+				return nil, nil, resp.StatusCode, lastErr
+			}
+			uc.logger.DebugContext(ctx, "retrying upstream request after failed body read",
+				slog.String("url", url),
+				slog.Int("attempt", attempt+1),
+				slog.String("error", err.Error()))
 			if backoffErr := exponentialBackoff(ctx, attempt); backoffErr != nil {
-				return nil, resp.StatusCode, backoffErr
+				return nil, nil, resp.StatusCode, backoffErr
 			}
-			lastErr = fmt.Errorf("server error: %d", resp.StatusCode)
 			continue
 		}
 
-		// Final attempt with 5xx error - return response for caller to handle
-		return resp, resp.StatusCode, nil
+		resp.Body.Close()
+		uc.logger.DebugContext(ctx, "retrying upstream request",
+			slog.String("url", url),
+			slog.Int("status", resp.StatusCode),
+			slog.Int("attempt", attempt+1),
+			slog.Duration("delay", delay))
+		if backoffErr := sleepContext(ctx, delay); backoffErr != nil {
+			return nil, nil, resp.StatusCode, backoffErr
+		}
+		lastErr = fmt.Errorf("upstream returned status %d", resp.StatusCode)
 	}
 
 	// Should not reach here
 	if lastErr != nil {
-		return nil, lastStatus, lastErr
+		return nil, nil, lastStatus, lastErr
+	}
+	return nil, nil, lastStatus, fmt.Errorf("unexpected state: max retries exceeded")
+}
+
+// canRetry reports whether a failed attempt may be retried: attempts must remain and the
+// host's retry budget must not be exhausted
+func (uc *UpstreamClient) canRetry(ctx context.Context, host string, attempt int) bool {
+	if attempt >= uc.maxRetries || ctx.Err() != nil {
+		return false
 	}
-	return nil, lastStatus, fmt.Errorf("unexpected state: max retries exceeded")
+	if !uc.retryBudget.withdraw(host) {
+		uc.logger.WarnContext(ctx, fmt.Sprintf("upstream retry budget exhausted, not retrying [host=%s]", host),
+			slog.String("host", host))
+		return false
+	}
+	return true
 }
 
 // fetch performs an HTTP GET request with retry logic, returning the full response body
-func (uc *UpstreamClient) fetch(ctx context.Context, url string) ([]byte, int, error) {
-	resp, status, err := uc.doRequestWithRetry(ctx, url)
+// Connections dropped while reading the body are retried like failed requests
+// credentialsHost is the registry or mirror whose token is sent; empty sends none
+func (uc *UpstreamClient) fetch(ctx context.Context, url, credentialsHost string) ([]byte, int, error) {
+	release, err := uc.fetchLimiter.Acquire(ctx)
 	if err != nil {
-		return nil, status, err
+		return nil, 0, err
 	}
+	defer release()
 
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
+	_, body, status, err := uc.doRequestWithRetry(ctx, url, credentialsHost, true)
 	if err != nil {
-		return nil, status, fmt.Errorf("failed to read response body: %w", err)
+		return nil, status, err
 	}
-
 	return body, status, nil
 }
 
@@ -303,11 +737,45 @@ func (uc *UpstreamClient) convertRegistryAPIToIndexResponse(data []byte) (*Index
 }
 
 // FetchDownloadURL fetches the download information for a specific provider version and platform
-func (uc *UpstreamClient) FetchDownloadURL(ctx context.Context, hostname, namespace, providerType, version, os, arch string) (*DownloadInfo, error) {
+func (uc *UpstreamClient) FetchDownloadURL(ctx context.Context, hostname, namespace, providerType, version, os, arch string) (_ *DownloadInfo, err error) {
+	ctx, span := tracing.Start(ctx, "UpstreamClient.FetchDownloadURL",
+		append(tracing.ProviderVersion(hostname, namespace, providerType, version), tracing.Platform(os, arch))...)
+	defer func() { tracing.End(span, err) }()
+
+	if err := uc.checkHostAllowed(ctx, hostname); err != nil {
+		return nil, err
+	}
+
+	if sources := uc.sources.forHost(hostname); sources != nil {
+		var info *DownloadInfo
+		err := uc.failover(ctx, hostname, namespace, providerType, "download URL "+version+" "+buildPlatformKey(os, arch), sources, func(ctx context.Context, src *upstreamSource) error {
+			var err error
+			info, err = uc.fetchSourceDownloadURL(ctx, src, hostname, namespace, providerType, version, os, arch)
+			return err
+		})
+		return info, err
+	}
+
+	if uc.useParentMirror(hostname, namespace) {
+		return uc.fetchMirrorDownloadURL(ctx, uc.parentMirrorURL(hostname, namespace, providerType, version+".json"), os, arch)
+	}
+
+	return uc.fetchRegistryDownloadURL(ctx, hostname, namespace, providerType, version, os, arch)
+}
+
+// fetchRegistryDownloadURL asks a provider's registry for an archive's download URL, falling back
+// to the version document of a mirror protocol upstream on the same host
+func (uc *UpstreamClient) fetchRegistryDownloadURL(ctx context.Context, hostname, namespace, providerType, version, os, arch string) (*DownloadInfo, error) {
 	// Get providers endpoint via service discovery
-	endpoint, err := uc.getProvidersEndpoint(ctx, hostname)
+	endpoint, err := uc.getProvidersEndpoint(ctx, hostname, namespace)
 	if err != nil {
-		return nil, fmt.Errorf("failed to discover services: %w", err)
+		// Fallback: mirror protocol upstreams list archive URLs in the version document
+		versionURL := fmt.Sprintf("https://%s/%s/%s/%s.json", uc.upstreamHost(hostname, namespace), namespace, providerType, version)
+		info, mirrorErr := uc.fetchMirrorDownloadURL(ctx, versionURL, os, arch)
+		if mirrorErr != nil {
+			return nil, fmt.Errorf("failed to discover services: %w", errors.Join(err, mirrorErr))
+		}
+		return info, nil
 	}
 
 	// Build download API URL: {endpoint}/{namespace}/{type}/{version}/download/{os}/{arch}
@@ -319,7 +787,7 @@ func (uc *UpstreamClient) FetchDownloadURL(ctx context.Context, hostname, namesp
 		slog.String("os", os),
 		slog.String("arch", arch))
 
-	body, status, err := uc.fetch(ctx, url)
+	body, status, err := uc.fetch(ctx, url, uc.upstreamHost(hostname, namespace))
 	if err != nil {
 		return nil, err
 	}
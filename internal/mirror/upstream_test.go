@@ -27,7 +27,10 @@ func newTestUpstreamClient(server *httptest.Server) *UpstreamClient {
 
 func TestNewUpstreamClient(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
-	client := NewUpstreamClient(30*time.Second, 3, 1*time.Hour, logger)
+	client, err := NewUpstreamClient(30*time.Second, 3, 1*time.Hour, logger, UpstreamOptions{})
+	if err != nil {
+		t.Fatalf("NewUpstreamClient failed: %v", err)
+	}
 
 	if client == nil {
 		t.Errorf("expected non-nil client")
@@ -54,7 +57,7 @@ func TestFetchArchive_ValidURL(t *testing.T) {
 	u, _ := url.Parse(server.URL)
 	archiveURL := fmt.Sprintf("https://%s/provider.zip", u.Host)
 
-	body, err := client.FetchArchive(context.Background(), archiveURL)
+	body, err := client.FetchArchive(context.Background(), "registry.terraform.io", archiveURL)
 	if err != nil {
 		t.Fatalf("FetchArchive failed: %v", err)
 	}
@@ -103,7 +106,7 @@ func TestFetchArchive_InvalidURL(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := client.FetchArchive(context.Background(), tt.url)
+			_, err := client.FetchArchive(context.Background(), "registry.terraform.io", tt.url)
 			if err == nil {
 				t.Errorf("expected error, got nil")
 			}
@@ -124,7 +127,7 @@ func TestFetchArchive_HTTPError(t *testing.T) {
 	u, _ := url.Parse(server.URL)
 	archiveURL := fmt.Sprintf("https://%s/notfound.zip", u.Host)
 
-	_, err := client.FetchArchive(context.Background(), archiveURL)
+	_, err := client.FetchArchive(context.Background(), "registry.terraform.io", archiveURL)
 	if err == nil {
 		t.Errorf("expected error for 404")
 	}
@@ -143,8 +146,9 @@ func TestExponentialBackoff_Success(t *testing.T) {
 	if err != nil {
 		t.Errorf("expected no error, got %v", err)
 	}
-	if elapsed < 1*time.Second {
-		t.Errorf("backoff duration too short: %v", elapsed)
+	// Full jitter waits a random duration below 1s for the first attempt
+	if elapsed >= 1100*time.Millisecond {
+		t.Errorf("backoff duration too long: %v", elapsed)
 	}
 }
 
@@ -169,7 +173,7 @@ func TestFetch_Success(t *testing.T) {
 	defer server.Close()
 
 	client := newTestUpstreamClient(server)
-	body, status, err := client.fetch(context.Background(), server.URL)
+	body, status, err := client.fetch(context.Background(), server.URL, "")
 
 	if err != nil {
 		t.Fatalf("fetch failed: %v", err)
@@ -189,7 +193,7 @@ func TestFetch_NotFound(t *testing.T) {
 	defer server.Close()
 
 	client := newTestUpstreamClient(server)
-	_, status, err := client.fetch(context.Background(), server.URL)
+	_, status, err := client.fetch(context.Background(), server.URL, "")
 
 	if err != nil {
 		t.Fatalf("fetch returned error for 404: %v", err)
@@ -212,7 +216,7 @@ func TestFetch_ServerError_WithRetry(t *testing.T) {
 	defer server.Close()
 
 	client := newTestUpstreamClient(server)
-	body, status, err := client.fetch(context.Background(), server.URL)
+	body, status, err := client.fetch(context.Background(), server.URL, "")
 
 	if err != nil {
 		t.Fatalf("fetch failed: %v", err)
@@ -239,7 +243,7 @@ func TestFetch_MaxRetriesExceeded(t *testing.T) {
 	client := newTestUpstreamClient(server)
 	client.maxRetries = 2
 
-	_, status, _ := client.fetch(context.Background(), server.URL)
+	_, status, _ := client.fetch(context.Background(), server.URL, "")
 
 	// With maxRetries=2, we should get 3 attempts (initial + 2 retries)
 	if callCount != 3 {
@@ -265,7 +269,7 @@ func TestFetch_ContextCancellation(t *testing.T) {
 	// Start fetch in goroutine
 	done := make(chan error)
 	go func() {
-		_, _, err := client.fetch(ctx, server.URL)
+		_, _, err := client.fetch(ctx, server.URL, "")
 		done <- err
 	}()
 
@@ -411,3 +415,145 @@ func TestFetchDownloadURL_NotFound(t *testing.T) {
 		t.Errorf("expected ErrNotFound, got %v", err)
 	}
 }
+
+// newParentMirrorServer serves a provider network mirror with a relative archive URL
+func newParentMirrorServer(t *testing.T, requests *[]string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests = append(*requests, r.URL.Path)
+		switch r.URL.Path {
+		case "/terraform/providers/registry.terraform.io/hashicorp/aws/index.json":
+			w.Write([]byte(`{"versions":{"1.0.0":{}}}`))
+		case "/terraform/providers/registry.terraform.io/hashicorp/aws/1.0.0.json":
+			w.Write([]byte(`{"archives":{"linux_amd64":{"url":"archives/terraform-provider-aws_1.0.0_linux_amd64.zip","hashes":["h1:abc"]}}}`))
+		case "/terraform/providers/registry.terraform.io/hashicorp/aws/archives/terraform-provider-aws_1.0.0_linux_amd64.zip":
+			w.Write([]byte("archive from parent"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestNewUpstreamClient_InvalidParentMirror(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	for _, parent := range []string{"central.example.com/terraform/providers", "ftp://central.example.com/"} {
+		if _, err := NewUpstreamClient(time.Second, 0, time.Minute, logger, UpstreamOptions{ParentMirrorURL: parent}); err == nil {
+			t.Errorf("expected error for parent mirror %q", parent)
+		}
+	}
+}
+
+// TestParentMirror_EndToEnd tests that every hostname is fetched from the parent mirror,
+// with archive URLs resolved relative to the parent's version document
+func TestParentMirror_EndToEnd(t *testing.T) {
+	var requests []string
+	server := newParentMirrorServer(t, &requests)
+
+	upstream := newTestUpstreamClient(server)
+	upstream.parentMirror, _ = url.Parse(server.URL + "/terraform/providers/")
+
+	store := NewMockStorage()
+	m := NewMirror(store, upstream, "http://localhost:8080", 0, Options{})
+	ctx := context.Background()
+
+	index, err := m.GetIndex(ctx, "registry.terraform.io", "hashicorp", "aws")
+	if err != nil {
+		t.Fatalf("GetIndex failed: %v", err)
+	}
+	if _, ok := indexVersions(t, index)["1.0.0"]; !ok {
+		t.Fatalf("expected 1.0.0 in index, got %s", index)
+	}
+
+	version, err := m.GetVersion(ctx, "registry.terraform.io", "hashicorp", "aws", "1.0.0")
+	if err != nil {
+		t.Fatalf("GetVersion failed: %v", err)
+	}
+	var response VersionResponse
+	json.Unmarshal(version, &response)
+	archive := response.Archives["linux_amd64"]
+	if archive.URL != "http://localhost:8080/terraform/providers/download/registry.terraform.io/hashicorp/aws/1.0.0/linux/amd64/terraform-provider-aws_1.0.0_linux_amd64.zip" {
+		t.Errorf("unexpected rewritten archive URL: %s", archive.URL)
+	}
+	if len(archive.Hashes) != 1 || archive.Hashes[0] != "h1:abc" {
+		t.Errorf("expected parent hashes to be kept, got %v", archive.Hashes)
+	}
+
+	reader, err := m.GetArchive(ctx, "registry.terraform.io", "hashicorp", "aws", "1.0.0", "linux", "amd64")
+	if err != nil {
+		t.Fatalf("GetArchive failed: %v", err)
+	}
+	data, _ := io.ReadAll(reader)
+	reader.Close()
+	if string(data) != "archive from parent" {
+		t.Errorf("unexpected archive contents: %q", data)
+	}
+
+	for _, path := range requests {
+		if strings.HasPrefix(path, "/.well-known") || strings.HasPrefix(path, "/v1/") {
+			t.Errorf("expected no registry protocol requests with a parent mirror, got %s", path)
+		}
+	}
+}
+
+// TestFetchIndex_CrossHostProvidersURL tests that an absolute providers.v1 URL on another host is used as is
+func TestFetchIndex_CrossHostProvidersURL(t *testing.T) {
+	api := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/providers/hashicorp/aws/versions" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"versions":[{"version":"1.0.0","platforms":[{"os":"linux","arch":"amd64"}]}]}`))
+	}))
+	defer api.Close()
+
+	registry := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"providers.v1":"%s/api/v1/providers/"}`, api.URL)
+	}))
+	defer registry.Close()
+
+	u, _ := url.Parse(registry.URL)
+	index, _, err := newTestUpstreamClient(registry).FetchIndex(context.Background(), u.Host, "hashicorp", "aws")
+	if err != nil {
+		t.Fatalf("FetchIndex failed: %v", err)
+	}
+	if _, ok := index.Versions["1.0.0"]; !ok {
+		t.Errorf("expected versions from the cross-host API, got %v", index.Versions)
+	}
+}
+
+// TestRequestHostLabel tests that only configured upstream hosts are reported to OnRequest
+func TestRequestHostLabel(t *testing.T) {
+	sources, err := ParseUpstreamSources([]string{"tf.corp.example=https://mirror.corp.example:8443/providers/|registry"})
+	if err != nil {
+		t.Fatalf("ParseUpstreamSources failed: %v", err)
+	}
+	uc, err := NewUpstreamClient(time.Second, 0, time.Hour, slog.New(slog.NewTextHandler(io.Discard, nil)), UpstreamOptions{
+		ParentMirrorURL: "https://parent.example/",
+		AllowedHosts:    []string{"registry.terraform.io", "*.internal.example", "tf.corp.example"},
+		Sources:         sources,
+	})
+	if err != nil {
+		t.Fatalf("NewUpstreamClient failed: %v", err)
+	}
+
+	tests := map[string]string{
+		"parent.example":            "parent.example",
+		"mirror.corp.example:8443":  "mirror.corp.example:8443",
+		"tf.corp.example":           "tf.corp.example",
+		"Registry.Terraform.IO":     "registry.terraform.io",
+		"registry.terraform.io:443": "registry.terraform.io:443",
+		"a.internal.example":        "*.internal.example",
+		"b.c.internal.example:8443": "*.internal.example",
+		"internal.example":          HostOther,
+		"releases.hashicorp.com":    HostOther,
+		"random-1234.attacker.test": HostOther,
+		"mirror.corp.example":       HostOther,
+	}
+	for host, want := range tests {
+		if got := uc.requestHostLabel(host); got != want {
+			t.Errorf("requestHostLabel(%q) = %q, want %q", host, got, want)
+		}
+	}
+}
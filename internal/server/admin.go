@@ -0,0 +1,218 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/elisiariocouto/specular/internal/audit"
+	"github.com/elisiariocouto/specular/internal/authz"
+	"github.com/elisiariocouto/specular/internal/mirror"
+	"github.com/go-chi/chi/v5"
+)
+
+// writeAdminJSON writes a JSON response for the admin API
+func writeAdminJSON(w http.ResponseWriter, status int, v any) {
+	body, _ := json.Marshal(v)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// writeAdminError maps mirror errors to admin API error responses
+func (h *Handlers) writeAdminError(w http.ResponseWriter, r *http.Request, operation string, err error) {
+	if errors.Is(err, mirror.ErrNotFound) {
+		writeAdminJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+		return
+	}
+
+	h.metrics.RecordError("admin_handler", operation+"_failed")
+	h.logger.ErrorContext(r.Context(),
+		fmt.Sprintf("admin %s failed [error=%s]", operation, err.Error()),
+		slog.String("operation", operation),
+		slog.String("error", err.Error()))
+	writeAdminJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+}
+
+// providerResource returns the provider addressed by the hostname, namespace and type URL parameters
+func providerResource(r *http.Request) authz.Resource {
+	return authz.Resource{
+		Hostname:  chi.URLParam(r, "hostname"),
+		Namespace: chi.URLParam(r, "namespace"),
+		Type:      chi.URLParam(r, "type"),
+	}
+}
+
+// PendingVersionsHandler handles GET /admin/providers/{hostname}/{namespace}/{type}/pending
+func (h *Handlers) PendingVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	resource := providerResource(r)
+	if !h.checkHostname(w, r, resource.Hostname) || !h.authorize(w, r, authz.ActionAdmin, resource) {
+		return
+	}
+
+	pending, err := h.mirror.PendingVersions(r.Context(), resource.Hostname, resource.Namespace, resource.Type)
+	if err != nil {
+		h.writeAdminError(w, r, "list_pending", err)
+		return
+	}
+
+	writeAdminJSON(w, http.StatusOK, map[string]any{"pending": pending})
+}
+
+// ApproveVersionHandler handles POST /admin/providers/{hostname}/{namespace}/{type}/versions/{version}/approve
+func (h *Handlers) ApproveVersionHandler(w http.ResponseWriter, r *http.Request) {
+	h.decideVersion(w, r, "approve", h.mirror.ApproveVersion)
+}
+
+// RejectVersionHandler handles POST /admin/providers/{hostname}/{namespace}/{type}/versions/{version}/reject
+func (h *Handlers) RejectVersionHandler(w http.ResponseWriter, r *http.Request) {
+	h.decideVersion(w, r, "reject", h.mirror.RejectVersion)
+}
+
+// decideVersion records an approval decision made by the authenticated identity
+func (h *Handlers) decideVersion(
+	w http.ResponseWriter,
+	r *http.Request,
+	operation string,
+	decide func(ctx context.Context, hostname, namespace, providerType, version, approver string) (*mirror.VersionApproval, error),
+) {
+	resource := providerResource(r)
+	version := chi.URLParam(r, "version")
+	if !h.checkHostname(w, r, resource.Hostname) || !h.authorize(w, r, authz.ActionAdmin, resource) {
+		return
+	}
+
+	approver := ""
+	if id, ok := IdentityFromContext(r.Context()); ok {
+		approver = id.Name
+	}
+
+	record, err := decide(r.Context(), resource.Hostname, resource.Namespace, resource.Type, version, approver)
+	if err != nil {
+		h.writeAdminError(w, r, operation, err)
+		return
+	}
+
+	writeAdminJSON(w, http.StatusOK, record)
+}
+
+// UpstreamStatusHandler handles GET /admin/upstreams
+func (h *Handlers) UpstreamStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.authorize(w, r, authz.ActionAdmin, authz.Resource{}) {
+		return
+	}
+
+	upstreams := h.mirror.CircuitStatus()
+	if upstreams == nil {
+		upstreams = []mirror.CircuitStatus{}
+	}
+	sources := h.mirror.SourceStatus()
+	if sources == nil {
+		sources = []mirror.SourceStatus{}
+	}
+	writeAdminJSON(w, http.StatusOK, map[string]any{"upstreams": upstreams, "sources": sources})
+}
+
+// BandwidthHandler handles GET /admin/bandwidth
+func (h *Handlers) BandwidthHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.authorize(w, r, authz.ActionAdmin, authz.Resource{}) {
+		return
+	}
+
+	writeAdminJSON(w, http.StatusOK, h.mirror.BandwidthSummary())
+}
+
+// CatalogHandler handles GET /admin/catalog
+// The cursor query parameter continues from a previous page's next_cursor and limit sets the
+// number of providers per page
+func (h *Handlers) CatalogHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.authorize(w, r, authz.ActionAdmin, authz.Resource{}) {
+		return
+	}
+
+	limit := mirror.DefaultCatalogLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > mirror.MaxCatalogLimit {
+			writeAdminJSON(w, http.StatusBadRequest,
+				map[string]string{"error": fmt.Sprintf("limit must be between 1 and %d", mirror.MaxCatalogLimit)})
+			return
+		}
+		limit = n
+	}
+
+	catalog, err := h.mirror.Catalog(r.Context(), r.URL.Query().Get("cursor"), limit)
+	if errors.Is(err, mirror.ErrInvalidCursor) {
+		writeAdminJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid cursor"})
+		return
+	}
+	if errors.Is(err, mirror.ErrCatalogUnavailable) {
+		writeAdminJSON(w, http.StatusNotImplemented, map[string]string{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.writeAdminError(w, r, "catalog", err)
+		return
+	}
+
+	writeAdminJSON(w, http.StatusOK, catalog)
+}
+
+// AuditHandler handles GET /admin/audit
+// Query parameters hostname, namespace, type, version, identity and resource filter entries,
+// since and until (RFC 3339) bound their time and limit caps how many are returned
+func (h *Handlers) AuditHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.authorize(w, r, authz.ActionAdmin, authz.Resource{}) {
+		return
+	}
+	if h.auditLog == nil {
+		writeAdminJSON(w, http.StatusNotFound, map[string]string{"error": "audit log disabled"})
+		return
+	}
+
+	params := r.URL.Query()
+	query := audit.Query{
+		Hostname:  params.Get("hostname"),
+		Namespace: params.Get("namespace"),
+		Type:      params.Get("type"),
+		Version:   params.Get("version"),
+		Identity:  params.Get("identity"),
+		Resource:  params.Get("resource"),
+	}
+	bounds := []struct {
+		name string
+		t    *time.Time
+	}{{"since", &query.Since}, {"until", &query.Until}}
+	for _, bound := range bounds {
+		if v := params.Get(bound.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				writeAdminJSON(w, http.StatusBadRequest, map[string]string{"error": bound.name + " must be an RFC 3339 time"})
+				return
+			}
+			*bound.t = t
+		}
+	}
+	if v := params.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			writeAdminJSON(w, http.StatusBadRequest, map[string]string{"error": "limit must be a positive integer"})
+			return
+		}
+		query.Limit = limit
+	}
+
+	entries, truncated, err := h.auditLog.Query(r.Context(), query)
+	if err != nil {
+		h.writeAdminError(w, r, "query_audit", err)
+		return
+	}
+
+	writeAdminJSON(w, http.StatusOK, map[string]any{"entries": entries, "truncated": truncated})
+}
@@ -0,0 +1,456 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/elisiariocouto/specular/internal/audit"
+	"github.com/elisiariocouto/specular/internal/mirror"
+	"github.com/elisiariocouto/specular/internal/storage"
+)
+
+func doAdminRequest(handler http.Handler, method, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+// TestAdmin_ApprovalEndpoints tests listing, approving and rejecting pending versions
+func TestAdmin_ApprovalEndpoints(t *testing.T) {
+	policyFile := filepath.Join(t.TempDir(), "policy.json")
+	policy := `{"rules":[
+		{"identities":["team-a"],"actions":["providers"]},
+		{"identities":["platform"],"actions":["admin"]}
+	]}`
+	if err := os.WriteFile(policyFile, []byte(policy), 0600); err != nil {
+		t.Fatalf("failed to write policy: %v", err)
+	}
+
+	store := storage.NewMemoryStorage()
+	store.PutMetadata(context.Background(), "approvals/registry.terraform.io/hashicorp/aws", []byte(`{"versions":{
+		"5.71.0":{"version":"5.71.0","state":"pending","discovered_at":"2025-06-01T00:00:00Z"},
+		"5.72.0":{"version":"5.72.0","state":"pending","discovered_at":"2025-06-02T00:00:00Z"}
+	}}`))
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	m := mirror.NewMirror(store, nil, "http://localhost:8080", 0, mirror.Options{RequireApproval: true})
+	srv, err := New("127.0.0.1", 0, time.Second, time.Second, m, metricsForTests(), logger,
+		Options{
+			Auth: AuthOptions{
+				TokenHashes: []string{sha256Entry("team-a", "team-a-token"), sha256Entry("platform", "platform-token")},
+			},
+			AuthzPolicyFile: policyFile,
+		})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	handler := srv.httpServer.Handler
+
+	pendingPath := "/admin/providers/registry.terraform.io/hashicorp/aws/pending"
+	approvePath := "/admin/providers/registry.terraform.io/hashicorp/aws/versions/5.71.0/approve"
+
+	if w := doAdminRequest(handler, "GET", pendingPath, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected anonymous admin request to return 401, got %d", w.Code)
+	}
+	if w := doAdminRequest(handler, "POST", approvePath, "team-a-token"); w.Code != http.StatusForbidden {
+		t.Errorf("expected identity without admin action to return 403, got %d", w.Code)
+	}
+
+	w := doAdminRequest(handler, "GET", pendingPath, "platform-token")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected pending list to return 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var list struct {
+		Pending []mirror.VersionApproval `json:"pending"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(list.Pending) != 2 || list.Pending[0].Version != "5.71.0" {
+		t.Fatalf("unexpected pending list: %+v", list.Pending)
+	}
+
+	w = doAdminRequest(handler, "POST", approvePath, "platform-token")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected approve to return 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var record mirror.VersionApproval
+	if err := json.Unmarshal(w.Body.Bytes(), &record); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if record.State != mirror.ApprovalApproved || record.DecidedBy != "platform" {
+		t.Errorf("unexpected approval record: %+v", record)
+	}
+
+	w = doAdminRequest(handler, "POST", "/admin/providers/registry.terraform.io/hashicorp/aws/versions/5.72.0/reject", "platform-token")
+	if w.Code != http.StatusOK {
+		t.Errorf("expected reject to return 200, got %d", w.Code)
+	}
+
+	w = doAdminRequest(handler, "POST", "/admin/providers/registry.terraform.io/hashicorp/aws/versions/1.0.0/approve", "platform-token")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected approving an unknown version to return 404, got %d", w.Code)
+	}
+
+	w = doAdminRequest(handler, "GET", pendingPath, "platform-token")
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(list.Pending) != 0 {
+		t.Errorf("expected no pending versions, got %+v", list.Pending)
+	}
+}
+
+// TestAdmin_RequiresAdminIdentityWithoutPolicy tests that without an authorization policy only
+// the configured admin identities may use the admin API, and nobody when none are configured
+func TestAdmin_RequiresAdminIdentityWithoutPolicy(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	store.PutMetadata(context.Background(), "approvals/registry.terraform.io/hashicorp/aws", []byte(`{"versions":{
+		"5.71.0":{"version":"5.71.0","state":"pending","discovered_at":"2025-06-01T00:00:00Z"}
+	}}`))
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	m := mirror.NewMirror(store, nil, "http://localhost:8080", 0, mirror.Options{RequireApproval: true})
+	defer m.Shutdown()
+	tokens := AuthOptions{TokenHashes: []string{sha256Entry("team-a", "team-a-token"), sha256Entry("platform", "platform-token")}}
+	approve := "/admin/providers/registry.terraform.io/hashicorp/aws/versions/5.71.0/approve"
+
+	srv, err := New("127.0.0.1", 0, time.Second, time.Second, m, metricsForTests(), logger, Options{Auth: tokens})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if w := doAdminRequest(srv.httpServer.Handler, "POST", approve, "platform-token"); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 without admin identities, got %d", w.Code)
+	}
+
+	srv, err = New("127.0.0.1", 0, time.Second, time.Second, m, metricsForTests(), logger,
+		Options{Auth: tokens, AdminIdentities: []string{"platform"}})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	handler := srv.httpServer.Handler
+	if w := doAdminRequest(handler, "POST", approve, "team-a-token"); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a non-admin identity, got %d", w.Code)
+	}
+	if w := doAdminRequest(handler, "GET", "/admin/bandwidth", "team-a-token"); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a non-admin identity, got %d", w.Code)
+	}
+	if w := doAdminRequest(handler, "POST", approve, "platform-token"); w.Code != http.StatusOK {
+		t.Errorf("expected 200 for an admin identity, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Provider routes stay open to every identity without a policy
+	if w := doAdminRequest(handler, "GET", "/terraform/providers/registry.terraform.io/hashicorp/aws/index.json", "team-a-token"); w.Code == http.StatusForbidden {
+		t.Errorf("expected provider routes to stay open without a policy, got %d", w.Code)
+	}
+}
+
+// TestAdmin_UpstreamStatus tests that failing upstreams fail fast with 503 and are listed as open
+func TestAdmin_UpstreamStatus(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer upstream.Close()
+	upstreamHost := upstream.Listener.Addr().String()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	upstreamClient, err := mirror.NewUpstreamClient(time.Second, 0, time.Hour, logger, mirror.UpstreamOptions{
+		Breaker: mirror.BreakerOptions{FailureThreshold: 1, OpenTimeout: time.Minute},
+	})
+	if err != nil {
+		t.Fatalf("NewUpstreamClient failed: %v", err)
+	}
+	m := mirror.NewMirror(storage.NewMemoryStorage(), upstreamClient, "http://localhost:8080", 0, mirror.Options{})
+	srv, err := New("127.0.0.1", 0, time.Second, time.Second, m, metricsForTests(), logger,
+		Options{
+			Auth:            AuthOptions{TokenHashes: []string{sha256Entry("platform", "platform-token")}},
+			AdminIdentities: []string{"platform"},
+		})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	handler := srv.httpServer.Handler
+
+	// Service discovery fails against the plain HTTP upstream, opening its circuit, so the
+	// mirror protocol fallback fails fast
+	w := doRequest(handler, "/terraform/providers/"+upstreamHost+"/hashicorp/aws/index.json", "platform-token")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d: %s", w.Code, w.Body.String())
+	}
+	if retryAfter := w.Header().Get("Retry-After"); retryAfter != "60" {
+		t.Errorf("Retry-After = %q, want 60", retryAfter)
+	}
+
+	if w := doAdminRequest(handler, "GET", "/admin/upstreams", ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without credentials, got %d", w.Code)
+	}
+
+	w = doAdminRequest(handler, "GET", "/admin/upstreams", "platform-token")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var body struct {
+		Upstreams []mirror.CircuitStatus `json:"upstreams"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if len(body.Upstreams) != 1 || body.Upstreams[0].Host != upstreamHost || body.Upstreams[0].State != mirror.CircuitOpen {
+		t.Errorf("unexpected upstream status: %s", w.Body.String())
+	}
+}
+
+// TestAdmin_Bandwidth tests that bytes served from cache are reported by the bandwidth endpoint
+func TestAdmin_Bandwidth(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	indexData := []byte(`{"versions":{"1.0.0":{}}}`)
+	store.PutIndex(context.Background(), "registry.terraform.io", "hashicorp", "aws", indexData)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	m := mirror.NewMirror(store, nil, "http://localhost:8080", 0, mirror.Options{})
+	defer m.Shutdown()
+	srv, err := New("127.0.0.1", 0, time.Second, time.Second, m, metricsForTests(), logger,
+		Options{
+			Auth:            AuthOptions{TokenHashes: []string{sha256Entry("platform", "platform-token")}},
+			AdminIdentities: []string{"platform"},
+		})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	handler := srv.httpServer.Handler
+
+	if w := doRequest(handler, "/terraform/providers/registry.terraform.io/hashicorp/aws/index.json", "platform-token"); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w := doAdminRequest(handler, "GET", "/admin/bandwidth", "platform-token")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var summary mirror.BandwidthSummary
+	if err := json.Unmarshal(w.Body.Bytes(), &summary); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if summary.SinceStartup.CacheBytes != int64(len(indexData)) || summary.SinceStartup.UpstreamBytes != 0 {
+		t.Errorf("unexpected totals since startup: %+v", summary.SinceStartup)
+	}
+	if summary.SinceCacheCreated.CacheBytes != int64(len(indexData)) {
+		t.Errorf("unexpected totals since cache creation: %+v", summary.SinceCacheCreated)
+	}
+}
+
+// TestAdmin_Audit tests that provider requests are audited and can be queried by version and time
+func TestAdmin_Audit(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	store.PutIndex(context.Background(), "registry.terraform.io", "hashicorp", "aws", []byte(`{"versions":{"1.0.0":{}}}`))
+
+	auditLog, err := audit.Open(t.TempDir(), audit.Options{})
+	if err != nil {
+		t.Fatalf("audit.Open failed: %v", err)
+	}
+	defer auditLog.Close()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	m := mirror.NewMirror(store, nil, "http://localhost:8080", 0, mirror.Options{})
+	defer m.Shutdown()
+	srv, err := New("127.0.0.1", 0, time.Second, time.Second, m, metricsForTests(), logger, Options{
+		Auth:            AuthOptions{TokenHashes: []string{sha256Entry("platform", "platform-token")}},
+		AdminIdentities: []string{"platform"},
+		AuditLog:        auditLog,
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	handler := srv.httpServer.Handler
+
+	since := time.Now().UTC().Add(-time.Second).Format(time.RFC3339)
+	doRequest(handler, "/terraform/providers/registry.terraform.io/hashicorp/aws/index.json", "platform-token")
+	doRequest(handler, "/terraform/providers/registry.terraform.io/hashicorp/aws/2.0.0.json", "platform-token")
+
+	w := doAdminRequest(handler, "GET", "/admin/audit?type=aws&resource=index&since="+since, "platform-token")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Entries   []audit.Entry `json:"entries"`
+		Truncated bool          `json:"truncated"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if len(resp.Entries) != 1 || resp.Truncated {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	entry := resp.Entries[0]
+	if entry.Identity != "platform" || entry.ClientIP != "192.0.2.1" || entry.Hostname != "registry.terraform.io" ||
+		entry.CacheStatus != string(mirror.CacheHit) || entry.Status != http.StatusOK {
+		t.Errorf("unexpected entry: %+v", entry)
+	}
+
+	w = doAdminRequest(handler, "GET", "/admin/audit?version=2.0.0", "platform-token")
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if len(resp.Entries) != 1 || resp.Entries[0].Resource != audit.ResourceVersion {
+		t.Errorf("unexpected version entries: %+v", resp.Entries)
+	}
+
+	for _, query := range []string{"since=yesterday", "until=2026-01-01", "limit=0"} {
+		if w := doAdminRequest(handler, "GET", "/admin/audit?"+query, "platform-token"); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, w.Code)
+		}
+	}
+}
+
+// TestAdmin_AuditRefusedRequests tests that requests refused by the authorization policy or the
+// provider policy are audited with their 403 status
+func TestAdmin_AuditRefusedRequests(t *testing.T) {
+	dir := t.TempDir()
+	authzFile := filepath.Join(dir, "authz.json")
+	authzPolicy := `{"rules":[
+		{"identities":["platform"],"actions":["admin","providers"]},
+		{"identities":["team-a"],"actions":["providers"],"providers":["hashicorp/aws"]}
+	]}`
+	providerFile := filepath.Join(dir, "providers.json")
+	for file, data := range map[string]string{authzFile: authzPolicy, providerFile: `{"deny":["hashicorp/template"]}`} {
+		if err := os.WriteFile(file, []byte(data), 0600); err != nil {
+			t.Fatalf("failed to write policy: %v", err)
+		}
+	}
+	providerPolicy, err := mirror.LoadProviderPolicy(providerFile)
+	if err != nil {
+		t.Fatalf("LoadProviderPolicy failed: %v", err)
+	}
+
+	auditLog, err := audit.Open(t.TempDir(), audit.Options{})
+	if err != nil {
+		t.Fatalf("audit.Open failed: %v", err)
+	}
+	defer auditLog.Close()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	m := mirror.NewMirror(storage.NewMemoryStorage(), nil, "http://localhost:8080", 0, mirror.Options{Policy: providerPolicy})
+	defer m.Shutdown()
+	srv, err := New("127.0.0.1", 0, time.Second, time.Second, m, metricsForTests(), logger, Options{
+		Auth: AuthOptions{
+			TokenHashes: []string{sha256Entry("team-a", "team-a-token"), sha256Entry("platform", "platform-token")},
+		},
+		AuthzPolicyFile: authzFile,
+		AuditLog:        auditLog,
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	handler := srv.httpServer.Handler
+
+	if w := doRequest(handler, "/terraform/providers/registry.terraform.io/hashicorp/google/index.json", "team-a-token"); w.Code != http.StatusForbidden {
+		t.Fatalf("expected the authorization policy to refuse with 403, got %d", w.Code)
+	}
+	if w := doRequest(handler, "/terraform/providers/registry.terraform.io/hashicorp/template/1.0.0.json", "platform-token"); w.Code != http.StatusForbidden {
+		t.Fatalf("expected the provider policy to refuse with 403, got %d", w.Code)
+	}
+
+	w := doAdminRequest(handler, "GET", "/admin/audit", "platform-token")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Entries []audit.Entry `json:"entries"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if len(resp.Entries) != 2 {
+		t.Fatalf("expected 2 audit entries, got %+v", resp.Entries)
+	}
+	denied, forbidden := resp.Entries[0], resp.Entries[1]
+	if denied.Identity != "team-a" || denied.Type != "google" || denied.Resource != audit.ResourceIndex ||
+		denied.Status != http.StatusForbidden || denied.CacheStatus != "" {
+		t.Errorf("unexpected authorization denial entry: %+v", denied)
+	}
+	if forbidden.Identity != "platform" || forbidden.Type != "template" || forbidden.Version != "1.0.0" ||
+		forbidden.Status != http.StatusForbidden {
+		t.Errorf("unexpected provider policy entry: %+v", forbidden)
+	}
+}
+
+// TestAdmin_AuditDisabled tests that the audit endpoint is not found without an audit log
+func TestAdmin_AuditDisabled(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	m := mirror.NewMirror(storage.NewMemoryStorage(), nil, "http://localhost:8080", 0, mirror.Options{})
+	defer m.Shutdown()
+	srv, err := New("127.0.0.1", 0, time.Second, time.Second, m, metricsForTests(), logger,
+		Options{
+			Auth:            AuthOptions{TokenHashes: []string{sha256Entry("platform", "platform-token")}},
+			AdminIdentities: []string{"platform"},
+		})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	if w := doAdminRequest(srv.httpServer.Handler, "GET", "/admin/audit", "platform-token"); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+}
+
+// TestAdmin_Catalog tests that the catalog endpoint pages through cached providers
+func TestAdmin_Catalog(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	store.PutIndex(context.Background(), "registry.terraform.io", "hashicorp", "aws", []byte(`{"versions":{}}`))
+	store.PutIndex(context.Background(), "registry.terraform.io", "hashicorp", "google", []byte(`{"versions":{}}`))
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	m := mirror.NewMirror(store, nil, "http://localhost:8080", 0, mirror.Options{})
+	defer m.Shutdown()
+	srv, err := New("127.0.0.1", 0, time.Second, time.Second, m, metricsForTests(), logger,
+		Options{
+			Auth:            AuthOptions{TokenHashes: []string{sha256Entry("platform", "platform-token")}},
+			AdminIdentities: []string{"platform"},
+		})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	handler := srv.httpServer.Handler
+
+	w := doAdminRequest(handler, "GET", "/admin/catalog?limit=1", "platform-token")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var page mirror.Catalog
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if len(page.Providers) != 1 || page.Providers[0].Type != "aws" || page.NextCursor != "registry.terraform.io/hashicorp/aws" {
+		t.Fatalf("unexpected first page: %+v", page)
+	}
+
+	w = doAdminRequest(handler, "GET", "/admin/catalog?limit=1&cursor="+page.NextCursor, "platform-token")
+	page = mirror.Catalog{}
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if len(page.Providers) != 1 || page.Providers[0].Type != "google" || page.NextCursor != "" {
+		t.Fatalf("unexpected second page: %+v", page)
+	}
+
+	for _, query := range []string{"limit=0", "limit=100000", "cursor=registry.terraform.io"} {
+		if w := doAdminRequest(handler, "GET", "/admin/catalog?"+query, "platform-token"); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, w.Code)
+		}
+	}
+	if w := doAdminRequest(handler, "GET", "/admin/catalog", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a token, got %d", w.Code)
+	}
+}
@@ -0,0 +1,265 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elisiariocouto/specular/internal/metrics"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// Route groups that can require authentication
+const (
+	RouteGroupHealth    = "health"
+	RouteGroupProviders = "providers"
+	RouteGroupMetrics   = "metrics"
+	// RouteGroupAdmin always requires authentication so decisions can be attributed
+	RouteGroupAdmin = "admin"
+)
+
+// AuthOptions configures bearer-token authentication
+type AuthOptions struct {
+	// TokensFile contains one "name:token" or "name:sha256:<hex>" entry per line
+	TokensFile string
+	// TokenHashes contains "name:sha256:<hex>" entries configured inline
+	TokenHashes []string
+	// ReloadInterval controls how often the tokens file is checked for changes.
+	// Zero disables polling; tokens can still be reloaded with ReloadAuth.
+	ReloadInterval time.Duration
+	// ProtectedRoutes lists the route groups that reject anonymous requests
+	ProtectedRoutes []string
+}
+
+// Enabled returns true if any token source is configured
+func (o AuthOptions) Enabled() bool {
+	return o.TokensFile != "" || len(o.TokenHashes) > 0
+}
+
+// tokenStore holds SHA-256 digests of accepted bearer tokens mapped to identity names.
+// Plaintext tokens from the tokens file are hashed on load and never kept in memory.
+type tokenStore struct {
+	file   string
+	static map[[sha256.Size]byte]string
+	logger *slog.Logger
+
+	mu      sync.RWMutex
+	tokens  map[[sha256.Size]byte]string
+	fileMod time.Time
+}
+
+// newTokenStore parses the inline token hashes and loads the tokens file, if any
+func newTokenStore(opts AuthOptions, logger *slog.Logger) (*tokenStore, error) {
+	static := make(map[[sha256.Size]byte]string)
+	for _, entry := range opts.TokenHashes {
+		name, digest, err := parseTokenEntry(entry, true)
+		if err != nil {
+			return nil, err
+		}
+		static[digest] = name
+	}
+
+	s := &tokenStore{
+		file:   opts.TokensFile,
+		static: static,
+		logger: logger,
+		tokens: static,
+	}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// parseTokenEntry parses "name:token" or "name:sha256:<hex>" into an identity name and token digest.
+// When hashedOnly is set, plaintext tokens are rejected.
+func parseTokenEntry(entry string, hashedOnly bool) (string, [sha256.Size]byte, error) {
+	var digest [sha256.Size]byte
+
+	name, secret, ok := strings.Cut(strings.TrimSpace(entry), ":")
+	if !ok || name == "" || secret == "" {
+		return "", digest, fmt.Errorf("invalid token entry for %q: expected name:token or name:sha256:<hex>", name)
+	}
+
+	if hashHex, isHash := strings.CutPrefix(secret, "sha256:"); isHash {
+		decoded, err := hex.DecodeString(hashHex)
+		if err != nil || len(decoded) != sha256.Size {
+			return "", digest, fmt.Errorf("invalid sha256 token hash for %q", name)
+		}
+		copy(digest[:], decoded)
+		return name, digest, nil
+	}
+
+	if hashedOnly {
+		return "", digest, fmt.Errorf("token for %q must be a sha256:<hex> hash", name)
+	}
+	return name, sha256.Sum256([]byte(secret)), nil
+}
+
+// Reload re-reads the tokens file and merges it with the inline token hashes.
+// On failure the previously loaded tokens stay in use.
+func (s *tokenStore) Reload() error {
+	if s.file == "" {
+		return nil
+	}
+
+	info, err := os.Stat(s.file)
+	if err != nil {
+		return fmt.Errorf("failed to stat tokens file: %w", err)
+	}
+	data, err := os.ReadFile(s.file)
+	if err != nil {
+		return fmt.Errorf("failed to read tokens file: %w", err)
+	}
+
+	tokens := make(map[[sha256.Size]byte]string, len(s.static))
+	for digest, name := range s.static {
+		tokens[digest] = name
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, digest, err := parseTokenEntry(line, false)
+		if err != nil {
+			return fmt.Errorf("tokens file line %d: %w", lineNum, err)
+		}
+		tokens[digest] = name
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to parse tokens file: %w", err)
+	}
+
+	s.mu.Lock()
+	s.tokens = tokens
+	s.fileMod = info.ModTime()
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Authenticate returns the identity name for a bearer token
+func (s *tokenStore) Authenticate(token string) (string, bool) {
+	digest := sha256.Sum256([]byte(token))
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	name, ok := s.tokens[digest]
+	return name, ok
+}
+
+// reloadIfChanged reloads the tokens file when its modification time changed
+func (s *tokenStore) reloadIfChanged(ctx context.Context) {
+	info, err := os.Stat(s.file)
+	if err != nil {
+		s.logger.WarnContext(ctx,
+			fmt.Sprintf("failed to check tokens file [error=%s]", err.Error()),
+			slog.String("error", err.Error()))
+		return
+	}
+
+	s.mu.RLock()
+	unchanged := info.ModTime().Equal(s.fileMod)
+	s.mu.RUnlock()
+	if unchanged {
+		return
+	}
+
+	if err := s.Reload(); err != nil {
+		s.logger.WarnContext(ctx,
+			fmt.Sprintf("failed to reload tokens file, keeping previous tokens [error=%s]", err.Error()),
+			slog.String("error", err.Error()))
+		return
+	}
+
+	s.logger.InfoContext(ctx,
+		fmt.Sprintf("auth tokens reloaded [tokens_file=%s]", s.file),
+		slog.String("tokens_file", s.file))
+}
+
+// watch polls the tokens file until the context is cancelled
+func (s *tokenStore) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.reloadIfChanged(ctx)
+		}
+	}
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer" header
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// TokenAuthMiddleware attaches the identity of a valid bearer token to the request context.
+// It never rejects requests itself; route groups enforce authentication with RequireAuthMiddleware.
+func TokenAuthMiddleware(tokens *tokenStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token, ok := bearerToken(r); ok {
+				if name, valid := tokens.Authenticate(token); valid {
+					r = r.WithContext(WithIdentity(r.Context(), &Identity{Name: name, Method: "token"}))
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireAuthMiddleware rejects requests without an authenticated identity with 401
+func RequireAuthMiddleware(routeGroup string, m *metrics.Metrics, logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := IdentityFromContext(r.Context()); ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			reason := "missing_credentials"
+			if _, hasToken := bearerToken(r); hasToken {
+				reason = "invalid_token"
+			}
+
+			m.RecordAuthFailure(routeGroup, reason)
+
+			requestID := middleware.GetReqID(r.Context())
+			logger.WarnContext(r.Context(),
+				fmt.Sprintf("authentication failed [request_id=%s route_group=%s reason=%s remote_addr=%s]",
+					requestID, routeGroup, reason, r.RemoteAddr),
+				slog.String("request_id", requestID),
+				slog.String("route_group", routeGroup),
+				slog.String("reason", reason),
+				slog.String("remote_addr", r.RemoteAddr),
+			)
+
+			w.Header().Set("WWW-Authenticate", `Bearer realm="specular"`)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error":"unauthorized"}`)
+		})
+	}
+}
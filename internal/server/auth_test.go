@@ -0,0 +1,265 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func sha256Entry(name, token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return name + ":sha256:" + hex.EncodeToString(sum[:])
+}
+
+// newAuthTestServer creates a server with the given auth options and returns its handler
+func newAuthTestServer(t *testing.T, auth AuthOptions) (*Server, http.Handler) {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	srv, err := New("127.0.0.1", 0, time.Second, time.Second,
+		createTestMirror([]byte(`{"versions":{}}`), nil, nil, nil, nil, nil), metricsForTests(), logger,
+		Options{Auth: auth})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return srv, srv.httpServer.Handler
+}
+
+func doRequest(handler http.Handler, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestParseTokenEntry(t *testing.T) {
+	tests := []struct {
+		name       string
+		entry      string
+		hashedOnly bool
+		wantName   string
+		wantErr    bool
+	}{
+		{name: "plaintext", entry: "ci:secret-token", wantName: "ci"},
+		{name: "hashed", entry: sha256Entry("platform", "secret"), hashedOnly: true, wantName: "platform"},
+		{name: "plaintext when hashed only", entry: "ci:secret-token", hashedOnly: true, wantErr: true},
+		{name: "missing secret", entry: "ci:", wantErr: true},
+		{name: "missing name", entry: ":secret", wantErr: true},
+		{name: "bad hash", entry: "ci:sha256:nothex", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, _, err := parseTokenEntry(tt.entry, tt.hashedOnly)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTokenEntry(%q) error = %v, wantErr %v", tt.entry, err, tt.wantErr)
+			}
+			if name != tt.wantName {
+				t.Errorf("parseTokenEntry(%q) name = %q, want %q", tt.entry, name, tt.wantName)
+			}
+		})
+	}
+}
+
+// TestAuth_ProtectedRouteGroups tests that only configured route groups require a token
+func TestAuth_ProtectedRouteGroups(t *testing.T) {
+	_, handler := newAuthTestServer(t, AuthOptions{
+		TokenHashes:     []string{sha256Entry("platform", "platform-token")},
+		ProtectedRoutes: []string{RouteGroupProviders, RouteGroupMetrics},
+	})
+
+	if w := doRequest(handler, "/health", ""); w.Code != http.StatusOK {
+		t.Errorf("expected open /health to return 200, got %d", w.Code)
+	}
+
+	for _, path := range []string{"/metrics", "/terraform/providers/registry.terraform.io/hashicorp/aws/index.json"} {
+		w := doRequest(handler, path, "")
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("expected %s without token to return 401, got %d", path, w.Code)
+		}
+		if got := w.Header().Get("WWW-Authenticate"); got == "" {
+			t.Errorf("expected WWW-Authenticate header on %s", path)
+		}
+
+		if w := doRequest(handler, path, "wrong-token"); w.Code != http.StatusUnauthorized {
+			t.Errorf("expected %s with invalid token to return 401, got %d", path, w.Code)
+		}
+
+		if w := doRequest(handler, path, "platform-token"); w.Code != http.StatusOK {
+			t.Errorf("expected %s with valid token to return 200, got %d", path, w.Code)
+		}
+	}
+}
+
+// TestAuth_TokenIdentity tests that a valid token sets the request identity
+func TestAuth_TokenIdentity(t *testing.T) {
+	store, err := newTokenStore(AuthOptions{TokenHashes: []string{sha256Entry("team-a", "team-a-token")}},
+		slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("newTokenStore failed: %v", err)
+	}
+
+	var got *Identity
+	handler := TokenAuthMiddleware(store)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = IdentityFromContext(r.Context())
+	}))
+	doRequest(handler, "/", "team-a-token")
+
+	if got == nil || got.Name != "team-a" || got.Method != "token" {
+		t.Errorf("unexpected identity: %+v", got)
+	}
+}
+
+// TestAuth_ReloadTokensFile tests that the tokens file is reloaded without restarting
+func TestAuth_ReloadTokensFile(t *testing.T) {
+	tokensFile := filepath.Join(t.TempDir(), "tokens")
+	if err := os.WriteFile(tokensFile, []byte("# CI runners\nci:old-token\n"), 0600); err != nil {
+		t.Fatalf("failed to write tokens file: %v", err)
+	}
+
+	srv, handler := newAuthTestServer(t, AuthOptions{
+		TokensFile:      tokensFile,
+		ProtectedRoutes: []string{RouteGroupMetrics},
+	})
+
+	if w := doRequest(handler, "/metrics", "old-token"); w.Code != http.StatusOK {
+		t.Fatalf("expected old token to be accepted, got %d", w.Code)
+	}
+
+	if err := os.WriteFile(tokensFile, []byte(sha256Entry("ci", "new-token")+"\n"), 0600); err != nil {
+		t.Fatalf("failed to rewrite tokens file: %v", err)
+	}
+	if err := srv.ReloadAuth(); err != nil {
+		t.Fatalf("ReloadAuth failed: %v", err)
+	}
+
+	if w := doRequest(handler, "/metrics", "old-token"); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected old token to be rejected after reload, got %d", w.Code)
+	}
+	if w := doRequest(handler, "/metrics", "new-token"); w.Code != http.StatusOK {
+		t.Errorf("expected new token to be accepted after reload, got %d", w.Code)
+	}
+}
+
+// TestAuth_InvalidTokensFile tests that a malformed reload keeps the previous tokens
+func TestAuth_InvalidTokensFile(t *testing.T) {
+	tokensFile := filepath.Join(t.TempDir(), "tokens")
+	os.WriteFile(tokensFile, []byte("ci:token\n"), 0600)
+
+	store, err := newTokenStore(AuthOptions{TokensFile: tokensFile}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("newTokenStore failed: %v", err)
+	}
+
+	os.WriteFile(tokensFile, []byte("garbage-without-separator\n"), 0600)
+	if err := store.Reload(); err == nil {
+		t.Fatal("expected error for malformed tokens file")
+	}
+
+	if _, ok := store.Authenticate("token"); !ok {
+		t.Error("expected previous token to remain valid")
+	}
+}
+
+// TestAuthorization_ProviderScopes tests that the policy is enforced before the mirror is called
+func TestAuthorization_ProviderScopes(t *testing.T) {
+	policyFile := filepath.Join(t.TempDir(), "policy.json")
+	policy := `{"rules":[
+		{"identities":["team-a"],"actions":["providers"],"providers":["hashicorp/*"]},
+		{"identities":["platform"],"actions":["*"]}
+	]}`
+	if err := os.WriteFile(policyFile, []byte(policy), 0600); err != nil {
+		t.Fatalf("failed to write policy: %v", err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	// Storage errors would surface as 500, so a 403 proves the mirror was never consulted
+	srv, err := New("127.0.0.1", 0, time.Second, time.Second,
+		createTestMirror(nil, errors.New("mirror must not be called"), nil, nil, nil, nil), metricsForTests(), logger,
+		Options{
+			Auth: AuthOptions{
+				TokenHashes:     []string{sha256Entry("team-a", "team-a-token"), sha256Entry("platform", "platform-token")},
+				ProtectedRoutes: []string{RouteGroupProviders},
+			},
+			AuthzPolicyFile: policyFile,
+		})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	handler := srv.httpServer.Handler
+
+	w := doRequest(handler, "/terraform/providers/registry.terraform.io/community/thing/index.json", "team-a-token")
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for provider outside scope, got %d", w.Code)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if body["reason"] != `identity "team-a" is not allowed to access provider registry.terraform.io/community/thing` {
+		t.Errorf("unexpected reason: %q", body["reason"])
+	}
+
+	w = doRequest(handler, "/terraform/providers/download/registry.terraform.io/community/thing/1.0.0/linux/amd64/thing.zip", "team-a-token")
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for archive outside scope, got %d", w.Code)
+	}
+
+	if w := doRequest(handler, "/metrics", "team-a-token"); w.Code != http.StatusForbidden {
+		t.Errorf("expected team-a to be denied metrics, got %d", w.Code)
+	}
+	if w := doRequest(handler, "/metrics", "platform-token"); w.Code != http.StatusOK {
+		t.Errorf("expected platform to scrape metrics, got %d", w.Code)
+	}
+}
+
+// TestAuthorization_NonCanonicalHostnames tests that other spellings of a registry hostname are
+// rejected before authorization, so scopes written for the canonical hostname cannot be bypassed
+func TestAuthorization_NonCanonicalHostnames(t *testing.T) {
+	policyFile := filepath.Join(t.TempDir(), "policy.json")
+	policy := `{"rules":[{"identities":["team-a"],"actions":["providers"],"providers":["example.com/*/*"]}]}`
+	if err := os.WriteFile(policyFile, []byte(policy), 0600); err != nil {
+		t.Fatalf("failed to write policy: %v", err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	srv, err := New("127.0.0.1", 0, time.Second, time.Second,
+		createTestMirror(nil, errors.New("mirror must not be called"), nil, nil, nil, nil), metricsForTests(), logger,
+		Options{
+			Auth: AuthOptions{
+				TokenHashes:     []string{sha256Entry("team-a", "team-a-token")},
+				ProtectedRoutes: []string{RouteGroupProviders},
+			},
+			AuthzPolicyFile: policyFile,
+		})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	handler := srv.httpServer.Handler
+
+	for _, hostname := range []string{"registry.terraform.io:443", "%EF%BD%92egistry.terraform.io", "ｒegistry.terraform.io"} {
+		w := doRequest(handler, "/terraform/providers/"+hostname+"/hashicorp/template/index.json", "team-a-token")
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", hostname, w.Code)
+		}
+		w = doRequest(handler, "/terraform/providers/download/"+hostname+"/hashicorp/template/1.0.0/linux/amd64/t.zip", "team-a-token")
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400 for archive, got %d", hostname, w.Code)
+		}
+	}
+
+	if w := doRequest(handler, "/terraform/providers/registry.terraform.io/hashicorp/template/index.json", "team-a-token"); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for the canonical hostname, got %d", w.Code)
+	}
+}
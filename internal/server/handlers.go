@@ -1,24 +1,44 @@
 package server
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/elisiariocouto/specular/internal/audit"
+	"github.com/elisiariocouto/specular/internal/authz"
+	"github.com/elisiariocouto/specular/internal/loadshed"
 	"github.com/elisiariocouto/specular/internal/metrics"
 	"github.com/elisiariocouto/specular/internal/mirror"
+	"github.com/elisiariocouto/specular/internal/tracing"
 	"github.com/go-chi/chi/v5"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
 // Handlers holds dependencies for HTTP handlers
 type Handlers struct {
-	mirror  *mirror.Mirror
-	metrics *metrics.Metrics
-	logger  *slog.Logger
+	mirror     *mirror.Mirror
+	metrics    *metrics.Metrics
+	logger     *slog.Logger
+	authorizer *authz.Authorizer // nil disables authorization checks
+	auditLog   *audit.Log        // nil disables the audit log
+
+	// adminIdentities may use the admin API when no authorizer is configured
+	adminIdentities map[string]bool
+
+	// trustedProxies are the proxies whose X-Forwarded-For header identifies audited clients
+	trustedProxies []*net.IPNet
 }
 
 // NewHandlers creates a new handlers instance
@@ -38,61 +58,301 @@ func writeJSONResponse(w http.ResponseWriter, data []byte, cacheMaxAge string) e
 	return err
 }
 
+// checkHostname rejects hostnames that are not in canonical form before any policy is consulted,
+// since other spellings of a registry would slip past rules written for the canonical one
+// It writes a 400 response and returns false for such hostnames
+func (h *Handlers) checkHostname(w http.ResponseWriter, r *http.Request, hostname string) bool {
+	err := mirror.CheckHostname(hostname)
+	if err == nil {
+		return true
+	}
+
+	h.logger.WarnContext(r.Context(),
+		fmt.Sprintf("non-canonical hostname rejected [hostname=%s error=%s]", hostname, err.Error()),
+		slog.String("hostname", hostname),
+		slog.String("error", err.Error()))
+	body, _ := json.Marshal(map[string]string{"error": "invalid provider address", "reason": err.Error()})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write(body)
+	return false
+}
+
+// authorize checks the request identity against the authorization policy before any mirror access
+// Without a policy every action is allowed except admin, which needs a configured admin identity
+// It writes a 403 response and returns false when the action is denied
+func (h *Handlers) authorize(w http.ResponseWriter, r *http.Request, action string, resource authz.Resource) bool {
+	if h.authorizer == nil && action != authz.ActionAdmin {
+		return true
+	}
+
+	identity := ""
+	if id, ok := IdentityFromContext(r.Context()); ok {
+		identity = id.Name
+	}
+
+	var decision authz.Decision
+	if h.authorizer != nil {
+		decision = h.authorizer.Authorize(identity, action, resource)
+	} else if identity != "" && h.adminIdentities[identity] {
+		decision = authz.Decision{Allowed: true, Reason: fmt.Sprintf("identity %q is an admin identity", identity)}
+	} else {
+		decision = authz.Decision{Reason: fmt.Sprintf("identity %q is not an admin identity and no authorization policy is configured", identity)}
+	}
+	logAttrs := []any{
+		slog.String("identity", identity),
+		slog.String("action", action),
+		slog.String("resource", resource.String()),
+		slog.Bool("allowed", decision.Allowed),
+		slog.String("reason", decision.Reason),
+	}
+
+	if decision.Allowed {
+		h.logger.DebugContext(r.Context(),
+			fmt.Sprintf("authorization allowed [identity=%s action=%s resource=%s reason=%s]", identity, action, resource, decision.Reason),
+			logAttrs...)
+		return true
+	}
+
+	h.metrics.RecordAuthzDenial(action)
+	h.logger.WarnContext(r.Context(),
+		fmt.Sprintf("authorization denied [identity=%s action=%s resource=%s reason=%s]", identity, action, resource, decision.Reason),
+		logAttrs...)
+
+	body, _ := json.Marshal(map[string]string{"error": "forbidden", "reason": decision.Reason})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	w.Write(body)
+	return false
+}
+
+// allowProvider runs the hostname and authorization checks of a provider request
+// Refused requests never reach handleRequest, so they are audited here
+func (h *Handlers) allowProvider(w http.ResponseWriter, r *http.Request, resourceType string, logAttrs []slog.Attr) bool {
+	resource := providerResource(r)
+	wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+	if h.checkHostname(wrapped, r, resource.Hostname) && h.authorize(wrapped, r, authz.ActionProviders, resource) {
+		return true
+	}
+	h.recordAudit(r.Context(), r, resourceType, logAttrs, "", wrapped.statusCode)
+	return false
+}
+
 // handleRequest is a helper that handles the common request/error/metrics pattern
 // It takes a fetch function that retrieves the data and a write function that writes the response
+// to the writer it is given, so the bytes served can be counted
+// The request is traced, continuing any W3C trace context sent by the client, and fetchData
+// receives the span's context
 func (h *Handlers) handleRequest(
 	w http.ResponseWriter,
 	r *http.Request,
 	resourceType string,
 	logAttrs []slog.Attr,
-	fetchData func() (any, error),
-	writeResponse func(any) error,
+	fetchData func(ctx context.Context) (any, error),
+	writeResponse func(w http.ResponseWriter, data any) error,
 ) {
-	// Convert attrs to both message parts and structured fields
+	// Convert attrs to message parts, structured fields and span attributes
 	attrs := make([]any, len(logAttrs))
 	msgParts := make([]string, 0, len(logAttrs))
+	spanAttrs := make([]attribute.KeyValue, 0, len(logAttrs)+1)
 	for i, attr := range logAttrs {
 		attrs[i] = attr
 		msgParts = append(msgParts, fmt.Sprintf("%s=%v", attr.Key, attr.Value))
+		spanAttrs = append(spanAttrs, attribute.String("specular.provider."+attr.Key, attr.Value.String()))
 	}
+	spanAttrs = append(spanAttrs, attribute.String("specular.resource", resourceType))
+
+	ctx, span := tracing.StartServer(r, r.Method+" "+resourceType, spanAttrs...)
+	wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+	w = wrapped
+	var cacheStatus mirror.CacheStatus
+	defer func() {
+		h.recordAudit(ctx, r, resourceType, logAttrs, cacheStatus, wrapped.statusCode)
+		span.SetAttributes(attribute.Int("http.response.status_code", wrapped.statusCode))
+		if wrapped.statusCode >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(wrapped.statusCode))
+		}
+		span.End()
+	}()
 	enrichedMsg := fmt.Sprintf("%s request [%s]", resourceType, strings.Join(msgParts, " "))
 
 	// Log request
-	h.logger.InfoContext(r.Context(), enrichedMsg, attrs...)
+	h.logger.InfoContext(ctx, enrichedMsg, attrs...)
 
-	// Fetch data and measure duration
+	// Fetch data, collecting how the mirror satisfied the request
+	ctx, cacheReport := mirror.WithCacheReport(ctx)
 	start := time.Now()
-	data, err := fetchData()
+	data, err := fetchData(ctx)
 	duration := time.Since(start).Seconds()
+	cacheStatus = cacheReport.Status()
+	if cacheStatus != "" {
+		span.SetAttributes(attribute.String("specular.cache.status", string(cacheStatus)))
+	}
 
 	// Handle errors
 	if err != nil {
+		span.RecordError(err)
+
+		if errors.Is(err, mirror.ErrForbidden) {
+			h.metrics.RecordPolicyDenial(resourceType)
+			deniedMsg := fmt.Sprintf("%s denied by provider policy [%s error=%s]", resourceType, strings.Join(msgParts, " "), err.Error())
+			h.logger.WarnContext(ctx, deniedMsg,
+				append(attrs, slog.String("error", err.Error()))...)
+			body, _ := json.Marshal(map[string]string{"error": "forbidden", "reason": err.Error()})
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			w.Write(body)
+			return
+		}
+
+		if errors.Is(err, mirror.ErrInvalidAddress) {
+			body, _ := json.Marshal(map[string]string{"error": "invalid provider address", "reason": err.Error()})
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(body)
+			return
+		}
+
+		if errors.Is(err, mirror.ErrUpstreamBlocked) {
+			blockedMsg := fmt.Sprintf("%s upstream request blocked [%s error=%s]", resourceType, strings.Join(msgParts, " "), err.Error())
+			h.logger.WarnContext(ctx, blockedMsg,
+				append(attrs, slog.String("error", err.Error()))...)
+			body, _ := json.Marshal(map[string]string{"error": "forbidden", "reason": err.Error()})
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			w.Write(body)
+			return
+		}
+
+		if errors.Is(err, loadshed.ErrOverloaded) {
+			writeOverloaded(w, r, err, h.metrics, h.logger)
+			return
+		}
+
+		if errors.Is(err, mirror.ErrCircuitOpen) {
+			retryAfter := 1
+			var circuitErr *mirror.CircuitOpenError
+			if errors.As(err, &circuitErr) {
+				retryAfter = max(1, int(math.Ceil(circuitErr.RetryAfter.Seconds())))
+			}
+			unavailableMsg := fmt.Sprintf("%s upstream unavailable [%s error=%s]", resourceType, strings.Join(msgParts, " "), err.Error())
+			h.logger.WarnContext(ctx, unavailableMsg,
+				append(attrs, slog.String("error", err.Error()))...)
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, `{"error":"upstream unavailable"}`)
+			return
+		}
+
 		if err == mirror.ErrNotFound || err == io.EOF {
-			h.metrics.RecordCacheMiss(resourceType)
+			h.recordCacheStatus(resourceType, cacheStatus)
 			notFoundMsg := fmt.Sprintf("%s not found [%s]", resourceType, strings.Join(msgParts, " "))
-			h.logger.InfoContext(r.Context(), notFoundMsg, attrs...)
+			h.logger.InfoContext(ctx, notFoundMsg, attrs...)
 			http.NotFound(w, r)
 			return
 		}
 
 		h.metrics.RecordError(resourceType+"_handler", "fetch_failed")
 		errMsg := fmt.Sprintf("failed to get %s [%s error=%s]", resourceType, strings.Join(msgParts, " "), err.Error())
-		h.logger.ErrorContext(r.Context(), errMsg,
+		h.logger.ErrorContext(ctx, errMsg,
 			append(attrs, slog.String("error", err.Error()))...)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	// Record success metrics
-	h.metrics.RecordCacheHit(resourceType)
-	h.metrics.RecordUpstreamRequest(http.StatusOK, duration, resourceType)
+	// Record cache metrics and tell the client how the response was produced
+	h.recordCacheStatus(resourceType, cacheStatus)
+	if cacheStatus != "" && !cacheStatus.Hit() {
+		h.metrics.RecordUpstreamFetch(resourceType, duration)
+	}
+	setCacheHeaders(w, cacheStatus)
 
 	// Write response
-	if err := writeResponse(data); err != nil {
-		h.logger.ErrorContext(r.Context(),
+	if err := writeResponse(w, data); err != nil {
+		h.logger.ErrorContext(ctx,
 			fmt.Sprintf("failed to write response [error=%s]", err.Error()),
 			slog.String("error", err.Error()))
 	}
+	h.mirror.RecordServed(chi.URLParam(r, "hostname"), chi.URLParam(r, "namespace"), chi.URLParam(r, "type"),
+		cacheStatus, wrapped.responseSize)
+}
+
+// recordAudit appends a served, refused or failed provider request to the audit log
+func (h *Handlers) recordAudit(ctx context.Context, r *http.Request, resourceType string, logAttrs []slog.Attr, cacheStatus mirror.CacheStatus, status int) {
+	if h.auditLog == nil {
+		return
+	}
+
+	entry := audit.Entry{
+		Time:        time.Now().UTC(),
+		ClientIP:    clientIP(r, h.trustedProxies),
+		Resource:    resourceType,
+		CacheStatus: string(cacheStatus),
+		Status:      status,
+	}
+	if id, ok := IdentityFromContext(r.Context()); ok {
+		entry.Identity = id.Name
+	}
+	for _, attr := range logAttrs {
+		switch attr.Key {
+		case "hostname":
+			entry.Hostname = attr.Value.String()
+		case "namespace":
+			entry.Namespace = attr.Value.String()
+		case "type":
+			entry.Type = attr.Value.String()
+		case "version":
+			entry.Version = attr.Value.String()
+		case "os":
+			entry.OS = attr.Value.String()
+		case "arch":
+			entry.Arch = attr.Value.String()
+		}
+	}
+
+	if err := h.auditLog.Record(entry); err != nil {
+		h.metrics.RecordError("audit", "write_failed")
+		h.logger.WarnContext(ctx,
+			fmt.Sprintf("failed to write audit entry [error=%s]", err.Error()),
+			slog.String("error", err.Error()))
+	}
+}
+
+// recordCacheStatus counts a request the mirror answered from its cache or upstream
+// Requests rejected before the cache was consulted report no status and are not counted
+func (h *Handlers) recordCacheStatus(resourceType string, status mirror.CacheStatus) {
+	if status == "" {
+		return
+	}
+	h.metrics.RecordCacheStatus(resourceType, string(status), status.Hit())
+}
+
+// setCacheHeaders sets X-Cache and an RFC 9211 Cache-Status header describing how the mirror
+// satisfied the request
+func setCacheHeaders(w http.ResponseWriter, status mirror.CacheStatus) {
+	var cacheStatus string
+	switch status {
+	case mirror.CacheHit:
+		cacheStatus = "specular; hit"
+	case mirror.CacheStale:
+		cacheStatus = "specular; hit; detail=stale"
+	case mirror.CacheBuilt:
+		cacheStatus = "specular; hit; detail=built"
+	case mirror.CacheMiss:
+		cacheStatus = "specular; fwd=uri-miss; stored"
+	case mirror.CacheCoalesced:
+		cacheStatus = "specular; fwd=uri-miss; collapsed"
+	default:
+		return
+	}
+
+	xCache := "MISS"
+	if status.Hit() {
+		xCache = "HIT"
+	}
+	w.Header().Set("X-Cache", xCache)
+	w.Header().Set("Cache-Status", cacheStatus)
 }
 
 // MetadataHandler handles index.json, version.json, and archive requests
@@ -128,16 +388,20 @@ func (h *Handlers) IndexHandler(w http.ResponseWriter, r *http.Request) {
 	namespace := chi.URLParam(r, "namespace")
 	providerType := chi.URLParam(r, "type")
 
-	h.handleRequest(w, r, "index",
-		[]slog.Attr{
-			slog.String("hostname", hostname),
-			slog.String("namespace", namespace),
-			slog.String("type", providerType),
-		},
-		func() (any, error) {
-			return h.mirror.GetIndex(r.Context(), hostname, namespace, providerType)
+	logAttrs := []slog.Attr{
+		slog.String("hostname", hostname),
+		slog.String("namespace", namespace),
+		slog.String("type", providerType),
+	}
+	if !h.allowProvider(w, r, "index", logAttrs) {
+		return
+	}
+
+	h.handleRequest(w, r, "index", logAttrs,
+		func(ctx context.Context) (any, error) {
+			return h.mirror.GetIndex(ctx, hostname, namespace, providerType)
 		},
-		func(data any) error {
+		func(w http.ResponseWriter, data any) error {
 			return writeJSONResponse(w, data.([]byte), "public, max-age=300")
 		},
 	)
@@ -149,17 +413,21 @@ func (h *Handlers) VersionHandlerWithParams(w http.ResponseWriter, r *http.Reque
 	namespace := chi.URLParam(r, "namespace")
 	providerType := chi.URLParam(r, "type")
 
-	h.handleRequest(w, r, "version",
-		[]slog.Attr{
-			slog.String("hostname", hostname),
-			slog.String("namespace", namespace),
-			slog.String("type", providerType),
-			slog.String("version", version),
-		},
-		func() (any, error) {
-			return h.mirror.GetVersion(r.Context(), hostname, namespace, providerType, version)
+	logAttrs := []slog.Attr{
+		slog.String("hostname", hostname),
+		slog.String("namespace", namespace),
+		slog.String("type", providerType),
+		slog.String("version", version),
+	}
+	if !h.allowProvider(w, r, "version", logAttrs) {
+		return
+	}
+
+	h.handleRequest(w, r, "version", logAttrs,
+		func(ctx context.Context) (any, error) {
+			return h.mirror.GetVersion(ctx, hostname, namespace, providerType, version)
 		},
-		func(data any) error {
+		func(w http.ResponseWriter, data any) error {
 			return writeJSONResponse(w, data.([]byte), "public, max-age=300")
 		},
 	)
@@ -177,23 +445,24 @@ func (h *Handlers) DownloadHandler(w http.ResponseWriter, r *http.Request) {
 	arch := chi.URLParam(r, "arch")
 	filename := chi.URLParam(r, "filename")
 
-	// Construct cache path
-	archivePath := fmt.Sprintf("%s/%s/%s/%s", hostname, namespace, providerType, filename)
-
-	h.handleRequest(w, r, "archive",
-		[]slog.Attr{
-			slog.String("hostname", hostname),
-			slog.String("namespace", namespace),
-			slog.String("type", providerType),
-			slog.String("version", version),
-			slog.String("os", os),
-			slog.String("arch", arch),
-			slog.String("filename", filename),
-		},
-		func() (any, error) {
-			return h.mirror.GetArchive(r.Context(), hostname, namespace, providerType, version, os, arch, archivePath)
+	logAttrs := []slog.Attr{
+		slog.String("hostname", hostname),
+		slog.String("namespace", namespace),
+		slog.String("type", providerType),
+		slog.String("version", version),
+		slog.String("os", os),
+		slog.String("arch", arch),
+		slog.String("filename", filename),
+	}
+	if !h.allowProvider(w, r, "archive", logAttrs) {
+		return
+	}
+
+	h.handleRequest(w, r, "archive", logAttrs,
+		func(ctx context.Context) (any, error) {
+			return h.mirror.GetArchive(ctx, hostname, namespace, providerType, version, os, arch)
 		},
-		func(data any) error {
+		func(w http.ResponseWriter, data any) error {
 			reader := data.(io.ReadCloser)
 			defer reader.Close()
 
@@ -222,6 +491,9 @@ func (h *Handlers) MetricsHandler() http.Handler {
 			http.NotFound(w, r)
 			return
 		}
+		if !h.authorize(w, r, authz.ActionMetrics, authz.Resource{}) {
+			return
+		}
 		promhttp.Handler().ServeHTTP(w, r)
 	})
 }
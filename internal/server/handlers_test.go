@@ -9,11 +9,15 @@ import (
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/elisiariocouto/specular/internal/metrics"
 	"github.com/elisiariocouto/specular/internal/mirror"
+	"github.com/elisiariocouto/specular/internal/storage"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -97,9 +101,9 @@ func createTestMirror(indexData []byte, indexErr error, versionData []byte, vers
 
 	// Create an upstream client that will return the configured errors
 	upstreamLogger := slog.New(slog.NewTextHandler(io.Discard, nil))
-	upstreamClient := mirror.NewUpstreamClient(30, 2, 1, upstreamLogger)
+	upstreamClient, _ := mirror.NewUpstreamClient(30, 2, 1, upstreamLogger, mirror.UpstreamOptions{})
 
-	return mirror.NewMirror(storage, upstreamClient, "http://localhost:8080", 0)
+	return mirror.NewMirror(storage, upstreamClient, "http://localhost:8080", 0, mirror.Options{})
 }
 
 // TestIndexHandler_Success tests successful index request
@@ -130,11 +134,46 @@ func TestIndexHandler_Success(t *testing.T) {
 		t.Errorf("expected Cache-Control public, max-age=300, got %s", cc)
 	}
 
+	if xc := w.Header().Get("X-Cache"); xc != "HIT" {
+		t.Errorf("expected X-Cache HIT, got %s", xc)
+	}
+
+	if cs := w.Header().Get("Cache-Status"); cs != "specular; hit" {
+		t.Errorf("expected Cache-Status specular; hit, got %s", cs)
+	}
+
 	if !bytes.Equal(w.Body.Bytes(), indexData) {
 		t.Errorf("expected body %q, got %q", indexData, w.Body.Bytes())
 	}
 }
 
+// TestSetCacheHeaders tests the X-Cache and Cache-Status headers for each cache status
+func TestSetCacheHeaders(t *testing.T) {
+	tests := []struct {
+		status      mirror.CacheStatus
+		xCache      string
+		cacheStatus string
+	}{
+		{mirror.CacheHit, "HIT", "specular; hit"},
+		{mirror.CacheStale, "HIT", "specular; hit; detail=stale"},
+		{mirror.CacheBuilt, "HIT", "specular; hit; detail=built"},
+		{mirror.CacheMiss, "MISS", "specular; fwd=uri-miss; stored"},
+		{mirror.CacheCoalesced, "MISS", "specular; fwd=uri-miss; collapsed"},
+		{"", "", ""},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		setCacheHeaders(w, tt.status)
+		if got := w.Header().Get("X-Cache"); got != tt.xCache {
+			t.Errorf("status %q: X-Cache = %q, want %q", tt.status, got, tt.xCache)
+		}
+		if got := w.Header().Get("Cache-Status"); got != tt.cacheStatus {
+			t.Errorf("status %q: Cache-Status = %q, want %q", tt.status, got, tt.cacheStatus)
+		}
+	}
+}
+
 // TestIndexHandler_NotFound tests when index is not found
 func TestIndexHandler_NotFound(t *testing.T) {
 	testMirror := createTestMirror(nil, mirror.ErrNotFound, nil, nil, nil, nil)
@@ -324,6 +363,111 @@ func TestDownloadHandler_NotFound(t *testing.T) {
 	}
 }
 
+// serveCachedArchive requests path from a mirror over store, whose upstream cannot be reached
+func serveCachedArchive(t *testing.T, store *storage.MemoryStorage, opts mirror.Options, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	upstreamClient, _ := mirror.NewUpstreamClient(30, 0, 1, logger, mirror.UpstreamOptions{})
+	m := mirror.NewMirror(store, upstreamClient, "http://localhost:8080", 0, opts)
+	defer m.Shutdown()
+
+	router := chi.NewRouter()
+	router.Get("/terraform/providers/download/{hostname}/{namespace}/{type}/{version}/{os}/{arch}/{filename}",
+		NewHandlers(m, metricsForTests(), logger).DownloadHandler)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	return w
+}
+
+// cacheArchive stores an archive under the path the mirror caches it at
+func cacheArchive(t *testing.T, store *storage.MemoryStorage, filename, content string) {
+	t.Helper()
+	if err := store.PutArchive(context.Background(), "registry.terraform.io/hashicorp/aws/"+filename, strings.NewReader(content)); err != nil {
+		t.Fatalf("PutArchive failed: %v", err)
+	}
+}
+
+// TestDownloadHandler_FilenameCannotReachDeniedVersion tests that the file name in a download URL
+// cannot serve the cached archive of a version the policy denies
+func TestDownloadHandler_FilenameCannotReachDeniedVersion(t *testing.T) {
+	policyFile := filepath.Join(t.TempDir(), "providers.json")
+	if err := os.WriteFile(policyFile, []byte(`{"versions":[{"provider":"hashicorp/aws","constraint":"< 6.0"}]}`), 0600); err != nil {
+		t.Fatalf("failed to write policy: %v", err)
+	}
+	policy, err := mirror.LoadProviderPolicy(policyFile)
+	if err != nil {
+		t.Fatalf("LoadProviderPolicy failed: %v", err)
+	}
+
+	store := storage.NewMemoryStorage()
+	cacheArchive(t, store, "terraform-provider-aws_6.0.0_linux_amd64.zip", "denied archive")
+
+	w := serveCachedArchive(t, store, mirror.Options{Policy: policy},
+		"/terraform/providers/download/registry.terraform.io/hashicorp/aws/5.0.0/linux/amd64/terraform-provider-aws_6.0.0_linux_amd64.zip")
+	if w.Code == http.StatusOK || strings.Contains(w.Body.String(), "denied archive") {
+		t.Errorf("expected denied archive to stay unreachable, got %d: %q", w.Code, w.Body.String())
+	}
+
+	w = serveCachedArchive(t, store, mirror.Options{Policy: policy},
+		"/terraform/providers/download/registry.terraform.io/hashicorp/aws/6.0.0/linux/amd64/terraform-provider-aws_6.0.0_linux_amd64.zip")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected denied version to return 404, got %d", w.Code)
+	}
+}
+
+// TestDownloadHandler_FilenameCannotReachCooldownVersion tests that the file name in a download
+// URL cannot serve the cached archive of a version still in its release cooldown
+func TestDownloadHandler_FilenameCannotReachCooldownVersion(t *testing.T) {
+	cooldown, err := mirror.NewReleaseCooldown(72*time.Hour, nil, nil)
+	if err != nil {
+		t.Fatalf("NewReleaseCooldown failed: %v", err)
+	}
+
+	old, recent := time.Now().Add(-30*24*time.Hour), time.Now().Add(-time.Hour)
+	versions, _ := json.Marshal(mirror.RegistryVersionsResponse{Versions: []mirror.RegistryVersion{
+		{Version: "5.0.0", Platforms: []mirror.RegistryPlatform{{OS: "linux", Arch: "amd64"}}, PublishedAt: &old},
+		{Version: "5.1.0", Platforms: []mirror.RegistryPlatform{{OS: "linux", Arch: "amd64"}}, PublishedAt: &recent},
+	}})
+	store := storage.NewMemoryStorage()
+	store.PutVersionsResponse(context.Background(), "registry.terraform.io", "hashicorp", "aws", versions)
+	cacheArchive(t, store, "terraform-provider-aws_5.1.0_linux_amd64.zip", "cooldown archive")
+
+	w := serveCachedArchive(t, store, mirror.Options{Cooldown: cooldown},
+		"/terraform/providers/download/registry.terraform.io/hashicorp/aws/5.0.0/linux/amd64/terraform-provider-aws_5.1.0_linux_amd64.zip")
+	if w.Code == http.StatusOK || strings.Contains(w.Body.String(), "cooldown archive") {
+		t.Errorf("expected archive in cooldown to stay unreachable, got %d: %q", w.Code, w.Body.String())
+	}
+
+	w = serveCachedArchive(t, store, mirror.Options{Cooldown: cooldown},
+		"/terraform/providers/download/registry.terraform.io/hashicorp/aws/5.1.0/linux/amd64/terraform-provider-aws_5.1.0_linux_amd64.zip")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected version in cooldown to return 404, got %d", w.Code)
+	}
+}
+
+// TestDownloadHandler_RejectedVersionUnreachable tests that a rejected version's cached archive
+// cannot be downloaded whatever version and file name the URL names
+func TestDownloadHandler_RejectedVersionUnreachable(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	store.PutMetadata(context.Background(), "approvals/registry.terraform.io/hashicorp/aws", []byte(`{"versions":{
+		"5.0.0":{"version":"5.0.0","state":"approved","discovered_at":"2025-06-01T00:00:00Z"},
+		"5.1.0":{"version":"5.1.0","state":"rejected","discovered_at":"2025-06-02T00:00:00Z"}
+	}}`))
+	cacheArchive(t, store, "terraform-provider-aws_5.1.0_linux_amd64.zip", "rejected archive")
+
+	for _, path := range []string{
+		"/terraform/providers/download/registry.terraform.io/hashicorp/aws/5.1.0/linux/amd64/terraform-provider-aws_5.1.0_linux_amd64.zip",
+		"/terraform/providers/download/registry.terraform.io/hashicorp/aws/5.0.0/linux/amd64/terraform-provider-aws_5.1.0_linux_amd64.zip",
+		"/terraform/providers/download/registry.terraform.io/hashicorp/aws/4.0.0/linux/amd64/terraform-provider-aws_5.1.0_linux_amd64.zip",
+		"/terraform/providers/download/registry.terraform.io/hashicorp/aws/5.1.0/linux/amd64/aws.zip",
+	} {
+		w := serveCachedArchive(t, store, mirror.Options{RequireApproval: true}, path)
+		if w.Code == http.StatusOK || strings.Contains(w.Body.String(), "rejected archive") {
+			t.Errorf("%s: expected rejected archive to stay unreachable, got %d: %q", path, w.Code, w.Body.String())
+		}
+	}
+}
+
 // TestDownloadHandler_Error tests error handling for download requests
 func TestDownloadHandler_Error(t *testing.T) {
 	testMirror := createTestMirror(nil, nil, nil, nil, nil, fmt.Errorf("upstream error"))
@@ -554,3 +698,58 @@ func TestIndexHandler_EOFError(t *testing.T) {
 		t.Errorf("expected status 404 or 500 for io.EOF error, got %d", w.Code)
 	}
 }
+
+// TestIndexHandler_PolicyForbidden tests that providers forbidden by the provider policy return 403
+func TestIndexHandler_PolicyForbidden(t *testing.T) {
+	policyFile := filepath.Join(t.TempDir(), "policy.json")
+	os.WriteFile(policyFile, []byte(`{"deny":["hashicorp/aws"]}`), 0600)
+	policy, err := mirror.LoadProviderPolicy(policyFile)
+	if err != nil {
+		t.Fatalf("LoadProviderPolicy failed: %v", err)
+	}
+
+	upstreamLogger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	upstreamClient, _ := mirror.NewUpstreamClient(30, 2, 1, upstreamLogger, mirror.UpstreamOptions{})
+	testMirror := mirror.NewMirror(&TestStorage{}, upstreamClient, "http://localhost:8080", 0, mirror.Options{Policy: policy})
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handlers := NewHandlers(testMirror, metricsForTests(), logger)
+
+	req := httptest.NewRequest("GET", "/terraform/providers/registry.terraform.io/hashicorp/aws/index.json", nil)
+	w := httptest.NewRecorder()
+
+	router := chi.NewRouter()
+	router.Get("/terraform/providers/{hostname}/{namespace}/{type}/*", handlers.MetadataHandler)
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected status 403, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `denied by pattern \"hashicorp/aws\"`) {
+		t.Errorf("expected denial reason in body, got %s", w.Body.String())
+	}
+}
+
+// TestIndexHandler_UpstreamBlocked tests that upstream hosts outside the allowlist return 403
+func TestIndexHandler_UpstreamBlocked(t *testing.T) {
+	upstreamLogger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	upstreamClient, _ := mirror.NewUpstreamClient(30, 2, 1, upstreamLogger, mirror.UpstreamOptions{
+		AllowedHosts: []string{"registry.terraform.io"},
+	})
+	testMirror := mirror.NewMirror(&TestStorage{indexErr: io.EOF}, upstreamClient, "http://localhost:8080", 0, mirror.Options{})
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handlers := NewHandlers(testMirror, metricsForTests(), logger)
+
+	req := httptest.NewRequest("GET", "/terraform/providers/169.254.169.254/hashicorp/aws/index.json", nil)
+	w := httptest.NewRecorder()
+
+	router := chi.NewRouter()
+	router.Get("/terraform/providers/{hostname}/{namespace}/{type}/*", handlers.MetadataHandler)
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected status 403, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "not in the upstream allowlist") {
+		t.Errorf("expected block reason in body, got %s", w.Body.String())
+	}
+}
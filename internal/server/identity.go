@@ -0,0 +1,72 @@
+package server
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+)
+
+// Identity describes the authenticated caller of a request
+type Identity struct {
+	// Name is the primary identifier used in logs and authorization decisions
+	Name string
+	// Method is how the caller was authenticated (e.g., "mtls")
+	Method string
+	// Subject is the distinguished name of the verified client certificate
+	Subject string
+	// SANs lists the DNS, email, URI and IP subject alternative names of the client certificate
+	SANs []string
+}
+
+type identityContextKey struct{}
+
+// WithIdentity returns a copy of ctx carrying the given identity
+func WithIdentity(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityContextKey{}, id)
+}
+
+// IdentityFromContext returns the identity attached to ctx, if any
+func IdentityFromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(identityContextKey{}).(*Identity)
+	return id, ok && id != nil
+}
+
+// ClientCertMiddleware attaches the identity of a verified client certificate to the request context.
+// Only certificates that chained to a trusted client CA during the handshake are considered.
+func ClientCertMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+				id := identityFromCertificate(r.TLS.VerifiedChains[0][0])
+				r = r.WithContext(WithIdentity(r.Context(), id))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// identityFromCertificate builds an identity from a client certificate.
+// The common name is preferred as the name, falling back to the first SAN.
+func identityFromCertificate(cert *x509.Certificate) *Identity {
+	var sans []string
+	sans = append(sans, cert.DNSNames...)
+	sans = append(sans, cert.EmailAddresses...)
+	for _, u := range cert.URIs {
+		sans = append(sans, u.String())
+	}
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+
+	name := cert.Subject.CommonName
+	if name == "" && len(sans) > 0 {
+		name = sans[0]
+	}
+
+	return &Identity{
+		Name:    name,
+		Method:  "mtls",
+		Subject: cert.Subject.String(),
+		SANs:    sans,
+	}
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// TestClientCertMiddleware_VerifiedCertificate tests that a verified certificate becomes the request identity
+func TestClientCertMiddleware_VerifiedCertificate(t *testing.T) {
+	cert := &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "ci-runner", Organization: []string{"Platform"}},
+		DNSNames: []string{"ci.internal"},
+	}
+
+	var got *Identity
+	handler := ClientCertMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = IdentityFromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest("GET", "/health", nil)
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got == nil {
+		t.Fatal("expected identity in request context")
+	}
+	if got.Name != "ci-runner" || got.Method != "mtls" {
+		t.Errorf("unexpected identity: %+v", got)
+	}
+	if got.Subject != "CN=ci-runner,O=Platform" {
+		t.Errorf("unexpected subject: %s", got.Subject)
+	}
+	if len(got.SANs) != 1 || got.SANs[0] != "ci.internal" {
+		t.Errorf("unexpected SANs: %v", got.SANs)
+	}
+}
+
+// TestClientCertMiddleware_UnverifiedCertificate tests that unverified peer certificates are ignored
+func TestClientCertMiddleware_UnverifiedCertificate(t *testing.T) {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "intruder"}}
+
+	called := false
+	handler := ClientCertMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		if _, ok := IdentityFromContext(r.Context()); ok {
+			t.Error("expected no identity for unverified certificate")
+		}
+	}))
+
+	req := httptest.NewRequest("GET", "/health", nil)
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if !called {
+		t.Fatal("expected next handler to be called")
+	}
+}
+
+func TestIdentityFromCertificate_SANFallback(t *testing.T) {
+	spiffe, _ := url.Parse("spiffe://corp/ci")
+	id := identityFromCertificate(&x509.Certificate{URIs: []*url.URL{spiffe}})
+
+	if id.Name != "spiffe://corp/ci" {
+		t.Errorf("expected URI SAN as name, got %q", id.Name)
+	}
+}
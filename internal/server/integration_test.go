@@ -0,0 +1,234 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elisiariocouto/specular/internal/mirror"
+	"github.com/elisiariocouto/specular/internal/storage"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// TestIntegration_MirrorProtocolUpstream tests serving a provider from a mirror protocol upstream
+// through the HTTP API, from index.json to the archive download
+func TestIntegration_MirrorProtocolUpstream(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/hashicorp/aws/index.json":
+			w.Write([]byte(`{"versions":{"1.0.0":{}}}`))
+		case "/hashicorp/aws/1.0.0.json":
+			w.Write([]byte(`{"archives":{"linux_amd64":{"url":"terraform-provider-aws_1.0.0_linux_amd64.zip","hashes":["h1:abc"]}}}`))
+		case "/hashicorp/aws/terraform-provider-aws_1.0.0_linux_amd64.zip":
+			w.Write([]byte("provider archive"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer upstream.Close()
+
+	caFile := filepath.Join(t.TempDir(), "upstream-ca.pem")
+	os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: upstream.Certificate().Raw}), 0600)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	upstreamClient, err := mirror.NewUpstreamClient(5*time.Second, 0, time.Minute, logger, mirror.UpstreamOptions{
+		Transport: mirror.TransportOptions{CAFiles: []string{caFile}},
+	})
+	if err != nil {
+		t.Fatalf("NewUpstreamClient failed: %v", err)
+	}
+	m := mirror.NewMirror(storage.NewMemoryStorage(), upstreamClient, "http://localhost:8080", 0, mirror.Options{})
+
+	srv, err := New("127.0.0.1", 0, 5*time.Second, 5*time.Second, m, metricsForTests(), logger, Options{})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	handler := srv.httpServer.Handler
+
+	u, _ := url.Parse(upstream.URL)
+	base := "/terraform/providers/" + u.Host + "/hashicorp/aws/"
+
+	if w := doRequest(handler, base+"index.json", ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "1.0.0") {
+		t.Fatalf("index.json: got %d %s", w.Code, w.Body.String())
+	}
+
+	w := doRequest(handler, base+"1.0.0.json", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("1.0.0.json: got %d %s", w.Code, w.Body.String())
+	}
+	var version mirror.VersionResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &version); err != nil {
+		t.Fatalf("failed to parse version response: %v", err)
+	}
+	archive, ok := version.Archives["linux_amd64"]
+	if !ok || !strings.HasPrefix(archive.URL, "http://localhost:8080/terraform/providers/download/") {
+		t.Fatalf("unexpected archive entry: %+v", archive)
+	}
+
+	w = doRequest(handler, strings.TrimPrefix(archive.URL, "http://localhost:8080"), "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("archive download: got %d %s", w.Code, w.Body.String())
+	}
+	if w.Body.String() != "provider archive" {
+		t.Errorf("unexpected archive contents: %q", w.Body.String())
+	}
+}
+
+// TestIntegration_Tracing tests the span structure of requests served from an upstream and
+// that the client's trace context is propagated to upstream requests
+func TestIntegration_Tracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		provider.Shutdown(context.Background())
+	})
+
+	var mu sync.Mutex
+	var traceparents []string
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		traceparents = append(traceparents, r.Header.Get("traceparent"))
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/hashicorp/aws/index.json":
+			w.Write([]byte(`{"versions":{"1.0.0":{}}}`))
+		case "/hashicorp/aws/1.0.0.json":
+			w.Write([]byte(`{"archives":{"linux_amd64":{"url":"terraform-provider-aws_1.0.0_linux_amd64.zip"}}}`))
+		case "/hashicorp/aws/terraform-provider-aws_1.0.0_linux_amd64.zip":
+			w.Write([]byte("provider archive"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer upstream.Close()
+
+	caFile := filepath.Join(t.TempDir(), "upstream-ca.pem")
+	os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: upstream.Certificate().Raw}), 0600)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	upstreamClient, err := mirror.NewUpstreamClient(5*time.Second, 0, time.Minute, logger, mirror.UpstreamOptions{
+		Transport: mirror.TransportOptions{CAFiles: []string{caFile}},
+	})
+	if err != nil {
+		t.Fatalf("NewUpstreamClient failed: %v", err)
+	}
+	m := mirror.NewMirror(storage.NewMemoryStorage(), upstreamClient, "http://localhost:8080", 0, mirror.Options{})
+	srv, err := New("127.0.0.1", 0, 5*time.Second, 5*time.Second, m, metricsForTests(), logger, Options{})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	handler := srv.httpServer.Handler
+
+	// Storage reads made while the mirror starts up belong to no request
+	exporter.Reset()
+
+	u, _ := url.Parse(upstream.URL)
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest("GET", "/terraform/providers/"+u.Host+"/hashicorp/aws/index.json", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("index.json: got %d %s", w.Code, w.Body.String())
+	}
+
+	spans := exporter.GetSpans()
+	byName := make(map[string]tracetest.SpanStub)
+	for _, span := range spans {
+		if span.SpanContext.TraceID().String() != traceID {
+			t.Errorf("span %s is not part of the client's trace", span.Name)
+		}
+		if _, ok := byName[span.Name]; !ok {
+			byName[span.Name] = span
+		}
+	}
+
+	parents := map[string]string{
+		"Mirror.GetIndex":                 "GET index",
+		"storage.GetIndex":                "Mirror.GetIndex",
+		"Mirror.fetchAndCacheIndex":       "Mirror.GetIndex",
+		"UpstreamClient.FetchIndex":       "Mirror.fetchAndCacheIndex",
+		"DiscoveryCache.DiscoverServices": "UpstreamClient.FetchIndex",
+		"storage.PutIndex":                "Mirror.fetchAndCacheIndex",
+	}
+	for child, parent := range parents {
+		c, ok := byName[child]
+		if !ok {
+			t.Errorf("missing span %s", child)
+			continue
+		}
+		if c.Parent.SpanID() != byName[parent].SpanContext.SpanID() {
+			t.Errorf("span %s is not a child of %s", child, parent)
+		}
+	}
+
+	server := byName["GET index"]
+	if server.SpanKind != trace.SpanKindServer || server.Parent.SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("expected a server span continuing the client's span, got kind %s parent %s", server.SpanKind, server.Parent.SpanID())
+	}
+
+	var clientSpans int
+	for _, span := range spans {
+		if span.SpanKind == trace.SpanKindClient {
+			clientSpans++
+		}
+	}
+	if clientSpans != 2 {
+		t.Errorf("expected client spans for service discovery and index.json, got %d", clientSpans)
+	}
+
+	// Archive downloads are traced until the body is consumed
+	exporter.Reset()
+	doRequest(handler, "/terraform/providers/"+u.Host+"/hashicorp/aws/1.0.0.json", "")
+	w = doRequest(handler, "/terraform/providers/download/"+u.Host+"/hashicorp/aws/1.0.0/linux/amd64/terraform-provider-aws_1.0.0_linux_amd64.zip", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("archive download: got %d %s", w.Code, w.Body.String())
+	}
+	byName = make(map[string]tracetest.SpanStub)
+	for _, span := range exporter.GetSpans() {
+		byName[span.Name] = span
+	}
+	getArchive := byName["Mirror.GetArchive"]
+	for _, child := range []string{"storage.GetArchive", "UpstreamClient.FetchArchive", "storage.PutArchive"} {
+		if byName[child].Parent.SpanID() != getArchive.SpanContext.SpanID() {
+			t.Errorf("span %s is not a child of Mirror.GetArchive", child)
+		}
+	}
+	var archiveBytes int64
+	for _, attr := range byName["UpstreamClient.FetchArchive"].Attributes {
+		if attr.Key == "specular.archive.bytes" {
+			archiveBytes = attr.Value.AsInt64()
+		}
+	}
+	if archiveBytes != int64(len("provider archive")) {
+		t.Errorf("expected archive span to record %d bytes, got %d", len("provider archive"), archiveBytes)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(traceparents) < 2 {
+		t.Fatalf("expected upstream requests, got %d", len(traceparents))
+	}
+	for _, traceparent := range traceparents[:2] {
+		if !strings.HasPrefix(traceparent, "00-"+traceID+"-") {
+			t.Errorf("upstream request has traceparent %q, want trace %s", traceparent, traceID)
+		}
+	}
+}
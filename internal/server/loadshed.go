@@ -0,0 +1,58 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/elisiariocouto/specular/internal/loadshed"
+	"github.com/elisiariocouto/specular/internal/metrics"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// writeOverloaded records a shed request and responds with 503 and Retry-After
+func writeOverloaded(w http.ResponseWriter, r *http.Request, err error, m *metrics.Metrics, logger *slog.Logger) {
+	limiter, retryAfter := "unknown", 1
+	var overloaded *loadshed.OverloadedError
+	if errors.As(err, &overloaded) {
+		limiter = overloaded.Limiter
+		retryAfter = int(math.Ceil(overloaded.RetryAfter.Seconds()))
+	}
+
+	m.RecordLoadShed(limiter)
+
+	requestID := middleware.GetReqID(r.Context())
+	logger.WarnContext(r.Context(),
+		fmt.Sprintf("request shed [request_id=%s limiter=%s retry_after=%d]", requestID, limiter, retryAfter),
+		slog.String("request_id", requestID),
+		slog.String("limiter", limiter),
+		slog.Int("retry_after", retryAfter),
+	)
+
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	fmt.Fprint(w, `{"error":"service overloaded"}`)
+}
+
+// ConcurrencyLimitMiddleware holds a limiter slot for the duration of each request.
+// Requests that cannot get a slot are rejected with 503.
+func ConcurrencyLimitMiddleware(limiter *loadshed.Limiter, m *metrics.Metrics, logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			release, err := limiter.Acquire(r.Context())
+			if err != nil {
+				if errors.Is(err, loadshed.ErrOverloaded) {
+					writeOverloaded(w, r, err, m, logger)
+				}
+				// Otherwise the client went away while queued; there is nobody to respond to
+				return
+			}
+			defer release()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
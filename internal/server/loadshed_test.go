@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/elisiariocouto/specular/internal/loadshed"
+	"github.com/elisiariocouto/specular/internal/mirror"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestConcurrencyLimitMiddleware_ShedsWhenFull(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	limiter := loadshed.NewLimiter("downloads", 1, 0, time.Second)
+
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	handler := ConcurrencyLimitMiddleware(limiter, metricsForTests(), logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-unblock
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	done := make(chan int)
+	go func() {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/download", nil))
+		done <- w.Code
+	}()
+	<-started
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/download", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 while the only slot is held, got %d", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("expected Retry-After 1, got %q", got)
+	}
+
+	close(unblock)
+	if code := <-done; code != http.StatusOK {
+		t.Fatalf("expected first request to succeed, got %d", code)
+	}
+	if limiter.InFlight() != 0 {
+		t.Errorf("expected slot to be released, in flight = %d", limiter.InFlight())
+	}
+}
+
+func TestIndexHandler_UpstreamOverloaded(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	limiter := loadshed.NewLimiter("upstream", 1, 0, 3*time.Second)
+	release, err := limiter.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+	defer release()
+
+	upstream, err := mirror.NewUpstreamClient(time.Second, 0, time.Minute, logger, mirror.UpstreamOptions{FetchLimiter: limiter})
+	if err != nil {
+		t.Fatalf("NewUpstreamClient failed: %v", err)
+	}
+	testMirror := mirror.NewMirror(&TestStorage{indexErr: io.EOF, versionErr: io.EOF}, upstream, "http://localhost:8080", 0, mirror.Options{})
+	handlers := NewHandlers(testMirror, metricsForTests(), logger)
+
+	req := httptest.NewRequest("GET", "/terraform/providers/registry.terraform.io/hashicorp/aws/index.json", nil)
+	w := httptest.NewRecorder()
+	router := chi.NewRouter()
+	router.Get("/terraform/providers/{hostname}/{namespace}/{type}/*", handlers.MetadataHandler)
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 when upstream fetches are saturated, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Retry-After"); got != "3" {
+		t.Errorf("expected Retry-After 3, got %q", got)
+	}
+}
@@ -12,19 +12,26 @@ import (
 )
 
 // LoggingMiddleware logs HTTP requests and responses
+// The caller identity is included when an earlier middleware authenticated the request
 func LoggingMiddleware(logger *slog.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Get request ID from context (set by chi middleware)
 			requestID := middleware.GetReqID(r.Context())
 
+			identity := ""
+			if id, ok := IdentityFromContext(r.Context()); ok {
+				identity = id.Name
+			}
+
 			logger.InfoContext(r.Context(),
-				fmt.Sprintf("request started [request_id=%s method=%s path=%s remote_addr=%s]",
-					requestID, r.Method, r.URL.Path, r.RemoteAddr),
+				fmt.Sprintf("request started [request_id=%s method=%s path=%s remote_addr=%s identity=%s]",
+					requestID, r.Method, r.URL.Path, r.RemoteAddr, identity),
 				slog.String("request_id", requestID),
 				slog.String("method", r.Method),
 				slog.String("path", r.URL.Path),
 				slog.String("remote_addr", r.RemoteAddr),
+				slog.String("identity", identity),
 			)
 
 			// Wrap response writer to capture status code and response size
@@ -35,14 +42,15 @@ func LoggingMiddleware(logger *slog.Logger) func(http.Handler) http.Handler {
 			duration := time.Since(start)
 
 			logger.InfoContext(r.Context(),
-				fmt.Sprintf("request completed [request_id=%s method=%s path=%s status_code=%d duration=%s response_size=%d]",
-					requestID, r.Method, r.URL.Path, wrapped.statusCode, duration, wrapped.responseSize),
+				fmt.Sprintf("request completed [request_id=%s method=%s path=%s status_code=%d duration=%s response_size=%d identity=%s]",
+					requestID, r.Method, r.URL.Path, wrapped.statusCode, duration, wrapped.responseSize, identity),
 				slog.String("request_id", requestID),
 				slog.String("method", r.Method),
 				slog.String("path", r.URL.Path),
 				slog.Int("status_code", wrapped.statusCode),
 				slog.Duration("duration", duration),
 				slog.Int64("response_size", wrapped.responseSize),
+				slog.String("identity", identity),
 			)
 		})
 	}
@@ -0,0 +1,212 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elisiariocouto/specular/internal/metrics"
+	"github.com/go-chi/chi/v5/middleware"
+	"golang.org/x/time/rate"
+)
+
+// Route classes with separate rate limits
+const (
+	RouteClassMetadata = "metadata"
+	RouteClassArchive  = "archive"
+)
+
+// rateLimiterIdleTTL is how long a client's bucket is kept after its last request
+const rateLimiterIdleTTL = 10 * time.Minute
+
+// RateLimitOptions configures per-client token-bucket rate limiting
+type RateLimitOptions struct {
+	// MetadataRate is the sustained rate of index.json and version.json requests per second per client.
+	// Zero disables metadata rate limiting.
+	MetadataRate float64
+	// MetadataBurst is the number of metadata requests a client can make at once
+	MetadataBurst int
+	// ArchiveRate is the sustained rate of archive downloads per second per client.
+	// Zero disables archive rate limiting.
+	ArchiveRate float64
+	// ArchiveBurst is the number of archive downloads a client can start at once
+	ArchiveBurst int
+	// TrustedProxies lists CIDRs of proxies whose X-Forwarded-For header is trusted
+	TrustedProxies []string
+}
+
+// parseTrustedProxies parses CIDRs or single IP addresses into networks
+func parseTrustedProxies(entries []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, entry := range entries {
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy: %s", entry)
+			}
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy: %s", entry)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// isTrusted reports whether ip belongs to one of the trusted networks
+func isTrusted(ip net.IP, trusted []*net.IPNet) bool {
+	for _, network := range trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the IP address of the client that made a request.
+// X-Forwarded-For is only honored when the direct peer is a trusted proxy; the rightmost
+// address not belonging to a trusted proxy is used so clients cannot spoof their address.
+func clientIP(r *http.Request, trusted []*net.IPNet) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	peer := net.ParseIP(host)
+	if peer == nil || !isTrusted(peer, trusted) {
+		return host
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(header, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(hops[i])
+		if ip == nil {
+			// Anything left of a malformed hop cannot be trusted
+			return host
+		}
+		if !isTrusted(ip, trusted) || i == 0 {
+			return ip.String()
+		}
+	}
+	return host
+}
+
+// clientLimiter is a token bucket for a single client
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// rateLimiter keeps one token bucket per client key for a route class
+type rateLimiter struct {
+	limit rate.Limit
+	burst int
+
+	mu        sync.Mutex
+	clients   map[string]*clientLimiter
+	lastSweep time.Time
+}
+
+func newRateLimiter(perSecond float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = int(math.Max(1, math.Ceil(perSecond)))
+	}
+	return &rateLimiter{
+		limit:   rate.Limit(perSecond),
+		burst:   burst,
+		clients: make(map[string]*clientLimiter),
+	}
+}
+
+// reserve takes a token for key, returning zero if the request may proceed or how long
+// the client has to wait for the next token otherwise
+func (rl *rateLimiter) reserve(key string, now time.Time) time.Duration {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	// Drop idle clients so the map does not grow without bound
+	if now.Sub(rl.lastSweep) > time.Minute {
+		for k, c := range rl.clients {
+			if now.Sub(c.lastSeen) > rateLimiterIdleTTL {
+				delete(rl.clients, k)
+			}
+		}
+		rl.lastSweep = now
+	}
+
+	c, ok := rl.clients[key]
+	if !ok {
+		c = &clientLimiter{limiter: rate.NewLimiter(rl.limit, rl.burst)}
+		rl.clients[key] = c
+	}
+	c.lastSeen = now
+
+	reservation := c.limiter.ReserveN(now, 1)
+	delay := reservation.DelayFrom(now)
+	if delay > 0 {
+		reservation.CancelAt(now)
+	}
+	return delay
+}
+
+// rateLimitKey identifies the client of a request: its authenticated identity if any,
+// otherwise its IP address
+func rateLimitKey(r *http.Request, trusted []*net.IPNet) string {
+	if id, ok := IdentityFromContext(r.Context()); ok {
+		return "identity:" + id.Name
+	}
+	return "ip:" + clientIP(r, trusted)
+}
+
+// RateLimitMiddleware rejects requests from clients that exceeded their rate with 429
+func RateLimitMiddleware(rl *rateLimiter, routeClass string, trusted []*net.IPNet, m *metrics.Metrics, logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := rateLimitKey(r, trusted)
+			delay := rl.reserve(key, time.Now())
+			if delay <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			m.RecordRateLimited(routeClass)
+
+			retryAfter := int(math.Ceil(delay.Seconds()))
+			requestID := middleware.GetReqID(r.Context())
+			logger.WarnContext(r.Context(),
+				fmt.Sprintf("rate limit exceeded [request_id=%s route_class=%s client=%s retry_after=%d]",
+					requestID, routeClass, key, retryAfter),
+				slog.String("request_id", requestID),
+				slog.String("route_class", routeClass),
+				slog.String("client", key),
+				slog.Int("retry_after", retryAfter),
+			)
+
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, `{"error":"rate limit exceeded"}`)
+		})
+	}
+}
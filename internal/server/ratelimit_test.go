@@ -0,0 +1,126 @@
+package server
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted, err := parseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatalf("parseTrustedProxies failed: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        string
+		want       string
+	}{
+		{"direct client", "203.0.113.7:5000", "", "203.0.113.7"},
+		{"untrusted peer ignores header", "203.0.113.7:5000", "198.51.100.1", "203.0.113.7"},
+		{"trusted proxy", "10.1.2.3:5000", "198.51.100.1", "198.51.100.1"},
+		{"spoofed leftmost hop", "10.1.2.3:5000", "1.2.3.4, 198.51.100.1", "198.51.100.1"},
+		{"chained trusted proxies", "192.168.1.1:5000", "198.51.100.1, 10.0.0.5", "198.51.100.1"},
+		{"only trusted hops", "10.1.2.3:5000", "10.0.0.9", "10.0.0.9"},
+		{"malformed hop", "10.1.2.3:5000", "garbage", "10.1.2.3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			if got := clientIP(req, trusted); got != tt.want {
+				t.Errorf("clientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := parseTrustedProxies([]string{"not-an-ip"}); err == nil {
+		t.Error("expected error for invalid trusted proxy")
+	}
+}
+
+func TestRateLimiter_Reserve(t *testing.T) {
+	rl := newRateLimiter(1, 2)
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if delay := rl.reserve("ip:203.0.113.7", now); delay != 0 {
+			t.Fatalf("request %d within burst was delayed by %s", i, delay)
+		}
+	}
+	if delay := rl.reserve("ip:203.0.113.7", now); delay <= 0 {
+		t.Fatal("expected request over burst to be delayed")
+	}
+	if delay := rl.reserve("ip:198.51.100.1", now); delay != 0 {
+		t.Error("expected other clients to have their own bucket")
+	}
+	// Rejected requests do not consume tokens, so one token is available after a second
+	if delay := rl.reserve("ip:203.0.113.7", now.Add(time.Second)); delay != 0 {
+		t.Errorf("expected token to be refilled, got delay %s", delay)
+	}
+
+	// Idle clients are dropped
+	rl.reserve("ip:192.0.2.1", now.Add(rateLimiterIdleTTL+2*time.Minute))
+	if _, ok := rl.clients["ip:203.0.113.7"]; ok {
+		t.Error("expected idle client to be removed")
+	}
+}
+
+// TestRateLimit_RouteClasses tests 429 responses and separate limits for metadata and archive routes
+func TestRateLimit_RouteClasses(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	srv, err := New("127.0.0.1", 0, time.Second, time.Second,
+		createTestMirror([]byte(`{"versions":{}}`), nil, nil, nil, []byte("archive"), nil), metricsForTests(), logger,
+		Options{
+			Auth: AuthOptions{TokenHashes: []string{sha256Entry("ci", "ci-token")}},
+			RateLimit: RateLimitOptions{
+				MetadataRate:  0.001,
+				MetadataBurst: 2,
+				ArchiveRate:   0.001,
+				ArchiveBurst:  1,
+			},
+		})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	handler := srv.httpServer.Handler
+
+	indexPath := "/terraform/providers/registry.terraform.io/hashicorp/aws/index.json"
+	for i := 0; i < 2; i++ {
+		if w := doRequest(handler, indexPath, ""); w.Code != http.StatusOK {
+			t.Fatalf("request %d: expected 200, got %d", i, w.Code)
+		}
+	}
+
+	w := doRequest(handler, indexPath, "")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 over the limit, got %d", w.Code)
+	}
+	if retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After")); err != nil || retryAfter < 1 {
+		t.Errorf("expected positive Retry-After, got %q", w.Header().Get("Retry-After"))
+	}
+
+	// Authenticated callers are limited by identity, not by address
+	if w := doRequest(handler, indexPath, "ci-token"); w.Code != http.StatusOK {
+		t.Errorf("expected authenticated caller to have its own bucket, got %d", w.Code)
+	}
+
+	// Archive downloads have their own limit
+	archivePath := "/terraform/providers/download/registry.terraform.io/hashicorp/aws/1.0.0/linux/amd64/a.zip"
+	if w := doRequest(handler, archivePath, ""); w.Code != http.StatusOK {
+		t.Errorf("expected archive download to use a separate limit, got %d", w.Code)
+	}
+	if w := doRequest(handler, archivePath, ""); w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected second archive download to be limited, got %d", w.Code)
+	}
+}
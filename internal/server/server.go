@@ -2,12 +2,17 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
 	"net/http"
 	"time"
 
+	"github.com/elisiariocouto/specular/internal/audit"
+	"github.com/elisiariocouto/specular/internal/authz"
+	"github.com/elisiariocouto/specular/internal/loadshed"
 	"github.com/elisiariocouto/specular/internal/metrics"
 	"github.com/elisiariocouto/specular/internal/mirror"
 	"github.com/go-chi/chi/v5"
@@ -16,8 +21,34 @@ import (
 
 // Server represents the HTTP server
 type Server struct {
-	httpServer *http.Server
-	logger     *slog.Logger
+	httpServer     *http.Server
+	logger         *slog.Logger
+	certs          *certReloader
+	reloadInterval time.Duration
+	tokens         *tokenStore
+	tokensInterval time.Duration
+	authorizer     *authz.Authorizer
+	watchCtx       context.Context
+	stopWatch      context.CancelFunc
+}
+
+// Options holds optional server features
+type Options struct {
+	// TLS enables HTTPS serving when certificate and key files are set
+	TLS TLSOptions
+	// Auth enables bearer-token authentication when a token source is set
+	Auth AuthOptions
+	// AuthzPolicyFile enables per-identity authorization from a JSON policy file
+	AuthzPolicyFile string
+	// AdminIdentities may use the admin API when no authorization policy is configured;
+	// without either, the admin API is denied to everyone
+	AdminIdentities []string
+	// RateLimit enables per-client rate limiting of provider routes
+	RateLimit RateLimitOptions
+	// DownloadLimiter caps concurrent archive downloads; nil leaves them unlimited
+	DownloadLimiter *loadshed.Limiter
+	// AuditLog records provider requests; nil disables auditing
+	AuditLog *audit.Log
 }
 
 // New creates and configures a new HTTP server
@@ -29,31 +60,114 @@ func New(
 	m *mirror.Mirror,
 	metrics *metrics.Metrics,
 	logger *slog.Logger,
-) *Server {
+	opts Options,
+) (*Server, error) {
+	s := &Server{
+		logger: logger,
+	}
+
+	if opts.Auth.Enabled() {
+		tokens, err := newTokenStore(opts.Auth, logger)
+		if err != nil {
+			return nil, err
+		}
+		s.tokens = tokens
+		s.tokensInterval = opts.Auth.ReloadInterval
+	}
+
+	if opts.AuthzPolicyFile != "" {
+		authorizer, err := authz.NewAuthorizer(opts.AuthzPolicyFile)
+		if err != nil {
+			return nil, err
+		}
+		s.authorizer = authorizer
+	}
+
 	router := chi.NewRouter()
 
 	// Global middleware
 	router.Use(middleware.RequestID)
+	router.Use(ClientCertMiddleware())
+	if s.tokens != nil {
+		router.Use(TokenAuthMiddleware(s.tokens))
+	}
 	router.Use(RecoveryMiddleware(logger))
 	router.Use(LoggingMiddleware(logger))
 	router.Use(MetricsMiddleware(metrics))
 
 	// Create handlers
 	handlers := NewHandlers(m, metrics, logger)
+	handlers.authorizer = s.authorizer
+	handlers.adminIdentities = make(map[string]bool, len(opts.AdminIdentities))
+	for _, identity := range opts.AdminIdentities {
+		handlers.adminIdentities[identity] = true
+	}
+
+	protected := make(map[string]bool)
+	for _, group := range opts.Auth.ProtectedRoutes {
+		protected[group] = true
+	}
+
+	// protect returns the middleware enforcing authentication for a route group
+	protect := func(group string) func(http.Handler) http.Handler {
+		if !protected[group] {
+			return func(next http.Handler) http.Handler { return next }
+		}
+		return RequireAuthMiddleware(group, metrics, logger)
+	}
+
+	trustedProxies, err := parseTrustedProxies(opts.RateLimit.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	handlers.auditLog = opts.AuditLog
+	handlers.trustedProxies = trustedProxies
+
+	// limit returns the middleware enforcing the rate limit of a route class
+	limit := func(routeClass string, perSecond float64, burst int) func(http.Handler) http.Handler {
+		if perSecond <= 0 {
+			return func(next http.Handler) http.Handler { return next }
+		}
+		return RateLimitMiddleware(newRateLimiter(perSecond, burst), routeClass, trustedProxies, metrics, logger)
+	}
+	limitMetadata := limit(RouteClassMetadata, opts.RateLimit.MetadataRate, opts.RateLimit.MetadataBurst)
+	limitArchive := limit(RouteClassArchive, opts.RateLimit.ArchiveRate, opts.RateLimit.ArchiveBurst)
+
+	// Shed archive downloads beyond the concurrency cap; rate limiting runs first so
+	// throttled clients never occupy a slot
+	limitDownloads := func(next http.Handler) http.Handler { return next }
+	if opts.DownloadLimiter != nil {
+		limitDownloads = ConcurrencyLimitMiddleware(opts.DownloadLimiter, metrics, logger)
+	}
 
 	// Routes
-	router.Get("/health", handlers.HealthHandler)
-	router.Handle("/metrics", handlers.MetricsHandler())
+	router.With(protect(RouteGroupHealth)).Get("/health", handlers.HealthHandler)
+	router.With(protect(RouteGroupMetrics)).Handle("/metrics", handlers.MetricsHandler())
 
 	// Terraform provider mirror protocol endpoints under /terraform/providers base path
 	// This allows for future support of other registries (e.g., /docker/registries, /npm, /pypi)
 	router.Route("/terraform/providers", func(r chi.Router) {
+		r.Use(protect(RouteGroupProviders))
+
 		// GET /terraform/providers/:hostname/:namespace/:type/* (catches index.json, version.json, and archives)
 		// Use wildcard to handle dots in version numbers (e.g., 6.26.0.json) and zip files
-		r.Get("/{hostname}/{namespace}/{type}/*", handlers.MetadataHandler)
+		r.With(limitMetadata).Get("/{hostname}/{namespace}/{type}/*", handlers.MetadataHandler)
 
 		// Provider archive download endpoint with explicit parameters
-		r.Get("/download/{hostname}/{namespace}/{type}/{version}/{os}/{arch}/{filename}", handlers.DownloadHandler)
+		r.With(limitArchive, limitDownloads).Get("/download/{hostname}/{namespace}/{type}/{version}/{os}/{arch}/{filename}", handlers.DownloadHandler)
+	})
+
+	// Administrative API; callers must always be authenticated
+	router.Route("/admin", func(r chi.Router) {
+		r.Use(RequireAuthMiddleware(RouteGroupAdmin, metrics, logger))
+
+		r.Get("/providers/{hostname}/{namespace}/{type}/pending", handlers.PendingVersionsHandler)
+		r.Post("/providers/{hostname}/{namespace}/{type}/versions/{version}/approve", handlers.ApproveVersionHandler)
+		r.Post("/providers/{hostname}/{namespace}/{type}/versions/{version}/reject", handlers.RejectVersionHandler)
+		r.Get("/upstreams", handlers.UpstreamStatusHandler)
+		r.Get("/bandwidth", handlers.BandwidthHandler)
+		r.Get("/catalog", handlers.CatalogHandler)
+		r.Get("/audit", handlers.AuditHandler)
 	})
 
 	// 404 handler
@@ -63,7 +177,7 @@ func New(
 		fmt.Fprint(w, `{"error":"not found"}`)
 	}))
 
-	httpServer := &http.Server{
+	s.httpServer = &http.Server{
 		Addr:         net.JoinHostPort(host, fmt.Sprintf("%d", port)),
 		Handler:      router,
 		ReadTimeout:  readTimeout,
@@ -71,22 +185,79 @@ func New(
 		IdleTimeout:  120 * time.Second,
 	}
 
-	return &Server{
-		httpServer: httpServer,
-		logger:     logger,
+	if opts.TLS.Enabled() {
+		tlsConfig, certs, err := buildTLSConfig(opts.TLS, logger)
+		if err != nil {
+			return nil, err
+		}
+		s.httpServer.TLSConfig = tlsConfig
+		s.certs = certs
+		s.reloadInterval = opts.TLS.ReloadInterval
 	}
+
+	s.watchCtx, s.stopWatch = context.WithCancel(context.Background())
+
+	return s, nil
 }
 
-// Start starts the HTTP server
+// Start starts the HTTP server, serving HTTPS when TLS is configured
 func (s *Server) Start() error {
-	s.logger.InfoContext(context.Background(), "starting HTTP server",
-		slog.String("address", s.httpServer.Addr),
+	listener, err := net.Listen("tcp", s.httpServer.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+// Serve accepts connections on the given listener
+func (s *Server) Serve(listener net.Listener) error {
+	if s.tokens != nil && s.tokens.file != "" && s.tokensInterval > 0 {
+		go s.tokens.watch(s.watchCtx, s.tokensInterval)
+	}
+
+	if s.certs == nil {
+		s.logger.InfoContext(context.Background(), "starting HTTP server",
+			slog.String("address", listener.Addr().String()),
+		)
+		return s.httpServer.Serve(listener)
+	}
+
+	if s.reloadInterval > 0 {
+		go s.certs.watch(s.watchCtx, s.reloadInterval)
+	}
+
+	s.logger.InfoContext(context.Background(), "starting HTTPS server",
+		slog.String("address", listener.Addr().String()),
+		slog.String("min_tls_version", tls.VersionName(s.httpServer.TLSConfig.MinVersion)),
 	)
-	return s.httpServer.ListenAndServe()
+	return s.httpServer.ServeTLS(listener, "", "")
+}
+
+// ReloadTLS re-reads the certificate and key files.
+// It is a no-op when TLS is not enabled.
+func (s *Server) ReloadTLS() error {
+	if s.certs == nil {
+		return nil
+	}
+	return s.certs.Reload()
+}
+
+// ReloadAuth re-reads the bearer tokens file and the authorization policy.
+// Sources that are not configured are skipped.
+func (s *Server) ReloadAuth() error {
+	var errs []error
+	if s.tokens != nil {
+		errs = append(errs, s.tokens.Reload())
+	}
+	if s.authorizer != nil {
+		errs = append(errs, s.authorizer.Reload())
+	}
+	return errors.Join(errs...)
 }
 
 // Shutdown gracefully shuts down the HTTP server
 func (s *Server) Shutdown(ctx context.Context) error {
 	s.logger.InfoContext(ctx, "shutting down HTTP server")
+	s.stopWatch()
 	return s.httpServer.Shutdown(ctx)
 }
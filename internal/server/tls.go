@@ -0,0 +1,252 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// TLSOptions configures HTTPS serving directly from certificate files
+type TLSOptions struct {
+	CertFile string
+	KeyFile  string
+	// MinVersion is "1.2" or "1.3" (defaults to "1.2")
+	MinVersion string
+	// CipherSuites lists IANA cipher suite names; empty uses Go's defaults.
+	// Only applies to TLS 1.2, TLS 1.3 suites are not configurable.
+	CipherSuites []string
+	// ReloadInterval controls how often the certificate files are checked for changes.
+	// Zero disables polling; certificates can still be reloaded with ReloadTLS.
+	ReloadInterval time.Duration
+	// ClientCAFile is a PEM bundle of CAs trusted to issue client certificates
+	ClientCAFile string
+	// ClientAuth is "none", "optional" or "required" (defaults to "none")
+	ClientAuth string
+}
+
+// Enabled returns true if both certificate and key files are configured
+func (o TLSOptions) Enabled() bool {
+	return o.CertFile != "" && o.KeyFile != ""
+}
+
+// tlsVersion converts a configured version name to its crypto/tls constant
+func tlsVersion(name string) (uint16, error) {
+	switch name {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unsupported TLS version: %s", name)
+	}
+}
+
+// clientAuthType converts a configured client authentication mode to its crypto/tls constant.
+// Optional mode still rejects certificates that are presented but fail verification.
+func clientAuthType(mode string) (tls.ClientAuthType, error) {
+	switch mode {
+	case "", "none":
+		return tls.NoClientCert, nil
+	case "optional":
+		return tls.VerifyClientCertIfGiven, nil
+	case "required":
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return tls.NoClientCert, fmt.Errorf("unsupported TLS client auth mode: %s", mode)
+	}
+}
+
+// loadCertPool reads a PEM bundle into a certificate pool
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in CA bundle %s", path)
+	}
+	return pool, nil
+}
+
+// cipherSuiteIDs converts cipher suite names to their crypto/tls identifiers
+func cipherSuiteIDs(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	available := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		available[suite.Name] = suite.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := available[name]
+		if !ok {
+			return nil, fmt.Errorf("unsupported TLS cipher suite: %s", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// buildTLSConfig creates the server TLS configuration and its certificate reloader
+func buildTLSConfig(opts TLSOptions, logger *slog.Logger) (*tls.Config, *certReloader, error) {
+	minVersion, err := tlsVersion(opts.MinVersion)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cipherSuites, err := cipherSuiteIDs(opts.CipherSuites)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	clientAuth, err := clientAuthType(opts.ClientAuth)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reloader, err := newCertReloader(opts.CertFile, opts.KeyFile, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:     minVersion,
+		CipherSuites:   cipherSuites,
+		GetCertificate: reloader.GetCertificate,
+		ClientAuth:     clientAuth,
+	}
+
+	if clientAuth != tls.NoClientCert {
+		if opts.ClientCAFile == "" {
+			return nil, nil, fmt.Errorf("TLS client auth mode %s requires a client CA file", opts.ClientAuth)
+		}
+		clientCAs, err := loadCertPool(opts.ClientCAFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		tlsConfig.ClientCAs = clientCAs
+	}
+
+	return tlsConfig, reloader, nil
+}
+
+// certReloader holds the active server certificate and swaps it when the files change.
+// Certificates are selected per handshake, so established connections are unaffected by a reload.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	logger   *slog.Logger
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	certMod time.Time
+	keyMod  time.Time
+}
+
+// newCertReloader loads the initial certificate, failing if it cannot be read
+func newCertReloader(certFile, keyFile string, logger *slog.Logger) (*certReloader, error) {
+	r := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		logger:   logger,
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate returns the current certificate for a TLS handshake
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Reload reads the certificate and key files from disk.
+// On failure the previously loaded certificate stays in use.
+func (r *certReloader) Reload() error {
+	certMod, keyMod, err := r.modTimes()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.certMod = certMod
+	r.keyMod = keyMod
+	r.mu.Unlock()
+
+	return nil
+}
+
+// modTimes returns the modification times of the certificate and key files
+func (r *certReloader) modTimes() (time.Time, time.Time, error) {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("failed to stat TLS certificate: %w", err)
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("failed to stat TLS key: %w", err)
+	}
+	return certInfo.ModTime(), keyInfo.ModTime(), nil
+}
+
+// reloadIfChanged reloads the certificate when either file's modification time changed
+func (r *certReloader) reloadIfChanged(ctx context.Context) {
+	certMod, keyMod, err := r.modTimes()
+	if err != nil {
+		r.logger.WarnContext(ctx,
+			fmt.Sprintf("failed to check TLS certificate files [error=%s]", err.Error()),
+			slog.String("error", err.Error()))
+		return
+	}
+
+	r.mu.RLock()
+	unchanged := certMod.Equal(r.certMod) && keyMod.Equal(r.keyMod)
+	r.mu.RUnlock()
+	if unchanged {
+		return
+	}
+
+	if err := r.Reload(); err != nil {
+		r.logger.WarnContext(ctx,
+			fmt.Sprintf("failed to reload TLS certificate, keeping previous one [error=%s]", err.Error()),
+			slog.String("error", err.Error()))
+		return
+	}
+
+	r.logger.InfoContext(ctx,
+		fmt.Sprintf("TLS certificate reloaded [cert_file=%s]", r.certFile),
+		slog.String("cert_file", r.certFile))
+}
+
+// watch polls the certificate files until the context is cancelled
+func (r *certReloader) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.reloadIfChanged(ctx)
+		}
+	}
+}
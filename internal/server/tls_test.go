@@ -0,0 +1,334 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeSelfSignedCert writes a self-signed certificate for 127.0.0.1 and returns its file paths
+func writeSelfSignedCert(t *testing.T, dir, commonName string) (certFile, keyFile string, cert *x509.Certificate) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	cert, err = x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	certFile = filepath.Join(dir, "tls.crt")
+	keyFile = filepath.Join(dir, "tls.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatalf("failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+
+	return certFile, keyFile, cert
+}
+
+// startTestServer starts a server on a random local port and returns its address
+func startTestServer(t *testing.T, opts Options) (*Server, string) {
+	t.Helper()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	srv, err := New("127.0.0.1", 0, 5*time.Second, 5*time.Second,
+		createTestMirror(nil, nil, nil, nil, nil, nil), metricsForTests(), logger, opts)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	go srv.Serve(listener)
+
+	t.Cleanup(func() {
+		srv.Shutdown(context.Background())
+	})
+
+	return srv, listener.Addr().String()
+}
+
+func clientTrusting(certs ...*x509.Certificate) *http.Client {
+	pool := x509.NewCertPool()
+	for _, c := range certs {
+		pool.AddCert(c)
+	}
+	return &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: pool},
+		},
+	}
+}
+
+// TestServer_ServesTLS tests that the server serves HTTPS from the configured files
+func TestServer_ServesTLS(t *testing.T) {
+	certFile, keyFile, cert := writeSelfSignedCert(t, t.TempDir(), "specular-test")
+	_, addr := startTestServer(t, Options{TLS: TLSOptions{CertFile: certFile, KeyFile: keyFile}})
+
+	resp, err := clientTrusting(cert).Get("https://" + addr + "/health")
+	if err != nil {
+		t.Fatalf("HTTPS request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected status 200, got %d", resp.StatusCode)
+	}
+	if resp.TLS == nil || resp.TLS.Version < tls.VersionTLS12 {
+		t.Errorf("expected TLS 1.2 or newer connection, got %+v", resp.TLS)
+	}
+}
+
+// TestServer_TLSMinVersion tests that clients below the minimum version are rejected
+func TestServer_TLSMinVersion(t *testing.T) {
+	certFile, keyFile, cert := writeSelfSignedCert(t, t.TempDir(), "specular-test")
+	_, addr := startTestServer(t, Options{TLS: TLSOptions{CertFile: certFile, KeyFile: keyFile, MinVersion: "1.3"}})
+
+	client := clientTrusting(cert)
+	client.Transport.(*http.Transport).TLSClientConfig.MaxVersion = tls.VersionTLS12
+
+	if resp, err := client.Get("https://" + addr + "/health"); err == nil {
+		resp.Body.Close()
+		t.Fatal("expected TLS 1.2 client to be rejected")
+	}
+}
+
+// TestServer_InvalidCertificate tests that New fails when the certificate cannot be loaded
+func TestServer_InvalidCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "missing.crt")
+	keyFile := filepath.Join(dir, "missing.key")
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	_, err := New("127.0.0.1", 0, time.Second, time.Second,
+		createTestMirror(nil, nil, nil, nil, nil, nil), metricsForTests(), logger,
+		Options{TLS: TLSOptions{CertFile: certFile, KeyFile: keyFile}})
+	if err == nil {
+		t.Fatal("expected error for missing certificate files")
+	}
+}
+
+// TestServer_ReloadTLS tests that new handshakes use a replaced certificate
+// while connections established before the reload keep working
+func TestServer_ReloadTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, oldCert := writeSelfSignedCert(t, dir, "old")
+	srv, addr := startTestServer(t, Options{TLS: TLSOptions{CertFile: certFile, KeyFile: keyFile}})
+
+	client := clientTrusting(oldCert)
+	resp, err := client.Get("https://" + addr + "/health")
+	if err != nil {
+		t.Fatalf("request before reload failed: %v", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	_, _, newCert := writeSelfSignedCert(t, dir, "new")
+	if err := srv.ReloadTLS(); err != nil {
+		t.Fatalf("ReloadTLS failed: %v", err)
+	}
+
+	// Kept-alive connection from before the reload is still usable
+	resp, err = client.Get("https://" + addr + "/health")
+	if err != nil {
+		t.Fatalf("request on existing connection failed: %v", err)
+	}
+	resp.Body.Close()
+
+	resp, err = clientTrusting(newCert).Get("https://" + addr + "/health")
+	if err != nil {
+		t.Fatalf("request with new certificate failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if got := resp.TLS.PeerCertificates[0].Subject.CommonName; got != "new" {
+		t.Errorf("expected new certificate after reload, got %q", got)
+	}
+}
+
+// TestCertReloader_ReloadIfChanged tests that file modifications are picked up by polling
+func TestCertReloader_ReloadIfChanged(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, _ := writeSelfSignedCert(t, dir, "first")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	reloader, err := newCertReloader(certFile, keyFile, logger)
+	if err != nil {
+		t.Fatalf("newCertReloader failed: %v", err)
+	}
+
+	writeSelfSignedCert(t, dir, "second")
+	// Ensure the modification time differs even on coarse-grained filesystems
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, future, future)
+
+	reloader.reloadIfChanged(context.Background())
+
+	cert, _ := reloader.GetCertificate(nil)
+	if cert.Leaf == nil {
+		t.Fatal("expected parsed leaf certificate")
+	}
+	if cert.Leaf.Subject.CommonName != "second" {
+		t.Errorf("expected reloaded certificate, got %q", cert.Leaf.Subject.CommonName)
+	}
+}
+
+// TestCertReloader_KeepsCertificateOnError tests that a broken file does not replace a working certificate
+func TestCertReloader_KeepsCertificateOnError(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, _ := writeSelfSignedCert(t, dir, "good")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	reloader, err := newCertReloader(certFile, keyFile, logger)
+	if err != nil {
+		t.Fatalf("newCertReloader failed: %v", err)
+	}
+
+	os.WriteFile(certFile, []byte("not a certificate"), 0600)
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, future, future)
+
+	reloader.reloadIfChanged(context.Background())
+
+	cert, _ := reloader.GetCertificate(nil)
+	if cert.Leaf.Subject.CommonName != "good" {
+		t.Errorf("expected previous certificate to remain, got %q", cert.Leaf.Subject.CommonName)
+	}
+}
+
+func TestCipherSuiteIDs(t *testing.T) {
+	ids, err := cipherSuiteIDs([]string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 {
+		t.Errorf("unexpected cipher suite IDs: %v", ids)
+	}
+
+	if _, err := cipherSuiteIDs([]string{"TLS_RSA_WITH_RC4_128_SHA"}); err == nil {
+		t.Error("expected error for insecure cipher suite")
+	}
+}
+
+func clientWithCertificate(t *testing.T, serverCert *x509.Certificate, certFile, keyFile string) *http.Client {
+	t.Helper()
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("failed to load client certificate: %v", err)
+	}
+	client := clientTrusting(serverCert)
+	client.Transport.(*http.Transport).TLSClientConfig.Certificates = []tls.Certificate{pair}
+	return client
+}
+
+// TestServer_ClientAuthRequired tests that required mode rejects clients without a trusted certificate
+func TestServer_ClientAuthRequired(t *testing.T) {
+	certFile, keyFile, serverCert := writeSelfSignedCert(t, t.TempDir(), "server")
+	clientCertFile, clientKeyFile, _ := writeSelfSignedCert(t, t.TempDir(), "ci-runner")
+	untrustedCertFile, untrustedKeyFile, _ := writeSelfSignedCert(t, t.TempDir(), "intruder")
+
+	_, addr := startTestServer(t, Options{TLS: TLSOptions{
+		CertFile:     certFile,
+		KeyFile:      keyFile,
+		ClientCAFile: clientCertFile,
+		ClientAuth:   "required",
+	}})
+
+	if resp, err := clientTrusting(serverCert).Get("https://" + addr + "/health"); err == nil {
+		resp.Body.Close()
+		t.Error("expected request without client certificate to fail")
+	}
+
+	if resp, err := clientWithCertificate(t, serverCert, untrustedCertFile, untrustedKeyFile).Get("https://" + addr + "/health"); err == nil {
+		resp.Body.Close()
+		t.Error("expected request with untrusted client certificate to fail")
+	}
+
+	resp, err := clientWithCertificate(t, serverCert, clientCertFile, clientKeyFile).Get("https://" + addr + "/health")
+	if err != nil {
+		t.Fatalf("request with trusted client certificate failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected status 200, got %d", resp.StatusCode)
+	}
+}
+
+// TestServer_ClientAuthOptional tests that optional mode accepts anonymous clients
+func TestServer_ClientAuthOptional(t *testing.T) {
+	certFile, keyFile, serverCert := writeSelfSignedCert(t, t.TempDir(), "server")
+	clientCertFile, _, _ := writeSelfSignedCert(t, t.TempDir(), "ci-runner")
+
+	_, addr := startTestServer(t, Options{TLS: TLSOptions{
+		CertFile:     certFile,
+		KeyFile:      keyFile,
+		ClientCAFile: clientCertFile,
+		ClientAuth:   "optional",
+	}})
+
+	resp, err := clientTrusting(serverCert).Get("https://" + addr + "/health")
+	if err != nil {
+		t.Fatalf("anonymous request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected status 200, got %d", resp.StatusCode)
+	}
+}
+
+// TestServer_ClientAuthMissingCA tests that client auth cannot be enabled without a CA bundle
+func TestServer_ClientAuthMissingCA(t *testing.T) {
+	certFile, keyFile, _ := writeSelfSignedCert(t, t.TempDir(), "server")
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	_, err := New("127.0.0.1", 0, time.Second, time.Second,
+		createTestMirror(nil, nil, nil, nil, nil, nil), metricsForTests(), logger,
+		Options{TLS: TLSOptions{CertFile: certFile, KeyFile: keyFile, ClientAuth: "required"}})
+	if err == nil {
+		t.Fatal("expected error when client CA file is missing")
+	}
+}
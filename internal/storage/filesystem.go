@@ -10,12 +10,14 @@ import (
 	"strings"
 	"time"
 
+	"github.com/elisiariocouto/specular/internal/tracing"
 	"golang.org/x/exp/slices"
 )
 
 // FilesystemStorage implements Storage using the local filesystem
 type FilesystemStorage struct {
-	cacheDir string
+	cacheDir      string
+	checkHostname func(hostname string) error
 }
 
 // NewFilesystemStorage creates a new filesystem storage backend
@@ -30,8 +32,17 @@ func NewFilesystemStorage(cacheDir string) (*FilesystemStorage, error) {
 	}, nil
 }
 
+// CheckHostnames makes ListProviders skip hostname directories that check rejects, such as
+// directories in the cache directory that Specular did not write
+func (fs *FilesystemStorage) CheckHostnames(check func(hostname string) error) {
+	fs.checkHostname = check
+}
+
 // GetIndex retrieves the cached index.json for a provider
-func (fs *FilesystemStorage) GetIndex(ctx context.Context, hostname, namespace, providerType string) ([]byte, error) {
+func (fs *FilesystemStorage) GetIndex(ctx context.Context, hostname, namespace, providerType string) (_ []byte, err error) {
+	ctx, span := startSpan(ctx, "filesystem", "GetIndex", tracing.Provider(hostname, namespace, providerType)...)
+	defer func() { endReadSpan(span, err) }()
+
 	if err := validateProviderPath(hostname, namespace, providerType); err != nil {
 		return nil, err
 	}
@@ -40,7 +51,10 @@ func (fs *FilesystemStorage) GetIndex(ctx context.Context, hostname, namespace,
 }
 
 // PutIndex stores the index.json for a provider
-func (fs *FilesystemStorage) PutIndex(ctx context.Context, hostname, namespace, providerType string, data []byte) error {
+func (fs *FilesystemStorage) PutIndex(ctx context.Context, hostname, namespace, providerType string, data []byte) (err error) {
+	ctx, span := startSpan(ctx, "filesystem", "PutIndex", tracing.Provider(hostname, namespace, providerType)...)
+	defer func() { tracing.End(span, err) }()
+
 	if err := validateProviderPath(hostname, namespace, providerType); err != nil {
 		return err
 	}
@@ -49,7 +63,10 @@ func (fs *FilesystemStorage) PutIndex(ctx context.Context, hostname, namespace,
 }
 
 // GetVersion retrieves the cached version.json for a specific provider version
-func (fs *FilesystemStorage) GetVersion(ctx context.Context, hostname, namespace, providerType, version string) ([]byte, error) {
+func (fs *FilesystemStorage) GetVersion(ctx context.Context, hostname, namespace, providerType, version string) (_ []byte, err error) {
+	ctx, span := startSpan(ctx, "filesystem", "GetVersion", tracing.ProviderVersion(hostname, namespace, providerType, version)...)
+	defer func() { endReadSpan(span, err) }()
+
 	if err := validateProviderPath(hostname, namespace, providerType); err != nil {
 		return nil, err
 	}
@@ -61,7 +78,10 @@ func (fs *FilesystemStorage) GetVersion(ctx context.Context, hostname, namespace
 }
 
 // PutVersion stores the version.json for a specific provider version
-func (fs *FilesystemStorage) PutVersion(ctx context.Context, hostname, namespace, providerType, version string, data []byte) error {
+func (fs *FilesystemStorage) PutVersion(ctx context.Context, hostname, namespace, providerType, version string, data []byte) (err error) {
+	ctx, span := startSpan(ctx, "filesystem", "PutVersion", tracing.ProviderVersion(hostname, namespace, providerType, version)...)
+	defer func() { tracing.End(span, err) }()
+
 	if err := validateProviderPath(hostname, namespace, providerType); err != nil {
 		return err
 	}
@@ -73,7 +93,10 @@ func (fs *FilesystemStorage) PutVersion(ctx context.Context, hostname, namespace
 }
 
 // GetArchive retrieves a cached provider archive
-func (fs *FilesystemStorage) GetArchive(ctx context.Context, path string) (io.ReadCloser, error) {
+func (fs *FilesystemStorage) GetArchive(ctx context.Context, path string) (_ io.ReadCloser, err error) {
+	_, span := startSpan(ctx, "filesystem", "GetArchive", pathAttr(path))
+	defer func() { endReadSpan(span, err) }()
+
 	fullPath := fs.archivePath(path)
 	file, err := os.Open(fullPath)
 	if err != nil {
@@ -86,7 +109,10 @@ func (fs *FilesystemStorage) GetArchive(ctx context.Context, path string) (io.Re
 }
 
 // PutArchive stores a provider archive
-func (fs *FilesystemStorage) PutArchive(ctx context.Context, path string, data io.Reader) error {
+func (fs *FilesystemStorage) PutArchive(ctx context.Context, path string, data io.Reader) (err error) {
+	_, span := startSpan(ctx, "filesystem", "PutArchive", pathAttr(path))
+	defer func() { tracing.End(span, err) }()
+
 	if path == "" {
 		return errors.New("archive path cannot be empty")
 	}
@@ -98,9 +124,12 @@ func (fs *FilesystemStorage) PutArchive(ctx context.Context, path string, data i
 }
 
 // ExistsArchive checks if an archive exists
-func (fs *FilesystemStorage) ExistsArchive(ctx context.Context, path string) (bool, error) {
+func (fs *FilesystemStorage) ExistsArchive(ctx context.Context, path string) (_ bool, err error) {
+	_, span := startSpan(ctx, "filesystem", "ExistsArchive", pathAttr(path))
+	defer func() { tracing.End(span, err) }()
+
 	fullPath := fs.archivePath(path)
-	_, err := os.Stat(fullPath)
+	_, err = os.Stat(fullPath)
 	if err == nil {
 		return true, nil
 	}
@@ -127,17 +156,150 @@ func (fs *FilesystemStorage) IndexAge(_ context.Context, hostname, namespace, pr
 }
 
 // GetVersionsResponse retrieves the cached full versions API response
-func (fs *FilesystemStorage) GetVersionsResponse(ctx context.Context, hostname, namespace, providerType string) ([]byte, error) {
+func (fs *FilesystemStorage) GetVersionsResponse(ctx context.Context, hostname, namespace, providerType string) (_ []byte, err error) {
+	ctx, span := startSpan(ctx, "filesystem", "GetVersionsResponse", tracing.Provider(hostname, namespace, providerType)...)
+	defer func() { endReadSpan(span, err) }()
+
 	path := fs.versionsResponsePath(hostname, namespace, providerType)
 	return fs.readFile(ctx, path)
 }
 
 // PutVersionsResponse stores the full versions API response
-func (fs *FilesystemStorage) PutVersionsResponse(ctx context.Context, hostname, namespace, providerType string, data []byte) error {
+func (fs *FilesystemStorage) PutVersionsResponse(ctx context.Context, hostname, namespace, providerType string, data []byte) (err error) {
+	ctx, span := startSpan(ctx, "filesystem", "PutVersionsResponse", tracing.Provider(hostname, namespace, providerType)...)
+	defer func() { tracing.End(span, err) }()
+
 	path := fs.versionsResponsePath(hostname, namespace, providerType)
 	return fs.writeFileAtomic(ctx, path, data)
 }
 
+// GetMetadata retrieves an internal metadata document
+func (fs *FilesystemStorage) GetMetadata(ctx context.Context, key string) (_ []byte, err error) {
+	ctx, span := startSpan(ctx, "filesystem", "GetMetadata", keyAttr(key))
+	defer func() { endReadSpan(span, err) }()
+
+	if err := validateMetadataKey(key); err != nil {
+		return nil, err
+	}
+	return fs.readFile(ctx, fs.metadataPath(key))
+}
+
+// PutMetadata stores an internal metadata document
+func (fs *FilesystemStorage) PutMetadata(ctx context.Context, key string, data []byte) (err error) {
+	ctx, span := startSpan(ctx, "filesystem", "PutMetadata", keyAttr(key))
+	defer func() { tracing.End(span, err) }()
+
+	if err := validateMetadataKey(key); err != nil {
+		return err
+	}
+	return fs.writeFileAtomic(ctx, fs.metadataPath(key), data)
+}
+
+// ListProviders returns up to limit providers with cached data that sort after the given provider
+// Hidden directories, such as the internal cache, are skipped
+func (fs *FilesystemStorage) ListProviders(ctx context.Context, after Provider, limit int) (_ []Provider, err error) {
+	ctx, span := startSpan(ctx, "filesystem", "ListProviders")
+	defer func() { tracing.End(span, err) }()
+
+	var providers []Provider
+	hostnames, err := listDirs(fs.cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, hostname := range hostnames {
+		if hostname < after.Hostname {
+			continue
+		}
+		if fs.checkHostname != nil && fs.checkHostname(hostname) != nil {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		namespaces, err := listDirs(filepath.Join(fs.cacheDir, hostname))
+		if err != nil {
+			return nil, err
+		}
+		for _, namespace := range namespaces {
+			if hostname == after.Hostname && namespace < after.Namespace {
+				continue
+			}
+			types, err := listDirs(filepath.Join(fs.cacheDir, hostname, namespace))
+			if err != nil {
+				return nil, err
+			}
+			for _, providerType := range types {
+				provider := Provider{Hostname: hostname, Namespace: namespace, Type: providerType}
+				if !provider.After(after) {
+					continue
+				}
+				providers = append(providers, provider)
+				if limit > 0 && len(providers) == limit {
+					return providers, nil
+				}
+			}
+		}
+	}
+	return providers, nil
+}
+
+// ListVersions returns the versions of a provider with a cached version.json
+func (fs *FilesystemStorage) ListVersions(ctx context.Context, hostname, namespace, providerType string) (_ []string, err error) {
+	_, span := startSpan(ctx, "filesystem", "ListVersions", tracing.Provider(hostname, namespace, providerType)...)
+	defer func() { tracing.End(span, err) }()
+
+	if err := validateProviderPath(hostname, namespace, providerType); err != nil {
+		return nil, err
+	}
+	files, err := listFiles(filepath.Join(fs.cacheDir, hostname, namespace, providerType))
+	if err != nil {
+		return nil, err
+	}
+	var versions []string
+	for _, file := range files {
+		name := file.Name()
+		if strings.HasSuffix(name, ".json") && name != "index.json" {
+			versions = append(versions, strings.TrimSuffix(name, ".json"))
+		}
+	}
+	return versions, nil
+}
+
+// ListArchives returns the archives cached for a provider
+// Archives are the files stored alongside the provider's JSON documents
+func (fs *FilesystemStorage) ListArchives(ctx context.Context, hostname, namespace, providerType string) (_ []ArchiveInfo, err error) {
+	_, span := startSpan(ctx, "filesystem", "ListArchives", tracing.Provider(hostname, namespace, providerType)...)
+	defer func() { tracing.End(span, err) }()
+
+	if err := validateProviderPath(hostname, namespace, providerType); err != nil {
+		return nil, err
+	}
+	files, err := listFiles(filepath.Join(fs.cacheDir, hostname, namespace, providerType))
+	if err != nil {
+		return nil, err
+	}
+	var archives []ArchiveInfo
+	for _, file := range files {
+		if strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		info, err := file.Info()
+		if errors.Is(err, os.ErrNotExist) {
+			// Removed since the directory was read
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat archive: %w", err)
+		}
+		archives = append(archives, ArchiveInfo{
+			Path:     strings.Join([]string{hostname, namespace, providerType, file.Name()}, "/"),
+			Size:     info.Size(),
+			CachedAt: info.ModTime(),
+		})
+	}
+	return archives, nil
+}
+
 // Helper methods
 
 // indexPath constructs the filesystem path for an index.json file
@@ -177,6 +339,17 @@ func (fs *FilesystemStorage) versionsResponsePath(hostname, namespace, providerT
 	)
 }
 
+// metadataPath constructs the filesystem path for an internal metadata document
+// Stored in internal cache: .specular-internal/metadata/<key>.json
+func (fs *FilesystemStorage) metadataPath(key string) string {
+	return filepath.Join(
+		fs.cacheDir,
+		".specular-internal",
+		"metadata",
+		filepath.FromSlash(key)+".json",
+	)
+}
+
 // archivePath constructs the filesystem path for an archive file
 // Archives are stored alongside metadata: hostname/namespace/type/archives/...
 func (fs *FilesystemStorage) archivePath(path string) string {
@@ -282,3 +455,53 @@ func validateProviderPath(hostname, namespace, providerType string) error {
 	}
 	return nil
 }
+
+// listDirs returns the names of the visible subdirectories of dir, sorted by name
+// A missing directory has no subdirectories
+func listDirs(dir string) ([]string, error) {
+	entries, err := readVisibleDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+// listFiles returns the visible regular files of dir, sorted by name
+// Hidden files include in-progress atomic writes
+func listFiles(dir string) ([]os.DirEntry, error) {
+	entries, err := readVisibleDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []os.DirEntry
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			files = append(files, entry)
+		}
+	}
+	return files, nil
+}
+
+// readVisibleDir reads the entries of dir whose names do not start with a dot
+func readVisibleDir(dir string) ([]os.DirEntry, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list directory: %w", err)
+	}
+	visible := entries[:0]
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), ".") {
+			visible = append(visible, entry)
+		}
+	}
+	return visible, nil
+}
@@ -495,3 +495,39 @@ func TestLargeArchive(t *testing.T) {
 		t.Errorf("archive size mismatch: got %d, want %d", len(got), len(largeData))
 	}
 }
+
+func TestPutGetMetadata(t *testing.T) {
+	fs, _ := NewFilesystemStorage(t.TempDir())
+	ctx := context.Background()
+
+	if _, err := fs.GetMetadata(ctx, "approvals/registry.terraform.io/hashicorp/aws"); err != io.EOF {
+		t.Errorf("GetMetadata() error = %v, want io.EOF", err)
+	}
+
+	data := []byte(`{"versions": {}}`)
+	if err := fs.PutMetadata(ctx, "approvals/registry.terraform.io/hashicorp/aws", data); err != nil {
+		t.Fatalf("PutMetadata() error = %v", err)
+	}
+
+	got, err := fs.GetMetadata(ctx, "approvals/registry.terraform.io/hashicorp/aws")
+	if err != nil {
+		t.Fatalf("GetMetadata() error = %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("GetMetadata() = %q, want %q", got, data)
+	}
+}
+
+func TestMetadata_InvalidKey(t *testing.T) {
+	fs, _ := NewFilesystemStorage(t.TempDir())
+	ctx := context.Background()
+
+	for _, key := range []string{"", "../escape", "approvals//aws", "approvals/./aws", `approvals\aws`} {
+		if err := fs.PutMetadata(ctx, key, []byte("{}")); err == nil {
+			t.Errorf("PutMetadata(%q) expected error", key)
+		}
+		if _, err := fs.GetMetadata(ctx, key); err == nil || err == io.EOF {
+			t.Errorf("GetMetadata(%q) expected validation error, got %v", key, err)
+		}
+	}
+}
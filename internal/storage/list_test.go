@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// listingStorage is a backend that can be populated and listed
+type listingStorage interface {
+	Storage
+	Lister
+}
+
+// listingBackends returns every storage backend for listing tests
+func listingBackends(t *testing.T) map[string]listingStorage {
+	fs, err := NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage() error = %v", err)
+	}
+	return map[string]listingStorage{
+		"filesystem": fs,
+		"memory":     NewMemoryStorage(),
+	}
+}
+
+// populateListingCache stores providers across hostnames, one of them with a port
+func populateListingCache(t *testing.T, s Storage) {
+	ctx := context.Background()
+	puts := []error{
+		s.PutIndex(ctx, "registry.terraform.io", "hashicorp", "aws", []byte(`{}`)),
+		s.PutVersion(ctx, "registry.terraform.io", "hashicorp", "aws", "5.0.0", []byte(`{}`)),
+		s.PutVersion(ctx, "registry.terraform.io", "hashicorp", "aws", "5.1.0", []byte(`{}`)),
+		s.PutArchive(ctx, "registry.terraform.io/hashicorp/aws/terraform-provider-aws_5.0.0_linux_amd64.zip", bytes.NewReader(make([]byte, 10))),
+		s.PutArchive(ctx, "registry.terraform.io/hashicorp/aws/terraform-provider-aws_5.0.0_darwin_arm64.zip", bytes.NewReader(make([]byte, 20))),
+		s.PutIndex(ctx, "registry.terraform.io", "hashicorp", "google", []byte(`{}`)),
+		s.PutIndex(ctx, "localhost:5000", "acme", "widget", []byte(`{}`)),
+		s.PutVersionsResponse(ctx, "internal.example.com", "acme", "hidden", []byte(`{}`)),
+	}
+	for _, err := range puts {
+		if err != nil {
+			t.Fatalf("populate cache: %v", err)
+		}
+	}
+}
+
+func TestListProviders(t *testing.T) {
+	for name, s := range listingBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			populateListingCache(t, s)
+			ctx := context.Background()
+
+			all, err := s.ListProviders(ctx, Provider{}, 0)
+			if err != nil {
+				t.Fatalf("ListProviders() error = %v", err)
+			}
+			want := []Provider{
+				{"localhost:5000", "acme", "widget"},
+				{"registry.terraform.io", "hashicorp", "aws"},
+				{"registry.terraform.io", "hashicorp", "google"},
+			}
+			if !reflect.DeepEqual(all, want) {
+				t.Fatalf("ListProviders() = %v, want %v", all, want)
+			}
+
+			page, err := s.ListProviders(ctx, Provider{}, 2)
+			if err != nil {
+				t.Fatalf("ListProviders() error = %v", err)
+			}
+			if !reflect.DeepEqual(page, want[:2]) {
+				t.Errorf("first page = %v, want %v", page, want[:2])
+			}
+			page, err = s.ListProviders(ctx, page[1], 2)
+			if err != nil {
+				t.Fatalf("ListProviders() error = %v", err)
+			}
+			if !reflect.DeepEqual(page, want[2:]) {
+				t.Errorf("second page = %v, want %v", page, want[2:])
+			}
+		})
+	}
+}
+
+func TestListVersionsAndArchives(t *testing.T) {
+	for name, s := range listingBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			populateListingCache(t, s)
+			ctx := context.Background()
+
+			versions, err := s.ListVersions(ctx, "registry.terraform.io", "hashicorp", "aws")
+			if err != nil {
+				t.Fatalf("ListVersions() error = %v", err)
+			}
+			sort.Strings(versions)
+			if !reflect.DeepEqual(versions, []string{"5.0.0", "5.1.0"}) {
+				t.Errorf("ListVersions() = %v", versions)
+			}
+
+			archives, err := s.ListArchives(ctx, "registry.terraform.io", "hashicorp", "aws")
+			if err != nil {
+				t.Fatalf("ListArchives() error = %v", err)
+			}
+			if len(archives) != 2 {
+				t.Fatalf("ListArchives() returned %d archives, want 2", len(archives))
+			}
+			if archives[0].Path != "registry.terraform.io/hashicorp/aws/terraform-provider-aws_5.0.0_darwin_arm64.zip" ||
+				archives[0].Size != 20 || archives[1].Size != 10 {
+				t.Errorf("unexpected archives: %+v", archives)
+			}
+			for _, archive := range archives {
+				if archive.CachedAt.IsZero() {
+					t.Errorf("archive %s has no cached-at time", archive.Path)
+				}
+				if exists, _ := s.ExistsArchive(ctx, archive.Path); !exists {
+					t.Errorf("listed archive path %s is not readable", archive.Path)
+				}
+			}
+
+			versions, err = s.ListVersions(ctx, "registry.terraform.io", "hashicorp", "missing")
+			if err != nil || len(versions) != 0 {
+				t.Errorf("ListVersions() for a missing provider = %v, %v", versions, err)
+			}
+			archives, err = s.ListArchives(ctx, "registry.terraform.io", "hashicorp", "missing")
+			if err != nil || len(archives) != 0 {
+				t.Errorf("ListArchives() for a missing provider = %v, %v", archives, err)
+			}
+		})
+	}
+}
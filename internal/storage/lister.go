@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// Lister enumerates the cached providers, versions and archives.
+// This is separate from the Storage interface to avoid breaking existing implementations.
+type Lister interface {
+	// ListProviders returns up to limit providers with cached data that sort after the given
+	// provider, ordered by hostname, namespace and type. A zero provider starts from the first
+	// and a limit of zero or less returns every provider.
+	ListProviders(ctx context.Context, after Provider, limit int) ([]Provider, error)
+
+	// ListVersions returns the versions of a provider with a cached version.json, in no particular order
+	ListVersions(ctx context.Context, hostname, namespace, providerType string) ([]string, error)
+
+	// ListArchives returns the archives cached for a provider, ordered by path
+	ListArchives(ctx context.Context, hostname, namespace, providerType string) ([]ArchiveInfo, error)
+}
+
+// Provider identifies a cached provider
+type Provider struct {
+	Hostname  string
+	Namespace string
+	Type      string
+}
+
+// After reports whether p sorts after other by hostname, namespace and type
+func (p Provider) After(other Provider) bool {
+	if p.Hostname != other.Hostname {
+		return p.Hostname > other.Hostname
+	}
+	if p.Namespace != other.Namespace {
+		return p.Namespace > other.Namespace
+	}
+	return p.Type > other.Type
+}
+
+// String returns the provider address as hostname/namespace/type
+func (p Provider) String() string {
+	return p.Hostname + "/" + p.Namespace + "/" + p.Type
+}
+
+// ArchiveInfo describes a cached provider archive
+type ArchiveInfo struct {
+	// Path is the archive path as passed to GetArchive
+	Path     string
+	Size     int64
+	CachedAt time.Time
+}
@@ -5,8 +5,12 @@ import (
 	"context"
 	"io"
 	"math"
+	"sort"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/elisiariocouto/specular/internal/tracing"
 )
 
 // MemoryStorage implements Storage using an in-memory map
@@ -30,13 +34,19 @@ func NewMemoryStorage() *MemoryStorage {
 }
 
 // GetIndex retrieves the cached index.json for a provider
-func (m *MemoryStorage) GetIndex(ctx context.Context, hostname, namespace, providerType string) ([]byte, error) {
+func (m *MemoryStorage) GetIndex(ctx context.Context, hostname, namespace, providerType string) (_ []byte, err error) {
+	_, span := startSpan(ctx, "memory", "GetIndex", tracing.Provider(hostname, namespace, providerType)...)
+	defer func() { endReadSpan(span, err) }()
+
 	key := indexKey(hostname, namespace, providerType)
 	return m.get(key)
 }
 
 // PutIndex stores the index.json for a provider
-func (m *MemoryStorage) PutIndex(_ context.Context, hostname, namespace, providerType string, data []byte) error {
+func (m *MemoryStorage) PutIndex(ctx context.Context, hostname, namespace, providerType string, data []byte) (err error) {
+	_, span := startSpan(ctx, "memory", "PutIndex", tracing.Provider(hostname, namespace, providerType)...)
+	defer func() { tracing.End(span, err) }()
+
 	key := indexKey(hostname, namespace, providerType)
 	m.mu.Lock()
 	m.data[key] = bytes.Clone(data)
@@ -64,19 +74,28 @@ func (m *MemoryStorage) IndexAge(_ context.Context, hostname, namespace, provide
 }
 
 // GetVersion retrieves the cached version.json for a specific provider version
-func (m *MemoryStorage) GetVersion(ctx context.Context, hostname, namespace, providerType, version string) ([]byte, error) {
+func (m *MemoryStorage) GetVersion(ctx context.Context, hostname, namespace, providerType, version string) (_ []byte, err error) {
+	_, span := startSpan(ctx, "memory", "GetVersion", tracing.ProviderVersion(hostname, namespace, providerType, version)...)
+	defer func() { endReadSpan(span, err) }()
+
 	key := versionKey(hostname, namespace, providerType, version)
 	return m.get(key)
 }
 
 // PutVersion stores the version.json for a specific provider version
-func (m *MemoryStorage) PutVersion(ctx context.Context, hostname, namespace, providerType, version string, data []byte) error {
+func (m *MemoryStorage) PutVersion(ctx context.Context, hostname, namespace, providerType, version string, data []byte) (err error) {
+	_, span := startSpan(ctx, "memory", "PutVersion", tracing.ProviderVersion(hostname, namespace, providerType, version)...)
+	defer func() { tracing.End(span, err) }()
+
 	key := versionKey(hostname, namespace, providerType, version)
 	return m.put(key, data)
 }
 
 // GetArchive retrieves a cached provider archive
-func (m *MemoryStorage) GetArchive(ctx context.Context, path string) (io.ReadCloser, error) {
+func (m *MemoryStorage) GetArchive(ctx context.Context, path string) (_ io.ReadCloser, err error) {
+	_, span := startSpan(ctx, "memory", "GetArchive", pathAttr(path))
+	defer func() { endReadSpan(span, err) }()
+
 	m.mu.RLock()
 	data, ok := m.archives[path]
 	m.mu.RUnlock()
@@ -90,7 +109,10 @@ func (m *MemoryStorage) GetArchive(ctx context.Context, path string) (io.ReadClo
 }
 
 // PutArchive stores a provider archive
-func (m *MemoryStorage) PutArchive(ctx context.Context, path string, data io.Reader) error {
+func (m *MemoryStorage) PutArchive(ctx context.Context, path string, data io.Reader) (err error) {
+	_, span := startSpan(ctx, "memory", "PutArchive", pathAttr(path))
+	defer func() { tracing.End(span, err) }()
+
 	// Read all data into memory
 	content, err := io.ReadAll(data)
 	if err != nil {
@@ -99,13 +121,17 @@ func (m *MemoryStorage) PutArchive(ctx context.Context, path string, data io.Rea
 
 	m.mu.Lock()
 	m.archives[path] = content
+	m.timestamps[archiveKey(path)] = time.Now()
 	m.mu.Unlock()
 
 	return nil
 }
 
 // ExistsArchive checks if an archive exists
-func (m *MemoryStorage) ExistsArchive(ctx context.Context, path string) (bool, error) {
+func (m *MemoryStorage) ExistsArchive(ctx context.Context, path string) (_ bool, err error) {
+	_, span := startSpan(ctx, "memory", "ExistsArchive", pathAttr(path))
+	defer func() { tracing.End(span, err) }()
+
 	m.mu.RLock()
 	_, ok := m.archives[path]
 	m.mu.RUnlock()
@@ -113,17 +139,120 @@ func (m *MemoryStorage) ExistsArchive(ctx context.Context, path string) (bool, e
 }
 
 // GetVersionsResponse retrieves the cached full versions API response
-func (m *MemoryStorage) GetVersionsResponse(ctx context.Context, hostname, namespace, providerType string) ([]byte, error) {
+func (m *MemoryStorage) GetVersionsResponse(ctx context.Context, hostname, namespace, providerType string) (_ []byte, err error) {
+	_, span := startSpan(ctx, "memory", "GetVersionsResponse", tracing.Provider(hostname, namespace, providerType)...)
+	defer func() { endReadSpan(span, err) }()
+
 	key := versionsResponseKey(hostname, namespace, providerType)
 	return m.get(key)
 }
 
 // PutVersionsResponse stores the full versions API response
-func (m *MemoryStorage) PutVersionsResponse(ctx context.Context, hostname, namespace, providerType string, data []byte) error {
+func (m *MemoryStorage) PutVersionsResponse(ctx context.Context, hostname, namespace, providerType string, data []byte) (err error) {
+	_, span := startSpan(ctx, "memory", "PutVersionsResponse", tracing.Provider(hostname, namespace, providerType)...)
+	defer func() { tracing.End(span, err) }()
+
 	key := versionsResponseKey(hostname, namespace, providerType)
 	return m.put(key, data)
 }
 
+// GetMetadata retrieves an internal metadata document
+func (m *MemoryStorage) GetMetadata(ctx context.Context, key string) (_ []byte, err error) {
+	_, span := startSpan(ctx, "memory", "GetMetadata", keyAttr(key))
+	defer func() { endReadSpan(span, err) }()
+
+	if err := validateMetadataKey(key); err != nil {
+		return nil, err
+	}
+	return m.get(metadataKey(key))
+}
+
+// PutMetadata stores an internal metadata document
+func (m *MemoryStorage) PutMetadata(ctx context.Context, key string, data []byte) (err error) {
+	_, span := startSpan(ctx, "memory", "PutMetadata", keyAttr(key))
+	defer func() { tracing.End(span, err) }()
+
+	if err := validateMetadataKey(key); err != nil {
+		return err
+	}
+	return m.put(metadataKey(key), data)
+}
+
+// ListProviders returns up to limit providers with cached data that sort after the given provider
+func (m *MemoryStorage) ListProviders(ctx context.Context, after Provider, limit int) (_ []Provider, err error) {
+	_, span := startSpan(ctx, "memory", "ListProviders")
+	defer func() { tracing.End(span, err) }()
+
+	seen := make(map[Provider]bool)
+	m.mu.RLock()
+	for key := range m.data {
+		if provider, _, ok := parseProviderKey(key); ok {
+			seen[provider] = true
+		}
+	}
+	for path := range m.archives {
+		parts := strings.SplitN(path, "/", 4)
+		if len(parts) == 4 {
+			seen[Provider{Hostname: parts[0], Namespace: parts[1], Type: parts[2]}] = true
+		}
+	}
+	m.mu.RUnlock()
+
+	var providers []Provider
+	for provider := range seen {
+		if provider.After(after) {
+			providers = append(providers, provider)
+		}
+	}
+	sort.Slice(providers, func(i, j int) bool { return providers[j].After(providers[i]) })
+	if limit > 0 && len(providers) > limit {
+		providers = providers[:limit]
+	}
+	return providers, nil
+}
+
+// ListVersions returns the versions of a provider with a cached version.json
+func (m *MemoryStorage) ListVersions(ctx context.Context, hostname, namespace, providerType string) (_ []string, err error) {
+	_, span := startSpan(ctx, "memory", "ListVersions", tracing.Provider(hostname, namespace, providerType)...)
+	defer func() { tracing.End(span, err) }()
+
+	want := Provider{Hostname: hostname, Namespace: namespace, Type: providerType}
+	var versions []string
+	m.mu.RLock()
+	for key := range m.data {
+		if !strings.HasPrefix(key, "version:") {
+			continue
+		}
+		if provider, version, ok := parseProviderKey(key); ok && provider == want {
+			versions = append(versions, version)
+		}
+	}
+	m.mu.RUnlock()
+	return versions, nil
+}
+
+// ListArchives returns the archives cached for a provider
+func (m *MemoryStorage) ListArchives(ctx context.Context, hostname, namespace, providerType string) (_ []ArchiveInfo, err error) {
+	_, span := startSpan(ctx, "memory", "ListArchives", tracing.Provider(hostname, namespace, providerType)...)
+	defer func() { tracing.End(span, err) }()
+
+	prefix := hostname + "/" + namespace + "/" + providerType + "/"
+	var archives []ArchiveInfo
+	m.mu.RLock()
+	for path, data := range m.archives {
+		if strings.HasPrefix(path, prefix) && !strings.Contains(path[len(prefix):], "/") {
+			archives = append(archives, ArchiveInfo{
+				Path:     path,
+				Size:     int64(len(data)),
+				CachedAt: m.timestamps[archiveKey(path)],
+			})
+		}
+	}
+	m.mu.RUnlock()
+	sort.Slice(archives, func(i, j int) bool { return archives[i].Path < archives[j].Path })
+	return archives, nil
+}
+
 // Helper functions
 
 func indexKey(hostname, namespace, providerType string) string {
@@ -138,6 +267,44 @@ func versionsResponseKey(hostname, namespace, providerType string) string {
 	return "versions_response:" + hostname + ":" + namespace + ":" + providerType
 }
 
+func metadataKey(key string) string {
+	return "metadata:" + key
+}
+
+func archiveKey(path string) string {
+	return "archive:" + path
+}
+
+// parseProviderKey returns the provider of an index or version key, and the version of a version key
+// Fields are taken from the right since hostnames may contain a port
+func parseProviderKey(key string) (Provider, string, bool) {
+	kind, rest, ok := strings.Cut(key, ":")
+	if !ok {
+		return Provider{}, "", false
+	}
+	version := ""
+	if kind == "version" {
+		i := strings.LastIndex(rest, ":")
+		if i < 0 {
+			return Provider{}, "", false
+		}
+		rest, version = rest[:i], rest[i+1:]
+	} else if kind != "index" {
+		return Provider{}, "", false
+	}
+
+	parts := strings.Split(rest, ":")
+	if len(parts) < 3 {
+		return Provider{}, "", false
+	}
+	n := len(parts)
+	return Provider{
+		Hostname:  strings.Join(parts[:n-2], ":"),
+		Namespace: parts[n-2],
+		Type:      parts[n-1],
+	}, version, true
+}
+
 func (m *MemoryStorage) get(key string) ([]byte, error) {
 	m.mu.RLock()
 	data, ok := m.data[key]
@@ -344,3 +344,29 @@ func TestMemoryStorage_MultipleProviders(t *testing.T) {
 		t.Errorf("azurerm data mismatch: got %q, want %q", got2, data2)
 	}
 }
+
+func TestMemoryStorage_PutGetMetadata(t *testing.T) {
+	m := NewMemoryStorage()
+	ctx := context.Background()
+
+	if _, err := m.GetMetadata(ctx, "approvals/registry.terraform.io/hashicorp/aws"); err != io.EOF {
+		t.Errorf("GetMetadata() error = %v, want io.EOF", err)
+	}
+
+	data := []byte(`{"versions": {}}`)
+	if err := m.PutMetadata(ctx, "approvals/registry.terraform.io/hashicorp/aws", data); err != nil {
+		t.Fatalf("PutMetadata() error = %v", err)
+	}
+
+	got, err := m.GetMetadata(ctx, "approvals/registry.terraform.io/hashicorp/aws")
+	if err != nil {
+		t.Fatalf("GetMetadata() error = %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("GetMetadata() = %q, want %q", got, data)
+	}
+
+	if err := m.PutMetadata(ctx, "../escape", data); err == nil {
+		t.Error("PutMetadata() expected error for invalid key")
+	}
+}
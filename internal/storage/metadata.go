@@ -0,0 +1,32 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// MetadataStore persists small internal documents such as approval records.
+// This is separate from the Storage interface to avoid breaking existing implementations.
+type MetadataStore interface {
+	// GetMetadata retrieves the document stored under key
+	// Returns io.EOF if not found
+	GetMetadata(ctx context.Context, key string) ([]byte, error)
+
+	// PutMetadata stores a document under key, replacing any previous document
+	PutMetadata(ctx context.Context, key string, data []byte) error
+}
+
+// validateMetadataKey checks that a metadata key is made of non-empty, slash-separated segments
+// that cannot escape the metadata directory
+func validateMetadataKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("metadata key cannot be empty")
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." || strings.Contains(segment, "\\") {
+			return fmt.Errorf("invalid metadata key: %s", key)
+		}
+	}
+	return nil
+}
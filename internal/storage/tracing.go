@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/elisiariocouto/specular/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// startSpan starts a span for a storage operation
+func startSpan(ctx context.Context, backend, operation string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "storage."+operation, append(attrs, attribute.String("specular.storage.backend", backend))...)
+}
+
+// endReadSpan ends a storage read span; io.EOF marks a missing entry rather than an error
+func endReadSpan(span trace.Span, err error) {
+	found := err == nil
+	if errors.Is(err, io.EOF) {
+		err = nil
+	}
+	span.SetAttributes(attribute.Bool("specular.storage.found", found))
+	tracing.End(span, err)
+}
+
+// pathAttr returns the span attribute identifying an archive path
+func pathAttr(path string) attribute.KeyValue {
+	return attribute.String("specular.storage.path", path)
+}
+
+// keyAttr returns the span attribute identifying a metadata key
+func keyAttr(key string) attribute.KeyValue {
+	return attribute.String("specular.storage.key", key)
+}
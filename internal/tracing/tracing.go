@@ -0,0 +1,155 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/elisiariocouto/specular/internal/version"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName identifies the spans created by Specular
+const instrumentationName = "github.com/elisiariocouto/specular"
+
+// Exporters supported by Setup
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+// propagator carries W3C trace context and baggage across HTTP requests
+var propagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// Options configures trace export
+type Options struct {
+	// Exporter is one of ExporterNone, ExporterOTLP or ExporterStdout
+	Exporter string
+	// OTLPEndpoint is the OTLP/HTTP collector URL; empty uses the OTEL_EXPORTER_OTLP_* variables
+	OTLPEndpoint string
+	// SampleRatio is the fraction of new traces recorded; incoming sampling decisions are kept
+	SampleRatio float64
+}
+
+// Setup installs the global tracer provider and returns a function flushing and stopping it.
+// With ExporterNone spans are not recorded, but trace context is still propagated.
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagator)
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch opts.Exporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		var exporterOpts []otlptracehttp.Option
+		if opts.OTLPEndpoint != "" {
+			endpoint, err := otlpEndpointURL(opts.OTLPEndpoint)
+			if err != nil {
+				return nil, err
+			}
+			exporterOpts = append(exporterOpts, otlptracehttp.WithEndpointURL(endpoint))
+		}
+		exporter, err = otlptracehttp.New(ctx, exporterOpts...)
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter: %s", opts.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s trace exporter: %w", opts.Exporter, err)
+	}
+
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES take precedence over the defaults
+	res, err := resource.New(ctx,
+		resource.WithAttributes(
+			attribute.String("service.name", "specular"),
+			attribute.String("service.version", version.Version),
+		),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// otlpEndpointURL adds the standard traces path to collector URLs without one
+func otlpEndpointURL(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("OTLP endpoint must be an absolute http or https URL: %s", endpoint)
+	}
+	if strings.Trim(u.Path, "/") == "" {
+		u.Path = "/v1/traces"
+	}
+	return u.String(), nil
+}
+
+// Start starts a span as a child of the span in ctx, if any
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// StartServer starts a server span continuing the trace context of an incoming request
+func StartServer(r *http.Request, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	return otel.Tracer(instrumentationName).Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attribute.String("http.request.method", r.Method), attribute.String("url.path", r.URL.Path)),
+		trace.WithAttributes(attrs...))
+}
+
+// End records err, if any, on span and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Provider returns the span attributes identifying a provider
+func Provider(hostname, namespace, providerType string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("specular.provider.hostname", hostname),
+		attribute.String("specular.provider.namespace", namespace),
+		attribute.String("specular.provider.type", providerType),
+	}
+}
+
+// ProviderVersion returns the span attributes identifying a provider version
+func ProviderVersion(hostname, namespace, providerType, version string) []attribute.KeyValue {
+	return append(Provider(hostname, namespace, providerType), attribute.String("specular.provider.version", version))
+}
+
+// Platform returns the span attribute identifying a provider platform
+func Platform(os, arch string) attribute.KeyValue {
+	return attribute.String("specular.provider.platform", os+"_"+arch)
+}
+
+// CacheHit returns the span attribute recording whether a lookup was served from cache
+func CacheHit(hit bool) attribute.KeyValue {
+	return attribute.Bool("specular.cache.hit", hit)
+}
@@ -0,0 +1,126 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// newTestExporter records spans in memory for the duration of a test
+func newTestExporter(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		provider.Shutdown(context.Background())
+	})
+	return exporter
+}
+
+func TestTransport_PropagatesTraceContext(t *testing.T) {
+	exporter := newTestExporter(t)
+
+	var traceparent string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer upstream.Close()
+
+	ctx, parent := Start(context.Background(), "parent")
+	client := &http.Client{Transport: NewTransport(http.DefaultTransport)}
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, upstream.URL+"/path?token=secret", nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	parent.End()
+
+	if req.Header.Get("traceparent") != "" {
+		t.Error("expected the caller's request to be left unmodified")
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	clientSpan := spans[0]
+	if clientSpan.SpanKind != trace.SpanKindClient || clientSpan.Parent.SpanID() != spans[1].SpanContext.SpanID() {
+		t.Errorf("expected a client span below the parent, got %+v", clientSpan)
+	}
+	if want := "00-" + clientSpan.SpanContext.TraceID().String() + "-" + clientSpan.SpanContext.SpanID().String() + "-01"; traceparent != want {
+		t.Errorf("traceparent = %q, want %q", traceparent, want)
+	}
+	if clientSpan.Status.Code != codes.Error {
+		t.Errorf("expected 502 to mark the span as failed, got %v", clientSpan.Status)
+	}
+	for _, attr := range clientSpan.Attributes {
+		if attr.Key == "url.full" && strings.Contains(attr.Value.AsString(), "secret") {
+			t.Errorf("expected query string to be redacted, got %s", attr.Value.AsString())
+		}
+	}
+}
+
+func TestStartServer_ContinuesIncomingTrace(t *testing.T) {
+	exporter := newTestExporter(t)
+
+	req := httptest.NewRequest("GET", "/index.json", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	_, span := StartServer(req, "GET index")
+	End(span, errors.New("upstream failed"))
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	if spans[0].SpanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || !spans[0].Parent.IsRemote() {
+		t.Errorf("expected span to continue the remote trace, got %+v", spans[0].SpanContext)
+	}
+	if spans[0].Status.Code != codes.Error || len(spans[0].Events) != 1 {
+		t.Errorf("expected error to be recorded, got %v with %d events", spans[0].Status, len(spans[0].Events))
+	}
+}
+
+func TestSetup(t *testing.T) {
+	shutdown, err := Setup(context.Background(), Options{Exporter: ExporterNone})
+	if err != nil {
+		t.Fatalf("Setup failed: %v", err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("shutdown failed: %v", err)
+	}
+
+	if _, err := Setup(context.Background(), Options{Exporter: "jaeger"}); err == nil {
+		t.Error("expected error for unknown exporter")
+	}
+	if _, err := Setup(context.Background(), Options{Exporter: ExporterOTLP, OTLPEndpoint: "collector:4318"}); err == nil {
+		t.Error("expected error for relative OTLP endpoint")
+	}
+}
+
+func TestOTLPEndpointURL(t *testing.T) {
+	tests := map[string]string{
+		"http://collector:4318":            "http://collector:4318/v1/traces",
+		"https://collector:4318/":          "https://collector:4318/v1/traces",
+		"https://otel.example.com/ingest/": "https://otel.example.com/ingest/",
+	}
+	for endpoint, want := range tests {
+		got, err := otlpEndpointURL(endpoint)
+		if err != nil || got != want {
+			t.Errorf("otlpEndpointURL(%q) = %q, %v; want %q", endpoint, got, err, want)
+		}
+	}
+}